@@ -0,0 +1,347 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/SummerCash/ursa/common"
+	"github.com/SummerCash/ursa/crypto"
+)
+
+const (
+	// CodeEncodingVersion - version of the serialized form of compiled interpreter code
+	CodeEncodingVersion = 1
+
+	// CodegenVersion - version of the code the compiler generates, part of every cache key so that code
+	// compiled by another version is recompiled. Bump it whenever SSA construction, gas insertion,
+	// register allocation or code serialization changes what is generated for a module.
+	CodegenVersion = 3
+)
+
+var (
+	// ErrUnsupportedCodeEncoding - describes an error regarding serialized interpreter code of an unknown encoding version
+	ErrUnsupportedCodeEncoding = errors.New("unsupported code encoding version")
+
+	// ErrMalformedCodeEncoding - describes an error regarding serialized interpreter code that is truncated or corrupt
+	ErrMalformedCodeEncoding = errors.New("malformed code encoding")
+
+	// codeMagic - prefix of serialized interpreter code
+	codeMagic = []byte("ursacode")
+)
+
+// FingerprintedGasPolicy - gas policy identified by a fingerprint. Policies with equal fingerprints must
+// charge the same cost for every op, so that code compiled with one can be reused with the other.
+type FingerprintedGasPolicy interface {
+	GasPolicy
+
+	Fingerprint() []byte // Get policy fingerprint
+}
+
+// CodeKey - identifies compiled interpreter code by the module and the options it was compiled with
+type CodeKey struct {
+	ModuleID             []byte // Module identifier (hash of the module's bytes)
+	GasPolicy            []byte // Gas policy fingerprint (see GasPolicyFingerprint)
+	DisableFloatingPoint bool   // Floating point ops disabled
+}
+
+// CodeCache - on-disk cache of compiled interpreter code, keyed by module and gas policy
+type CodeCache struct {
+	Dir string // Directory cached code is stored in
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// Fingerprint - get the fingerprint of the simple gas policy
+func (p *SimpleGasPolicy) Fingerprint() []byte {
+	b := make([]byte, 8) // Init cost buffer
+
+	binary.BigEndian.PutUint64(b, uint64(p.GasPerInstruction)) // Write cost
+
+	return crypto.Sha3(append([]byte("simple:"), b...)) // Return fingerprint
+}
+
+// Fingerprint - get the fingerprint of the gas table
+func (table *GasTable) Fingerprint() []byte {
+	b, _ := json.Marshal(table) // Marshal (map keys are sorted)
+
+	return crypto.Sha3(append([]byte("table:"), b...)) // Return fingerprint
+}
+
+// GasPolicyFingerprint - get the fingerprint of the given gas policy (false if it has none, in which
+// case code compiled with it cannot be cached). A nil policy has a fixed fingerprint.
+func GasPolicyFingerprint(gasPolicy GasPolicy) ([]byte, bool) {
+	if gasPolicy == nil { // Check no policy
+		return crypto.Sha3([]byte("none")), true // Return fingerprint
+	}
+
+	if fingerprinted, ok := gasPolicy.(FingerprintedGasPolicy); ok { // Check has fingerprint
+		return fingerprinted.Fingerprint(), true // Return fingerprint
+	}
+
+	return nil, false // No fingerprint
+}
+
+// EncodeInterpreterCode - serialize the given interpreter code, compiled with the options in key.
+// Just-in-time metadata is not encoded.
+func EncodeInterpreterCode(key CodeKey, functionCode []InterpreterCode) []byte {
+	buffer := append([]byte(nil), codeMagic...) // Init buffer
+
+	buffer = appendUint32(buffer, CodeEncodingVersion) // Write version
+	buffer = append(buffer, key.encode()...)           // Write key
+
+	buffer = appendUint32(buffer, uint32(len(functionCode))) // Write function count
+
+	for _, code := range functionCode { // Iterate through functions
+		buffer = appendUint32(buffer, uint32(code.NumRegs))    // Write reg count
+		buffer = appendUint32(buffer, uint32(code.NumParams))  // Write param count
+		buffer = appendUint32(buffer, uint32(code.NumLocals))  // Write local count
+		buffer = appendUint32(buffer, uint32(code.NumReturns)) // Write return count
+		buffer = appendBytes(buffer, code.Bytes)               // Write code
+	}
+
+	return append(buffer, crypto.Sha3(buffer)...) // Write checksum
+}
+
+// DecodeInterpreterCode - deserialize interpreter code written by EncodeInterpreterCode, checking it was compiled with the options in key
+func DecodeInterpreterCode(key CodeKey, b []byte) ([]InterpreterCode, error) {
+	if len(b) < len(codeMagic)+4+32 || !bytes.HasPrefix(b, codeMagic) { // Check has header and checksum
+		return nil, fmt.Errorf("%w: missing header", ErrMalformedCodeEncoding) // Return error
+	}
+
+	body, checksum := b[:len(b)-32], b[len(b)-32:] // Split checksum
+
+	if !bytes.Equal(crypto.Sha3(body), checksum) { // Check checksum
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrMalformedCodeEncoding) // Return error
+	}
+
+	decoder := &codeDecoder{data: body[len(codeMagic):]} // Init decoder
+
+	if version := decoder.uint32(); version != CodeEncodingVersion { // Check version
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedCodeEncoding, version) // Return error
+	}
+
+	if encodedKey := decoder.take(len(key.encode())); decoder.err == nil && !bytes.Equal(encodedKey, key.encode()) { // Check compiled with the same options
+		return nil, fmt.Errorf("%w: compiled for a different module or gas policy", ErrMalformedCodeEncoding) // Return error
+	}
+
+	count := decoder.uint32() // Read function count
+
+	if decoder.err == nil && int(count) > len(decoder.data)/20 { // Check count fits (every function takes at least 20 bytes)
+		return nil, fmt.Errorf("%w: %d functions", ErrMalformedCodeEncoding, count) // Return error
+	}
+
+	functionCode := make([]InterpreterCode, 0, count) // Init function code buffer
+
+	for i := uint32(0); i < count && decoder.err == nil; i++ { // Iterate through functions
+		functionCode = append(functionCode, InterpreterCode{
+			NumRegs:    int(decoder.uint32()), // Read reg count
+			NumParams:  int(decoder.uint32()), // Read param count
+			NumLocals:  int(decoder.uint32()), // Read local count
+			NumReturns: int(decoder.uint32()), // Read return count
+			Bytes:      decoder.bytes(),       // Read code
+		}) // Append function
+	}
+
+	if decoder.err == nil && len(decoder.data) != 0 { // Check fully read
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrMalformedCodeEncoding, len(decoder.data)) // Return error
+	}
+
+	if decoder.err != nil { // Check for errors
+		return nil, decoder.err // Return found error
+	}
+
+	return functionCode, nil // Return function code
+}
+
+// NewCodeCache - initialize a code cache storing code in the given directory (DataDir/code if empty)
+func NewCodeCache(dir string) *CodeCache {
+	if dir == "" { // Check no dir
+		dir = filepath.Join(common.DataDir, "code") // Use default dir
+	}
+
+	return &CodeCache{
+		Dir: dir, // Set dir
+	} // Return cache
+}
+
+// Compile - load and validate a WebAssembly module (see Compile), reusing its interpreter code if it was
+// already compiled with the same gas policy. Newly compiled code is written to the cache; failing to
+// write it does not fail compilation. Code compiled with a gas policy that has no fingerprint is not cached.
+func (cache *CodeCache) Compile(code []byte, gasPolicy GasPolicy, disableFloatingPoint bool) (*CompiledModule, error) {
+	fingerprint, ok := GasPolicyFingerprint(gasPolicy) // Get gas policy fingerprint
+
+	if !ok { // Check cannot cache
+		return Compile(code, gasPolicy, disableFloatingPoint) // Compile
+	}
+
+	module, err := LoadModule(code) // Load module
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	module.DisableFloatingPoint = disableFloatingPoint // Set floating point disabled
+
+	key := CodeKey{
+		ModuleID:             module.Identifier,    // Set module ID
+		GasPolicy:            fingerprint,          // Set gas policy
+		DisableFloatingPoint: disableFloatingPoint, // Set floating point disabled
+	} // Init key
+
+	if functionCode, err := cache.read(key); err == nil && len(functionCode) == functionCount(module) { // Check cached
+		return newCompiledModule(module, functionCode), nil // Return compiled module
+	}
+
+	functionCode, err := module.CompileForInterpreter(gasPolicy) // Compile function code for interpreter
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	cache.write(key, functionCode) // Cache code (best effort)
+
+	return newCompiledModule(module, functionCode), nil // Return compiled module
+}
+
+// Path - get the path of the file caching code compiled with the options in key
+func (cache *CodeCache) Path(key CodeKey) string {
+	return filepath.Join(cache.Dir, hex.EncodeToString(key.ModuleID)+"-"+crypto.Sha3String(key.encode())+".code") // Return path
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// read - read cached code compiled with the options in key
+func (cache *CodeCache) read(key CodeKey) ([]InterpreterCode, error) {
+	b, err := ioutil.ReadFile(cache.Path(key)) // Read file
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	return DecodeInterpreterCode(key, b) // Decode code
+}
+
+// write - cache code compiled with the options in key, replacing the cached file atomically
+func (cache *CodeCache) write(key CodeKey, functionCode []InterpreterCode) error {
+	if err := common.CreateDirIfDoesNotExit(cache.Dir); err != nil { // Create dir if necessary
+		return err // Return found error
+	}
+
+	file, err := ioutil.TempFile(cache.Dir, "code-") // Create temp file
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	defer os.Remove(file.Name()) // Remove temp file if not renamed
+
+	if _, err := file.Write(EncodeInterpreterCode(key, functionCode)); err != nil { // Write code
+		file.Close() // Close file
+
+		return err // Return found error
+	}
+
+	if err := file.Close(); err != nil { // Close file
+		return err // Return found error
+	}
+
+	return os.Rename(file.Name(), cache.Path(key)) // Move into place
+}
+
+// encode - encode the key for code generated by the current compiler
+func (key CodeKey) encode() []byte {
+	return key.encodeFor(CodegenVersion) // Encode key
+}
+
+// encodeFor - encode the key for code generated by the given codegen version
+func (key CodeKey) encodeFor(codegenVersion uint32) []byte {
+	buffer := appendUint32(nil, codegenVersion) // Write codegen version
+	buffer = appendBytes(buffer, key.ModuleID)  // Write module ID
+	buffer = appendBytes(buffer, key.GasPolicy) // Write gas policy
+
+	if key.DisableFloatingPoint { // Check floating point disabled
+		return append(buffer, 1) // Write disabled
+	}
+
+	return append(buffer, 0) // Write enabled
+}
+
+// functionCount - get the number of functions of the module, imports first (the length of its interpreter code)
+func functionCount(module *Module) int {
+	count := len(module.Base.FunctionIndexSpace) // Get defined function count
+
+	for _, imp := range moduleImports(module) { // Iterate through imports
+		if imp.Signature != nil { // Check is function import
+			count++ // Count import
+		}
+	}
+
+	return count // Return count
+}
+
+// appendUint32 - append a big endian uint32 to the buffer
+func appendUint32(buffer []byte, value uint32) []byte {
+	b := make([]byte, 4) // Init buffer
+
+	binary.BigEndian.PutUint32(b, value) // Write value
+
+	return append(buffer, b...) // Append value
+}
+
+// appendBytes - append a length-prefixed byte slice to the buffer
+func appendBytes(buffer []byte, value []byte) []byte {
+	return append(appendUint32(buffer, uint32(len(value))), value...) // Append length and value
+}
+
+// codeDecoder - reads values written by EncodeInterpreterCode, recording the first error
+type codeDecoder struct {
+	data []byte // Remaining bytes
+	err  error  // First error
+}
+
+// take - read n bytes
+func (decoder *codeDecoder) take(n int) []byte {
+	if decoder.err != nil { // Check already failed
+		return nil // Nothing to read
+	}
+
+	if n < 0 || n > len(decoder.data) { // Check has bytes
+		decoder.err = fmt.Errorf("%w: truncated", ErrMalformedCodeEncoding) // Set error
+
+		return nil // Nothing to read
+	}
+
+	b := decoder.data[:n:n]         // Get bytes
+	decoder.data = decoder.data[n:] // Advance
+
+	return b // Return bytes
+}
+
+// uint32 - read a big endian uint32
+func (decoder *codeDecoder) uint32() uint32 {
+	b := decoder.take(4) // Read bytes
+
+	if b == nil { // Check failed
+		return 0 // Nothing to read
+	}
+
+	return binary.BigEndian.Uint32(b) // Return value
+}
+
+// bytes - read a length-prefixed byte slice (copied)
+func (decoder *codeDecoder) bytes() []byte {
+	n := decoder.uint32() // Read length
+
+	return append([]byte(nil), decoder.take(int(n))...) // Return copy
+}
+
+/* END INTERNAL METHODS */
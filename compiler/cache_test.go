@@ -0,0 +1,147 @@
+package compiler
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/SummerCash/ursa/crypto"
+)
+
+// costPolicy - gas policy without a fingerprint
+type costPolicy struct{}
+
+// GetCost - get gas cost
+func (costPolicy) GetCost(key string) int64 {
+	return 1 // Charge every op
+}
+
+// TestEncodeInterpreterCode - test interpreter code round trips through its serialized form, which rejects other keys and corruption
+func TestEncodeInterpreterCode(t *testing.T) {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/host.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	compiled, err := Compile(testSourceFile, DefaultGasTable(), false) // Compile module
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	key := CodeKey{ModuleID: compiled.Module().Identifier, GasPolicy: DefaultGasTable().Fingerprint()} // Init key
+
+	encoded := EncodeInterpreterCode(key, compiled.FunctionCode()) // Encode code
+
+	decoded, err := DecodeInterpreterCode(key, encoded) // Decode code
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if !reflect.DeepEqual(decoded, compiled.FunctionCode()) { // Check round trip
+		t.Fatal("expected decoded code to match compiled code") // Panic
+	}
+
+	other := key                      // Init other key
+	other.DisableFloatingPoint = true // Compiled with other options
+
+	if _, err := DecodeInterpreterCode(other, encoded); !errors.Is(err, ErrMalformedCodeEncoding) { // Decode with other key
+		t.Fatalf("expected malformed encoding error, got %v", err) // Panic
+	}
+
+	corrupt := append([]byte(nil), encoded...) // Copy encoding
+	corrupt[len(corrupt)/2] ^= 0xff            // Flip byte
+
+	if _, err := DecodeInterpreterCode(key, corrupt); !errors.Is(err, ErrMalformedCodeEncoding) { // Decode corrupt code
+		t.Fatalf("expected malformed encoding error, got %v", err) // Panic
+	}
+
+	if _, err := DecodeInterpreterCode(key, encoded[:len(encoded)-1]); !errors.Is(err, ErrMalformedCodeEncoding) { // Decode truncated code
+		t.Fatalf("expected malformed encoding error, got %v", err) // Panic
+	}
+
+	stale := append([]byte(nil), encoded[:len(encoded)-32]...)      // Copy encoding without checksum
+	copy(stale[len(codeMagic)+4:], key.encodeFor(CodegenVersion-1)) // Mark generated by the previous compiler
+	stale = append(stale, crypto.Sha3(stale)...)                    // Write checksum
+
+	if _, err := DecodeInterpreterCode(key, stale); !errors.Is(err, ErrMalformedCodeEncoding) { // Decode code of the previous compiler
+		t.Fatalf("expected malformed encoding error, got %v", err) // Panic
+	}
+}
+
+// TestCodeCache - test the code cache reuses code compiled with the same policy and recompiles otherwise
+func TestCodeCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ursa-code") // Init cache dir
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	defer os.RemoveAll(dir) // Remove cache dir
+
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/wasm_bg.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	cache := NewCodeCache(dir) // Init cache
+
+	compiled, err := cache.Compile(testSourceFile, DefaultGasTable(), false) // Compile and cache module
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	key := CodeKey{ModuleID: compiled.Module().Identifier, GasPolicy: DefaultGasTable().Fingerprint()} // Init key
+
+	if _, err := os.Stat(cache.Path(key)); err != nil { // Check cached
+		t.Fatal(err) // Panic
+	}
+
+	cached, err := cache.Compile(testSourceFile, DefaultGasTable(), false) // Load cached module
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if !reflect.DeepEqual(cached.FunctionCode(), compiled.FunctionCode()) { // Check same code
+		t.Fatal("expected cached code to match compiled code") // Panic
+	}
+
+	marked := append([]InterpreterCode(nil), compiled.FunctionCode()...) // Copy code
+	marked[0].NumRegs = 12345                                            // Mark code
+
+	if err := ioutil.WriteFile(cache.Path(key), EncodeInterpreterCode(key, marked), 0644); err != nil { // Replace cached code
+		t.Fatal(err) // Panic
+	}
+
+	if cached, err := cache.Compile(testSourceFile, DefaultGasTable(), false); err != nil || cached.FunctionCode()[0].NumRegs != 12345 { // Check not recompiled
+		t.Fatalf("expected cached code to be used (%v)", err) // Panic
+	}
+
+	if err := ioutil.WriteFile(cache.Path(key), []byte("corrupt"), 0644); err != nil { // Corrupt cached code
+		t.Fatal(err) // Panic
+	}
+
+	if cached, err := cache.Compile(testSourceFile, DefaultGasTable(), false); err != nil || !reflect.DeepEqual(cached.FunctionCode(), compiled.FunctionCode()) { // Check recompiled
+		t.Fatalf("expected corrupt code to be recompiled (%v)", err) // Panic
+	}
+
+	if _, err := cache.Compile(testSourceFile, &SimpleGasPolicy{GasPerInstruction: 1}, false); err != nil { // Compile with other policy
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := cache.Compile(testSourceFile, costPolicy{}, false); err != nil { // Compile with policy without fingerprint
+		t.Fatal(err) // Panic
+	}
+
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 2 { // Check one file per fingerprinted policy
+		t.Fatalf("expected 2 cached files, got %d (%v)", len(files), err) // Panic
+	}
+}
@@ -0,0 +1,214 @@
+package compiler
+
+import (
+	"sort"
+
+	"github.com/SummerCash/wagon/wasm"
+)
+
+// CompiledModule - module loaded, validated and compiled for the interpreter once, so that it can be
+// instantiated many times. A compiled module is immutable: instances share its parsed module and
+// function code, neither of which may be modified, so it can be cached and used from any goroutine.
+type CompiledModule struct {
+	module       *Module           // Parsed module
+	functionCode []InterpreterCode // Interpreter code of each function (imports first)
+
+	imports []Import // Imports, in declaration order
+	exports []Export // Exports, sorted by name
+}
+
+// Import - description of a module import
+type Import struct {
+	Module    string            // Name of the imported module
+	Field     string            // Name of the imported field
+	Kind      wasm.External     // Kind of import (function, table, memory or global)
+	Signature *wasm.FunctionSig // Signature of an imported function (nil for other kinds)
+}
+
+// Export - description of a module export
+type Export struct {
+	Name      string            // Name of the export
+	Kind      wasm.External     // Kind of export (function, table, memory or global)
+	Index     uint32            // Index of the export in its index space (imports first)
+	Signature *wasm.FunctionSig // Signature of an exported function (nil for other kinds)
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// Compile - load and validate a WebAssembly module and compile it for the interpreter, metering gas with the given policy
+func Compile(code []byte, gasPolicy GasPolicy, disableFloatingPoint bool) (*CompiledModule, error) {
+	module, err := LoadModule(code) // Load module
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	module.DisableFloatingPoint = disableFloatingPoint // Set floating point disabled
+
+	functionCode, err := module.CompileForInterpreter(gasPolicy) // Compile function code for interpreter
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	return newCompiledModule(module, functionCode), nil // Return compiled module
+}
+
+// Module - get the parsed module (shared, must not be modified)
+func (compiled *CompiledModule) Module() *Module {
+	return compiled.module // Return module
+}
+
+// FunctionCode - get the interpreter code of each function, imports first (shared, must not be modified)
+func (compiled *CompiledModule) FunctionCode() []InterpreterCode {
+	return compiled.functionCode // Return function code
+}
+
+// Imports - get a copy of the module's imports, in declaration order
+func (compiled *CompiledModule) Imports() []Import {
+	imports := make([]Import, len(compiled.imports)) // Init imports buffer
+
+	for i, imp := range compiled.imports { // Iterate through imports
+		imp.Signature = copySignature(imp.Signature) // Copy signature
+		imports[i] = imp                             // Set import
+	}
+
+	return imports // Return imports
+}
+
+// Exports - get a copy of the module's exports, sorted by name
+func (compiled *CompiledModule) Exports() []Export {
+	exports := make([]Export, len(compiled.exports)) // Init exports buffer
+
+	for i, export := range compiled.exports { // Iterate through exports
+		export.Signature = copySignature(export.Signature) // Copy signature
+		exports[i] = export                                // Set export
+	}
+
+	return exports // Return exports
+}
+
+// Export - get a copy of the export with the given name
+func (compiled *CompiledModule) Export(name string) (Export, bool) {
+	i := sort.Search(len(compiled.exports), func(i int) bool { return compiled.exports[i].Name >= name }) // Find export
+
+	if i == len(compiled.exports) || compiled.exports[i].Name != name { // Check exists
+		return Export{}, false // Return does not exist
+	}
+
+	export := compiled.exports[i]                      // Get export
+	export.Signature = copySignature(export.Signature) // Copy signature
+
+	return export, true // Return export
+}
+
+// FunctionSignature - get a copy of the signature of the exported function with the given name
+func (compiled *CompiledModule) FunctionSignature(name string) (*wasm.FunctionSig, bool) {
+	export, ok := compiled.Export(name) // Get export
+
+	if !ok || export.Kind != wasm.ExternalFunction { // Check is function
+		return nil, false // Return does not exist
+	}
+
+	return export.Signature, true // Return signature
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// newCompiledModule - initialize a compiled module from a loaded module and its interpreter code
+func newCompiledModule(module *Module, functionCode []InterpreterCode) *CompiledModule {
+	return &CompiledModule{
+		module:       module,                // Set module
+		functionCode: functionCode,          // Set function code
+		imports:      moduleImports(module), // Set imports
+		exports:      moduleExports(module), // Set exports
+	} // Return compiled module
+}
+
+// moduleImports - describe the imports of the given module
+func moduleImports(module *Module) []Import {
+	if module.Base.Import == nil { // Check no imports
+		return nil // Nothing to describe
+	}
+
+	imports := make([]Import, len(module.Base.Import.Entries)) // Init imports buffer
+
+	for i, entry := range module.Base.Import.Entries { // Iterate through imports
+		imports[i] = Import{
+			Module: entry.ModuleName,  // Set module
+			Field:  entry.FieldName,   // Set field
+			Kind:   entry.Type.Kind(), // Set kind
+		} // Set import
+
+		if funcImport, ok := entry.Type.(wasm.FuncImport); ok { // Check is function import
+			imports[i].Signature = copySignature(&module.Base.Types.Entries[funcImport.Type]) // Set signature
+		}
+	}
+
+	return imports // Return imports
+}
+
+// moduleExports - describe the exports of the given module, sorted by name
+func moduleExports(module *Module) []Export {
+	if module.Base.Export == nil { // Check no exports
+		return nil // Nothing to describe
+	}
+
+	exports := make([]Export, 0, len(module.Base.Export.Entries)) // Init exports buffer
+
+	for name, entry := range module.Base.Export.Entries { // Iterate through exports
+		export := Export{
+			Name:  name,        // Set name
+			Kind:  entry.Kind,  // Set kind
+			Index: entry.Index, // Set index
+		} // Init export
+
+		if entry.Kind == wasm.ExternalFunction { // Check is function
+			export.Signature = copySignature(functionSignature(module, int(entry.Index))) // Set signature
+		}
+
+		exports = append(exports, export) // Append export
+	}
+
+	sort.Slice(exports, func(i, j int) bool { return exports[i].Name < exports[j].Name }) // Sort by name
+
+	return exports // Return exports
+}
+
+// functionSignature - get the signature of the module's function with the given index (imports first)
+func functionSignature(module *Module, index int) *wasm.FunctionSig {
+	if module.Base.Import != nil { // Check has imports
+		for _, entry := range module.Base.Import.Entries { // Iterate through imports
+			if funcImport, ok := entry.Type.(wasm.FuncImport); ok { // Check is function import
+				if index == 0 { // Check is target
+					return &module.Base.Types.Entries[funcImport.Type] // Return import signature
+				}
+
+				index-- // Skip import
+			}
+		}
+	}
+
+	if index < 0 || index >= len(module.Base.FunctionIndexSpace) { // Check in bounds
+		return nil // No such function
+	}
+
+	return module.Base.FunctionIndexSpace[index].Sig // Return defined signature
+}
+
+// copySignature - copy the given function signature (nil if nil)
+func copySignature(sig *wasm.FunctionSig) *wasm.FunctionSig {
+	if sig == nil { // Check nil
+		return nil // Nothing to copy
+	}
+
+	return &wasm.FunctionSig{
+		Form:        sig.Form,                                          // Set form
+		ParamTypes:  append([]wasm.ValueType(nil), sig.ParamTypes...),  // Copy params
+		ReturnTypes: append([]wasm.ValueType(nil), sig.ReturnTypes...), // Copy results
+	} // Return copy
+}
+
+/* END INTERNAL METHODS */
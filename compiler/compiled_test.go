@@ -0,0 +1,83 @@
+package compiler
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/SummerCash/wagon/wasm"
+)
+
+// TestCompile - test modules are compiled once into code for every function, imports first
+func TestCompile(t *testing.T) {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/host.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	compiled, err := Compile(testSourceFile, &SimpleGasPolicy{GasPerInstruction: 1}, false) // Compile module
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if n := len(compiled.FunctionCode()); n != 8 { // Check 4 imports and 4 functions
+		t.Fatalf("expected code for 8 functions, got %d", n) // Panic
+	}
+
+	if _, err := Compile([]byte("not wasm"), nil, false); err == nil { // Compile invalid module
+		t.Fatal("expected invalid module to fail to compile") // Panic
+	}
+}
+
+// TestCompiledModuleIntrospection - test the imports, exports and signatures of a compiled module
+func TestCompiledModuleIntrospection(t *testing.T) {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/host.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	compiled, err := Compile(testSourceFile, nil, false) // Compile module
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	imports := compiled.Imports() // Get imports
+
+	if len(imports) != 4 || imports[0].Module != "env" || imports[0].Field != "add" || imports[0].Kind != wasm.ExternalFunction { // Check imports in declaration order
+		t.Fatalf("expected 4 env imports starting with add, got %v", imports) // Panic
+	}
+
+	if sig := imports[3].Signature; len(sig.ParamTypes) != 1 || len(sig.ReturnTypes) != 0 { // Check check(i32) signature
+		t.Fatalf("expected check to take one param and return nothing, got %v", sig) // Panic
+	}
+
+	exports := compiled.Exports() // Get exports
+
+	if len(exports) != 4 || exports[0].Name != "add" || exports[3].Name != "scale" { // Check sorted by name
+		t.Fatalf("expected 4 exports sorted by name, got %v", exports) // Panic
+	}
+
+	if export, ok := compiled.Export("negate"); !ok || export.Kind != wasm.ExternalFunction || export.Index != 6 { // Check index counts imports
+		t.Fatalf("expected negate export at function 6, got %v (%t)", export, ok) // Panic
+	}
+
+	sig, ok := compiled.FunctionSignature("scale") // Get signature
+
+	if !ok || len(sig.ParamTypes) != 2 || sig.ParamTypes[0] != wasm.ValueTypeF32 || sig.ReturnTypes[0] != wasm.ValueTypeF64 { // Check (f32, f64) -> (f64)
+		t.Fatalf("expected (f32, f64) -> (f64), got %v (%t)", sig, ok) // Panic
+	}
+
+	sig.ParamTypes[0] = wasm.ValueTypeI32 // Modify copy
+
+	if sig, _ := compiled.FunctionSignature("scale"); sig.ParamTypes[0] != wasm.ValueTypeF32 { // Check compiled module unaffected
+		t.Fatal("expected signatures to be copied") // Panic
+	}
+
+	if _, ok := compiled.FunctionSignature("missing"); ok { // Get unknown signature
+		t.Fatal("expected no signature for a missing export") // Panic
+	}
+}
@@ -4,6 +4,8 @@ package compiler
 func (c *SSAFunctionCompiler) InsertGasCounters(gp GasPolicy) {
 	cfg := c.NewCFGraph() // Init cf graph
 
+	_, chargesJumps := gp.(*GasTable) // Only gas tables charge jumps (other policies charge a block's instructions alone, as they always have)
+
 	for x, block := range cfg.Blocks { // Iterate through blocks
 
 		totalCost := int64(0) // Init gas buffer
@@ -16,6 +18,14 @@ func (c *SSAFunctionCompiler) InsertGasCounters(gp GasPolicy) {
 			}
 		}
 
+		if op := jmpOp(block.JmpKind); op != "" && chargesJumps { // Check block ends in a charged jump
+			totalCost += gp.GetCost(op) // Get cost of jump (so that empty loops are not free)
+
+			if totalCost < 0 { // Check cost will cause overflow
+				panic("total cost overflow") // Panic with err
+			}
+		}
+
 		if totalCost != 0 { // Check total cost is not nil
 			block.Code = append([]Instr{ // Append add_gas instruction
 				buildInstr(0, "add_gas", []int64{totalCost}, []TyValueID{}),
@@ -27,3 +37,19 @@ func (c *SSAFunctionCompiler) InsertGasCounters(gp GasPolicy) {
 
 	c.Code = cfg.ToInsSeq() // Set code with added gas instruction
 }
+
+// jmpOp - get the name of the op terminating a block of the given jump kind (empty if none)
+func jmpOp(kind TyJmpKind) string {
+	switch kind { // Handle jump kinds
+	case JmpUncond:
+		return "jmp"
+	case JmpEither:
+		return "jmp_either"
+	case JmpTable:
+		return "jmp_table"
+	case JmpReturn:
+		return "return"
+	default:
+		return ""
+	}
+}
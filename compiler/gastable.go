@@ -0,0 +1,224 @@
+package compiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const (
+	// GasClassArithmetic - numeric, comparison, conversion, const and select ops
+	GasClassArithmetic = "arithmetic"
+
+	// GasClassVariable - local and global reads/writes
+	GasClassVariable = "variable"
+
+	// GasClassMemory - loads, stores and current_memory
+	GasClassMemory = "memory"
+
+	// GasClassControl - jumps, returns, phi and unreachable
+	GasClassControl = "control"
+
+	// GasClassCall - direct and indirect calls
+	GasClassCall = "call"
+
+	// GasClassGrowMemory - grow_memory
+	GasClassGrowMemory = "grow_memory"
+)
+
+var (
+	// ErrNegativeGasCost - describes an error regarding a gas table containing a negative cost
+	ErrNegativeGasCost = errors.New("negative gas cost")
+
+	// ErrUnknownGasClass - describes an error regarding a gas table pricing a class that does not exist
+	ErrUnknownGasClass = errors.New("unknown gas class")
+)
+
+// GasTable - table-driven gas policy. An op is priced by its entry in Ops, falling back to
+// the cost of its class in Classes, then to Default.
+type GasTable struct {
+	Default int64            `json:"default" toml:"default"` // Cost of ops with no op or class entry
+	Classes map[string]int64 `json:"classes" toml:"classes"` // Cost per op class (see GasClass)
+	Ops     map[string]int64 `json:"ops" toml:"ops"`         // Cost per op name (e.g. "i32.div_s")
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// NewGasTable - initialize an empty gas table charging defaultCost for every op
+func NewGasTable(defaultCost int64) *GasTable {
+	return &GasTable{
+		Default: defaultCost,            // Set default cost
+		Classes: make(map[string]int64), // Init class costs
+		Ops:     make(map[string]int64), // Init op costs
+	}
+}
+
+// DefaultGasTable - initialize the built-in gas schedule, roughly proportional to the
+// interpreter's cost of each op
+func DefaultGasTable() *GasTable {
+	table := NewGasTable(1) // Init table
+
+	table.Classes[GasClassArithmetic] = 1    // Register ops
+	table.Classes[GasClassVariable] = 1      // Locals, globals
+	table.Classes[GasClassMemory] = 3        // Bounds checked memory access
+	table.Classes[GasClassControl] = 2       // Branches
+	table.Classes[GasClassCall] = 20         // Frame setup
+	table.Classes[GasClassGrowMemory] = 1000 // Page allocation
+
+	for _, op := range []string{"i32.mul", "i64.mul", "f32.mul", "f64.mul"} { // Iterate through multiplications
+		table.Ops[op] = 3 // Set cost
+	}
+
+	for _, op := range []string{"i32.div_s", "i32.div_u", "i32.rem_s", "i32.rem_u", "i64.div_s", "i64.div_u", "i64.rem_s", "i64.rem_u", "f32.div", "f64.div", "f32.sqrt", "f64.sqrt"} { // Iterate through divisions
+		table.Ops[op] = 8 // Set cost
+	}
+
+	table.Ops["jmp_table"] = 4      // Table lookup
+	table.Ops["call_indirect"] = 30 // Table lookup and signature check
+
+	return table // Return table
+}
+
+// GetCost - get gas cost of the op with the given name
+func (table *GasTable) GetCost(key string) int64 {
+	if cost, ok := table.Ops[key]; ok { // Check has op cost
+		return cost // Return op cost
+	}
+
+	if cost, ok := table.Classes[GasClass(key)]; ok { // Check has class cost
+		return cost // Return class cost
+	}
+
+	return table.Default // Return default cost
+}
+
+// Validate - check all costs in the table are usable
+func (table *GasTable) Validate() error {
+	if table.Default < 0 { // Check default
+		return fmt.Errorf("%w: default %d", ErrNegativeGasCost, table.Default) // Return error
+	}
+
+	for class, cost := range table.Classes { // Iterate through classes
+		switch class { // Check known
+		case GasClassArithmetic, GasClassVariable, GasClassMemory, GasClassControl, GasClassCall, GasClassGrowMemory:
+		default:
+			return fmt.Errorf("%w: %s", ErrUnknownGasClass, class) // Return error
+		}
+
+		if cost < 0 { // Check cost
+			return fmt.Errorf("%w: class %s costs %d", ErrNegativeGasCost, class, cost) // Return error
+		}
+	}
+
+	for op, cost := range table.Ops { // Iterate through ops
+		if cost < 0 { // Check cost
+			return fmt.Errorf("%w: op %s costs %d", ErrNegativeGasCost, op, cost) // Return error
+		}
+	}
+
+	return nil // Table is valid
+}
+
+// GasClass - get the class of the op with the given name (as seen by InsertGasCounters)
+func GasClass(op string) string {
+	switch op { // Handle non-numeric ops
+	case "get_local", "set_local", "get_global", "set_global":
+		return GasClassVariable
+	case "current_memory", "memory.size":
+		return GasClassMemory
+	case "grow_memory", "memory.grow":
+		return GasClassGrowMemory
+	case "jmp", "jmp_either", "jmp_table", "return", "phi", "unreachable":
+		return GasClassControl
+	case "call", "call_indirect":
+		return GasClassCall
+	}
+
+	if strings.Contains(op, ".load") || strings.Contains(op, ".store") { // Check is memory access
+		return GasClassMemory
+	}
+
+	return GasClassArithmetic // Everything else operates on registers
+}
+
+/*
+	BEGIN FORMATTING METHODS
+*/
+
+// String - get string representation of given gas table
+func (table *GasTable) String() string {
+	marshaledVal, _ := json.MarshalIndent(*table, "", "  ") // Marshal to JSON
+
+	return string(marshaledVal) // Return string value
+}
+
+// Bytes - get byte array representation of given gas table
+func (table *GasTable) Bytes() []byte {
+	marshaledVal, _ := json.MarshalIndent(*table, "", "  ") // Marshal to JSON
+
+	return marshaledVal // Return success
+}
+
+// GasTableFromBytes - unmarshal a JSON gas table
+func GasTableFromBytes(b []byte) (*GasTable, error) {
+	buffer := &GasTable{} // Initialize buffer
+
+	if err := json.Unmarshal(b, buffer); err != nil { // Read json into buffer
+		return nil, err // Return error
+	}
+
+	if err := buffer.Validate(); err != nil { // Validate table
+		return nil, err // Return error
+	}
+
+	return buffer, nil // No error occurred, return read table
+}
+
+// GasTableFromTOML - unmarshal a TOML gas table
+func GasTableFromTOML(b []byte) (*GasTable, error) {
+	buffer := &GasTable{} // Initialize buffer
+
+	if _, err := toml.Decode(string(b), buffer); err != nil { // Read toml into buffer
+		return nil, err // Return error
+	}
+
+	if err := buffer.Validate(); err != nil { // Validate table
+		return nil, err // Return error
+	}
+
+	return buffer, nil // No error occurred, return read table
+}
+
+/*
+	END FORMATTING METHODS
+*/
+
+/*
+	BEGIN I/O METHODS
+*/
+
+// ReadGasTable - read a gas table from a .json or .toml file
+func ReadGasTable(path string) (*GasTable, error) {
+	data, err := ioutil.ReadFile(filepath.FromSlash(path)) // Read file
+
+	if err != nil { // Check for errors
+		return nil, err // Return error
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".toml") { // Check is toml
+		return GasTableFromTOML(data) // Decode toml
+	}
+
+	return GasTableFromBytes(data) // Decode json
+}
+
+/*
+	END I/O METHODS
+*/
+
+/* END EXPORTED METHODS */
@@ -0,0 +1,94 @@
+package compiler
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestGasTableGetCost - test op costs fall back from op to class to default
+func TestGasTableGetCost(t *testing.T) {
+	table := NewGasTable(7) // Init table
+
+	table.Classes[GasClassMemory] = 3 // Set class cost
+	table.Ops["i32.load8_u"] = 2      // Set op cost
+
+	tests := map[string]int64{
+		"i32.load8_u": 2, // Op entry
+		"i64.store":   3, // Class entry
+		"i32.add":     7, // Default
+	}
+
+	for op, expected := range tests { // Iterate through tests
+		if cost := table.GetCost(op); cost != expected { // Check cost
+			t.Fatalf("%s: expected %d, got %d", op, expected, cost) // Panic
+		}
+	}
+}
+
+// TestGasClass - test ops are grouped into the expected classes
+func TestGasClass(t *testing.T) {
+	tests := map[string]string{
+		"i32.add":           GasClassArithmetic,
+		"f64.convert_s/i32": GasClassArithmetic,
+		"get_local":         GasClassVariable,
+		"f32.load":          GasClassMemory,
+		"i64.store32":       GasClassMemory,
+		"current_memory":    GasClassMemory,
+		"jmp_either":        GasClassControl,
+		"call_indirect":     GasClassCall,
+		"grow_memory":       GasClassGrowMemory,
+	}
+
+	for op, expected := range tests { // Iterate through tests
+		if class := GasClass(op); class != expected { // Check class
+			t.Fatalf("%s: expected %s, got %s", op, expected, class) // Panic
+		}
+	}
+}
+
+// TestDefaultGasTable - test the built-in schedule prices expensive ops above cheap ones
+func TestDefaultGasTable(t *testing.T) {
+	table := DefaultGasTable() // Init table
+
+	if err := table.Validate(); err != nil { // Validate table
+		t.Fatal(err) // Panic
+	}
+
+	if table.GetCost("i32.div_s") <= table.GetCost("i32.add") || table.GetCost("grow_memory") <= table.GetCost("call") { // Check ordering
+		t.Fatal("expected division and memory growth to cost more than addition and calls") // Panic
+	}
+}
+
+// TestGasTableFromBytes - test a gas table survives a JSON round trip
+func TestGasTableFromBytes(t *testing.T) {
+	table, err := GasTableFromBytes(DefaultGasTable().Bytes()) // Round trip default table
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if table.GetCost("call_indirect") != DefaultGasTable().GetCost("call_indirect") { // Check cost preserved
+		t.Fatalf("expected %d, got %d", DefaultGasTable().GetCost("call_indirect"), table.GetCost("call_indirect")) // Panic
+	}
+
+	if _, err := GasTableFromBytes([]byte(`{"classes": {"arithmetic": -1}}`)); !errors.Is(err, ErrNegativeGasCost) { // Check negative rejected
+		t.Fatalf("expected %v, got %v", ErrNegativeGasCost, err) // Panic
+	}
+
+	if _, err := GasTableFromBytes([]byte(`{"classes": {"float": 1}}`)); !errors.Is(err, ErrUnknownGasClass) { // Check unknown class rejected
+		t.Fatalf("expected %v, got %v", ErrUnknownGasClass, err) // Panic
+	}
+}
+
+// TestReadGasTable - test reading the example TOML gas table
+func TestReadGasTable(t *testing.T) {
+	table, err := ReadGasTable("../examples/gastable.toml") // Read table
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if table.GetCost("i32.div_s") != 8 || table.GetCost("call") != 20 || table.GetCost("call_indirect") != 30 { // Check costs
+		t.Fatalf("unexpected costs: %s", table) // Panic
+	}
+}
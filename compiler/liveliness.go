@@ -1,5 +1,7 @@
 package compiler
 
+import "sort"
+
 // FIXME: The current RegAlloc is based on wasm stack info and we probably
 // want a real one (in addition to this) with liveness analysis.
 
@@ -9,8 +11,16 @@ func (c *SSAFunctionCompiler) RegAlloc() int {
 
 	valueRelocs := make(map[TyValueID]TyValueID) // Init reloc buffer
 
-	for _, values := range c.StackValueSets { // Iterate through stack values
-		for _, v := range values { // Iterate through values
+	depths := make([]int, 0, len(c.StackValueSets)) // Init stack depth buffer
+
+	for depth := range c.StackValueSets { // Iterate through stack depths
+		depths = append(depths, depth) // Append depth
+	}
+
+	sort.Ints(depths) // Allocate in stack order, so that compiling a module always yields the same code
+
+	for _, depth := range depths { // Iterate through stack values
+		for _, v := range c.StackValueSets[depth] { // Iterate through values
 			valueRelocs[v] = regID // Set reloc value
 		}
 
@@ -5,6 +5,8 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 
 	"github.com/SummerCash/ursa/common"
 	"github.com/SummerCash/ursa/compiler/opcodes"
@@ -35,22 +37,18 @@ type InterpreterCode struct {
 }
 
 // LoadModule - load WASM raw bytes module
-func LoadModule(moduleBytes []byte) (*Module, error) {
+func LoadModule(moduleBytes []byte) (_retModule *Module, retErr error) {
+	defer common.CatchPanic(&retErr) // Catch panic
+
 	reader := bytes.NewReader(moduleBytes) // Generate reader for inputted raw WASM module
 
 	module, err := wasm.ReadModule(reader, nil) // Read module via wagon
 
-	if err != nil { // Check for errors
-		return &Module{}, err // Return error
-	}
-
-	/*
-		err = validate.VerifyModule(module) // Verify module
+	var duplicateExport wasm.DuplicateExportError // Init duplicate export buffer
 
-		if err != nil { // Check for errors
-			return &Module{}, err // Return error
-		}
-	*/
+	if errors.As(err, &duplicateExport) { // Check rejected for a duplicate export
+		return &Module{}, &ValidationError{Section: "export", Index: -1, Offset: -1, Err: fmt.Errorf("%w: %q", ErrDuplicateExport, string(duplicateExport))} // Return error
+	}
 
 	if err != nil { // Check for errors
 		return &Module{}, err // Return error
@@ -62,6 +60,14 @@ func LoadModule(moduleBytes []byte) (*Module, error) {
 		if sec.Name == "name" { // Check should be analyzed
 			r := bytes.NewReader(sec.RawSection.Bytes) // Get section bytes as byte reader
 
+			nameLen, err := leb128.ReadVarUint32(r) // Read section name length
+
+			if err != nil || r.Len() < int(nameLen) { // Check for errors
+				continue // Skip malformed section
+			}
+
+			r.Seek(int64(nameLen), io.SeekCurrent) // Skip section name
+
 			for { // Iterate
 				ty, err := leb128.ReadVarUint32(r) // Read
 
@@ -131,11 +137,19 @@ func LoadModule(moduleBytes []byte) (*Module, error) {
 		//fmt.Printf("%d function names written\n", len(functionNames))
 	}
 
-	return &Module{ // Return initialized module
+	loaded := &Module{ // Init module
 		Base:          module,                   // Set base module
 		FunctionNames: functionNames,            // Set function names
 		Identifier:    crypto.Sha3(moduleBytes), // Gen, set identifier
-	}, nil
+	}
+
+	err = loaded.Validate() // Validate module
+
+	if err != nil { // Check for errors
+		return &Module{}, err // Return error
+	}
+
+	return loaded, nil // Return initialized module
 }
 
 // String - module stringer
@@ -152,6 +166,9 @@ func (module *Module) CompileForInterpreter(gp GasPolicy) (_retCode []Interprete
 	ret := make([]InterpreterCode, 0) // Init interpreter code buffer
 	importTypeIDs := make([]int, 0)   // Init imports buffer
 
+	disasmModule := *module.Base          // Copy module (for disassembly)
+	disasmModule.FunctionIndexSpace = nil // Reset function index space
+
 	if module.Base.Import != nil { // Check has imports
 		for i := 0; i < len(module.Base.Import.Entries); i++ { // Iterate through imports
 			e := &module.Base.Import.Entries[i] // Get import entry
@@ -167,7 +184,7 @@ func (module *Module) CompileForInterpreter(gp GasPolicy) (_retCode []Interprete
 
 			binary.Write(buf, binary.LittleEndian, uint32(1))            // value ID
 			binary.Write(buf, binary.LittleEndian, opcodes.InvokeImport) // Write invoked import
-			binary.Write(buf, binary.LittleEndian, uint32(i))            // Write to buffer
+			binary.Write(buf, binary.LittleEndian, uint32(len(ret)))     // Write function import index
 
 			binary.Write(buf, binary.LittleEndian, uint32(0)) // Write to buffer
 
@@ -188,16 +205,18 @@ func (module *Module) CompileForInterpreter(gp GasPolicy) (_retCode []Interprete
 				Bytes:      code,
 			})
 
-			importTypeIDs = append(importTypeIDs, int(tyID)) // Append to import types
+			importTypeIDs = append(importTypeIDs, int(tyID))                                                                              // Append to import types
+			disasmModule.FunctionIndexSpace = append(disasmModule.FunctionIndexSpace, wasm.Function{Sig: ty, Body: &wasm.FunctionBody{}}) // Index import (calls are disassembled by index, imports first)
 		}
 	}
 
-	numFuncImports := len(ret)                                                         // Get # of func imports
-	ret = append(ret, make([]InterpreterCode, len(module.Base.FunctionIndexSpace))...) // Append function index space to parsed interpreter source
+	numFuncImports := len(ret)                                                                                   // Get # of func imports
+	disasmModule.FunctionIndexSpace = append(disasmModule.FunctionIndexSpace, module.Base.FunctionIndexSpace...) // Index local functions after imports
+	ret = append(ret, make([]InterpreterCode, len(module.Base.FunctionIndexSpace))...)                           // Append function index space to parsed interpreter source
 
 	for i, f := range module.Base.FunctionIndexSpace { // Iterate thorugh function index space
 		//fmt.Printf("Compiling function %d (%+v) with %d locals\n", i, f.Sig, len(f.Body.Locals))
-		d, err := disasm.NewDisassembly(f, module.Base) // Disassemble function
+		d, err := disasm.NewDisassembly(f, &disasmModule) // Disassemble function
 
 		if err != nil { // Check for errors
 			panic(err) // Panic to catch
@@ -3,6 +3,7 @@ package compiler
 import (
 	"io/ioutil"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -82,3 +83,63 @@ func TestCompileForInterpreter(t *testing.T) {
 
 	t.Log(interpreterCompiled) // Log success
 }
+
+// TestCompileImportCalls - test compiling a module whose functions call imports with signatures differing from its own functions
+func TestCompileImportCalls(t *testing.T) {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/storage.wasm")) // Read test WASM file (4 imports, 4 functions)
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	module, err := LoadModule(testSourceFile) // Load module
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	interpreterCompiled, err := module.CompileForInterpreter(nil) // Compile for interpreter
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if len(interpreterCompiled) != 8 { // Check imports and functions compiled
+		t.Fatalf("expected 8 functions, got %d", len(interpreterCompiled)) // Panic
+	}
+}
+
+// TestCompileDeterministic - test compiling a module twice yields the same code
+func TestCompileDeterministic(t *testing.T) {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/wasm_bg.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	var first []InterpreterCode // Init first compilation buffer
+
+	for i := 0; i < 4; i++ { // Compile several times
+		module, err := LoadModule(testSourceFile) // Load module
+
+		if err != nil { // Check for errors
+			t.Fatal(err) // Panic
+		}
+
+		compiled, err := module.CompileForInterpreter(nil) // Compile for interpreter
+
+		if err != nil { // Check for errors
+			t.Fatal(err) // Panic
+		}
+
+		if first == nil { // Check is first compilation
+			first = compiled // Set first compilation
+
+			continue // Compile again
+		}
+
+		if !reflect.DeepEqual(compiled, first) { // Check same code
+			t.Fatalf("compilation %d yielded different code", i) // Panic
+		}
+	}
+}
@@ -0,0 +1,1003 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/SummerCash/wagon/wasm"
+	"github.com/SummerCash/wagon/wasm/leb128"
+	ops "github.com/SummerCash/wagon/wasm/operators"
+)
+
+const (
+	// MaxMemoryPages - max number of 64 KiB pages addressable by a 32-bit linear memory
+	MaxMemoryPages = 65536
+
+	// unknownType - operand type produced by a stack-polymorphic (unreachable) sequence
+	unknownType = wasm.ValueType(0)
+
+	// emptyBlockType - value type representation of an empty block signature
+	emptyBlockType = wasm.ValueType(wasm.BlockTypeEmpty)
+)
+
+var (
+	// ErrTypeMismatch - describes an error regarding an operand or result of an unexpected type
+	ErrTypeMismatch = errors.New("type mismatch")
+
+	// ErrStackUnderflow - describes an error regarding an instruction popping from an empty operand stack
+	ErrStackUnderflow = errors.New("operand stack underflow")
+
+	// ErrInvalidIndex - describes an error regarding an out-of-bounds type, function, local, global, table, memory or label index
+	ErrInvalidIndex = errors.New("index out of bounds")
+
+	// ErrInvalidOpcode - describes an error regarding an unknown or unsupported opcode
+	ErrInvalidOpcode = errors.New("invalid opcode")
+
+	// ErrInvalidBlockType - describes an error regarding a malformed block signature
+	ErrInvalidBlockType = errors.New("invalid block type")
+
+	// ErrUnbalancedBlock - describes an error regarding an unmatched else/end or an unterminated block
+	ErrUnbalancedBlock = errors.New("unbalanced block")
+
+	// ErrInvalidAlignment - describes an error regarding a memory access aligned beyond its natural alignment
+	ErrInvalidAlignment = errors.New("alignment must not be larger than natural")
+
+	// ErrImmutableGlobal - describes an error regarding a write to an immutable global
+	ErrImmutableGlobal = errors.New("global is immutable")
+
+	// ErrInvalidInitExpr - describes an error regarding a non-constant or ill-typed initializer expression
+	ErrInvalidInitExpr = errors.New("invalid initializer expression")
+
+	// ErrInvalidLimits - describes an error regarding table or memory limits that cannot be satisfied
+	ErrInvalidLimits = errors.New("invalid limits")
+
+	// ErrInvalidSignature - describes an error regarding a function signature the runtime cannot represent
+	ErrInvalidSignature = errors.New("invalid function signature")
+
+	// ErrMultipleTables - describes an error regarding a module declaring or importing more than one table
+	ErrMultipleTables = errors.New("multiple tables")
+
+	// ErrMultipleMemories - describes an error regarding a module declaring or importing more than one memory
+	ErrMultipleMemories = errors.New("multiple memories")
+
+	// ErrDuplicateExport - describes an error regarding a module exporting more than one entry under the same name
+	ErrDuplicateExport = errors.New("duplicate export name")
+
+	// ErrUnsupportedVersion - describes an error regarding a binary format version other than 1
+	ErrUnsupportedVersion = errors.New("unknown binary version")
+)
+
+// ValidationError - positioned error describing why a module was rejected
+type ValidationError struct {
+	Section string // Name of the section holding the offending entry
+	Index   int    // Index of the offending entry (function index space for code, -1 if unknown)
+	Offset  int    // Byte offset into the function body (-1 if not applicable)
+	Err     error  // Underlying error
+}
+
+// Error - implement error interface
+func (e *ValidationError) Error() string {
+	if e.Offset >= 0 { // Check is positioned within code
+		return fmt.Sprintf("invalid module: %s %d at offset %d: %v", e.Section, e.Index, e.Offset, e.Err) // Return positioned error
+	}
+
+	if e.Index < 0 { // Check entry unknown
+		return fmt.Sprintf("invalid module: %s: %v", e.Section, e.Err) // Return section error
+	}
+
+	return fmt.Sprintf("invalid module: %s %d: %v", e.Section, e.Index, e.Err) // Return error
+}
+
+// Unwrap - get underlying error
+func (e *ValidationError) Unwrap() error {
+	return e.Err // Return underlying error
+}
+
+// moduleContext - index spaces a module is validated against
+type moduleContext struct {
+	Types       []wasm.FunctionSig // Type section
+	Functions   []uint32           // Type index of each function (imports first)
+	Globals     []wasm.GlobalVar   // Global types (imports first)
+	NumImported int                // Number of imported globals
+	NumTables   int                // Number of tables
+	NumMemories int                // Number of memories
+}
+
+// controlFrame - control stack entry used during body validation
+type controlFrame struct {
+	Opcode      byte           // Opening opcode
+	Result      wasm.ValueType // Block result (emptyBlockType if none)
+	Height      int            // Operand stack height at entry
+	Unreachable bool           // Remaining instructions are unreachable
+}
+
+// bodyValidator - operand/control stack machine type checking a single function body
+type bodyValidator struct {
+	ctx *moduleContext // Module index spaces
+
+	sig    *wasm.FunctionSig // Function signature
+	locals []wasm.LocalEntry // Declared locals
+
+	reader *bytes.Reader // Code reader
+	size   int           // Code size
+
+	operands []wasm.ValueType // Operand stack
+	controls []controlFrame   // Control stack
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// Validate - validate the module's index spaces, initializers and function bodies
+// according to the WebAssembly MVP validation rules
+func (module *Module) Validate() error {
+	if module.Base == nil { // Check nil module
+		return &ValidationError{Section: "module", Offset: -1, Err: ErrInvalidIndex} // Return error
+	}
+
+	if module.Base.Version != wasm.Version { // Check binary version
+		return &ValidationError{Section: "module", Offset: 4, Err: ErrUnsupportedVersion} // Return error
+	}
+
+	ctx, err := newModuleContext(module.Base) // Build index spaces
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	if err = ctx.validateSections(module.Base); err != nil { // Validate non-code sections
+		return err // Return found error
+	}
+
+	numFuncImports := len(ctx.Functions) - len(module.Base.FunctionIndexSpace) // Get # of func imports
+
+	for i, f := range module.Base.FunctionIndexSpace { // Iterate through functions
+		offset, err := ctx.validateBody(f.Sig, f.Body) // Validate body
+
+		if err != nil { // Check for errors
+			return &ValidationError{Section: "function", Index: numFuncImports + i, Offset: offset, Err: err} // Return positioned error
+		}
+	}
+
+	return nil // No error occurred, return nil
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// newModuleContext - build index spaces for the given module
+func newModuleContext(m *wasm.Module) (*moduleContext, error) {
+	ctx := &moduleContext{} // Init context
+
+	if m.Types != nil { // Check has types
+		ctx.Types = m.Types.Entries // Set types
+	}
+
+	for i, sig := range ctx.Types { // Iterate through types
+		if len(sig.ReturnTypes) > 1 { // Check multi-value
+			return nil, &ValidationError{Section: "type", Index: i, Offset: -1, Err: ErrInvalidSignature} // Return error
+		}
+
+		for _, t := range append(append([]wasm.ValueType{}, sig.ParamTypes...), sig.ReturnTypes...) { // Iterate through value types
+			if !isValueType(t) { // Check invalid type
+				return nil, &ValidationError{Section: "type", Index: i, Offset: -1, Err: ErrInvalidSignature} // Return error
+			}
+		}
+	}
+
+	if m.Import != nil { // Check has imports
+		for i, imp := range m.Import.Entries { // Iterate through imports
+			switch t := imp.Type.(type) { // Handle import kinds
+			case wasm.FuncImport:
+				if int(t.Type) >= len(ctx.Types) { // Check type in bounds
+					return nil, &ValidationError{Section: "import", Index: i, Offset: -1, Err: ErrInvalidIndex} // Return error
+				}
+
+				ctx.Functions = append(ctx.Functions, t.Type) // Append function
+			case wasm.GlobalVarImport:
+				if !isValueType(t.Type.Type) { // Check valid type
+					return nil, &ValidationError{Section: "import", Index: i, Offset: -1, Err: ErrTypeMismatch} // Return error
+				}
+
+				ctx.Globals = append(ctx.Globals, t.Type) // Append global
+				ctx.NumImported++                         // Increment imported globals
+			case wasm.TableImport:
+				if err := validateLimits(t.Type.Limits, 1<<32-1); err != nil { // Check limits
+					return nil, &ValidationError{Section: "import", Index: i, Offset: -1, Err: err} // Return error
+				}
+
+				ctx.NumTables++ // Increment tables
+			case wasm.MemoryImport:
+				if err := validateLimits(t.Type.Limits, MaxMemoryPages); err != nil { // Check limits
+					return nil, &ValidationError{Section: "import", Index: i, Offset: -1, Err: err} // Return error
+				}
+
+				ctx.NumMemories++ // Increment memories
+			default:
+				return nil, &ValidationError{Section: "import", Index: i, Offset: -1, Err: ErrInvalidIndex} // Return error
+			}
+		}
+	}
+
+	if m.Function != nil { // Check has functions
+		for i, f := range m.FunctionIndexSpace { // Iterate through local functions
+			typeIndex := -1 // Init type index buffer
+
+			for x := range ctx.Types { // Find signature
+				if &ctx.Types[x] == f.Sig { // Check match
+					typeIndex = x // Set index
+					break         // Break
+				}
+			}
+
+			if typeIndex == -1 || f.Body == nil { // Check resolved
+				return nil, &ValidationError{Section: "function", Index: len(ctx.Functions) + i, Offset: -1, Err: ErrInvalidIndex} // Return error
+			}
+
+			ctx.Functions = append(ctx.Functions, uint32(typeIndex)) // Append function
+		}
+	}
+
+	if m.Table != nil { // Check has tables
+		for i, t := range m.Table.Entries { // Iterate through tables
+			if err := validateLimits(t.Limits, 1<<32-1); err != nil { // Check limits
+				return nil, &ValidationError{Section: "table", Index: i, Offset: -1, Err: err} // Return error
+			}
+
+			ctx.NumTables++ // Increment tables
+		}
+	}
+
+	if m.Memory != nil { // Check has memories
+		for i, mem := range m.Memory.Entries { // Iterate through memories
+			if err := validateLimits(mem.Limits, MaxMemoryPages); err != nil { // Check limits
+				return nil, &ValidationError{Section: "memory", Index: i, Offset: -1, Err: err} // Return error
+			}
+
+			ctx.NumMemories++ // Increment memories
+		}
+	}
+
+	if ctx.NumTables > 1 { // Check single table
+		return nil, &ValidationError{Section: "table", Index: 1, Offset: -1, Err: ErrMultipleTables} // Return error
+	}
+
+	if ctx.NumMemories > 1 { // Check single memory
+		return nil, &ValidationError{Section: "memory", Index: 1, Offset: -1, Err: ErrMultipleMemories} // Return error
+	}
+
+	return ctx, nil // Return built context
+}
+
+// validateSections - validate globals, exports, start function, element and data segments
+func (ctx *moduleContext) validateSections(m *wasm.Module) error {
+	if m.Global != nil { // Check has globals
+		for i, g := range m.Global.Globals { // Iterate through globals
+			if !isValueType(g.Type.Type) { // Check valid type
+				return &ValidationError{Section: "global", Index: ctx.NumImported + i, Offset: -1, Err: ErrTypeMismatch} // Return error
+			}
+
+			if err := ctx.validateInitExpr(g.Init, g.Type.Type); err != nil { // Check initializer
+				return &ValidationError{Section: "global", Index: ctx.NumImported + i, Offset: -1, Err: err} // Return error
+			}
+
+			ctx.Globals = append(ctx.Globals, g.Type) // Append global
+		}
+	}
+
+	if m.Export != nil { // Check has exports
+		names := make(map[string]bool, len(m.Export.Names)) // Init export name set
+
+		for i, name := range m.Export.Names { // Iterate through export names (in declaration order)
+			if names[name] { // Check name already exported
+				return &ValidationError{Section: "export", Index: i, Offset: -1, Err: fmt.Errorf("%w: %q", ErrDuplicateExport, name)} // Return error
+			}
+
+			names[name] = true // Add to set
+		}
+
+		for _, e := range m.Export.Entries { // Iterate through exports
+			limit := 0 // Init index space size
+
+			switch e.Kind { // Handle export kinds
+			case wasm.ExternalFunction:
+				limit = len(ctx.Functions) // Set limit
+			case wasm.ExternalTable:
+				limit = ctx.NumTables // Set limit
+			case wasm.ExternalMemory:
+				limit = ctx.NumMemories // Set limit
+			case wasm.ExternalGlobal:
+				limit = len(ctx.Globals) // Set limit
+			}
+
+			if int(e.Index) >= limit { // Check in bounds
+				return &ValidationError{Section: "export", Index: int(e.Index), Offset: -1, Err: ErrInvalidIndex} // Return error
+			}
+		}
+	}
+
+	if m.Start != nil { // Check has start function
+		if int(m.Start.Index) >= len(ctx.Functions) { // Check in bounds
+			return &ValidationError{Section: "start", Index: int(m.Start.Index), Offset: -1, Err: ErrInvalidIndex} // Return error
+		}
+
+		sig := ctx.Types[ctx.Functions[m.Start.Index]] // Get start signature
+
+		if len(sig.ParamTypes) != 0 || len(sig.ReturnTypes) != 0 { // Check nullary
+			return &ValidationError{Section: "start", Index: int(m.Start.Index), Offset: -1, Err: ErrInvalidSignature} // Return error
+		}
+	}
+
+	if m.Elements != nil { // Check has elements
+		for i, e := range m.Elements.Entries { // Iterate through segments
+			if int(e.Index) >= ctx.NumTables { // Check table exists
+				return &ValidationError{Section: "element", Index: i, Offset: -1, Err: ErrInvalidIndex} // Return error
+			}
+
+			if err := ctx.validateInitExpr(e.Offset, wasm.ValueTypeI32); err != nil { // Check offset
+				return &ValidationError{Section: "element", Index: i, Offset: -1, Err: err} // Return error
+			}
+
+			for _, f := range e.Elems { // Iterate through elements
+				if int(f) >= len(ctx.Functions) { // Check function exists
+					return &ValidationError{Section: "element", Index: i, Offset: -1, Err: ErrInvalidIndex} // Return error
+				}
+			}
+		}
+	}
+
+	if m.Data != nil { // Check has data
+		for i, d := range m.Data.Entries { // Iterate through segments
+			if int(d.Index) >= ctx.NumMemories { // Check memory exists
+				return &ValidationError{Section: "data", Index: i, Offset: -1, Err: ErrInvalidIndex} // Return error
+			}
+
+			if err := ctx.validateInitExpr(d.Offset, wasm.ValueTypeI32); err != nil { // Check offset
+				return &ValidationError{Section: "data", Index: i, Offset: -1, Err: err} // Return error
+			}
+		}
+	}
+
+	return nil // No error occurred, return nil
+}
+
+// validateInitExpr - check expr is a single constant instruction of type t followed by end
+func (ctx *moduleContext) validateInitExpr(expr []byte, t wasm.ValueType) error {
+	r := bytes.NewReader(expr) // Init reader
+
+	op, err := r.ReadByte() // Read opcode
+
+	if err != nil { // Check for errors
+		return ErrInvalidInitExpr // Return error
+	}
+
+	var result wasm.ValueType // Init result buffer
+
+	switch op { // Handle constant instructions
+	case ops.I32Const:
+		_, err = leb128.ReadVarint32(r) // Read immediate
+		result = wasm.ValueTypeI32      // Set result
+	case ops.I64Const:
+		_, err = leb128.ReadVarint64(r) // Read immediate
+		result = wasm.ValueTypeI64      // Set result
+	case ops.F32Const:
+		_, err = r.Seek(4, io.SeekCurrent) // Skip immediate
+		result = wasm.ValueTypeF32         // Set result
+	case ops.F64Const:
+		_, err = r.Seek(8, io.SeekCurrent) // Skip immediate
+		result = wasm.ValueTypeF64         // Set result
+	case ops.GetGlobal:
+		index, readErr := leb128.ReadVarUint32(r) // Read index
+
+		if readErr != nil { // Check for errors
+			return ErrInvalidInitExpr // Return error
+		}
+
+		if int(index) >= ctx.NumImported { // Only imported globals are visible to initializers
+			return ErrInvalidIndex // Return error
+		}
+
+		if ctx.Globals[index].Mutable { // Check constant
+			return ErrInvalidInitExpr // Return error
+		}
+
+		result = ctx.Globals[index].Type // Set result
+	default:
+		return ErrInvalidInitExpr // Return error
+	}
+
+	if err != nil { // Check for errors
+		return ErrInvalidInitExpr // Return error
+	}
+
+	if end, err := r.ReadByte(); err != nil || end != ops.End || r.Len() != 0 { // Check terminated
+		return ErrInvalidInitExpr // Return error
+	}
+
+	if result != t { // Check type
+		return ErrTypeMismatch // Return error
+	}
+
+	return nil // No error occurred, return nil
+}
+
+// validateBody - type check a function body, returning the offset of the first invalid instruction
+func (ctx *moduleContext) validateBody(sig *wasm.FunctionSig, body *wasm.FunctionBody) (int, error) {
+	v := &bodyValidator{
+		ctx:    ctx,
+		sig:    sig,
+		locals: body.Locals,
+		reader: bytes.NewReader(body.Code),
+		size:   len(body.Code),
+	} // Init validator
+
+	numLocals := uint64(len(sig.ParamTypes)) // Init local count
+
+	for _, l := range body.Locals { // Iterate through locals
+		if !isValueType(l.Type) { // Check valid type
+			return -1, ErrTypeMismatch // Return error
+		}
+
+		numLocals += uint64(l.Count) // Increment count
+	}
+
+	if numLocals > 1<<32-1 { // Check local count fits index space
+		return -1, ErrInvalidIndex // Return error
+	}
+
+	result := emptyBlockType // Init result buffer
+
+	if len(sig.ReturnTypes) != 0 { // Check has result
+		result = sig.ReturnTypes[0] // Set result
+	}
+
+	v.pushControl(ops.Block, result) // Push function frame
+
+	for v.reader.Len() != 0 { // Iterate through instructions
+		offset := v.size - v.reader.Len() // Get instruction offset
+
+		if err := v.step(); err != nil { // Validate instruction
+			return offset, err // Return positioned error
+		}
+	}
+
+	if len(v.controls) != 1 { // Check all blocks terminated
+		return v.size, ErrUnbalancedBlock // Return error
+	}
+
+	if _, err := v.popControl(); err != nil { // Validate implicit end
+		return v.size, err // Return error
+	}
+
+	return -1, nil // No error occurred
+}
+
+// step - validate a single instruction
+func (v *bodyValidator) step() error {
+	code, err := v.reader.ReadByte() // Read opcode
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	switch code { // Handle opcodes with immediates or polymorphic typing
+	case ops.Unreachable:
+		v.setUnreachable() // Mark unreachable
+	case ops.Nop:
+	case ops.Block, ops.Loop:
+		t, err := v.readBlockType() // Read signature
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		v.pushControl(code, t) // Push frame
+	case ops.If:
+		t, err := v.readBlockType() // Read signature
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if err = v.popExpect(wasm.ValueTypeI32); err != nil { // Pop condition
+			return err // Return found error
+		}
+
+		v.pushControl(code, t) // Push frame
+	case ops.Else:
+		frame, err := v.popControl() // Close then-branch
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if frame.Opcode != ops.If { // Check matches if
+			return ErrUnbalancedBlock // Return error
+		}
+
+		v.pushControl(ops.Else, frame.Result) // Open else-branch
+	case ops.End:
+		if len(v.controls) == 1 { // Function frame is closed by the implicit trailing end
+			return ErrUnbalancedBlock // Return error
+		}
+
+		frame, err := v.popControl() // Close block
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if frame.Opcode == ops.If && frame.Result != emptyBlockType { // Check if without else yields nothing
+			return ErrTypeMismatch // Return error
+		}
+
+		v.push(frame.Result) // Push result
+	case ops.Br:
+		label, err := v.readLabel() // Read label
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if err = v.popExpect(v.labelType(label)); err != nil { // Pop branch operand
+			return err // Return found error
+		}
+
+		v.setUnreachable() // Mark unreachable
+	case ops.BrIf:
+		label, err := v.readLabel() // Read label
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if err = v.popExpect(wasm.ValueTypeI32); err != nil { // Pop condition
+			return err // Return found error
+		}
+
+		t := v.labelType(label) // Get label type
+
+		if err = v.popExpect(t); err != nil { // Pop branch operand
+			return err // Return found error
+		}
+
+		v.push(t) // Push operand back
+	case ops.BrTable:
+		count, err := leb128.ReadVarUint32(v.reader) // Read target count
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if uint64(count) > uint64(v.reader.Len()) { // Check count plausible
+			return io.ErrUnexpectedEOF // Return error
+		}
+
+		labels := make([]uint32, count+1) // Init label buffer
+
+		for i := range labels { // Read targets and default
+			if labels[i], err = v.readLabel(); err != nil { // Read label
+				return err // Return found error
+			}
+		}
+
+		t := v.labelType(labels[count]) // Get default label type
+
+		for _, label := range labels { // Check all targets agree
+			if v.labelType(label) != t { // Check arity
+				return ErrTypeMismatch // Return error
+			}
+		}
+
+		if err = v.popExpect(wasm.ValueTypeI32); err != nil { // Pop index
+			return err // Return found error
+		}
+
+		if err = v.popExpect(t); err != nil { // Pop branch operand
+			return err // Return found error
+		}
+
+		v.setUnreachable() // Mark unreachable
+	case ops.Return:
+		for i := len(v.sig.ReturnTypes) - 1; i >= 0; i-- { // Pop results
+			if err := v.popExpect(v.sig.ReturnTypes[i]); err != nil { // Pop result
+				return err // Return found error
+			}
+		}
+
+		v.setUnreachable() // Mark unreachable
+	case ops.Call:
+		index, err := leb128.ReadVarUint32(v.reader) // Read function index
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if int(index) >= len(v.ctx.Functions) { // Check in bounds
+			return ErrInvalidIndex // Return error
+		}
+
+		return v.applySignature(&v.ctx.Types[v.ctx.Functions[index]]) // Apply call signature
+	case ops.CallIndirect:
+		index, err := leb128.ReadVarUint32(v.reader) // Read type index
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if reserved, err := v.reader.ReadByte(); err != nil || reserved != 0 { // Check reserved table index
+			return ErrInvalidIndex // Return error
+		}
+
+		if int(index) >= len(v.ctx.Types) || v.ctx.NumTables == 0 { // Check in bounds
+			return ErrInvalidIndex // Return error
+		}
+
+		if err = v.popExpect(wasm.ValueTypeI32); err != nil { // Pop table index
+			return err // Return found error
+		}
+
+		return v.applySignature(&v.ctx.Types[index]) // Apply call signature
+	case ops.Drop:
+		_, err := v.pop() // Pop any operand
+
+		return err // Return error (if any)
+	case ops.Select:
+		if err := v.popExpect(wasm.ValueTypeI32); err != nil { // Pop condition
+			return err // Return found error
+		}
+
+		a, err := v.pop() // Pop first operand
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		b, err := v.pop() // Pop second operand
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if a != b && a != unknownType && b != unknownType { // Check operands agree
+			return ErrTypeMismatch // Return error
+		}
+
+		if a == unknownType { // Check should use other operand type
+			a = b // Set type
+		}
+
+		v.push(a) // Push result
+	case ops.GetLocal, ops.SetLocal, ops.TeeLocal:
+		index, err := leb128.ReadVarUint32(v.reader) // Read local index
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		t, ok := v.localType(index) // Get local type
+
+		if !ok { // Check in bounds
+			return ErrInvalidIndex // Return error
+		}
+
+		if code == ops.GetLocal { // Check is read
+			v.push(t) // Push local
+			return nil
+		}
+
+		if err = v.popExpect(t); err != nil { // Pop value
+			return err // Return found error
+		}
+
+		if code == ops.TeeLocal { // Check should keep value
+			v.push(t) // Push value back
+		}
+	case ops.GetGlobal, ops.SetGlobal:
+		index, err := leb128.ReadVarUint32(v.reader) // Read global index
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if int(index) >= len(v.ctx.Globals) { // Check in bounds
+			return ErrInvalidIndex // Return error
+		}
+
+		g := v.ctx.Globals[index] // Get global
+
+		if code == ops.GetGlobal { // Check is read
+			v.push(g.Type) // Push global
+			return nil
+		}
+
+		if !g.Mutable { // Check writable
+			return ErrImmutableGlobal // Return error
+		}
+
+		return v.popExpect(g.Type) // Pop value
+	case ops.CurrentMemory, ops.GrowMemory:
+		if reserved, err := v.reader.ReadByte(); err != nil || reserved != 0 { // Check reserved memory index
+			return ErrInvalidIndex // Return error
+		}
+
+		if v.ctx.NumMemories == 0 { // Check has memory
+			return ErrInvalidIndex // Return error
+		}
+
+		return v.applyOp(code) // Apply operator type
+	case ops.I32Const:
+		if _, err := leb128.ReadVarint32(v.reader); err != nil { // Read immediate
+			return err // Return found error
+		}
+
+		v.push(wasm.ValueTypeI32) // Push constant
+	case ops.I64Const:
+		if _, err := leb128.ReadVarint64(v.reader); err != nil { // Read immediate
+			return err // Return found error
+		}
+
+		v.push(wasm.ValueTypeI64) // Push constant
+	case ops.F32Const:
+		if v.reader.Len() < 4 { // Check truncated
+			return io.ErrUnexpectedEOF // Return error
+		}
+
+		v.reader.Seek(4, io.SeekCurrent) // Skip immediate
+		v.push(wasm.ValueTypeF32)        // Push constant
+	case ops.F64Const:
+		if v.reader.Len() < 8 { // Check truncated
+			return io.ErrUnexpectedEOF // Return error
+		}
+
+		v.reader.Seek(8, io.SeekCurrent) // Skip immediate
+		v.push(wasm.ValueTypeF64)        // Push constant
+	default:
+		if width := memoryAccessWidth(code); width != 0 { // Check is load/store
+			align, err := leb128.ReadVarUint32(v.reader) // Read alignment
+
+			if err != nil { // Check for errors
+				return err // Return found error
+			}
+
+			if _, err = leb128.ReadVarUint32(v.reader); err != nil { // Read offset
+				return err // Return found error
+			}
+
+			if align >= 32 || 1<<align > width { // Check natural alignment
+				return ErrInvalidAlignment // Return error
+			}
+
+			if v.ctx.NumMemories == 0 { // Check has memory
+				return ErrInvalidIndex // Return error
+			}
+		}
+
+		return v.applyOp(code) // Apply operator type
+	}
+
+	return nil // No error occurred, return nil
+}
+
+// applyOp - pop the arguments and push the result of a monomorphic operator
+func (v *bodyValidator) applyOp(code byte) error {
+	op, err := ops.New(code) // Get operator
+
+	if err != nil || op.Polymorphic { // Check is known monomorphic operator
+		return ErrInvalidOpcode // Return error
+	}
+
+	for _, t := range op.Args { // Iterate through arguments (top of stack first)
+		if err = v.popExpect(t); err != nil { // Pop argument
+			return err // Return found error
+		}
+	}
+
+	v.push(op.Returns) // Push result
+
+	return nil // No error occurred, return nil
+}
+
+// applySignature - pop the parameters and push the results of a call
+func (v *bodyValidator) applySignature(sig *wasm.FunctionSig) error {
+	for i := len(sig.ParamTypes) - 1; i >= 0; i-- { // Pop params
+		if err := v.popExpect(sig.ParamTypes[i]); err != nil { // Pop param
+			return err // Return found error
+		}
+	}
+
+	for _, t := range sig.ReturnTypes { // Push results
+		v.push(t) // Push result
+	}
+
+	return nil // No error occurred, return nil
+}
+
+// readBlockType - read a block signature immediate
+func (v *bodyValidator) readBlockType() (wasm.ValueType, error) {
+	b, err := v.reader.ReadByte() // Read signature
+
+	if err != nil { // Check for errors
+		return 0, err // Return found error
+	}
+
+	t := wasm.ValueType(int8(b<<1) >> 1) // Sign-extend varint7
+
+	if b&0x80 != 0 || (t != emptyBlockType && !isValueType(t)) { // Check valid signature
+		return 0, ErrInvalidBlockType // Return error
+	}
+
+	return t, nil // Return signature
+}
+
+// readLabel - read a branch depth immediate
+func (v *bodyValidator) readLabel() (uint32, error) {
+	label, err := leb128.ReadVarUint32(v.reader) // Read label
+
+	if err != nil { // Check for errors
+		return 0, err // Return found error
+	}
+
+	if int(label) >= len(v.controls) { // Check in bounds
+		return 0, ErrInvalidIndex // Return error
+	}
+
+	return label, nil // Return label
+}
+
+// labelType - get operand type expected by a branch to label
+func (v *bodyValidator) labelType(label uint32) wasm.ValueType {
+	frame := v.controls[len(v.controls)-1-int(label)] // Get target frame
+
+	if frame.Opcode == ops.Loop { // Loops are branched to at their start
+		return emptyBlockType // Return nothing
+	}
+
+	return frame.Result // Return block result
+}
+
+// localType - get type of local at index
+func (v *bodyValidator) localType(index uint32) (wasm.ValueType, bool) {
+	if int(index) < len(v.sig.ParamTypes) { // Check is param
+		return v.sig.ParamTypes[index], true // Return param type
+	}
+
+	remaining := uint64(index) - uint64(len(v.sig.ParamTypes)) // Get index past params
+
+	for _, l := range v.locals { // Iterate through local entries
+		if remaining < uint64(l.Count) { // Check within entry
+			return l.Type, true // Return local type
+		}
+
+		remaining -= uint64(l.Count) // Skip entry
+	}
+
+	return 0, false // Out of bounds
+}
+
+// push - push operand (emptyBlockType pushes nothing)
+func (v *bodyValidator) push(t wasm.ValueType) {
+	if t == emptyBlockType { // Check nothing to push
+		return
+	}
+
+	v.operands = append(v.operands, t) // Push operand
+}
+
+// pop - pop any operand
+func (v *bodyValidator) pop() (wasm.ValueType, error) {
+	frame := &v.controls[len(v.controls)-1] // Get current frame
+
+	if len(v.operands) == frame.Height { // Check frame operands exhausted
+		if frame.Unreachable { // Polymorphic stack yields anything
+			return unknownType, nil // Return unknown
+		}
+
+		return 0, ErrStackUnderflow // Return error
+	}
+
+	t := v.operands[len(v.operands)-1]          // Get top
+	v.operands = v.operands[:len(v.operands)-1] // Pop
+
+	return t, nil // Return popped
+}
+
+// popExpect - pop an operand of type t (emptyBlockType pops nothing)
+func (v *bodyValidator) popExpect(t wasm.ValueType) error {
+	if t == emptyBlockType { // Check nothing to pop
+		return nil
+	}
+
+	actual, err := v.pop() // Pop
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	if actual != t && actual != unknownType { // Check type
+		return ErrTypeMismatch // Return error
+	}
+
+	return nil // No error occurred, return nil
+}
+
+// pushControl - open a block
+func (v *bodyValidator) pushControl(opcode byte, result wasm.ValueType) {
+	v.controls = append(v.controls, controlFrame{
+		Opcode: opcode,
+		Result: result,
+		Height: len(v.operands),
+	}) // Push frame
+}
+
+// popControl - close the current block, checking its operands match its result
+func (v *bodyValidator) popControl() (controlFrame, error) {
+	if len(v.controls) == 0 { // Check has open block
+		return controlFrame{}, ErrUnbalancedBlock // Return error
+	}
+
+	frame := v.controls[len(v.controls)-1] // Get frame
+
+	if err := v.popExpect(frame.Result); err != nil { // Pop result
+		return frame, err // Return found error
+	}
+
+	if len(v.operands) != frame.Height { // Check no leftover operands
+		return frame, ErrTypeMismatch // Return error
+	}
+
+	v.controls = v.controls[:len(v.controls)-1] // Pop frame
+
+	return frame, nil // Return closed frame
+}
+
+// setUnreachable - mark the rest of the current block as stack-polymorphic
+func (v *bodyValidator) setUnreachable() {
+	frame := &v.controls[len(v.controls)-1] // Get current frame
+
+	v.operands = v.operands[:frame.Height] // Unwind operands
+	frame.Unreachable = true               // Set unreachable
+}
+
+// memoryAccessWidth - get natural width (in bytes) of a load/store opcode, or 0
+func memoryAccessWidth(code byte) uint32 {
+	switch code { // Handle memory operators
+	case ops.I32Load8s, ops.I32Load8u, ops.I64Load8s, ops.I64Load8u, ops.I32Store8, ops.I64Store8:
+		return 1
+	case ops.I32Load16s, ops.I32Load16u, ops.I64Load16s, ops.I64Load16u, ops.I32Store16, ops.I64Store16:
+		return 2
+	case ops.I32Load, ops.F32Load, ops.I64Load32s, ops.I64Load32u, ops.I32Store, ops.F32Store, ops.I64Store32:
+		return 4
+	case ops.I64Load, ops.F64Load, ops.I64Store, ops.F64Store:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// validateLimits - check resizable limits are well formed and within bound
+func validateLimits(limits wasm.ResizableLimits, bound uint64) error {
+	if uint64(limits.Initial) > bound { // Check initial in bounds
+		return ErrInvalidLimits // Return error
+	}
+
+	if limits.Flags&1 != 0 && (uint64(limits.Maximum) > bound || limits.Maximum < limits.Initial) { // Check maximum
+		return ErrInvalidLimits // Return error
+	}
+
+	return nil // No error occurred, return nil
+}
+
+// isValueType - check t is one of i32, i64, f32, f64
+func isValueType(t wasm.ValueType) bool {
+	switch t { // Handle types
+	case wasm.ValueTypeI32, wasm.ValueTypeI64, wasm.ValueTypeF32, wasm.ValueTypeF64:
+		return true
+	default:
+		return false
+	}
+}
+
+/* END INTERNAL METHODS */
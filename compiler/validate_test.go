@@ -0,0 +1,145 @@
+package compiler
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// testModuleBytes - assemble a module exporting a single function of the given signature and body
+func testModuleBytes(params []byte, results []byte, body []byte) []byte {
+	typeSection := append([]byte{0x01, 0x60, byte(len(params))}, params...) // Init type section
+	typeSection = append(typeSection, byte(len(results)))                   // Write result count
+	typeSection = append(typeSection, results...)                           // Write results
+
+	code := append([]byte{0x00}, body...) // Init code (no locals)
+	code = append(code, 0x0b)             // Write end
+
+	codeSection := append([]byte{0x01, byte(len(code))}, code...) // Init code section
+
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00} // Init header
+
+	module = append(module, 0x01, byte(len(typeSection))) // Write type section header
+	module = append(module, typeSection...)               // Write type section
+	module = append(module, 0x03, 0x02, 0x01, 0x00)       // Write function section
+	module = append(module, 0x0a, byte(len(codeSection))) // Write code section header
+	module = append(module, codeSection...)               // Write code section
+
+	return module // Return assembled module
+}
+
+// TestValidate - test functionality of module validation
+func TestValidate(t *testing.T) {
+	i32 := byte(0x7f) // Init i32 type
+	i64 := byte(0x7e) // Init i64 type
+
+	tests := []struct {
+		name    string
+		params  []byte
+		results []byte
+		body    []byte
+		err     error
+	}{
+		{"add", []byte{i32, i32}, []byte{i32}, []byte{0x20, 0x00, 0x20, 0x01, 0x6a}, nil},
+		{"unreachable", nil, []byte{i32}, []byte{0x00, 0x6a}, nil},
+		{"br_value", nil, []byte{i32}, []byte{0x02, 0x7f, 0x41, 0x01, 0x0c, 0x00, 0x0b}, nil},
+		{"wrong_result", nil, []byte{i32}, []byte{0x42, 0x01}, ErrTypeMismatch},
+		{"wrong_operand", []byte{i64}, []byte{i32}, []byte{0x20, 0x00, 0x45}, ErrTypeMismatch},
+		{"underflow", nil, []byte{i32}, []byte{0x6a}, ErrStackUnderflow},
+		{"missing_block_value", nil, nil, []byte{0x02, 0x7f, 0x0b, 0x1a}, ErrStackUnderflow},
+		{"bad_local", nil, []byte{i32}, []byte{0x20, 0x05}, ErrInvalidIndex},
+		{"bad_call", nil, nil, []byte{0x10, 0x09}, ErrInvalidIndex},
+		{"bad_label", nil, nil, []byte{0x0c, 0x03}, ErrInvalidIndex},
+		{"no_memory", nil, []byte{i32}, []byte{0x41, 0x00, 0x28, 0x02, 0x00}, ErrInvalidIndex},
+		{"unterminated", nil, nil, []byte{0x02, 0x40}, ErrUnbalancedBlock},
+		{"bad_block_type", nil, nil, []byte{0x02, 0x01, 0x0b}, ErrInvalidBlockType},
+		{"bad_opcode", nil, nil, []byte{0xff}, ErrInvalidOpcode},
+	}
+
+	for _, test := range tests { // Iterate through tests
+		module, err := LoadModule(testModuleBytes(test.params, test.results, test.body)) // Load module
+
+		if test.err == nil { // Check should be valid
+			if err != nil { // Check for errors
+				t.Fatalf("%s: %s", test.name, err) // Panic
+			}
+
+			continue // Continue to next test
+		}
+
+		if !errors.Is(err, test.err) { // Check correct error
+			t.Fatalf("%s: expected %s, got %v (%v)", test.name, test.err, err, module) // Panic
+		}
+
+		var validationErr *ValidationError // Init error buffer
+
+		if !errors.As(err, &validationErr) || validationErr.Section != "function" || validationErr.Index != 0 { // Check positioned
+			t.Fatalf("%s: unpositioned error %v", test.name, err) // Panic
+		}
+	}
+}
+
+// TestValidateExamples - test all example modules pass validation
+func TestValidateExamples(t *testing.T) {
+	files, err := filepath.Glob(filepath.FromSlash("../examples/*.wasm")) // Get example modules
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	for _, file := range files { // Iterate through examples
+		source, err := ioutil.ReadFile(file) // Read example
+
+		if err != nil { // Check for errors
+			t.Fatal(err) // Panic
+		}
+
+		module, err := LoadModule(source) // Load module
+
+		if err != nil { // Check for errors
+			t.Fatalf("%s: %s", file, err) // Panic
+		}
+
+		if err = module.Validate(); err != nil { // Validate again
+			t.Fatalf("%s: %s", file, err) // Panic
+		}
+	}
+}
+
+// TestValidateDuplicateExports - test modules exporting two entries under the same name are rejected
+func TestValidateDuplicateExports(t *testing.T) {
+	source := testModuleBytes(nil, nil, nil) // Assemble module
+
+	exportSection := []byte{0x02, 0x01, 'f', 0x00, 0x00, 0x01, 'f', 0x00, 0x00} // Export function 0 as "f" twice
+
+	code := source[len(source)-6:]                                    // Get code section
+	withExports := append([]byte(nil), source[:len(source)-6]...)     // Copy sections before code
+	withExports = append(withExports, 0x07, byte(len(exportSection))) // Write export section header
+	withExports = append(withExports, exportSection...)               // Write export section
+	withExports = append(withExports, code...)                        // Write code section
+
+	if _, err := LoadModule(withExports); !errors.Is(err, ErrDuplicateExport) { // Load module
+		t.Fatalf("expected %s, got %v", ErrDuplicateExport, err) // Panic
+	}
+
+	source, err := ioutil.ReadFile(filepath.FromSlash("../examples/host.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	module, err := LoadModule(source) // Load module
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	module.Base.Export.Names = append(module.Base.Export.Names, module.Base.Export.Names[0]) // Export first name again
+
+	var validationErr *ValidationError // Init error buffer
+
+	if err := module.Validate(); !errors.Is(err, ErrDuplicateExport) || !errors.As(err, &validationErr) || validationErr.Section != "export" || validationErr.Index != len(module.Base.Export.Names)-1 { // Validate
+		t.Fatalf("expected positioned %s, got %v", ErrDuplicateExport, err) // Panic
+	}
+}
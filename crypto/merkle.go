@@ -0,0 +1,102 @@
+package crypto
+
+import "bytes"
+
+const (
+	// merkleLeafPrefix - domain separation prefix of hashed leaves
+	merkleLeafPrefix = 0x00
+
+	// merkleNodePrefix - domain separation prefix of hashed inner nodes
+	merkleNodePrefix = 0x01
+)
+
+// MerkleProofNode - sibling hash on the path from a leaf to a merkle root
+type MerkleProofNode struct {
+	Hash []byte `json:"hash"` // Sibling hash
+	Left bool   `json:"left"` // Sibling is the left child
+}
+
+// HashMerkleLeaf - hash the given leaf data
+func HashMerkleLeaf(data []byte) []byte {
+	return Sha3(append([]byte{merkleLeafPrefix}, data...)) // Return hash
+}
+
+// HashMerkleNode - hash the given pair of child hashes
+func HashMerkleNode(left []byte, right []byte) []byte {
+	buffer := make([]byte, 0, 1+len(left)+len(right)) // Init buffer
+
+	buffer = append(buffer, merkleNodePrefix) // Append prefix
+	buffer = append(buffer, left...)          // Append left child
+	buffer = append(buffer, right...)         // Append right child
+
+	return Sha3(buffer) // Return hash
+}
+
+// MerkleRoot - get the root of the binary merkle tree over the given leaf hashes. The last node of
+// a level with an odd number of nodes is promoted to the next level unchanged. The root of an
+// empty tree is Sha3(nil).
+func MerkleRoot(leaves [][]byte) []byte {
+	if len(leaves) == 0 { // Check empty tree
+		return Sha3(nil) // Return empty root
+	}
+
+	level := leaves // Init level
+
+	for len(level) > 1 { // Iterate until single node
+		level = nextMerkleLevel(level) // Hash level
+	}
+
+	return level[0] // Return root
+}
+
+// MerkleProof - get the sibling hashes on the path from the leaf at the given index to the root
+func MerkleProof(leaves [][]byte, index int) []MerkleProofNode {
+	var proof []MerkleProofNode // Init proof buffer
+
+	level := leaves // Init level
+
+	for len(level) > 1 { // Iterate until root
+		sibling := index ^ 1 // Get sibling index
+
+		if sibling < len(level) { // Check has sibling (else promoted)
+			proof = append(proof, MerkleProofNode{Hash: level[sibling], Left: sibling < index}) // Append sibling
+		}
+
+		level = nextMerkleLevel(level) // Hash level
+		index /= 2                     // Get parent index
+	}
+
+	return proof // Return proof
+}
+
+// VerifyMerkleProof - check the given leaf hash and proof lead to the given root
+func VerifyMerkleProof(root []byte, leaf []byte, proof []MerkleProofNode) bool {
+	hash := leaf // Init hash
+
+	for _, node := range proof { // Iterate through path
+		if node.Left { // Check sibling is left child
+			hash = HashMerkleNode(node.Hash, hash) // Hash pair
+		} else {
+			hash = HashMerkleNode(hash, node.Hash) // Hash pair
+		}
+	}
+
+	return bytes.Equal(hash, root) // Return matches root
+}
+
+// nextMerkleLevel - hash each pair of nodes in the given level
+func nextMerkleLevel(level [][]byte) [][]byte {
+	next := make([][]byte, 0, (len(level)+1)/2) // Init next level
+
+	for i := 0; i < len(level); i += 2 { // Iterate through pairs
+		if i+1 == len(level) { // Check odd node
+			next = append(next, level[i]) // Promote node
+
+			continue // Continue
+		}
+
+		next = append(next, HashMerkleNode(level[i], level[i+1])) // Hash pair
+	}
+
+	return next // Return level
+}
@@ -0,0 +1,44 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestMerkleProof - test proofs of every leaf verify against the root, for odd and even leaf counts
+func TestMerkleProof(t *testing.T) {
+	for count := 1; count <= 9; count++ { // Iterate through tree sizes
+		var leaves [][]byte // Init leaf buffer
+
+		for i := 0; i < count; i++ { // Iterate through leaves
+			leaves = append(leaves, HashMerkleLeaf([]byte{byte(i)})) // Append leaf
+		}
+
+		root := MerkleRoot(leaves) // Get root
+
+		for i, leaf := range leaves { // Iterate through leaves
+			proof := MerkleProof(leaves, i) // Get proof
+
+			if !VerifyMerkleProof(root, leaf, proof) { // Verify proof
+				t.Fatalf("proof of leaf %d of %d did not verify", i, count) // Panic
+			}
+
+			if count > 1 && VerifyMerkleProof(root, HashMerkleLeaf([]byte{0xff}), proof) { // Verify wrong leaf
+				t.Fatalf("proof of leaf %d of %d verified the wrong leaf", i, count) // Panic
+			}
+		}
+	}
+}
+
+// TestMerkleRoot - test the root of a single leaf and of an empty tree
+func TestMerkleRoot(t *testing.T) {
+	leaf := HashMerkleLeaf([]byte("test")) // Hash leaf
+
+	if !bytes.Equal(MerkleRoot([][]byte{leaf}), leaf) { // Check single leaf is root
+		t.Fatal("expected the root of a single leaf to be the leaf") // Panic
+	}
+
+	if !bytes.Equal(MerkleRoot(nil), Sha3(nil)) { // Check empty root
+		t.Fatal("expected the root of an empty tree to be Sha3(nil)") // Panic
+	}
+}
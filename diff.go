@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/SummerCash/ursa/vm"
+)
+
+// runDiff - print the changes between two saved states (ursa diff -source FILE (-state-db ID | -state-key KEY) [-state-path DIR] [-json] FROM TO)
+func runDiff(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError) // Init flag set
+
+	source := flags.String("source", "", "specify .wasm source file the states were saved by")                                    // Init source flag
+	stateDBID := flags.String("state-db", "", "diff states of the state database with given hex ID")                              // Init state db flag
+	stateKey := flags.String("state-key", "", "diff states of the state database of the module's instances with given state key") // Init state key flag
+	statePath := flags.String("state-path", "", "read state databases from given directory (defaults to DataDir/state)")          // Init state path flag
+	asJSON := flags.Bool("json", false, "print diff as JSON")                                                                     // Init JSON flag
+
+	flags.Parse(args) // Parse flags
+
+	if *source == "" || (*stateDBID == "") == (*stateKey == "") || flags.NArg() != 2 { // Check has source, one state db and states
+		return fmt.Errorf("usage: ursa diff -source FILE (-state-db ID | -state-key KEY) [-state-path DIR] [-json] FROM TO") // Return error
+	}
+
+	wasmSource, err := ioutil.ReadFile(filepath.FromSlash(*source)) // Read WASM source
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	machine, err := vm.NewVirtualMachine(wasmSource, vm.Environment{
+		DefaultMemoryPages: 128,
+		DefaultTableSize:   65536,
+		StateStore:         vm.StateStoreMemory, // Don't overwrite the persisted state database
+	}, new(Resolver), nil) // Init virtual machine
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	id := vm.StateDatabaseID(machine.Module.Identifier, *stateKey) // Init state db ID
+
+	if *stateDBID != "" { // Check has state db ID
+		if id, err = hex.DecodeString(*stateDBID); err != nil { // Decode ID
+			return err // Return found error
+		}
+	}
+
+	store, err := vm.OpenExistingStateStore(&vm.Environment{StateStorePath: *statePath}, id) // Open state store (without creating it)
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	defer store.Close() // Close store
+
+	if machine.StateDB, err = vm.ReadStateDB(store); err != nil { // Read state db
+		return err // Return found error
+	}
+
+	from, err := resolveState(machine.StateDB, flags.Arg(0)) // Resolve first state
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	to, err := resolveState(machine.StateDB, flags.Arg(1)) // Resolve second state
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	diff, err := machine.Diff(from.ID, to.ID) // Diff states
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	if *asJSON { // Check print JSON
+		fmt.Fprintln(os.Stdout, string(diff.Bytes())) // Log diff
+
+		return nil // Done
+	}
+
+	fmt.Fprint(os.Stdout, diff.String()) // Log diff
+
+	return nil // Done
+}
+
+// resolveState - get the entry with the given label or hex ID
+func resolveState(stateDB *vm.StateDatabase, ref string) (*vm.StateEntry, error) {
+	if entry, err := stateDB.Resolve(ref); err == nil { // Check is label
+		return entry, nil // Return entry
+	}
+
+	id, err := hex.DecodeString(ref) // Decode ID
+
+	if err != nil { // Check for errors
+		return nil, fmt.Errorf("%s is neither a label nor a state ID", ref) // Return error
+	}
+
+	entry, err := stateDB.QueryState(id) // Query state
+
+	if err != nil { // Check for errors
+		return nil, fmt.Errorf("state %s: %w", ref, err) // Return found error
+	}
+
+	return entry, nil // Return entry
+}
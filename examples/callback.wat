@@ -0,0 +1,46 @@
+(module
+    (import "env" "map" (func $map (param i32) (result i32)))
+    (import "env" "greet" (func $greet (result i32)))
+    (import "env" "deep" (func $deep (param i32) (result i32)))
+    (import "env" "guarded" (func $guarded (result i32)))
+    (memory 1)
+    (global $heap (mut i32) (i32.const 1024))
+    (func $square (param i32) (result i32)
+        get_local 0
+        get_local 0
+        i32.mul
+    )
+    (func $alloc (param i32) (result i32)
+        get_global $heap
+        get_global $heap
+        get_local 0
+        i32.add
+        set_global $heap
+    )
+    (func $run (param i32) (result i32)
+        get_local 0
+        call $map
+        i32.const 1
+        i32.add
+    )
+    (func $hello (result i32)
+        call $greet
+    )
+    (func $down (param i32) (result i32)
+        get_local 0
+        call $deep
+    )
+    (func $trap
+        unreachable
+    )
+    (func $recover (result i32)
+        call $guarded
+    )
+    (export "square" (func $square))
+    (export "alloc" (func $alloc))
+    (export "run" (func $run))
+    (export "hello" (func $hello))
+    (export "down" (func $down))
+    (export "trap" (func $trap))
+    (export "recover" (func $recover))
+)
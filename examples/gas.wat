@@ -0,0 +1,14 @@
+(module
+    (import "env" "work" (func $work (param i32)))
+    (memory 1)
+    (func $grow (param i32) (result i32)
+        get_local 0
+        grow_memory
+    )
+    (func $work_n (param i32)
+        get_local 0
+        call $work
+    )
+    (export "grow" (func $grow))
+    (export "work" (func $work_n))
+)
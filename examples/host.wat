@@ -0,0 +1,30 @@
+(module
+    (import "env" "add" (func $add (param i32 i64) (result i64)))
+    (import "env" "scale" (func $scale (param f32 f64) (result f64)))
+    (import "env" "negate" (func $negate (param i32) (result i32)))
+    (import "env" "check" (func $check (param i32)))
+    (func $add_wide (param i32 i64) (result i64)
+        get_local 0
+        get_local 1
+        call $add
+    )
+    (func $scale_by (param f32 f64) (result f64)
+        get_local 0
+        get_local 1
+        call $scale
+    )
+    (func $negate_twice (param i32) (result i32)
+        get_local 0
+        call $negate
+        call $negate
+    )
+    (func $checked (param i32) (result i32)
+        get_local 0
+        call $check
+        get_local 0
+    )
+    (export "add" (func $add_wide))
+    (export "scale" (func $scale_by))
+    (export "negate" (func $negate_twice))
+    (export "check" (func $checked))
+)
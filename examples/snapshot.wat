@@ -0,0 +1,49 @@
+(module
+    (memory 4)
+    (global $counter (mut i32) (i32.const 7))
+    (func $store (param i32 i32)
+        get_local 0
+        get_local 1
+        i32.store
+    )
+    (func $store64 (param i32 i64)
+        get_local 0
+        get_local 1
+        i64.store
+    )
+    (func $load (param i32) (result i32)
+        get_local 0
+        i32.load
+    )
+    (func $grow (param i32) (result i32)
+        get_local 0
+        grow_memory
+    )
+    (func $bump (result i32)
+        get_global $counter
+        i32.const 1
+        i32.add
+        set_global $counter
+        get_global $counter
+    )
+    (func $fail (param i32 i32)
+        get_local 0
+        get_local 1
+        i32.store
+        get_global $counter
+        i32.const 1
+        i32.add
+        set_global $counter
+        i32.const 1
+        grow_memory
+        drop
+        unreachable
+    )
+    (export "counter" (global $counter))
+    (export "fail" (func $fail))
+    (export "bump" (func $bump))
+    (export "store" (func $store))
+    (export "store64" (func $store64))
+    (export "load" (func $load))
+    (export "grow" (func $grow))
+)
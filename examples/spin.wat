@@ -0,0 +1,32 @@
+(module
+    (import "env" "tick" (func $tick))
+    (func $spin
+        (loop
+            br 0
+        )
+    )
+    (func $spin_host
+        (loop
+            call $tick
+            br 0
+        )
+    )
+    (func $count (param i32) (result i32)
+        (block
+            (loop
+                get_local 0
+                i32.eqz
+                br_if 1
+                get_local 0
+                i32.const 1
+                i32.sub
+                set_local 0
+                br 0
+            )
+        )
+        i32.const 42
+    )
+    (export "spin" (func $spin))
+    (export "spin_host" (func $spin_host))
+    (export "count" (func $count))
+)
@@ -0,0 +1,55 @@
+(module
+    (import "ursa" "storage_get" (func $storage_get (param i32 i32 i32 i32) (result i32)))
+    (import "ursa" "storage_set" (func $storage_set (param i32 i32 i32 i32)))
+    (import "ursa" "storage_delete" (func $storage_delete (param i32 i32) (result i32)))
+    (import "ursa" "storage_has" (func $storage_has (param i32 i32) (result i32)))
+    (memory 1)
+    (data (i32.const 0) "count")
+    (func $increment (result i32)
+        block
+            i32.const 0
+            i32.const 5
+            i32.const 16
+            i32.const 4
+            call $storage_get
+            i32.const -1
+            i32.ne
+            br_if 0
+            i32.const 16
+            i32.const 0
+            i32.store
+        end
+        i32.const 16
+        i32.const 16
+        i32.load
+        i32.const 1
+        i32.add
+        i32.store
+        i32.const 0
+        i32.const 5
+        i32.const 16
+        i32.const 4
+        call $storage_set
+        i32.const 16
+        i32.load
+    )
+    (func $increment_fail
+        call $increment
+        drop
+        unreachable
+    )
+    (func $remove (result i32)
+        i32.const 0
+        i32.const 5
+        call $storage_delete
+    )
+    (func $has (result i32)
+        i32.const 0
+        i32.const 5
+        call $storage_has
+    )
+    (export "increment" (func $increment))
+    (export "increment_fail" (func $increment_fail))
+    (export "remove" (func $remove))
+    (export "has" (func $has))
+)
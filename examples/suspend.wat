@@ -0,0 +1,33 @@
+(module
+    (import "env" "fetch" (func $fetch (param i32) (result i32)))
+    (import "env" "notify" (func $notify (param i32)))
+    (memory 1)
+    (func $run (param i32) (result i32)
+        (local i32)
+        get_local 0
+        call $fetch
+        set_local 1
+        i32.const 0
+        get_local 1
+        i32.store
+        get_local 0
+        i32.const 100
+        i32.mul
+        get_local 1
+        i32.add
+    )
+    (func $twice (result i32)
+        i32.const 1
+        call $fetch
+        i32.const 2
+        call $fetch
+        i32.add
+    )
+    (func $wait
+        i32.const 3
+        call $notify
+    )
+    (export "run" (func $run))
+    (export "twice" (func $twice))
+    (export "wait" (func $wait))
+)
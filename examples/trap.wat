@@ -0,0 +1,27 @@
+(module
+    (import "env" "fail" (func $fail))
+    (memory 1)
+    (func $unreachable
+        unreachable
+    )
+    (func $div (param i32 i32) (result i32)
+        get_local 0
+        get_local 1
+        i32.div_s
+    )
+    (func $load (param i32) (result i32)
+        get_local 0
+        i32.load
+    )
+    (func $recurse
+        call $recurse
+    )
+    (func $host
+        call $fail
+    )
+    (export "unreachable" (func $unreachable))
+    (export "div" (func $div))
+    (export "load" (func $load))
+    (export "recurse" (func $recurse))
+    (export "host" (func $host))
+)
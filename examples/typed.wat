@@ -0,0 +1,41 @@
+(module
+    (func $add_f64 (param f64 f64) (result f64)
+        get_local 0
+        get_local 1
+        f64.add
+    )
+    (func $mul_f32 (param f32 f32) (result f32)
+        get_local 0
+        get_local 1
+        f32.mul
+    )
+    (func $mix (param i32 i64 f32 f64) (result f64)
+        get_local 0
+        f64.convert_s/i32
+        get_local 1
+        f64.convert_s/i64
+        f64.add
+        get_local 2
+        f64.promote/f32
+        f64.add
+        get_local 3
+        f64.add
+    )
+    (func $neg_i32 (param i32) (result i32)
+        i32.const 0
+        get_local 0
+        i32.sub
+    )
+    (func $neg_i64 (param i64) (result i64)
+        i64.const 0
+        get_local 0
+        i64.sub
+    )
+    (func $nop)
+    (export "add_f64" (func $add_f64))
+    (export "mul_f32" (func $mul_f32))
+    (export "mix" (func $mix))
+    (export "neg_i32" (func $neg_i32))
+    (export "neg_i64" (func $neg_i64))
+    (export "nop" (func $nop))
+)
@@ -1,8 +1,9 @@
 module github.com/SummerCash/ursa
 
-go 1.12
+go 1.13
 
 require (
+	github.com/BurntSushi/toml v0.3.0
 	github.com/SummerCash/wagon v0.4.0
 	golang.org/x/crypto v0.0.0-20190228161510-8dd112bcdc25
 )
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strconv"
 
@@ -17,20 +18,41 @@ type Resolver struct {
 }
 
 var (
-	sourceFlag        = flag.String("source", "", "specify .wasm source file to run")   // Init source flag
-	gasLimitFlag      = flag.Int("gas-limit", 1000, "run .wasm with given gas limit")   // Init gas limit flag
-	gasPerInstruction = flag.Int64("gas-per", 1, "run .wasm with given gas policy")     // Init gas policy flag
-	entryFunctionFlag = flag.String("entry", "", "run .wasm from given entry function") // Init entry flag
+	sourceFlag        = flag.String("source", "", "specify .wasm source file to run")               // Init source flag
+	gasLimitFlag      = flag.Uint64("gas-limit", 1000, "run .wasm with given gas limit")            // Init gas limit flag
+	gasPerInstruction = flag.Int64("gas-per", 1, "run .wasm with given gas policy")                 // Init gas policy flag
+	gasTableFlag      = flag.String("gas-table", "", "run .wasm with given gas table file")         // Init gas table flag
+	entryFunctionFlag = flag.String("entry", "", "run .wasm from given entry function")             // Init entry flag
+	codeCacheFlag     = flag.Bool("code-cache", false, "cache compiled .wasm code in the data dir") // Init code cache flag
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "diff" { // Check is diff subcommand
+		if err := runDiff(os.Args[2:]); err != nil { // Diff states
+			fmt.Fprintln(os.Stderr, err) // Log error
+			os.Exit(1)                   // Exit
+		}
+
+		return // Done
+	}
+
 	flag.Parse() // Parse flags
 
 	if sourceFlag == nil || *sourceFlag == "" { // Check for nil .wasm source
 		panic("no .wasm file provided, exiting") // Panic
 	}
 
-	gasPolicy := &compiler.SimpleGasPolicy{GasPerInstruction: *gasPerInstruction} // Init simple gas policy
+	var gasPolicy compiler.GasPolicy = &compiler.SimpleGasPolicy{GasPerInstruction: *gasPerInstruction} // Init simple gas policy
+
+	if *gasTableFlag != "" { // Check has gas table
+		gasTable, err := compiler.ReadGasTable(*gasTableFlag) // Read gas table
+
+		if err != nil { // Check for errors
+			panic(err) // Panic
+		}
+
+		gasPolicy = gasTable // Set gas policy
+	}
 
 	sourcePath, err := filepath.Abs(filepath.FromSlash(*sourceFlag)) // Get source path
 
@@ -48,6 +70,7 @@ func main() {
 		EnableJIT:          false,
 		DefaultMemoryPages: 128,
 		DefaultTableSize:   65536,
+		CodeCache:          *codeCacheFlag,
 	}, new(Resolver), gasPolicy) // Init virtual machine
 
 	if err != nil { // Check for errors
@@ -74,14 +97,14 @@ func main() {
 		}
 	}
 
-	ret, err := vm.RunWithGasLimit(entryID, *gasLimitFlag, args...) // Run with given entry function, params, gas
+	result, err := vm.RunWithGasLimit(entryID, *gasLimitFlag, args...) // Run with given entry function, params, gas
 
 	if err != nil { // Check for errors
 		vm.PrintStackTrace() // Log stack trace
 		panic(err)           // Panic
 	}
 
-	fmt.Printf("Return Value: %d, Gas Used: %d\n", ret, vm.Gas) // Log successful run
+	fmt.Printf("Return Value: %d, Gas Used: %d, Gas Remaining: %d\n", result.ReturnValue, result.GasUsed, result.GasRemaining) // Log successful run
 }
 
 // ResolveFunc - define a set of import functions that may be called within a WebAssembly module
@@ -97,10 +120,13 @@ func (r *Resolver) ResolveFunc(module, field string) vm.FunctionImport {
 			}
 		case "__ursa_log":
 			return func(vm *vm.VirtualMachine) int64 {
-				ptr := int(uint32(vm.GetCurrentFrame().Locals[0]))
-				msgLen := int(uint32(vm.GetCurrentFrame().Locals[1]))
-				msg := vm.Memory[ptr : ptr+msgLen]
-				fmt.Printf("[app] %s\n", string(msg))
+				ptr := uint32(vm.GetCurrentFrame().Locals[0])
+				msgLen := uint32(vm.GetCurrentFrame().Locals[1])
+				msg, err := vm.GuestMemory().ReadString(ptr, msgLen)
+				if err != nil {
+					panic(err) // Trap on malformed pointer
+				}
+				fmt.Printf("[app] %s\n", msg)
 				return 0
 			}
 
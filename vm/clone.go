@@ -0,0 +1,187 @@
+package vm
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrCloneRunning - describes an error regarding an attempt to clone a vm that is in the middle of a run
+	ErrCloneRunning = errors.New("cannot clone a vm in the middle of a run")
+)
+
+// Pool - concurrency-safe pool of vms forked from a template vm, each ready to run. The pool owns
+// the template, which must not be run or modified while the pool is in use.
+type Pool struct {
+	template *VirtualMachine // Vm instances are forked from
+
+	maxIdle int               // Max number of idle instances kept
+	idle    []*VirtualMachine // Idle instances, reset to the template
+
+	mutex sync.Mutex // Pool lock
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// Clone - fork the vm. The clone shares the vm's module and function code, starts with copies of its
+// globals, table and storage, and shares its memory until either vm writes to it (at which point the
+// writer copies it). The clone gets its own in-memory state database, rooted at the vm's working root,
+// which is created on first use and written on the first SaveState (until then, the clone shares the
+// root entry with the vm). The vm must not be in the middle of a run (Reset it after a trap).
+func (vm *VirtualMachine) Clone() (*VirtualMachine, error) {
+	clone := &VirtualMachine{} // Init clone
+
+	if err := vm.cloneInto(clone); err != nil { // Fork vm
+		return nil, err // Return found error
+	}
+
+	return clone, nil // Return clone
+}
+
+// NewPool - initialize a pool of vms forked from the given template, keeping up to maxIdle idle instances for reuse
+func NewPool(template *VirtualMachine, maxIdle int) *Pool {
+	return &Pool{
+		template: template, // Set template
+		maxIdle:  maxIdle,  // Set max idle
+	} // Return pool
+}
+
+// Get - get an instance that is in the template's state and ready to run
+func (pool *Pool) Get() (*VirtualMachine, error) {
+	pool.mutex.Lock()         // Lock
+	defer pool.mutex.Unlock() // Unlock
+
+	if len(pool.idle) > 0 { // Check has idle instance
+		vm := pool.idle[len(pool.idle)-1]        // Get instance
+		pool.idle = pool.idle[:len(pool.idle)-1] // Remove from idle instances
+
+		return vm, nil // Return instance
+	}
+
+	return pool.template.Clone() // Fork template
+}
+
+// Put - return an instance to the pool, which resets it to the template's state (it must not be used afterwards)
+func (pool *Pool) Put(vm *VirtualMachine) {
+	pool.mutex.Lock()         // Lock
+	defer pool.mutex.Unlock() // Unlock
+
+	if len(pool.idle) >= pool.maxIdle { // Check full
+		return // Drop instance
+	}
+
+	vm.Reset() // Abandon any run
+
+	if pool.template.cloneInto(vm) != nil { // Reset to template
+		return // Drop instance
+	}
+
+	pool.idle = append(pool.idle, vm) // Keep instance
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// cloneInto - set the given vm to a fork of the vm (see Clone), reusing its call stack
+func (vm *VirtualMachine) cloneInto(clone *VirtualMachine) error {
+	if vm.CurrentFrame != -1 { // Check not running
+		return ErrCloneRunning // Return error
+	}
+
+	stateDB, err := vm.StateDatabase() // Get state database
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	root, base, err := stateDB.forkRoot() // Fork working root
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	callStack := clone.CallStack // Get call stack to reuse
+
+	if len(callStack) != len(vm.CallStack) { // Check cannot reuse
+		callStack = make([]Frame, len(vm.CallStack)) // Init call stack
+	}
+
+	for i := range callStack { // Iterate through frames
+		callStack[i] = Frame{} // Clear frame
+	}
+
+	vm.shareMemory() // Copy memory before the next write
+
+	*clone = VirtualMachine{
+		Module:          vm.Module,                               // Set module
+		Environment:     vm.Environment,                          // Set environment
+		FunctionCode:    vm.FunctionCode,                         // Set function code
+		FunctionImports: vm.FunctionImports,                      // Set function imports
+		CallStack:       callStack,                               // Set call stack
+		CurrentFrame:    -1,                                      // Set current frame
+		Table:           append([]uint32(nil), vm.Table...),      // Set table
+		Globals:         append([]int64(nil), vm.Globals...),     // Set globals
+		Memory:          vm.Memory,                               // Share memory
+		Exited:          true,                                    // Set exited
+		Gas:             vm.Gas,                                  // Set gas
+		Storage:         copyStorage(vm.Storage),                 // Set storage
+		pendingRoot:     root,                                    // Set root of the state database created on first use
+		pendingBase:     base,                                    // Set memory the root's pages apply to
+		dirtyPages:      append([]bool(nil), vm.dirtyPages...),   // Set pages written since the working root
+		pageHashes:      append([][]byte(nil), vm.pageHashes...), // Set page hashes
+		memoryShared:    true,                                    // Copy memory before the first write
+	} // Set clone
+
+	return nil // No error occurred, return nil
+}
+
+// shareMemory - mark memory as shared with a clone, so that it is copied before the next write
+func (vm *VirtualMachine) shareMemory() {
+	vm.Memory = vm.Memory[:len(vm.Memory):len(vm.Memory)] // Grow memory into a new array
+	vm.memoryShared = true                                // Copy before writing
+}
+
+// ownMemory - copy memory shared with a clone, so that it can be written
+func (vm *VirtualMachine) ownMemory() {
+	if !vm.memoryShared { // Check not shared
+		return // Already owned
+	}
+
+	vm.Memory = append([]byte(nil), vm.Memory...) // Copy memory
+	vm.memoryShared = false                       // Set owned
+}
+
+// forkRoot - copy the working root for a vm forked from the state database, along with the memory its
+// pages apply to (nil if it is a full snapshot), which is rebuilt once and shared by every fork of the entry
+func (stateDB *StateDatabase) forkRoot() (*StateEntry, []byte, error) {
+	workingRoot := stateDB.WorkingRoot // Get working root
+
+	state := *workingRoot.State // Copy state (sharing its immutable fields)
+	state.StateChildren = nil   // Fork has no children yet
+
+	root := &StateEntry{
+		State: &state,            // Set state
+		Nonce: workingRoot.Nonce, // Set nonce
+		ID:    workingRoot.ID,    // Set ID
+	} // Init root
+
+	if state.IsFullSnapshot() { // Check root holds all of memory
+		return root, nil, nil // Return root
+	}
+
+	if stateDB.forkBaseOf != workingRoot { // Check not yet rebuilt
+		memory, err := stateDB.ReconstructMemory(workingRoot) // Rebuild memory
+
+		if err != nil { // Check for errors
+			return nil, nil, err // Return found error
+		}
+
+		stateDB.forkBase = memory        // Set memory the root's pages apply to
+		stateDB.forkBaseOf = workingRoot // Set entry
+	}
+
+	return root, stateDB.forkBase, nil // Return root
+}
+
+/* END INTERNAL METHODS */
@@ -0,0 +1,245 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// TestClone - test clones start from the vm's state and diverge from it independently
+func TestClone(t *testing.T) {
+	vm := newSnapshotTestVM(t) // Init vm
+
+	if _, err := vm.Call("store", I32(0), I32(11)); err != nil { // Write
+		t.Fatal(err) // Panic
+	}
+
+	if err := vm.SaveState(); err != nil { // Save state (incremental working root)
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := vm.Call("store", I32(4), I32(12)); err != nil { // Write after saving
+		t.Fatal(err) // Panic
+	}
+
+	clone, err := vm.Clone() // Clone vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if results, err := clone.Call("load", I32(4)); err != nil || results[0].I32() != 12 { // Check clone sees unsaved write
+		t.Fatalf("expected 12, got %v (%v)", results, err) // Panic
+	}
+
+	if _, err := clone.Call("store", I32(0), I32(21)); err != nil { // Write to clone
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := clone.Call("bump"); err != nil { // Bump clone counter
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := vm.Call("store", I32(8), I32(13)); err != nil { // Write to vm
+		t.Fatal(err) // Panic
+	}
+
+	if results, err := vm.Call("load", I32(0)); err != nil || results[0].I32() != 11 { // Check vm unaffected by clone
+		t.Fatalf("expected 11, got %v (%v)", results, err) // Panic
+	}
+
+	if results, err := clone.Call("load", I32(8)); err != nil || results[0].I32() != 0 { // Check clone unaffected by vm
+		t.Fatalf("expected 0, got %v (%v)", results, err) // Panic
+	}
+
+	if vm.Globals[0] != 7 || clone.Globals[0] != 8 { // Check globals independent
+		t.Fatalf("expected counters 7 and 8, got %d and %d", vm.Globals[0], clone.Globals[0]) // Panic
+	}
+
+	if clone.StateDB != nil { // Check state database not yet created
+		t.Fatal("expected clone state database to be created on first use") // Panic
+	}
+
+	stateDB, err := clone.StateDatabase() // Get clone state database
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	root := stateDB.WorkingRoot // Get clone root
+
+	if !bytes.Equal(root.ID, vm.StateDB.WorkingRoot.ID) || len(root.State.Pages) != len(vm.StateDB.WorkingRoot.State.Pages) { // Check forked from the vm's working root
+		t.Fatal("expected clone root to be the vm's working root") // Panic
+	}
+
+	if _, err := stateDB.Store().Get([]byte(stateDBHeaderKey)); !errors.Is(err, ErrKeyNotFound) { // Check nothing written
+		t.Fatalf("expected nothing written before the first save, got %v", err) // Panic
+	}
+
+	if err := clone.SaveState(); err != nil { // Save clone state
+		t.Fatal(err) // Panic
+	}
+
+	saved := clone.StateDB.WorkingRoot // Get saved clone state
+
+	if err := clone.ResetToState(root.ID); err != nil { // Reset clone to its root
+		t.Fatal(err) // Panic
+	}
+
+	for offset, expected := range map[int32]int32{0: 11, 4: 0} { // Check root rebuilt from the vm's saved pages
+		if results, err := clone.Call("load", I32(offset)); err != nil || results[0].I32() != expected { // Load
+			t.Fatalf("expected %d at %d, got %v (%v)", expected, offset, results, err) // Panic
+		}
+	}
+
+	if err := clone.ResetToState(saved.ID); err != nil { // Reset clone to its saved state
+		t.Fatal(err) // Panic
+	}
+
+	for offset, expected := range map[int32]int32{0: 21, 4: 12} { // Check saved with writes made before and after cloning
+		if results, err := clone.Call("load", I32(offset)); err != nil || results[0].I32() != expected { // Load
+			t.Fatalf("expected %d at %d, got %v (%v)", expected, offset, results, err) // Panic
+		}
+	}
+
+	if len(vm.StateDB.States) != 2 { // Check vm's state database unaffected
+		t.Fatalf("expected 2 states in the vm's db, got %d", len(vm.StateDB.States)) // Panic
+	}
+}
+
+// TestPool - test pooled instances start from the template's state, including when used concurrently
+func TestPool(t *testing.T) {
+	template := newSnapshotTestVM(t) // Init template
+
+	if _, err := template.Call("store", I32(0), I32(5)); err != nil { // Write
+		t.Fatal(err) // Panic
+	}
+
+	pool := NewPool(template, 4) // Init pool
+
+	var wg sync.WaitGroup            // Init wait group
+	errs := make(chan error, 8*10)   // Init error buffer
+	values := make(chan int32, 8*10) // Init value buffer
+
+	for worker := int32(0); worker < 8; worker++ { // Start workers
+		wg.Add(1) // Add worker
+
+		go func(worker int32) {
+			defer wg.Done() // Done
+
+			for i := 0; i < 10; i++ { // Run calls
+				vm, err := pool.Get() // Get instance
+
+				if err != nil { // Check for errors
+					errs <- err // Report error
+
+					return // Stop
+				}
+
+				results, err := vm.Call("load", I32(0)) // Load template value
+
+				if err != nil { // Check for errors
+					errs <- err // Report error
+
+					return // Stop
+				}
+
+				values <- results[0].I32() // Report value
+
+				if _, err := vm.Call("store", I32(0), I32(100+worker)); err != nil { // Overwrite value
+					errs <- err // Report error
+
+					return // Stop
+				}
+
+				pool.Put(vm) // Return instance
+			}
+		}(worker)
+	}
+
+	wg.Wait()     // Wait for workers
+	close(errs)   // Done reporting errors
+	close(values) // Done reporting values
+
+	for err := range errs { // Iterate through errors
+		t.Fatal(err) // Panic
+	}
+
+	for value := range values { // Iterate through values
+		if value != 5 { // Check reset to template
+			t.Fatalf("expected every instance to start with 5, got %d", value) // Panic
+		}
+	}
+
+	if results, err := template.Call("load", I32(0)); err != nil || results[0].I32() != 5 { // Check template unaffected
+		t.Fatalf("expected 5, got %v (%v)", results, err) // Panic
+	}
+
+	if template.StateDB == nil || template.StateDB.Store() != nil { // Check forking wrote nothing
+		t.Fatal("expected the template's state database to be created, but not written") // Panic
+	}
+}
+
+// TestCloneHostWrites - test host functions writing to a clone's memory do not write to memory shared with the vm
+func TestCloneHostWrites(t *testing.T) {
+	vm := newSnapshotTestVM(t) // Init vm
+
+	clone, err := vm.Clone() // Clone vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if err := clone.GuestMemory().Write(100, []byte{0xAB}); err != nil { // Write through guest memory
+		t.Fatal(err) // Panic
+	}
+
+	if value, err := clone.GuestMemory().ReadUint8(100); err != nil || value != 0xAB { // Check clone sees write
+		t.Fatalf("expected 0xAB in the clone, got %d (%v)", value, err) // Panic
+	}
+
+	if value, err := vm.GuestMemory().ReadUint8(100); err != nil || value != 0 { // Check vm unaffected
+		t.Fatalf("expected 0 in the vm, got %d (%v)", value, err) // Panic
+	}
+
+	template := newStorageTestVM(t, Environment{}) // Init storage vm
+
+	template.SetStorage([]byte("count"), []byte{41, 0, 0, 0}) // Set count
+
+	storageClone, err := template.Clone() // Clone storage vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if results, err := storageClone.Call("increment"); err != nil || results[0].I32() != 42 { // Read count through the storage host module
+		t.Fatalf("expected 42, got %v (%v)", results, err) // Panic
+	}
+
+	if value, err := template.GuestMemory().ReadUint32(16); err != nil || value != 0 { // Check template unaffected
+		t.Fatalf("expected 0 in the template, got %d (%v)", value, err) // Panic
+	}
+
+	directClone, err := template.Clone() // Clone storage vm again
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	directClone.FunctionImports = append([]FunctionImport(nil), directClone.FunctionImports...) // Copy imports
+	directClone.FunctionImports[0] = func(vm *VirtualMachine) int64 {
+		binary.LittleEndian.PutUint32(vm.Memory[16:20], 99) // Write count without marking it dirty
+
+		return 4 // Return value length
+	} // Replace storage_get with a host function writing vm.Memory directly
+
+	if results, err := directClone.Call("increment"); err != nil || results[0].I32() != 100 { // Read count through the replaced host function
+		t.Fatalf("expected 100, got %v (%v)", results, err) // Panic
+	}
+
+	if value, err := template.GuestMemory().ReadUint32(16); err != nil || value != 0 { // Check template unaffected
+		t.Fatalf("expected 0 in the template, got %d (%v)", value, err) // Panic
+	}
+}
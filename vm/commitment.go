@@ -0,0 +1,299 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/SummerCash/ursa/crypto"
+)
+
+const (
+	// StateProofMemory - proof of a range of memory pages
+	StateProofMemory = "memory"
+
+	// StateProofGlobal - proof of a global value
+	StateProofGlobal = "global"
+
+	// tableChunkSize - number of table entries committed to by a single leaf
+	tableChunkSize = 1024
+)
+
+const (
+	// commitmentMemory - index of the memory page tree root in a state commitment
+	commitmentMemory = iota
+
+	// commitmentGlobals - index of the global tree root in a state commitment
+	commitmentGlobals
+
+	// commitmentTable - index of the table tree root in a state commitment
+	commitmentTable
+
+	// commitmentStorage - index of the persistent storage tree root in a state commitment
+	commitmentStorage
+
+	// commitmentComponents - number of trees in a state commitment
+	commitmentComponents
+)
+
+const (
+	// leafPage - leaf kind of a memory page
+	leafPage byte = iota + 1
+
+	// leafGlobal - leaf kind of a global value
+	leafGlobal
+
+	// leafTable - leaf kind of a chunk of table entries
+	leafTable
+
+	// leafStorage - leaf kind of a storage entry
+	leafStorage
+)
+
+var (
+	// ErrInvalidStateProof - describes an error regarding a state proof that does not verify against the given root
+	ErrInvalidStateProof = errors.New("invalid state proof")
+
+	// ErrProofOutOfBounds - describes an error regarding a proof request for state the vm does not have
+	ErrProofOutOfBounds = errors.New("proof out of bounds")
+)
+
+// StateProof - inclusion proof of part of a vm's state in its state commitment. A commitment is
+// a merkle tree for each of memory pages, globals, the table and persistent storage; the state
+// root is the hash of the four tree roots.
+type StateProof struct {
+	Kind  string `json:"kind"`  // Proven state (StateProofMemory, StateProofGlobal)
+	Index uint32 `json:"index"` // Index of the first page or global proven
+
+	Leaves [][]byte                   `json:"leaves"` // Proven page contents or global values (8 bytes, little endian)
+	Paths  [][]crypto.MerkleProofNode `json:"paths"`  // Path of each leaf to its tree root
+
+	ComponentRoots [][]byte `json:"component_roots"` // Tree roots (memory, globals, table, storage)
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// StateRoot - get the merkle commitment of the vm's current memory, globals, table and storage
+func (vm *VirtualMachine) StateRoot() []byte {
+	return hashStateRoot(vm.componentRoots()) // Return root
+}
+
+// ProveMemory - prove the memory range of the given length starting at offset against the current state root
+func (vm *VirtualMachine) ProveMemory(offset int, length int) (*StateProof, error) {
+	if offset < 0 || length <= 0 || offset+length > len(vm.Memory) { // Check in bounds
+		return nil, fmt.Errorf("%w: memory range [%d, %d) of %d bytes", ErrProofOutOfBounds, offset, offset+length, len(vm.Memory)) // Return error
+	}
+
+	leaves := vm.memoryLeaves() // Get page hashes
+
+	proof := &StateProof{
+		Kind:           StateProofMemory,                 // Set kind
+		Index:          uint32(offset / DefaultPageSize), // Set first page
+		ComponentRoots: vm.componentRoots(),              // Set tree roots
+	} // Init proof
+
+	for page := offset / DefaultPageSize; page <= (offset+length-1)/DefaultPageSize; page++ { // Iterate through pages
+		start := page * DefaultPageSize // Get page offset
+
+		proof.Leaves = append(proof.Leaves, append([]byte(nil), vm.Memory[start:start+DefaultPageSize]...)) // Append page
+		proof.Paths = append(proof.Paths, crypto.MerkleProof(leaves, page))                                 // Append path
+	}
+
+	return proof, nil // Return proof
+}
+
+// ProveGlobal - prove the global with the given index against the current state root
+func (vm *VirtualMachine) ProveGlobal(index int) (*StateProof, error) {
+	if index < 0 || index >= len(vm.Globals) { // Check in bounds
+		return nil, fmt.Errorf("%w: global %d of %d", ErrProofOutOfBounds, index, len(vm.Globals)) // Return error
+	}
+
+	return &StateProof{
+		Kind:           StateProofGlobal,                                                         // Set kind
+		Index:          uint32(index),                                                            // Set global
+		Leaves:         [][]byte{encodeGlobal(vm.Globals[index])},                                // Set value
+		Paths:          [][]crypto.MerkleProofNode{crypto.MerkleProof(vm.globalLeaves(), index)}, // Set path
+		ComponentRoots: vm.componentRoots(),                                                      // Set tree roots
+	}, nil // Return proof
+}
+
+// Verify - check the proof against the given state root
+func (proof *StateProof) Verify(root []byte) error {
+	if len(proof.ComponentRoots) != commitmentComponents || len(proof.Leaves) == 0 || len(proof.Leaves) != len(proof.Paths) { // Check shape
+		return fmt.Errorf("%w: malformed", ErrInvalidStateProof) // Return error
+	}
+
+	if !bytes.Equal(hashStateRoot(proof.ComponentRoots), root) { // Check tree roots
+		return fmt.Errorf("%w: tree roots do not match state root %x", ErrInvalidStateProof, root) // Return error
+	}
+
+	kind, component := leafPage, commitmentMemory // Init leaf kind
+
+	switch proof.Kind { // Handle proof kinds
+	case StateProofMemory:
+	case StateProofGlobal:
+		kind, component = leafGlobal, commitmentGlobals // Set global kind
+	default:
+		return fmt.Errorf("%w: unknown kind %s", ErrInvalidStateProof, proof.Kind) // Return error
+	}
+
+	for i, leaf := range proof.Leaves { // Iterate through leaves
+		index := proof.Index + uint32(i) // Get leaf index
+
+		if !crypto.VerifyMerkleProof(proof.ComponentRoots[component], hashStateLeaf(kind, index, leaf), proof.Paths[i]) { // Verify path
+			return fmt.Errorf("%w: %s %d", ErrInvalidStateProof, proof.Kind, index) // Return error
+		}
+	}
+
+	return nil // Proof is valid
+}
+
+// VerifyMemory - check the proof against the given state root, and that it shows data at offset
+func (proof *StateProof) VerifyMemory(root []byte, offset int, data []byte) error {
+	if err := proof.Verify(root); err != nil { // Verify proof
+		return err // Return found error
+	}
+
+	start := int(proof.Index) * DefaultPageSize // Get proven range start
+
+	if proof.Kind != StateProofMemory || offset < start || offset+len(data) > start+len(proof.Leaves)*DefaultPageSize { // Check proves range
+		return fmt.Errorf("%w: does not cover memory range [%d, %d)", ErrInvalidStateProof, offset, offset+len(data)) // Return error
+	}
+
+	proven := bytes.Join(proof.Leaves, nil) // Get proven memory
+
+	if !bytes.Equal(proven[offset-start:offset-start+len(data)], data) { // Check data
+		return fmt.Errorf("%w: memory at %d does not match", ErrInvalidStateProof, offset) // Return error
+	}
+
+	return nil // Proof is valid
+}
+
+// VerifyGlobal - check the proof against the given state root, and that it shows the global with index has value
+func (proof *StateProof) VerifyGlobal(root []byte, index int, value int64) error {
+	if err := proof.Verify(root); err != nil { // Verify proof
+		return err // Return found error
+	}
+
+	if proof.Kind != StateProofGlobal || int(proof.Index) != index || !bytes.Equal(proof.Leaves[0], encodeGlobal(value)) { // Check proves value
+		return fmt.Errorf("%w: global %d is not %d", ErrInvalidStateProof, index, value) // Return error
+	}
+
+	return nil // Proof is valid
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// componentRoots - get the tree roots of the vm's current state commitment
+func (vm *VirtualMachine) componentRoots() [][]byte {
+	var tableLeaves [][]byte // Init table leaf buffer
+
+	for start := 0; start < len(vm.Table); start += tableChunkSize { // Iterate through chunks
+		end := start + tableChunkSize // Get chunk end
+
+		if end > len(vm.Table) { // Check last chunk
+			end = len(vm.Table) // Clamp
+		}
+
+		chunk := make([]byte, 4*(end-start)) // Init chunk
+
+		for i, element := range vm.Table[start:end] { // Iterate through entries
+			binary.LittleEndian.PutUint32(chunk[4*i:], element) // Encode entry
+		}
+
+		tableLeaves = append(tableLeaves, hashStateLeaf(leafTable, uint32(start/tableChunkSize), chunk)) // Append chunk
+	}
+
+	roots := make([][]byte, commitmentComponents) // Init roots
+
+	roots[commitmentMemory] = crypto.MerkleRoot(vm.memoryLeaves())   // Commit to memory
+	roots[commitmentGlobals] = crypto.MerkleRoot(vm.globalLeaves())  // Commit to globals
+	roots[commitmentTable] = crypto.MerkleRoot(tableLeaves)          // Commit to table
+	roots[commitmentStorage] = crypto.MerkleRoot(vm.storageLeaves()) // Commit to storage
+
+	return roots // Return roots
+}
+
+// memoryLeaves - get the hash of each memory page, rehashing only pages written since they were last hashed
+func (vm *VirtualMachine) memoryLeaves() [][]byte {
+	pages := len(vm.Memory) / DefaultPageSize // Get page count
+
+	if len(vm.pageHashes) > pages { // Check memory replaced
+		vm.pageHashes = nil // Rehash all pages
+	}
+
+	for page := len(vm.pageHashes); page < pages; page++ { // Iterate through unhashed pages
+		vm.pageHashes = append(vm.pageHashes, vm.hashPage(page)) // Hash page
+	}
+
+	for _, page := range vm.DirtyPages() { // Iterate through written pages
+		vm.pageHashes[page] = vm.hashPage(int(page)) // Rehash page
+	}
+
+	return vm.pageHashes // Return hashes
+}
+
+// globalLeaves - get the hash of each global
+func (vm *VirtualMachine) globalLeaves() [][]byte {
+	leaves := make([][]byte, len(vm.Globals)) // Init leaves
+
+	for i, global := range vm.Globals { // Iterate through globals
+		leaves[i] = hashStateLeaf(leafGlobal, uint32(i), encodeGlobal(global)) // Hash global
+	}
+
+	return leaves // Return leaves
+}
+
+// storageLeaves - get the hash of each storage entry, in key order
+func (vm *VirtualMachine) storageLeaves() [][]byte {
+	keys := sortedStorageKeys(vm.Storage) // Get keys
+
+	leaves := make([][]byte, len(keys)) // Init leaves
+
+	for i, key := range keys { // Iterate through entries
+		encoder := &stateEncoder{} // Init encoder
+
+		encoder.string(key)            // Write key
+		encoder.bytes(vm.Storage[key]) // Write value
+
+		leaves[i] = hashStateLeaf(leafStorage, uint32(i), encoder.buffer) // Hash entry
+	}
+
+	return leaves // Return leaves
+}
+
+// hashPage - hash the memory page with the given index
+func (vm *VirtualMachine) hashPage(page int) []byte {
+	start := page * DefaultPageSize // Get page offset
+
+	return hashStateLeaf(leafPage, uint32(page), vm.Memory[start:start+DefaultPageSize]) // Return hash
+}
+
+// hashStateLeaf - hash a state commitment leaf of the given kind and index
+func hashStateLeaf(kind byte, index uint32, data []byte) []byte {
+	buffer := make([]byte, 5, 5+len(data)) // Init buffer
+
+	buffer[0] = kind                               // Set kind
+	binary.BigEndian.PutUint32(buffer[1:5], index) // Set index
+
+	return crypto.HashMerkleLeaf(append(buffer, data...)) // Return hash
+}
+
+// hashStateRoot - hash the tree roots of a state commitment
+func hashStateRoot(roots [][]byte) []byte {
+	return crypto.Sha3(bytes.Join(roots, nil)) // Return root
+}
+
+// encodeGlobal - encode a global value as committed to
+func encodeGlobal(value int64) []byte {
+	encoded := make([]byte, 8) // Init buffer
+
+	binary.LittleEndian.PutUint64(encoded, uint64(value)) // Encode value
+
+	return encoded // Return encoded
+}
+
+/* END INTERNAL METHODS */
@@ -0,0 +1,131 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// TestStateRoot - test the state commitment tracks writes, is saved with each state and is restored on reset
+func TestStateRoot(t *testing.T) {
+	vm := newSnapshotTestVM(t) // Init vm
+
+	initial := vm.StateRoot() // Get initial root
+
+	stateDB, err := vm.StateDatabase() // Get state database
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if !bytes.Equal(stateDB.MerkleRoot, initial) { // Check db commits to root state
+		t.Fatalf("expected db merkle root %x, got %x", initial, stateDB.MerkleRoot) // Panic
+	}
+
+	if _, err := vm.Call("store", I32(DefaultPageSize+16), I32(42)); err != nil { // Write
+		t.Fatal(err) // Panic
+	}
+
+	written := vm.StateRoot() // Get root after write
+
+	if bytes.Equal(written, initial) { // Check root changed
+		t.Fatal("expected the state root to change after a write") // Panic
+	}
+
+	if err := vm.SaveState(); err != nil { // Save state
+		t.Fatal(err) // Panic
+	}
+
+	if !bytes.Equal(vm.StateDB.MerkleRoot, written) || !bytes.Equal(vm.StateDB.WorkingRoot.State.MerkleRoot, written) { // Check saved
+		t.Fatalf("expected saved merkle root %x, got %x", written, vm.StateDB.MerkleRoot) // Panic
+	}
+
+	if err := vm.ResetToState(vm.StateDB.States[0].ID); err != nil { // Reset to root state
+		t.Fatal(err) // Panic
+	}
+
+	if !bytes.Equal(vm.StateRoot(), initial) || !bytes.Equal(vm.StateDB.MerkleRoot, initial) { // Check restored
+		t.Fatalf("expected restored merkle root %x, got %x", initial, vm.StateRoot()) // Panic
+	}
+}
+
+// TestProveMemory - test memory range proofs verify against the state root, and fail for other data
+func TestProveMemory(t *testing.T) {
+	vm := newSnapshotTestVM(t) // Init vm
+
+	offset := 2*DefaultPageSize - 4 // Write across pages 1 and 2
+
+	if _, err := vm.Call("store64", I32(int32(offset)), I64(0x0102030405060708)); err != nil { // Write
+		t.Fatal(err) // Panic
+	}
+
+	if err := vm.SaveState(); err != nil { // Save state
+		t.Fatal(err) // Panic
+	}
+
+	proof, err := vm.ProveMemory(offset, 8) // Prove written range
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if len(proof.Leaves) != 2 { // Check covers both pages
+		t.Fatalf("expected 2 pages, got %d", len(proof.Leaves)) // Panic
+	}
+
+	encoded, _ := json.Marshal(proof) // Encode proof as sent to a light client
+
+	received := &StateProof{} // Init received proof
+
+	if err = json.Unmarshal(encoded, received); err != nil { // Decode proof
+		t.Fatal(err) // Panic
+	}
+
+	data := []byte{8, 7, 6, 5, 4, 3, 2, 1} // Get written bytes
+
+	if err = received.VerifyMemory(vm.StateDB.MerkleRoot, offset, data); err != nil { // Verify proof
+		t.Fatal(err) // Panic
+	}
+
+	data[0] = 9 // Tamper with data
+
+	if err = received.VerifyMemory(vm.StateDB.MerkleRoot, offset, data); !errors.Is(err, ErrInvalidStateProof) { // Check tampered data rejected
+		t.Fatalf("expected %v, got %v", ErrInvalidStateProof, err) // Panic
+	}
+
+	received.Leaves[1][0] = 9 // Tamper with proof
+
+	if err = received.Verify(vm.StateDB.MerkleRoot); !errors.Is(err, ErrInvalidStateProof) { // Check tampered proof rejected
+		t.Fatalf("expected %v, got %v", ErrInvalidStateProof, err) // Panic
+	}
+
+	if _, err = vm.ProveMemory(len(vm.Memory)-4, 8); !errors.Is(err, ErrProofOutOfBounds) { // Check out of bounds
+		t.Fatalf("expected %v, got %v", ErrProofOutOfBounds, err) // Panic
+	}
+}
+
+// TestProveGlobal - test global proofs verify the global's value
+func TestProveGlobal(t *testing.T) {
+	vm := newSnapshotTestVM(t) // Init vm
+
+	if _, err := vm.Call("bump"); err != nil { // Increment global
+		t.Fatal(err) // Panic
+	}
+
+	proof, err := vm.ProveGlobal(0) // Prove global
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	root := vm.StateRoot() // Get root
+
+	if err = proof.VerifyGlobal(root, 0, 8); err != nil { // Verify proof
+		t.Fatal(err) // Panic
+	}
+
+	if err = proof.VerifyGlobal(root, 0, 7); !errors.Is(err, ErrInvalidStateProof) { // Check old value rejected
+		t.Fatalf("expected %v, got %v", ErrInvalidStateProof, err) // Panic
+	}
+}
@@ -0,0 +1,138 @@
+package vm
+
+import (
+	"context"
+	"errors"
+
+	"github.com/SummerCash/ursa/common"
+)
+
+var (
+	// ErrExecutionCanceled - describes an error regarding a run stopped because its context was canceled
+	ErrExecutionCanceled = errors.New("execution canceled")
+
+	// ErrExecutionDeadlineExceeded - describes an error regarding a run stopped because its context deadline passed
+	ErrExecutionDeadlineExceeded = errors.New("execution deadline exceeded")
+)
+
+/* BEGIN EXPORTED METHODS */
+
+// RunContext - run a WebAssembly modules function denoted by its ID with a specified set
+// of parameters, stopping with ErrExecutionCanceled or ErrExecutionDeadlineExceeded once
+// ctx is done. ctx is checked between Execute slices and around host calls.
+// If the VM runs out of gas with ReturnOnGasLimitExceeded set, TrapOutOfGas is returned
+// and the VM is left suspended (see SuspendedOnGas).
+func (vm *VirtualMachine) RunContext(ctx context.Context, entryID int, params ...int64) (int64, error) {
+	if err := contextError(ctx); err != nil { // Check already done
+		return -1, err // Return error
+	}
+
+	vm.Ignite(entryID, params...) // Ignite VM
+
+	return vm.resume(ctx) // Run until exit
+}
+
+// Context - get the context of the current run (for use by host functions)
+func (vm *VirtualMachine) Context() context.Context {
+	if vm.ctx == nil { // Check not inside RunContext
+		return context.Background() // Return empty context
+	}
+
+	return vm.ctx // Return run context
+}
+
+// Reset - abandon any in-progress or trapped execution, leaving memory, table and globals
+// untouched, so the VM can be ignited again
+func (vm *VirtualMachine) Reset() {
+	for i := 0; i <= vm.CurrentFrame && i < len(vm.CallStack); i++ { // Iterate through active frames
+		vm.CallStack[i] = Frame{} // Clear frame
+	}
+
+	vm.CurrentFrame = -1     // Reset call stack
+	vm.entryFrame = 0        // Reset entry frame
+	vm.NumValueSlots = 0     // Reset value slots
+	vm.InsideExecute = false // Reset execute flag
+	vm.Delegate = nil        // Reset delegate
+	vm.Exited = true         // Set exited
+	vm.ExitError = nil       // Reset exit error
+	vm.Yielded = 0           // Reset yielded value
+	vm.Suspended = false     // Reset suspended
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// resume - drive an ignited VM until it exits, ctx is done, or it runs out of gas with
+// ReturnOnGasLimitExceeded set. In the last case TrapOutOfGas is returned, but the VM is
+// left suspended (not exited) so that it can be resumed once its gas limit is raised.
+func (vm *VirtualMachine) resume(ctx context.Context) (int64, error) {
+	previous := vm.ctx // Get context of the enclosing run (set for calls made by host functions)
+
+	vm.ctx = ctx // Set context
+
+	defer func() {
+		vm.ctx = previous // Reset context
+	}()
+
+	for !vm.Exited { // Check not already exited
+		vm.Execute() // Execute
+
+		if vm.GasLimitExceeded && !vm.Exited { // Check paused for gas
+			return -1, TrapOutOfGas // Return error (resumable)
+		}
+
+		if vm.Delegate != nil { // Check for delegate call
+			if err := vm.interrupt(ctx); err != nil { // Check done before host call
+				return -1, err // Return error
+			}
+
+			if err := vm.runDelegate(); err != nil { // Run delegate call
+				return -1, err // Return error
+			}
+
+			if vm.Suspended { // Check host call suspended the run
+				return -1, vm.suspend() // Save state
+			}
+		}
+
+		if !vm.Exited { // Check still running
+			if err := vm.interrupt(ctx); err != nil { // Check done
+				return -1, err // Return error
+			}
+		}
+	}
+
+	if vm.ExitError != nil { // Check for exit error
+		return -1, common.UnifyError(vm.ExitError) // Return error
+	}
+
+	return vm.ReturnValue, nil // Return success
+}
+
+// interrupt - stop execution if ctx is done, recording the interruption as the exit error
+func (vm *VirtualMachine) interrupt(ctx context.Context) error {
+	err := contextError(ctx) // Get context error
+
+	if err != nil { // Check done
+		vm.Delegate = nil  // Drop pending host call
+		vm.Exited = true   // Set exited
+		vm.ExitError = err // Set exit error
+	}
+
+	return err // Return error
+}
+
+// contextError - translate a done context into the matching execution error (nil if not done)
+func contextError(ctx context.Context) error {
+	switch ctx.Err() { // Handle context errors
+	case nil:
+		return nil // Not done
+	case context.DeadlineExceeded:
+		return ErrExecutionDeadlineExceeded // Deadline passed
+	default:
+		return ErrExecutionCanceled // Canceled
+	}
+}
+
+/* END INTERNAL METHODS */
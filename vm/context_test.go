@@ -0,0 +1,113 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// tickResolver - resolves env.tick to a host function invoking onTick
+type tickResolver struct {
+	onTick func(vm *VirtualMachine) // Host callback
+}
+
+// ResolveFunc - resolve env.tick
+func (r *tickResolver) ResolveFunc(module, field string) FunctionImport {
+	return func(vm *VirtualMachine) int64 {
+		if r.onTick != nil { // Check has callback
+			r.onTick(vm) // Run callback
+		}
+
+		return 0 // Return nothing
+	}
+}
+
+// ResolveGlobal - panic
+func (r *tickResolver) ResolveGlobal(module, field string) int64 {
+	panic("global import not allowed") // Panic
+}
+
+// newSpinTestVM - initialize a vm running the spin example module
+func newSpinTestVM(t *testing.T, resolver ImportResolver) *VirtualMachine {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/spin.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	vm, err := NewVirtualMachine(testSourceFile, Environment{}, resolver, nil) // Init vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	return vm // Return vm
+}
+
+// TestRunContextDeadline - test a runaway loop is stopped by its deadline
+func TestRunContextDeadline(t *testing.T) {
+	vm := newSpinTestVM(t, new(tickResolver)) // Init vm
+
+	entryID, _ := vm.GetFunctionExport("spin") // Get entry
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond) // Init deadline
+	defer cancel()                                                                // Release context
+
+	if _, err := vm.RunContext(ctx, entryID); !errors.Is(err, ErrExecutionDeadlineExceeded) { // Run until deadline
+		t.Fatalf("expected %v, got %v", ErrExecutionDeadlineExceeded, err) // Panic
+	}
+
+	if !vm.Exited || vm.ExitError == nil { // Check recorded as exit
+		t.Fatal("expected vm to be exited with an error") // Panic
+	}
+
+	vm.Reset() // Reset vm
+
+	countID, _ := vm.GetFunctionExport("count") // Get function
+
+	ret, err := vm.RunContext(context.Background(), countID, 100000) // Run to completion after reset
+
+	if err != nil || ret != 42 { // Check result
+		t.Fatalf("unexpected result %d (%v)", ret, err) // Panic
+	}
+}
+
+// TestRunContextCancelInHostCall - test cancellation from inside a host call stops execution
+func TestRunContextCancelInHostCall(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background()) // Init context
+
+	ticks := 0 // Init tick count
+
+	vm := newSpinTestVM(t, &tickResolver{onTick: func(vm *VirtualMachine) {
+		ticks++ // Increment ticks
+
+		if vm.Context() != ctx { // Check context visible to host
+			t.Error("host function cannot see run context") // Log error
+		}
+
+		if ticks == 3 { // Check should cancel
+			cancel() // Cancel
+		}
+	}}) // Init vm
+
+	entryID, _ := vm.GetFunctionExport("spin_host") // Get entry
+
+	if _, err := vm.RunContext(ctx, entryID); !errors.Is(err, ErrExecutionCanceled) { // Run until canceled
+		t.Fatalf("expected %v, got %v", ErrExecutionCanceled, err) // Panic
+	}
+
+	if ticks != 3 { // Check stopped immediately
+		t.Fatalf("expected 3 host calls, got %d", ticks) // Panic
+	}
+
+	if vm.Context() != context.Background() { // Check context cleared
+		t.Fatal("run context leaked after return") // Panic
+	}
+
+	if _, err := vm.RunContext(ctx, entryID); !errors.Is(err, ErrExecutionCanceled) { // Check canceled context refused up front
+		t.Fatalf("expected %v, got %v", ErrExecutionCanceled, err) // Panic
+	}
+}
@@ -0,0 +1,377 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/SummerCash/ursa/common"
+	"github.com/SummerCash/wagon/wasm"
+)
+
+// StateDiff - changes between two saved states
+type StateDiff struct {
+	From []byte `json:"from"` // ID of the entry diffed from
+	To   []byte `json:"to"`   // ID of the entry diffed to
+
+	MemorySizeBefore int            `json:"memory_size_before"` // Memory size of the first state
+	MemorySizeAfter  int            `json:"memory_size_after"`  // Memory size of the second state
+	Memory           []MemoryChange `json:"memory"`             // Changed memory ranges, in address order
+
+	Globals []GlobalChange `json:"globals"` // Changed globals, in index order
+	Table   []TableChange  `json:"table"`   // Changed table entries, in index order
+
+	Storage []StorageChange `json:"storage"` // Changed storage entries, in key order
+
+	GasDelta int64 `json:"gas_delta"` // Gas used by the second state less gas used by the first
+
+	ReturnValueBefore int64 `json:"return_value_before"` // Return value of the first state
+	ReturnValueAfter  int64 `json:"return_value_after"`  // Return value of the second state
+
+	ExitStatusBefore string `json:"exit_status_before"` // Exit status of the first state
+	ExitStatusAfter  string `json:"exit_status_after"`  // Exit status of the second state
+}
+
+// MemoryChange - range of memory changed between two states (bytes beyond a state's memory read as zero)
+type MemoryChange struct {
+	Offset int `json:"offset"` // Range start
+
+	Before []byte `json:"before"` // Range contents in the first state
+	After  []byte `json:"after"`  // Range contents in the second state
+}
+
+// GlobalChange - global changed between two states
+type GlobalChange struct {
+	Index int    `json:"index"` // Global index
+	Name  string `json:"name"`  // Export name ("" if not exported)
+
+	Before int64 `json:"before"` // Value in the first state
+	After  int64 `json:"after"`  // Value in the second state
+}
+
+// TableChange - table entry changed between two states
+type TableChange struct {
+	Index int `json:"index"` // Entry index
+
+	Before *uint32 `json:"before"` // Value in the first state (nil if the table was smaller)
+	After  *uint32 `json:"after"`  // Value in the second state (nil if the table was smaller)
+}
+
+// StorageChange - storage entry changed between two states
+type StorageChange struct {
+	Key []byte `json:"key"` // Entry key
+
+	Before []byte `json:"before"` // Value in the first state (nil if not found)
+	After  []byte `json:"after"`  // Value in the second state (nil if not found)
+
+	Created bool `json:"created"` // Key not found in the first state
+	Deleted bool `json:"deleted"` // Key not found in the second state
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// Diff - get the changes between the saved states with the given IDs
+func (vm *VirtualMachine) Diff(from []byte, to []byte) (*StateDiff, error) {
+	stateDB, err := vm.StateDatabase() // Get state database
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	fromEntry, err := stateDB.QueryState(from) // Query first state
+
+	if err != nil { // Check for errors
+		return nil, fmt.Errorf("%w: %x", err, from) // Return found error
+	}
+
+	toEntry, err := stateDB.QueryState(to) // Query second state
+
+	if err != nil { // Check for errors
+		return nil, fmt.Errorf("%w: %x", err, to) // Return found error
+	}
+
+	before, err := stateDB.ReconstructMemory(fromEntry) // Rebuild first memory
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	after, err := stateDB.ReconstructMemory(toEntry) // Rebuild second memory
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	fromState, toState := fromEntry.State, toEntry.State // Get states
+
+	diff := &StateDiff{
+		From:              fromEntry.ID,                                      // Set first ID
+		To:                toEntry.ID,                                        // Set second ID
+		MemorySizeBefore:  len(before),                                       // Set first memory size
+		MemorySizeAfter:   len(after),                                        // Set second memory size
+		Memory:            diffMemory(before, after),                         // Diff memory
+		Table:             diffTable(fromState.Table, toState.Table),         // Diff table
+		Storage:           diffStorage(fromState.Storage, toState.Storage),   // Diff storage
+		GasDelta:          int64(toState.Gas) - int64(fromState.Gas),         // Set gas delta
+		ReturnValueBefore: fromState.ReturnValue,                             // Set first return value
+		ReturnValueAfter:  toState.ReturnValue,                               // Set second return value
+		ExitStatusBefore:  exitStatus(fromState.Exited, fromState.ExitError), // Set first exit status
+		ExitStatusAfter:   exitStatus(toState.Exited, toState.ExitError),     // Set second exit status
+	} // Init diff
+
+	names := vm.globalExportNames() // Get global export names
+
+	for i := 0; i < len(fromState.Globals) || i < len(toState.Globals); i++ { // Iterate through globals
+		var beforeValue, afterValue int64 // Init values
+
+		if i < len(fromState.Globals) { // Check in first state
+			beforeValue = fromState.Globals[i] // Set value
+		}
+
+		if i < len(toState.Globals) { // Check in second state
+			afterValue = toState.Globals[i] // Set value
+		}
+
+		if beforeValue != afterValue { // Check changed
+			diff.Globals = append(diff.Globals, GlobalChange{Index: i, Name: names[i], Before: beforeValue, After: afterValue}) // Append change
+		}
+	}
+
+	return diff, nil // Return diff
+}
+
+// IsEmpty - check the diffed states are identical in memory, globals, table, storage, gas, return value and exit status
+func (diff *StateDiff) IsEmpty() bool {
+	return diff.MemorySizeBefore == diff.MemorySizeAfter && len(diff.Memory) == 0 && len(diff.Globals) == 0 && len(diff.Table) == 0 && len(diff.Storage) == 0 &&
+		diff.GasDelta == 0 && diff.ReturnValueBefore == diff.ReturnValueAfter && diff.ExitStatusBefore == diff.ExitStatusAfter // Return is empty
+}
+
+/*
+	BEGIN TYPE HELPERS
+*/
+
+// String - get a human-readable representation of diff, with memory in hex
+func (diff *StateDiff) String() string {
+	var builder strings.Builder // Init builder
+
+	fmt.Fprintf(&builder, "--- %x\n+++ %x\n", diff.From, diff.To) // Write IDs
+
+	if diff.MemorySizeBefore != diff.MemorySizeAfter { // Check memory resized
+		fmt.Fprintf(&builder, "memory size: %d -> %d bytes\n", diff.MemorySizeBefore, diff.MemorySizeAfter) // Write size
+	}
+
+	for _, change := range diff.Memory { // Iterate through memory changes
+		fmt.Fprintf(&builder, "memory [0x%08x, 0x%08x): %s -> %s\n", change.Offset, change.Offset+len(change.After), hex.EncodeToString(change.Before), hex.EncodeToString(change.After)) // Write change
+	}
+
+	for _, change := range diff.Globals { // Iterate through global changes
+		name := "" // Init name
+
+		if change.Name != "" { // Check exported
+			name = fmt.Sprintf(" (%s)", change.Name) // Set name
+		}
+
+		fmt.Fprintf(&builder, "global %d%s: %d -> %d\n", change.Index, name, change.Before, change.After) // Write change
+	}
+
+	for _, change := range diff.Table { // Iterate through table changes
+		fmt.Fprintf(&builder, "table %d: %s -> %s\n", change.Index, formatTableEntry(change.Before), formatTableEntry(change.After)) // Write change
+	}
+
+	for _, change := range diff.Storage { // Iterate through storage changes
+		before, after := hex.EncodeToString(change.Before), hex.EncodeToString(change.After) // Encode values
+
+		if change.Created { // Check created
+			before = "none" // No value
+		}
+
+		if change.Deleted { // Check deleted
+			after = "none" // No value
+		}
+
+		fmt.Fprintf(&builder, "storage %x: %s -> %s\n", change.Key, before, after) // Write change
+	}
+
+	if diff.GasDelta != 0 { // Check gas used
+		fmt.Fprintf(&builder, "gas: %+d\n", diff.GasDelta) // Write gas delta
+	}
+
+	if diff.ReturnValueBefore != diff.ReturnValueAfter { // Check return value changed
+		fmt.Fprintf(&builder, "return value: %d -> %d\n", diff.ReturnValueBefore, diff.ReturnValueAfter) // Write return value
+	}
+
+	if diff.ExitStatusBefore != diff.ExitStatusAfter { // Check exit status changed
+		fmt.Fprintf(&builder, "exit status: %s -> %s\n", diff.ExitStatusBefore, diff.ExitStatusAfter) // Write exit status
+	}
+
+	return builder.String() // Return string
+}
+
+// Bytes - get JSON representation of diff (memory as base64)
+func (diff *StateDiff) Bytes() []byte {
+	marshaledVal, _ := json.MarshalIndent(*diff, "", "  ") // Marshal JSON
+
+	return marshaledVal // Return success
+}
+
+/*
+	END TYPE HELPERS
+*/
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// globalExportNames - get the export name of each exported global, by index
+func (vm *VirtualMachine) globalExportNames() map[int]string {
+	names := make(map[int]string) // Init names
+
+	if vm.Module == nil || vm.Module.Base == nil || vm.Module.Base.Export == nil { // Check no exports
+		return names // Return no names
+	}
+
+	for name, entry := range vm.Module.Base.Export.Entries { // Iterate through exports
+		if entry.Kind == wasm.ExternalGlobal { // Check is global
+			names[int(entry.Index)] = name // Set name
+		}
+	}
+
+	return names // Return names
+}
+
+// diffMemory - get the ranges of memory that differ, comparing page by page (bytes beyond a memory read as zero)
+func diffMemory(before []byte, after []byte) []MemoryChange {
+	var changes []MemoryChange // Init change buffer
+
+	size := len(before) // Init compared size
+
+	if len(after) > size { // Check second memory larger
+		size = len(after) // Set size
+	}
+
+	padded := func(memory []byte, start int, end int) []byte {
+		page := make([]byte, end-start) // Init page
+
+		if start < len(memory) { // Check in memory
+			copy(page, memory[start:]) // Copy contents
+		}
+
+		return page // Return page
+	}
+
+	for start := 0; start < size; start += DefaultPageSize { // Iterate through pages
+		end := start + DefaultPageSize // Get page end
+
+		if end > size { // Check last page
+			end = size // Clamp
+		}
+
+		beforePage, afterPage := padded(before, start, end), padded(after, start, end) // Get pages
+
+		if bytes.Equal(beforePage, afterPage) { // Check page unchanged
+			continue // Skip
+		}
+
+		for i := 0; i < len(beforePage); i++ { // Iterate through bytes
+			if beforePage[i] == afterPage[i] { // Check unchanged
+				continue // Skip
+			}
+
+			run := i // Init run end
+
+			for run < len(beforePage) && beforePage[run] != afterPage[run] { // Iterate through changed bytes
+				run++ // Extend run
+			}
+
+			if count := len(changes); count > 0 && changes[count-1].Offset+len(changes[count-1].After) == start+i { // Check continues previous page's run
+				changes[count-1].Before = append(changes[count-1].Before, beforePage[i:run]...) // Extend before
+				changes[count-1].After = append(changes[count-1].After, afterPage[i:run]...)    // Extend after
+			} else {
+				changes = append(changes, MemoryChange{Offset: start + i, Before: beforePage[i:run], After: afterPage[i:run]}) // Append change
+			}
+
+			i = run // Skip run
+		}
+	}
+
+	return changes // Return changes
+}
+
+// diffTable - get the table entries that differ
+func diffTable(before []uint32, after []uint32) []TableChange {
+	var changes []TableChange // Init change buffer
+
+	for i := 0; i < len(before) || i < len(after); i++ { // Iterate through entries
+		change := TableChange{Index: i} // Init change
+
+		if i < len(before) { // Check in first table
+			value := before[i]     // Copy value
+			change.Before = &value // Set value
+		}
+
+		if i < len(after) { // Check in second table
+			value := after[i]     // Copy value
+			change.After = &value // Set value
+		}
+
+		if change.Before == nil || change.After == nil || *change.Before != *change.After { // Check changed
+			changes = append(changes, change) // Append change
+		}
+	}
+
+	return changes // Return changes
+}
+
+// diffStorage - get the storage entries that differ
+func diffStorage(before map[string][]byte, after map[string][]byte) []StorageChange {
+	var changes []StorageChange // Init change buffer
+
+	keys := sortedStorageKeys(before) // Get first keys
+
+	for key := range after { // Iterate through second keys
+		if _, ok := before[key]; !ok { // Check created
+			keys = append(keys, key) // Append key
+		}
+	}
+
+	sort.Strings(keys) // Sort keys
+
+	for _, key := range keys { // Iterate through keys
+		beforeValue, existed := before[key] // Get first value
+		afterValue, exists := after[key]    // Get second value
+
+		if existed && exists && bytes.Equal(beforeValue, afterValue) { // Check unchanged
+			continue // Skip
+		}
+
+		changes = append(changes, StorageChange{Key: []byte(key), Before: beforeValue, After: afterValue, Created: !existed, Deleted: !exists}) // Append change
+	}
+
+	return changes // Return changes
+}
+
+// exitStatus - describe whether a state has exited, and with what error
+func exitStatus(exited bool, exitError interface{}) string {
+	switch {
+	case exitError != nil:
+		return "error: " + common.UnifyError(exitError).Error() // Return error
+	case exited:
+		return "exited" // Return exited
+	default:
+		return "running" // Return running
+	}
+}
+
+// formatTableEntry - format a table entry that may be absent
+func formatTableEntry(entry *uint32) string {
+	if entry == nil { // Check absent
+		return "none" // Return absent
+	}
+
+	return fmt.Sprint(*entry) // Return value
+}
+
+/* END INTERNAL METHODS */
@@ -0,0 +1,70 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestDiff - test diffs report changed memory ranges, globals by export name and return values
+func TestDiff(t *testing.T) {
+	vm := newSnapshotTestVM(t) // Init vm
+
+	stateDB, err := vm.StateDatabase() // Get state database
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	from := stateDB.WorkingRoot // Get root
+
+	if _, err := vm.Call("store", I32(DefaultPageSize-2), I32(0x04030201)); err != nil { // Write across pages 0 and 1
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := vm.Call("store", I32(100), I32(0xff)); err != nil { // Write page 0
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := vm.Call("grow", I32(1)); err != nil { // Grow memory
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := vm.Call("bump"); err != nil { // Bump counter
+		t.Fatal(err) // Panic
+	}
+
+	if err := vm.SaveState(); err != nil { // Save state
+		t.Fatal(err) // Panic
+	}
+
+	diff, err := vm.Diff(from.ID, vm.StateDB.WorkingRoot.ID) // Diff states
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if diff.MemorySizeBefore != 4*DefaultPageSize || diff.MemorySizeAfter != 5*DefaultPageSize { // Check memory size
+		t.Fatalf("expected memory to grow by a page, got %d -> %d", diff.MemorySizeBefore, diff.MemorySizeAfter) // Panic
+	}
+
+	if len(diff.Memory) != 2 || diff.Memory[0].Offset != 100 || diff.Memory[1].Offset != DefaultPageSize-2 || !bytes.Equal(diff.Memory[1].After, []byte{1, 2, 3, 4}) || !bytes.Equal(diff.Memory[1].Before, make([]byte, 4)) { // Check memory ranges (the write spanning pages is one range)
+		t.Fatalf("unexpected memory changes %v", diff.Memory) // Panic
+	}
+
+	if len(diff.Globals) != 1 || diff.Globals[0].Name != "counter" || diff.Globals[0].Before != 7 || diff.Globals[0].After != 8 { // Check global
+		t.Fatalf("unexpected global changes %v", diff.Globals) // Panic
+	}
+
+	if diff.ReturnValueAfter != 8 || len(diff.Table) != 0 { // Check return value
+		t.Fatalf("expected return value 8, got %d", diff.ReturnValueAfter) // Panic
+	}
+
+	if output := diff.String(); !strings.Contains(output, "00000000 -> 01020304") || !strings.Contains(output, "global 0 (counter): 7 -> 8") { // Check hex output
+		t.Fatalf("unexpected diff output:\n%s", output) // Panic
+	}
+
+	if empty, _ := vm.Diff(from.ID, from.ID); !empty.IsEmpty() { // Check identical states
+		t.Fatalf("expected empty diff, got:\n%s", empty) // Panic
+	}
+}
@@ -0,0 +1,743 @@
+package vm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/SummerCash/ursa/common"
+	"github.com/SummerCash/ursa/crypto"
+)
+
+const (
+	// StateEncodingVersion - version of the canonical binary encoding of states, state entries and state databases
+	StateEncodingVersion = 3
+)
+
+const (
+	// exitErrorUnknown - code of an exit error that is neither a trap nor an interrupted run
+	exitErrorUnknown = iota
+
+	// exitErrorTrap - code of a trap
+	exitErrorTrap
+
+	// exitErrorCanceled - code of ErrExecutionCanceled
+	exitErrorCanceled
+
+	// exitErrorDeadlineExceeded - code of ErrExecutionDeadlineExceeded
+	exitErrorDeadlineExceeded
+)
+
+var (
+	// ErrUnsupportedStateEncoding - describes an error regarding an encoded state of an unknown encoding version
+	ErrUnsupportedStateEncoding = errors.New("unsupported state encoding version")
+
+	// ErrMalformedStateEncoding - describes an error regarding an encoded state that is truncated or not canonical
+	ErrMalformedStateEncoding = errors.New("malformed state encoding")
+
+	// ErrExecutionFailed - describes an error regarding a decoded state that exited with an error other than a trap or an interrupted run
+	ErrExecutionFailed = errors.New("execution failed")
+)
+
+// exitErrorRecord - canonical form of an exit error. Only stable codes are kept: error messages (a
+// trap's cause included) may change between Go versions and host implementations, and would change state IDs
+type exitErrorRecord struct {
+	Code         uint8    // Exit error code (see exitErrorTrap)
+	Kind         TrapKind // Trap kind
+	FunctionID   int      // Trap function ID
+	FunctionName string   // Trap function name
+	Offset       int      // Trap offset
+}
+
+// stateRecord - encoded state entry with its parent, as persisted
+type stateRecord struct {
+	ParentID []byte      // Parent entry ID (nil for the root)
+	Entry    *StateEntry // Entry
+}
+
+// stateEncoder - appends fixed-width big endian and length-prefixed values to a buffer
+type stateEncoder struct {
+	buffer []byte // Encoded bytes
+}
+
+// stateDecoder - reads values written by a stateEncoder, recording the first error
+type stateDecoder struct {
+	data []byte // Remaining bytes
+	err  error  // First error
+
+	lastPage uint32 // Index of the last page read (pages must be in ascending order)
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// StateFromBytes - decode a state from its canonical encoding (see State.Bytes)
+func StateFromBytes(b []byte) (*State, error) {
+	decoder := &stateDecoder{data: b} // Init decoder
+
+	state := decoder.state() // Decode state
+
+	return state, decoder.finish() // Return state
+}
+
+// StateEntryFromBytes - decode a state entry from its canonical encoding (see StateEntry.Bytes)
+func StateEntryFromBytes(b []byte) (*StateEntry, error) {
+	decoder := &stateDecoder{data: b} // Init decoder
+
+	entry := decoder.entry() // Decode entry
+
+	return entry, decoder.finish() // Return entry
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// encodeState - canonically encode a state. Frames above the current frame, the code of
+// each frame (reattached from the module by function ID when restored), the state's
+// children and its ID (the hash of this encoding) are not encoded.
+func encodeState(state *State) []byte {
+	encoder := &stateEncoder{} // Init encoder
+
+	encoder.uint8(StateEncodingVersion) // Write version
+
+	active := state.CurrentFrame + 1 // Get active frame count
+
+	if active > len(state.CallStack) { // Check frame out of range
+		active = len(state.CallStack) // Clamp
+	}
+
+	if active < 0 { // Check no frames
+		active = 0 // Clamp
+	}
+
+	encoder.uint32(uint32(len(state.CallStack))) // Write call stack size
+	encoder.int64(int64(state.CurrentFrame))     // Write current frame
+
+	for _, frame := range state.CallStack[:active] { // Iterate through active frames
+		encoder.int64(int64(frame.FunctionID))     // Write function ID
+		encoder.int64s(frame.Regs)                 // Write regs
+		encoder.int64s(frame.Locals)               // Write locals
+		encoder.int64(int64(frame.IP))             // Write IP
+		encoder.int64(int64(frame.ReturnReg))      // Write return reg
+		encoder.uint32(uint32(frame.Continuation)) // Write continuation
+	}
+
+	encoder.uint32(uint32(len(state.Table))) // Write table size
+
+	for _, element := range state.Table { // Iterate through table
+		encoder.uint32(element) // Write element
+	}
+
+	encoder.int64s(state.Globals) // Write globals
+
+	encoder.bool(state.Memory != nil) // Write is full snapshot
+
+	if state.Memory != nil { // Check full snapshot
+		encoder.bytes(state.Memory) // Write memory
+	}
+
+	encoder.uint64(uint64(state.MemorySize)) // Write memory size
+
+	pages := make([]uint32, 0, len(state.Pages)) // Init page index buffer
+
+	for page := range state.Pages { // Iterate through pages
+		pages = append(pages, page) // Append index
+	}
+
+	sort.Slice(pages, func(i, j int) bool { return pages[i] < pages[j] }) // Sort pages
+
+	encoder.uint32(uint32(len(pages))) // Write page count
+
+	for _, page := range pages { // Iterate through pages
+		encoder.uint32(page)             // Write index
+		encoder.bytes(state.Pages[page]) // Write page
+	}
+
+	encoder.int64(int64(state.NumValueSlots)) // Write value slots
+	encoder.int64(state.Yielded)              // Write yielded
+	encoder.bool(state.InsideExecute)         // Write inside execute
+	encoder.bool(state.Exited)                // Write exited
+
+	exitError := newExitErrorRecord(state.ExitError) // Get exit error
+
+	encoder.bool(exitError != nil) // Write has exit error
+
+	if exitError != nil { // Check has exit error
+		encoder.uint8(exitError.Code)              // Write code
+		encoder.int64(int64(exitError.Kind))       // Write kind
+		encoder.int64(int64(exitError.FunctionID)) // Write function ID
+		encoder.string(exitError.FunctionName)     // Write function name
+		encoder.int64(int64(exitError.Offset))     // Write offset
+	}
+
+	encoder.int64(state.ReturnValue)     // Write return value
+	encoder.uint64(state.Gas)            // Write gas
+	encoder.bool(state.GasLimitExceeded) // Write gas limit exceeded
+	encoder.bool(state.Suspended)        // Write suspended
+
+	keys := sortedStorageKeys(state.Storage) // Get storage keys
+
+	encoder.uint32(uint32(len(keys))) // Write storage size
+
+	for _, key := range keys { // Iterate through storage
+		encoder.string(key)               // Write key
+		encoder.bytes(state.Storage[key]) // Write value
+	}
+
+	encoder.bytes(state.MerkleRoot) // Write merkle root
+
+	return encoder.buffer // Return encoded
+}
+
+// encodeEntry - canonically encode a state entry (its nonce and state; the entry's ID is the hash of this encoding)
+func encodeEntry(entry *StateEntry) []byte {
+	encoder := &stateEncoder{} // Init encoder
+
+	encoder.uint8(StateEncodingVersion) // Write version
+	encoder.uint64(entry.Nonce)         // Write nonce
+	encoder.bool(entry.State != nil)    // Write has state
+
+	if entry.State != nil { // Check has state
+		encoder.bytes(encodeState(entry.State)) // Write state
+	}
+
+	return encoder.buffer // Return encoded
+}
+
+// encodeRecord - canonically encode a state entry with its parent
+func encodeRecord(entry *StateEntry, parent *StateEntry) []byte {
+	encoder := &stateEncoder{} // Init encoder
+
+	encoder.uint8(StateEncodingVersion) // Write version
+
+	if parent != nil { // Check has parent
+		encoder.bytes(parent.ID) // Write parent ID
+	} else {
+		encoder.bytes(nil) // Write no parent
+	}
+
+	encoder.bytes(encodeEntry(entry)) // Write entry
+
+	return encoder.buffer // Return encoded
+}
+
+// encodeHeader - canonically encode a state database's fields (entries are encoded separately)
+func encodeHeader(stateDB *StateDatabase) []byte {
+	encoder := &stateEncoder{} // Init encoder
+
+	encoder.uint8(StateEncodingVersion) // Write version
+	encoder.bytes(stateDB.ID)           // Write ID
+	encoder.bytes(stateDB.MerkleRoot)   // Write merkle root
+
+	for _, root := range []*StateEntry{stateDB.StateRoot, stateDB.WorkingRoot} { // Iterate through roots
+		if root != nil { // Check has root
+			encoder.bytes(root.ID) // Write root ID
+		} else {
+			encoder.bytes(nil) // Write no root
+		}
+	}
+
+	encoder.string(stateDB.Branch) // Write checked out branch
+
+	names := make([]string, 0, len(stateDB.Labels)) // Init label name buffer
+
+	for name := range stateDB.Labels { // Iterate through labels
+		names = append(names, name) // Append name
+	}
+
+	sort.Strings(names) // Sort names
+
+	encoder.uint32(uint32(len(names))) // Write label count
+
+	for _, name := range names { // Iterate through labels
+		encoder.string(name)                        // Write name
+		encoder.bytes(stateDB.Labels[name].ID)      // Write entry ID
+		encoder.bool(stateDB.Labels[name].IsBranch) // Write is branch
+	}
+
+	return encoder.buffer // Return encoded
+}
+
+// encodeStateDB - canonically encode a state database with all of its entries
+func encodeStateDB(stateDB *StateDatabase) []byte {
+	encoder := &stateEncoder{} // Init encoder
+
+	encoder.uint8(StateEncodingVersion)     // Write version
+	encoder.bytes(encodeHeader(stateDB))    // Write header
+	encoder.bool(stateDB.baseMemory != nil) // Write has base memory
+
+	if stateDB.baseMemory != nil { // Check has base memory
+		encoder.bytes(stateDB.baseMemory) // Write base memory
+	}
+
+	parents := stateDB.parents() // Get parents
+
+	encoder.uint32(uint32(len(stateDB.States))) // Write entry count
+
+	for _, entry := range stateDB.States { // Iterate through entries
+		encoder.bytes(encodeRecord(entry, parents[string(entry.ID)])) // Write entry
+	}
+
+	return encoder.buffer // Return encoded
+}
+
+// decodeStateDB - decode a state database encoded by encodeStateDB
+func decodeStateDB(b []byte) (*StateDatabase, error) {
+	decoder := &stateDecoder{data: b} // Init decoder
+
+	decoder.version() // Read version
+
+	header := &stateDecoder{data: decoder.bytes()}         // Init header decoder
+	stateDB, stateRootID, workingRootID := header.header() // Read header
+
+	if err := header.finish(); err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	if decoder.bool() { // Check has base memory
+		stateDB.baseMemory = append([]byte{}, decoder.bytes()...) // Read base memory
+	}
+
+	records := make([]*stateRecord, decoder.count(4)) // Init records
+
+	for i := range records { // Iterate through records
+		nested := &stateDecoder{data: decoder.bytes()} // Init record decoder
+
+		records[i] = nested.record() // Read record
+
+		if err := nested.finish(); err != nil { // Check for errors
+			return nil, err // Return found error
+		}
+	}
+
+	if err := decoder.finish(); err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	if err := stateDB.assemble(stateRootID, workingRootID, records); err != nil { // Link entries
+		return nil, err // Return found error
+	}
+
+	return stateDB, nil // Return decoded db
+}
+
+// newExitErrorRecord - convert an exit error to its canonical form (nil if none)
+func newExitErrorRecord(exitError interface{}) *exitErrorRecord {
+	if exitError == nil { // Check no error
+		return nil // Nothing to encode
+	}
+
+	err := common.UnifyError(exitError) // Get error
+
+	var trap *Trap // Init trap
+
+	switch { // Handle known errors
+	case errors.As(err, &trap):
+		return &exitErrorRecord{Code: exitErrorTrap, Kind: trap.Kind, FunctionID: trap.FunctionID, FunctionName: trap.FunctionName, Offset: trap.Offset} // Return trap
+	case errors.Is(err, ErrExecutionCanceled):
+		return &exitErrorRecord{Code: exitErrorCanceled} // Return canceled
+	case errors.Is(err, ErrExecutionDeadlineExceeded):
+		return &exitErrorRecord{Code: exitErrorDeadlineExceeded} // Return deadline exceeded
+	}
+
+	return &exitErrorRecord{Code: exitErrorUnknown} // Return unknown
+}
+
+// toError - convert a canonical exit error back to an error (nil if none). A trap's cause is not
+// recorded, so decoded traps have a nil Err
+func (record *exitErrorRecord) toError() interface{} {
+	if record == nil { // Check no error
+		return nil // No error
+	}
+
+	switch record.Code { // Handle codes
+	case exitErrorTrap:
+		return &Trap{Kind: record.Kind, FunctionID: record.FunctionID, FunctionName: record.FunctionName, Offset: record.Offset} // Return trap
+	case exitErrorCanceled:
+		return ErrExecutionCanceled // Return canceled
+	case exitErrorDeadlineExceeded:
+		return ErrExecutionDeadlineExceeded // Return deadline exceeded
+	}
+
+	return ErrExecutionFailed // Return unknown
+}
+
+// state - decode a state, setting its ID to the hash of its encoding
+func (decoder *stateDecoder) state() *State {
+	start := decoder.data // Get encoding start
+
+	decoder.version() // Read version
+
+	state := &State{} // Init state
+
+	size := int(decoder.uint32())             // Read call stack size
+	state.CurrentFrame = int(decoder.int64()) // Read current frame
+
+	active := state.CurrentFrame + 1 // Get active frame count
+
+	if active < 0 { // Check no frames
+		active = 0 // Clamp
+	}
+
+	if active > size || size > DefaultCallStackSize*64 { // Check frame in range
+		decoder.fail("current frame %d of %d", state.CurrentFrame, size) // Fail
+	}
+
+	if decoder.err != nil { // Check for errors
+		return nil // Return nothing
+	}
+
+	state.CallStack = make([]Frame, size) // Init call stack
+
+	for i := 0; i < active && decoder.err == nil; i++ { // Iterate through active frames
+		frame := &state.CallStack[i] // Get frame
+
+		frame.FunctionID = int(decoder.int64())      // Read function ID
+		frame.Regs = decoder.int64s()                // Read regs
+		frame.Locals = decoder.int64s()              // Read locals
+		frame.IP = int(decoder.int64())              // Read IP
+		frame.ReturnReg = int(decoder.int64())       // Read return reg
+		frame.Continuation = int32(decoder.uint32()) // Read continuation
+	}
+
+	state.Table = make([]uint32, decoder.count(4)) // Init table
+
+	for i := range state.Table { // Iterate through table
+		state.Table[i] = decoder.uint32() // Read element
+	}
+
+	state.Globals = decoder.int64s() // Read globals
+
+	if decoder.bool() { // Check full snapshot
+		state.Memory = decoder.bytes() // Read memory
+
+		if state.Memory == nil { // Check empty memory
+			state.Memory = []byte{} // Keep full snapshot
+		}
+	}
+
+	state.MemorySize = int(decoder.uint64()) // Read memory size
+
+	pages := decoder.count(8) // Read page count
+
+	if pages > 0 { // Check has pages
+		state.Pages = make(map[uint32][]byte, pages) // Init pages
+	}
+
+	for i := 0; i < pages && decoder.err == nil; i++ { // Iterate through pages
+		page := decoder.uint32() // Read index
+
+		if _, ok := state.Pages[page]; ok || (i > 0 && page < decoder.lastPage) { // Check ascending
+			decoder.fail("page %d out of order", page) // Fail
+		}
+
+		decoder.lastPage = page             // Set last page
+		state.Pages[page] = decoder.bytes() // Read page
+	}
+
+	state.NumValueSlots = int(decoder.int64()) // Read value slots
+	state.Yielded = decoder.int64()            // Read yielded
+	state.InsideExecute = decoder.bool()       // Read inside execute
+	state.Exited = decoder.bool()              // Read exited
+
+	if decoder.bool() { // Check has exit error
+		record := &exitErrorRecord{} // Init record
+
+		record.Code = decoder.uint8()            // Read code
+		record.Kind = TrapKind(decoder.int64())  // Read kind
+		record.FunctionID = int(decoder.int64()) // Read function ID
+		record.FunctionName = decoder.string()   // Read function name
+		record.Offset = int(decoder.int64())     // Read offset
+
+		if record.Code > exitErrorDeadlineExceeded || (record.Code != exitErrorTrap && (record.Kind != 0 || record.FunctionID != 0 || record.FunctionName != "" || record.Offset != 0)) { // Check canonical
+			decoder.fail("exit error code %d", record.Code) // Fail
+		}
+
+		state.ExitError = record.toError() // Set exit error
+	}
+
+	state.ReturnValue = decoder.int64()     // Read return value
+	state.Gas = decoder.uint64()            // Read gas
+	state.GasLimitExceeded = decoder.bool() // Read gas limit exceeded
+	state.Suspended = decoder.bool()        // Read suspended
+
+	entries := decoder.count(8) // Read storage size
+
+	if entries > 0 { // Check has storage
+		state.Storage = make(map[string][]byte, entries) // Init storage
+	}
+
+	previous := "" // Init previous key
+
+	for i := 0; i < entries && decoder.err == nil; i++ { // Iterate through storage
+		key := decoder.string() // Read key
+
+		if i > 0 && key <= previous { // Check ascending
+			decoder.fail("storage key %x out of order", key) // Fail
+		}
+
+		previous = key                                            // Set previous key
+		state.Storage[key] = append([]byte{}, decoder.bytes()...) // Read value
+	}
+
+	state.MerkleRoot = decoder.bytes() // Read merkle root
+
+	if decoder.err != nil { // Check for errors
+		return nil // Return nothing
+	}
+
+	state.ID = crypto.Sha3(start[:len(start)-len(decoder.data)]) // Hash encoding
+
+	return state // Return state
+}
+
+// entry - decode a state entry, setting its ID to the hash of its encoding
+func (decoder *stateDecoder) entry() *StateEntry {
+	start := decoder.data // Get encoding start
+
+	decoder.version() // Read version
+
+	entry := &StateEntry{Nonce: decoder.uint64()} // Init entry
+
+	if decoder.bool() { // Check has state
+		nested := &stateDecoder{data: decoder.bytes()} // Init state decoder
+
+		entry.State = nested.state() // Read state
+
+		if err := nested.finish(); err != nil && decoder.err == nil { // Check for errors
+			decoder.err = err // Set error
+		}
+	}
+
+	if decoder.err != nil { // Check for errors
+		return nil // Return nothing
+	}
+
+	entry.ID = crypto.Sha3(start[:len(start)-len(decoder.data)]) // Hash encoding
+
+	return entry // Return entry
+}
+
+// record - decode a state entry with its parent
+func (decoder *stateDecoder) record() *stateRecord {
+	decoder.version() // Read version
+
+	record := &stateRecord{ParentID: decoder.bytes()} // Init record
+
+	nested := &stateDecoder{data: decoder.bytes()} // Init entry decoder
+
+	record.Entry = nested.entry() // Read entry
+
+	if err := nested.finish(); err != nil && decoder.err == nil { // Check for errors
+		decoder.err = err // Set error
+	}
+
+	return record // Return record
+}
+
+// header - decode a state database's fields, returning the IDs of its roots
+func (decoder *stateDecoder) header() (stateDB *StateDatabase, stateRootID []byte, workingRootID []byte) {
+	decoder.version() // Read version
+
+	stateDB = &StateDatabase{} // Init state db
+
+	stateDB.ID = decoder.bytes()         // Read ID
+	stateDB.MerkleRoot = decoder.bytes() // Read merkle root
+	stateRootID = decoder.bytes()        // Read root ID
+	workingRootID = decoder.bytes()      // Read working root ID
+	stateDB.Branch = decoder.string()    // Read checked out branch
+
+	labels := decoder.count(9) // Read label count
+
+	if labels > 0 { // Check has labels
+		stateDB.Labels = make(map[string]*StateLabel, labels) // Init labels
+	}
+
+	previous := "" // Init previous name
+
+	for i := 0; i < labels && decoder.err == nil; i++ { // Iterate through labels
+		name := decoder.string() // Read name
+
+		if i > 0 && name <= previous { // Check ascending
+			decoder.fail("label %s out of order", name) // Fail
+		}
+
+		previous = name                                                                   // Set previous name
+		stateDB.Labels[name] = &StateLabel{ID: decoder.bytes(), IsBranch: decoder.bool()} // Read label
+	}
+
+	return stateDB, stateRootID, workingRootID // Return db and root IDs
+}
+
+// uint8 - write a byte
+func (encoder *stateEncoder) uint8(value uint8) {
+	encoder.buffer = append(encoder.buffer, value) // Append value
+}
+
+// bool - write a bool as a single 0 or 1 byte
+func (encoder *stateEncoder) bool(value bool) {
+	if value { // Check true
+		encoder.uint8(1) // Write true
+	} else {
+		encoder.uint8(0) // Write false
+	}
+}
+
+// uint32 - write a big endian uint32
+func (encoder *stateEncoder) uint32(value uint32) {
+	var buffer [4]byte // Init buffer
+
+	binary.BigEndian.PutUint32(buffer[:], value)          // Encode value
+	encoder.buffer = append(encoder.buffer, buffer[:]...) // Append value
+}
+
+// uint64 - write a big endian uint64
+func (encoder *stateEncoder) uint64(value uint64) {
+	var buffer [8]byte // Init buffer
+
+	binary.BigEndian.PutUint64(buffer[:], value)          // Encode value
+	encoder.buffer = append(encoder.buffer, buffer[:]...) // Append value
+}
+
+// int64 - write a big endian two's complement int64
+func (encoder *stateEncoder) int64(value int64) {
+	encoder.uint64(uint64(value)) // Write value
+}
+
+// int64s - write a length-prefixed int64 slice
+func (encoder *stateEncoder) int64s(values []int64) {
+	encoder.uint32(uint32(len(values))) // Write length
+
+	for _, value := range values { // Iterate through values
+		encoder.int64(value) // Write value
+	}
+}
+
+// bytes - write a length-prefixed byte slice
+func (encoder *stateEncoder) bytes(value []byte) {
+	encoder.uint32(uint32(len(value)))                // Write length
+	encoder.buffer = append(encoder.buffer, value...) // Append value
+}
+
+// string - write a length-prefixed string
+func (encoder *stateEncoder) string(value string) {
+	encoder.bytes([]byte(value)) // Write value
+}
+
+// fail - record a malformed encoding error (keeping the first)
+func (decoder *stateDecoder) fail(format string, args ...interface{}) {
+	if decoder.err == nil { // Check no error yet
+		decoder.err = fmt.Errorf("%w: "+format, append([]interface{}{ErrMalformedStateEncoding}, args...)...) // Set error
+	}
+
+	decoder.data = nil // Stop reading
+}
+
+// take - read the next n bytes
+func (decoder *stateDecoder) take(n int) []byte {
+	if decoder.err != nil || n < 0 || n > len(decoder.data) { // Check enough data
+		decoder.fail("truncated") // Fail
+
+		return make([]byte, 8) // Return zeroes
+	}
+
+	value := decoder.data[:n]       // Get value
+	decoder.data = decoder.data[n:] // Advance
+
+	return value // Return value
+}
+
+// version - read and check the encoding version
+func (decoder *stateDecoder) version() {
+	if version := decoder.uint8(); version != StateEncodingVersion && decoder.err == nil { // Check version
+		decoder.err = fmt.Errorf("%w: %d", ErrUnsupportedStateEncoding, version) // Set error
+		decoder.data = nil                                                       // Stop reading
+	}
+}
+
+// uint8 - read a byte
+func (decoder *stateDecoder) uint8() uint8 {
+	return decoder.take(1)[0] // Return value
+}
+
+// bool - read a bool, which must be encoded as 0 or 1
+func (decoder *stateDecoder) bool() bool {
+	value := decoder.uint8() // Read value
+
+	if value > 1 { // Check canonical
+		decoder.fail("bool %d", value) // Fail
+	}
+
+	return value == 1 // Return value
+}
+
+// uint32 - read a big endian uint32
+func (decoder *stateDecoder) uint32() uint32 {
+	return binary.BigEndian.Uint32(decoder.take(4)) // Return value
+}
+
+// uint64 - read a big endian uint64
+func (decoder *stateDecoder) uint64() uint64 {
+	return binary.BigEndian.Uint64(decoder.take(8)) // Return value
+}
+
+// int64 - read a big endian two's complement int64
+func (decoder *stateDecoder) int64() int64 {
+	return int64(decoder.uint64()) // Return value
+}
+
+// count - read a length prefix, checking enough data remains for that many elements of at least minSize bytes
+func (decoder *stateDecoder) count(minSize int) int {
+	count := int(decoder.uint32()) // Read count
+
+	if decoder.err == nil && minSize > 0 && count > len(decoder.data)/minSize { // Check enough data
+		decoder.fail("%d elements in %d bytes", count, len(decoder.data)) // Fail
+
+		return 0 // Return nothing
+	}
+
+	if decoder.err != nil { // Check for errors
+		return 0 // Return nothing
+	}
+
+	return count // Return count
+}
+
+// int64s - read a length-prefixed int64 slice
+func (decoder *stateDecoder) int64s() []int64 {
+	values := make([]int64, decoder.count(8)) // Init values
+
+	for i := range values { // Iterate through values
+		values[i] = decoder.int64() // Read value
+	}
+
+	return values // Return values
+}
+
+// bytes - read a length-prefixed byte slice (nil if empty)
+func (decoder *stateDecoder) bytes() []byte {
+	length := decoder.count(1) // Read length
+
+	if length == 0 { // Check empty
+		return nil // Return nothing
+	}
+
+	return append([]byte(nil), decoder.take(length)...) // Return copy
+}
+
+// string - read a length-prefixed string
+func (decoder *stateDecoder) string() string {
+	return string(decoder.bytes()) // Return value
+}
+
+// finish - check the whole encoding was read, returning the first error
+func (decoder *stateDecoder) finish() error {
+	if decoder.err == nil && len(decoder.data) != 0 { // Check trailing data
+		decoder.fail("%d trailing bytes", len(decoder.data)) // Fail
+	}
+
+	return decoder.err // Return error
+}
+
+/* END INTERNAL METHODS */
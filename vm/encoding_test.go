@@ -0,0 +1,236 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// newEncodingTestState - initialize a state using every encoded field
+func newEncodingTestState() *State {
+	callStack := make([]Frame, 4) // Init call stack
+
+	callStack[0] = Frame{FunctionID: 2, Code: []byte{1, 2, 3}, Regs: []int64{-1, 7}, Locals: []int64{9}, IP: 12, ReturnReg: 1, Continuation: 3} // Set active frame
+	callStack[2] = Frame{FunctionID: 5, Regs: []int64{4}}                                                                                       // Set stale frame (not encoded)
+
+	return &State{
+		CallStack:    callStack,                                // Set call stack
+		CurrentFrame: 0,                                        // Set current frame
+		Table:        []uint32{0xffffffff, 1},                  // Set table
+		Globals:      []int64{-3, 1 << 40},                     // Set globals
+		MemorySize:   3 * DefaultPageSize,                      // Set memory size
+		Pages:        map[uint32][]byte{2: {5}, 0: {1, 2}},     // Set pages
+		Yielded:      4,                                        // Set yielded
+		Exited:       true,                                     // Set exited
+		ExitError:    &Trap{Kind: TrapUnreachable, Offset: 17}, // Set exit error
+		ReturnValue:  -9,                                       // Set return value
+		Gas:          1000,                                     // Set gas
+		MerkleRoot:   []byte{0xaa, 0xbb},                       // Set merkle root
+	} // Init state
+}
+
+// TestStateFromBytes - test a state survives a canonical encoding round trip with the same ID
+func TestStateFromBytes(t *testing.T) {
+	state := newEncodingTestState()  // Init state
+	entry := newStateEntry(state, 3) // Init entry
+
+	decoded, err := StateFromBytes(state.Bytes()) // Decode state
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if !bytes.Equal(decoded.Bytes(), state.Bytes()) || !bytes.Equal(decoded.ID, state.ID) { // Check round trip
+		t.Fatalf("expected state %x, got %x", state.ID, decoded.ID) // Panic
+	}
+
+	if trap, ok := decoded.ExitError.(*Trap); !ok || trap.Kind != TrapUnreachable || trap.Offset != 17 { // Check exit error
+		t.Fatalf("unexpected exit error %v", decoded.ExitError) // Panic
+	}
+
+	if decoded.CallStack[0].Regs[0] != -1 || decoded.CallStack[2].Regs != nil || len(decoded.CallStack) != 4 { // Check frames
+		t.Fatalf("unexpected call stack %v", decoded.CallStack) // Panic
+	}
+
+	if decoded.CallStack[0].Code != nil || decoded.CallStack[0].FunctionID != 2 { // Check frame code not encoded
+		t.Fatalf("expected only the function ID of frame code to be encoded, got %v", decoded.CallStack[0]) // Panic
+	}
+
+	decodedEntry, err := StateEntryFromBytes(entry.Bytes()) // Decode entry
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if !bytes.Equal(decodedEntry.ID, entry.ID) || decodedEntry.Nonce != 3 { // Check round trip
+		t.Fatalf("expected entry %x, got %x", entry.ID, decodedEntry.ID) // Panic
+	}
+}
+
+// TestExitErrorEncoding - test exit errors are encoded by a stable code, not by their message text
+func TestExitErrorEncoding(t *testing.T) {
+	state := newEncodingTestState()                                                          // Init state
+	state.ExitError = &Trap{Kind: TrapHostError, Offset: 17, Err: errors.New("host failed")} // Set trap with cause
+
+	other := newEncodingTestState()                                                           // Init state
+	other.ExitError = &Trap{Kind: TrapHostError, Offset: 17, Err: errors.New("host failed!")} // Set trap with another cause
+
+	if !bytes.Equal(state.Bytes(), other.Bytes()) { // Check cause not encoded
+		t.Fatal("expected trap causes not to be encoded") // Panic
+	}
+
+	for _, exitError := range []interface{}{ErrExecutionCanceled, ErrExecutionDeadlineExceeded, errors.New("failed"), "failed"} { // Iterate through non-trap errors
+		state.ExitError = exitError // Set exit error
+
+		decoded, err := StateFromBytes(state.Bytes()) // Decode state
+
+		if err != nil { // Check for errors
+			t.Fatal(err) // Panic
+		}
+
+		expected := ErrExecutionFailed // Init expected error
+
+		if err, ok := exitError.(error); ok && (err == ErrExecutionCanceled || err == ErrExecutionDeadlineExceeded) { // Check interrupted run
+			expected = err // Keep error
+		}
+
+		if decoded.ExitError != expected { // Check exit error
+			t.Fatalf("expected %v, got %v", expected, decoded.ExitError) // Panic
+		}
+	}
+}
+
+// TestStateIDsDeterministic - test the same execution on two vms yields byte-identical states
+func TestStateIDsDeterministic(t *testing.T) {
+	var ids [][]byte // Init ID buffer
+
+	for i := 0; i < 2; i++ { // Run twice
+		vm := newSnapshotTestVM(t) // Init vm
+
+		if _, err := vm.Call("store", I32(64), I32(5)); err != nil { // Write
+			t.Fatal(err) // Panic
+		}
+
+		if _, err := vm.Call("bump"); err != nil { // Increment global
+			t.Fatal(err) // Panic
+		}
+
+		if err := vm.SaveState(); err != nil { // Save state
+			t.Fatal(err) // Panic
+		}
+
+		ids = append(ids, vm.StateDB.WorkingRoot.ID) // Append ID
+	}
+
+	if !bytes.Equal(ids[0], ids[1]) { // Check identical
+		t.Fatalf("expected identical state IDs, got %x and %x", ids[0], ids[1]) // Panic
+	}
+}
+
+// TestStateDatabaseRoundTrip - test a state database survives a canonical encoding round trip
+func TestStateDatabaseRoundTrip(t *testing.T) {
+	vm := newSnapshotTestVM(t) // Init vm
+
+	for i := 0; i < 3; i++ { // Save states
+		if _, err := vm.Call("store", I32(int32(i*DefaultPageSize)), I32(int32(i))); err != nil { // Write
+			t.Fatal(err) // Panic
+		}
+
+		if err := vm.SaveState(); err != nil { // Save state
+			t.Fatal(err) // Panic
+		}
+	}
+
+	if err := vm.StateDB.CreateBranch("main", vm.StateDB.WorkingRoot.ID); err != nil { // Label working root
+		t.Fatal(err) // Panic
+	}
+
+	if err := vm.StateDB.Label("genesis", vm.StateDB.StateRoot.ID); err != nil { // Label root
+		t.Fatal(err) // Panic
+	}
+
+	encoded := vm.StateDB.Bytes() // Encode db
+
+	stateDB, err := StateDatabaseFromBytes(encoded) // Decode db
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if !bytes.Equal(stateDB.Bytes(), encoded) { // Check round trip
+		t.Fatal("expected re-encoded state database to match") // Panic
+	}
+
+	if len(stateDB.States) != 4 || !bytes.Equal(stateDB.WorkingRoot.ID, vm.StateDB.WorkingRoot.ID) || len(stateDB.StateRoot.State.StateChildren) != 1 { // Check tree
+		t.Fatalf("unexpected state database with %d states", len(stateDB.States)) // Panic
+	}
+
+	if entry, err := stateDB.Resolve("genesis"); err != nil || entry != stateDB.StateRoot || !stateDB.Labels["main"].IsBranch { // Check labels
+		t.Fatalf("expected labels to survive round trip (%v)", err) // Panic
+	}
+}
+
+// TestRestoreFrameCode - test restored frames run the code of their function, and states calling unknown functions are rejected
+func TestRestoreFrameCode(t *testing.T) {
+	vm := newSnapshotTestVM(t) // Init vm
+
+	stateDB, err := vm.StateDatabase() // Get state database
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	workingRoot := stateDB.WorkingRoot // Get working root
+
+	state := *workingRoot.State                           // Copy state
+	state.CallStack = []Frame{{FunctionID: 1, IP: 4}, {}} // Set call stack
+	state.CurrentFrame = 0                                // Set current frame
+
+	decoded, err := StateFromBytes(state.Bytes()) // Round trip state
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	decoded.Memory = state.Memory // Keep full snapshot
+
+	if err := vm.restoreState(&StateEntry{State: decoded}); err != nil { // Restore state
+		t.Fatal(err) // Panic
+	}
+
+	if frame := vm.CallStack[0]; !bytes.Equal(frame.Code, vm.FunctionCode[1].Bytes) || frame.IP != 4 { // Check code reattached
+		t.Fatalf("expected frame to run function 1, got %v", frame) // Panic
+	}
+
+	decoded.CallStack[0].FunctionID = len(vm.FunctionCode) // Set unknown function
+
+	if err := vm.restoreState(&StateEntry{State: decoded}); !errors.Is(err, ErrMalformedStateEncoding) { // Restore state
+		t.Fatalf("expected %v, got %v", ErrMalformedStateEncoding, err) // Panic
+	}
+}
+
+// TestMalformedStateEncoding - test truncated, non-canonical and unknown version encodings are rejected
+func TestMalformedStateEncoding(t *testing.T) {
+	encoded := newEncodingTestState().Bytes() // Encode state
+
+	if _, err := StateFromBytes(encoded[:len(encoded)-1]); !errors.Is(err, ErrMalformedStateEncoding) { // Check truncated
+		t.Fatalf("expected %v, got %v", ErrMalformedStateEncoding, err) // Panic
+	}
+
+	if _, err := StateFromBytes(append(encoded, 0)); !errors.Is(err, ErrMalformedStateEncoding) { // Check trailing data
+		t.Fatalf("expected %v, got %v", ErrMalformedStateEncoding, err) // Panic
+	}
+
+	nonCanonical := append([]byte(nil), encoded...) // Copy encoding
+	nonCanonical[len(nonCanonical)-2-4-1] = 2       // Encode gas limit exceeded (before the merkle root and its length) as 2
+
+	if _, err := StateFromBytes(nonCanonical); !errors.Is(err, ErrMalformedStateEncoding) { // Check non-canonical bool
+		t.Fatalf("expected %v, got %v", ErrMalformedStateEncoding, err) // Panic
+	}
+
+	encoded[0] = StateEncodingVersion + 1 // Set unknown version
+
+	if _, err := StateFromBytes(encoded); !errors.Is(err, ErrUnsupportedStateEncoding) { // Check version
+		t.Fatalf("expected %v, got %v", ErrUnsupportedStateEncoding, err) // Panic
+	}
+}
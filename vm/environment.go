@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 
 	"github.com/SummerCash/ursa/common"
+	"github.com/SummerCash/ursa/compiler"
 )
 
 // Environment - VM config, vars
@@ -21,7 +22,18 @@ type Environment struct {
 	DefaultMemoryPages int `json:"defaultMemPages"`  // Default num mem pages at given time
 	DefaultTableSize   int `json:"defaultTableSize"` // Preset table size
 
-	GasLimit uint64 `json:"gasLimit"` // Gas limit
+	GasLimit uint64             `json:"gasLimit"`           // Gas limit
+	GasTable *compiler.GasTable `json:"gasTable,omitempty"` // Per-op gas costs (used when no gas policy is given to NewVirtualMachine)
+
+	GasPerMemoryPage  uint64 `json:"gasPerMemPage"`     // Gas charged per page added by grow_memory
+	GasPerStorageByte uint64 `json:"gasPerStorageByte"` // Gas charged per key and value byte read or written through the storage host module
+
+	StateStore     string `json:"stateStore"`     // State database store ("file" or "memory"; defaults to "file")
+	StateStorePath string `json:"stateStorePath"` // Directory of file state stores (defaults to DataDir/state)
+	StateKey       string `json:"stateKey"`       // Key naming the instance's state database, along with the module (see StateDatabaseID; a random ID if empty)
+
+	CodeCache     bool   `json:"codeCache"`     // Cache compiled interpreter code on disk, so repeat loads of a module skip compilation
+	CodeCachePath string `json:"codeCachePath"` // Directory of cached code (defaults to DataDir/code)
 
 	DisableFloatingPoint     bool `json:"disableFloat"`      // Remove float capacity
 	ReturnOnGasLimitExceeded bool `json:"returnOnGasExceed"` // Panic on exceed specified gas limit
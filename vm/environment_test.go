@@ -1,6 +1,12 @@
 package vm
 
-import "testing"
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/SummerCash/ursa/compiler"
+)
 
 // TestNewEnvironment - test functionality of environment initializer
 func TestNewEnvironment(t *testing.T) {
@@ -98,3 +104,42 @@ func TestReadEnvironmentFromMemory(t *testing.T) {
 	t.Log(err) // Log nil error to force code coverage
 	t.Log(env) // Log success
 }
+
+// TestEnvironmentGasTable - test a gas table embedded in an environment meters execution
+func TestEnvironmentGasTable(t *testing.T) {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/spin.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	env := &Environment{GasTable: compiler.NewGasTable(1)} // Init env
+
+	env, err = EnvironmentFromBytes(env.Bytes()) // Round trip env
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	gasUsed := make([]uint64, 2) // Init gas buffer
+
+	for i := range gasUsed { // Iterate through costs
+		env.GasTable.Default = int64(i + 1) // Set cost
+
+		vm, err := NewVirtualMachine(testSourceFile, *env, new(tickResolver), nil) // Init vm metered by env
+
+		if err != nil { // Check for errors
+			t.Fatal(err) // Panic
+		}
+
+		if _, err := vm.Call("count", I32(10)); err != nil { // Run
+			t.Fatal(err) // Panic
+		}
+
+		gasUsed[i] = vm.Gas // Set gas used
+	}
+
+	if gasUsed[0] == 0 || gasUsed[1] != 2*gasUsed[0] { // Check metered by table
+		t.Fatalf("unexpected gas usage %v", gasUsed) // Panic
+	}
+}
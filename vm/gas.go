@@ -0,0 +1,109 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"math"
+)
+
+/* BEGIN EXPORTED METHODS */
+
+// ChargeGas - charge gas for work done by a host function (e.g. per byte hashed or logged).
+// Panics with TrapOutOfGas once the gas limit is exceeded, which ends the host call and
+// surfaces as an out-of-gas trap from Run. Host calls cannot be resumed part way through,
+// so this traps even when ReturnOnGasLimitExceeded is set.
+func (vm *VirtualMachine) ChargeGas(amount uint64) {
+	if !vm.AddAndCheckGas(amount) { // Check gas limit exceeded
+		vm.GasLimitExceeded = true // Set gas limit exceeded
+
+		panic(TrapOutOfGas) // Panic
+	}
+}
+
+// GasRemaining - get the gas left before the gas limit is reached
+// (math.MaxUint64 - Gas if there is no limit)
+func (vm *VirtualMachine) GasRemaining() uint64 {
+	if vm.Environment.GasLimit == 0 { // Check unlimited
+		return math.MaxUint64 - vm.Gas // Only bounded by overflow
+	}
+
+	if vm.Gas >= vm.Environment.GasLimit { // Check exhausted
+		return 0 // Nothing left
+	}
+
+	return vm.Environment.GasLimit - vm.Gas // Return remaining gas
+}
+
+// SuspendedOnGas - check whether the last run stopped on running out of gas with
+// ReturnOnGasLimitExceeded set, and can be resumed
+func (vm *VirtualMachine) SuspendedOnGas() bool {
+	return vm.GasLimitExceeded && !vm.Exited && vm.CurrentFrame != -1 // Return suspended
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// chargeMemoryGrowth - charge gas for adding the given number of memory pages.
+// Returns false if the gas limit was exceeded and the VM should return to its caller.
+func (vm *VirtualMachine) chargeMemoryGrowth(pages int) bool {
+	if vm.Environment.GasPerMemoryPage == 0 || pages == 0 { // Check free
+		return true // Nothing to charge
+	}
+
+	cost := uint64(pages) * vm.Environment.GasPerMemoryPage // Calculate cost
+
+	if cost/vm.Environment.GasPerMemoryPage != uint64(pages) { // Check for overflow
+		panic(TrapOutOfGas) // Panic
+	}
+
+	return vm.AddAndCheckGas(cost) // Charge cost
+}
+
+// runMetered - resume an ignited vm with a budget of limit gas (0 for no limit), never
+// exceeding the environment's gas limit, and restoring the environment's gas limit afterwards.
+//
+// A run trapped for running out of gas reports the rejected charge as used. A suspended
+// run does not, since the rejected charge is made again once the run is resumed.
+func (vm *VirtualMachine) runMetered(limit uint64) (*RunResult, error) {
+	startGas := vm.Gas                  // Get gas used before this call
+	gasLimit := vm.Environment.GasLimit // Get environment gas limit
+
+	if limit != 0 { // Check has budget
+		budget := startGas + limit // Calculate budget
+
+		if budget < startGas { // Check for overflow
+			budget = math.MaxUint64 // Set max budget
+		}
+
+		if gasLimit == 0 || budget < gasLimit { // Check budget is stricter
+			vm.Environment.GasLimit = budget // Set budget
+		}
+	}
+
+	vm.deniedGas = 0 // Reset denied charge
+
+	ret, err := vm.resume(context.Background()) // Run
+
+	result := &RunResult{
+		ReturnValue:  ret,                 // Set return value
+		GasUsed:      vm.Gas - startGas,   // Set gas used
+		GasRemaining: vm.GasRemaining(),   // Set gas remaining
+		OutOfGas:     vm.SuspendedOnGas(), // Set suspended
+	}
+
+	vm.Environment.GasLimit = gasLimit // Restore gas limit
+
+	if result.OutOfGas { // Check suspended
+		return result, nil // Return resumable result
+	}
+
+	if errors.Is(err, TrapOutOfGas) { // Check trapped for gas
+		result.GasUsed += vm.deniedGas // Count rejected charge
+		result.GasRemaining = 0        // Nothing left
+	}
+
+	return result, err // Return result
+}
+
+/* END INTERNAL METHODS */
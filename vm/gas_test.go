@@ -0,0 +1,230 @@
+package vm
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/SummerCash/ursa/compiler"
+)
+
+// workResolver - resolves env.work to a host function charging gasPerUnit per unit of work
+type workResolver struct {
+	gasPerUnit uint64 // Gas per unit of work
+}
+
+// ResolveFunc - resolve env.work
+func (r *workResolver) ResolveFunc(module, field string) FunctionImport {
+	return func(vm *VirtualMachine) int64 {
+		vm.ChargeGas(uint64(vm.GetCurrentFrame().Locals[0]) * r.gasPerUnit) // Charge for work
+
+		return 0 // Return nothing
+	}
+}
+
+// ResolveGlobal - panic
+func (r *workResolver) ResolveGlobal(module, field string) int64 {
+	panic("global import not allowed") // Panic
+}
+
+// newGasTestVM - initialize a vm running the gas example module
+func newGasTestVM(t *testing.T, env Environment) *VirtualMachine {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/gas.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	vm, err := NewVirtualMachine(testSourceFile, env, &workResolver{gasPerUnit: 10}, nil) // Init vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	return vm // Return vm
+}
+
+// TestMemoryGrowthGas - test grow_memory is charged per page added
+func TestMemoryGrowthGas(t *testing.T) {
+	vm := newGasTestVM(t, Environment{GasPerMemoryPage: 100}) // Init vm
+
+	if _, err := vm.Call("grow", I32(3)); err != nil { // Grow by 3 pages
+		t.Fatal(err) // Panic
+	}
+
+	if vm.Gas != 300 { // Check charged per page
+		t.Fatalf("expected 300 gas, got %d", vm.Gas) // Panic
+	}
+
+	vm = newGasTestVM(t, Environment{GasPerMemoryPage: 100, GasLimit: 250}) // Init limited vm
+
+	if _, err := vm.Call("grow", I32(3)); !errors.Is(err, TrapOutOfGas) { // Grow past limit
+		t.Fatalf("expected %v, got %v", TrapOutOfGas, err) // Panic
+	}
+
+	if len(vm.Memory) != DefaultPageSize { // Check memory not grown
+		t.Fatalf("expected 1 page, got %d bytes", len(vm.Memory)) // Panic
+	}
+}
+
+// TestChargeGas - test host functions can charge gas and run out of it
+func TestChargeGas(t *testing.T) {
+	vm := newGasTestVM(t, Environment{GasLimit: 100}) // Init vm
+
+	if _, err := vm.Call("work", I32(5)); err != nil { // Do 5 units of work
+		t.Fatal(err) // Panic
+	}
+
+	if vm.Gas != 50 || vm.GasRemaining() != 50 { // Check charged
+		t.Fatalf("expected 50 gas used and 50 remaining, got %d and %d", vm.Gas, vm.GasRemaining()) // Panic
+	}
+
+	_, err := vm.Call("work", I32(20)) // Do 20 units of work
+
+	if !errors.Is(err, TrapOutOfGas) || errors.Is(err, TrapHostError) { // Check out of gas
+		t.Fatalf("expected %v, got %v", TrapOutOfGas, err) // Panic
+	}
+}
+
+// newMeteredSpinTestVM - initialize a vm running the spin example module, charging 1 gas per instruction
+func newMeteredSpinTestVM(t *testing.T, env Environment) *VirtualMachine {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/spin.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	vm, err := NewVirtualMachine(testSourceFile, env, new(tickResolver), &compiler.SimpleGasPolicy{GasPerInstruction: 1}) // Init metered vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	return vm // Return vm
+}
+
+// TestRunWithGasLimit - test a run is metered against the given budget
+func TestRunWithGasLimit(t *testing.T) {
+	vm := newMeteredSpinTestVM(t, Environment{}) // Init vm
+
+	entryID, _ := vm.GetFunctionExport("count") // Get entry
+
+	result, err := vm.RunWithGasLimit(entryID, 100000, 100) // Run with plenty of gas
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if result.ReturnValue != 42 || result.GasUsed == 0 || result.GasUsed+result.GasRemaining != 100000 || result.OutOfGas { // Check result
+		t.Fatalf("unexpected result %+v", result) // Panic
+	}
+
+	if vm.Environment.GasLimit != 0 { // Check environment limit restored
+		t.Fatalf("expected gas limit to be restored, got %d", vm.Environment.GasLimit) // Panic
+	}
+
+	vm = newMeteredSpinTestVM(t, Environment{}) // Init vm
+
+	result, err = vm.RunWithGasLimit(entryID, 100, 100) // Run with too little gas
+
+	if !errors.Is(err, TrapOutOfGas) || result.GasUsed <= 100 || result.GasUsed != vm.Gas+vm.deniedGas || result.GasRemaining != 0 { // Check out of gas, counting the rejected charge
+		t.Fatalf("expected %v past budget, got %v (%+v)", TrapOutOfGas, err, result) // Panic
+	}
+
+	for _, limit := range []uint64{0, 100000} { // Run without budget and with a looser budget
+		vm = newMeteredSpinTestVM(t, Environment{GasLimit: 100}) // Init vm limited by environment
+
+		result, err = vm.RunWithGasLimit(entryID, limit, 100) // Run
+
+		if !errors.Is(err, TrapOutOfGas) || vm.Gas > 100 || result.GasRemaining != 0 { // Check environment limit applied
+			t.Fatalf("expected %v within environment limit for budget %d, got %v (%+v)", TrapOutOfGas, limit, err, result) // Panic
+		}
+
+		if vm.Environment.GasLimit != 100 { // Check environment limit restored
+			t.Fatalf("expected gas limit 100 to be restored, got %d", vm.Environment.GasLimit) // Panic
+		}
+	}
+
+	vm = newGasTestVM(t, Environment{}) // Init vm charging from a host function
+
+	entryID, _ = vm.GetFunctionExport("work") // Get entry
+
+	result, err = vm.RunWithGasLimit(entryID, 100, 5) // Do 5 units of work
+
+	if err != nil || result.GasUsed != 50 || result.GasRemaining != 50 { // Check charged
+		t.Fatalf("expected 50 gas used and 50 remaining, got %v (%+v)", err, result) // Panic
+	}
+
+	result, err = vm.RunWithGasLimit(entryID, 100, 20) // Do 20 units of work
+
+	if !errors.Is(err, TrapOutOfGas) || result.GasUsed != 200 || result.GasRemaining != 0 { // Check rejected charge counted
+		t.Fatalf("expected %v using 200 gas, got %v (%+v)", TrapOutOfGas, err, result) // Panic
+	}
+}
+
+// TestResumeWithGasLimit - test a run suspended on gas can be resumed to completion
+func TestResumeWithGasLimit(t *testing.T) {
+	vm := newMeteredSpinTestVM(t, Environment{}) // Init vm
+
+	entryID, _ := vm.GetFunctionExport("count") // Get entry
+
+	unlimited, err := vm.RunWithGasLimit(entryID, 0, 100) // Run without limit
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	vm = newMeteredSpinTestVM(t, Environment{ReturnOnGasLimitExceeded: true}) // Init resumable vm
+
+	if _, err := vm.ResumeWithGasLimit(100); !errors.Is(err, ErrNotSuspended) { // Check cannot resume idle vm
+		t.Fatalf("expected %v, got %v", ErrNotSuspended, err) // Panic
+	}
+
+	result, err := vm.RunWithGasLimit(entryID, 100, 100) // Run with too little gas
+	gasUsed := result.GasUsed                            // Init gas used
+
+	for i := 0; result.OutOfGas; i++ { // Resume until finished
+		if err != nil || i > 100 { // Check for errors
+			t.Fatalf("unexpected error %v after %d resumes", err, i) // Panic
+		}
+
+		result, err = vm.ResumeWithGasLimit(100) // Resume with more gas
+		gasUsed += result.GasUsed                // Add gas used
+	}
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if result.ReturnValue != 42 || gasUsed != unlimited.GasUsed { // Check same outcome as unlimited run
+		t.Fatalf("expected 42 using %d gas, got %d using %d gas", unlimited.GasUsed, result.ReturnValue, gasUsed) // Panic
+	}
+}
+
+// TestSimpleGasPolicyTotals - test the simple gas policy charges what it charged before gas tables were added (jumps are free)
+func TestSimpleGasPolicyTotals(t *testing.T) {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/fib.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	vm, err := NewVirtualMachine(testSourceFile, Environment{}, new(NopResolver), &compiler.SimpleGasPolicy{GasPerInstruction: 1}) // Init vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	entryID, _ := vm.GetFunctionExport("fib") // Get fib func
+
+	result, err := vm.RunWithGasLimit(entryID, 1000000, 20) // Compute fib(20)
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if result.ReturnValue != 6765 || result.GasUsed != 147827 { // Check total
+		t.Fatalf("expected fib(20) = 6765 for 147827 gas, got %d for %d gas", result.ReturnValue, result.GasUsed) // Panic
+	}
+}
@@ -1,14 +1,26 @@
 package vm
 
 import (
+	"context"
 	"errors"
 	"fmt"
-
-	"github.com/SummerCash/ursa/common"
 )
 
 var _ ImportResolver = (*NopResolver)(nil)
 
+// ErrNotSuspended - describes an error regarding an attempt to resume a vm that is not suspended on gas
+var ErrNotSuspended = errors.New("vm is not suspended on gas")
+
+// RunResult - outcome of a metered run
+type RunResult struct {
+	ReturnValue int64 `json:"return_value"` // Value returned by the entry function (-1 unless finished)
+
+	GasUsed      uint64 `json:"gas_used"`      // Gas used by this call
+	GasRemaining uint64 `json:"gas_remaining"` // Gas left of this call's budget
+
+	OutOfGas bool `json:"out_of_gas"` // Suspended on running out of gas (resumable with ResumeWithGasLimit)
+}
+
 // NopResolver - nil WebAssembly module import resolver.
 type NopResolver struct{}
 
@@ -27,57 +39,6 @@ func (r *NopResolver) ResolveGlobal(module, field string) int64 {
 	panic("global import not allowed") // Panic
 }
 
-// RunWithGasLimit - run a WebAssembly modules function denoted by its ID with a specified set
-// of parameters for a specified amount of instructions (also known as gas) denoted by `limit`
-func (vm *VirtualMachine) RunWithGasLimit(entryID, limit int, params ...int64) (int64, error) {
-	count := 0 // Init count buffer
-
-	vm.Ignite(entryID, params...) // Ignite vm
-
-	for !vm.Exited { // Do until vm exits
-		vm.Execute() // Execute
-
-		if vm.Delegate != nil { // Check for delegate call
-			vm.Delegate()     // Run delegate call
-			vm.Delegate = nil // Delgate run, set to nil
-		}
-
-		count++ // Iterate
-
-		if count >= limit { // Check gas limit exceeded
-			return -1, errors.New("gas limit exceeded") // Return error
-		}
-	}
-
-	if vm.ExitError != nil { // Check for errors
-		return -1, common.UnifyError(vm.ExitError) // Return error
-	}
-
-	return vm.ReturnValue, nil // Return success
-}
-
-// Run runs a WebAssembly modules function denoted by its ID with a specified set
-// of parameters.
-// Panics on logical errors.
-func (vm *VirtualMachine) Run(entryID int, params ...int64) (int64, error) {
-	vm.Ignite(entryID, params...) // Ignite VM
-
-	for !vm.Exited { // Check not already exited
-		vm.Execute() // Execute
-
-		if vm.Delegate != nil { // Check for errors
-			vm.Delegate()     // Run delegate call
-			vm.Delegate = nil // Delegate run, set to nil
-		}
-	}
-
-	if vm.ExitError != nil { // Check for exit error
-		return -1, common.UnifyError(vm.ExitError) // Panic/return err
-	}
-
-	return vm.ReturnValue, nil // Return success
-}
-
 // ResolveFunc - define a set of import functions that may be called within a WebAssembly module
 func (r *Resolver) ResolveFunc(module, field string) FunctionImport {
 	//fmt.Printf("Resolve func: %s %s\n", module, field) // Log resolve
@@ -122,3 +83,37 @@ func (r *Resolver) ResolveGlobal(module, field string) int64 {
 		panic(fmt.Errorf("unknown module: %s", module)) // Panic
 	}
 }
+
+// RunWithGasLimit - run a WebAssembly modules function denoted by its ID with a specified set
+// of parameters and a budget of `limit` gas for this call (0 for no limit). Gas is metered by
+// the gas policy the module was compiled with. The environment's gas limit still applies
+// when it is stricter than the budget.
+//
+// The returned result is non-nil even when err is set, so that gas used can always be
+// accounted for. If the budget runs out and Environment.ReturnOnGasLimitExceeded is set,
+// the run is suspended rather than trapped: err is nil, result.OutOfGas is true and the
+// run can be continued with ResumeWithGasLimit. Otherwise running out of gas is a
+// TrapOutOfGas error, and the charge that exceeded the budget is counted in result.GasUsed.
+// A suspended run's result.GasUsed excludes that charge, as it is made again once resumed.
+func (vm *VirtualMachine) RunWithGasLimit(entryID int, limit uint64, params ...int64) (*RunResult, error) {
+	vm.Ignite(entryID, params...) // Ignite vm
+
+	return vm.runMetered(limit) // Run with budget
+}
+
+// ResumeWithGasLimit - continue a run suspended for running out of gas (see RunWithGasLimit),
+// allowing it `limit` more gas (0 for no limit)
+func (vm *VirtualMachine) ResumeWithGasLimit(limit uint64) (*RunResult, error) {
+	if !vm.SuspendedOnGas() { // Check suspended
+		return nil, ErrNotSuspended // Return error
+	}
+
+	return vm.runMetered(limit) // Run with budget
+}
+
+// Run runs a WebAssembly modules function denoted by its ID with a specified set
+// of parameters.
+// Panics on logical errors.
+func (vm *VirtualMachine) Run(entryID int, params ...int64) (int64, error) {
+	return vm.RunContext(context.Background(), entryID, params...) // Run without deadline
+}
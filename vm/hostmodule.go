@@ -0,0 +1,384 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/SummerCash/wagon/wasm"
+)
+
+var (
+	// ErrInvalidHostFunction - describes an error regarding a registered Go function whose signature cannot be mapped to WebAssembly types
+	ErrInvalidHostFunction = errors.New("invalid host function")
+
+	// ErrHostFunctionExists - describes an error regarding a host function or module registered twice under the same name
+	ErrHostFunctionExists = errors.New("host function already registered")
+
+	// ErrImportNotFound - describes an error regarding an import no host module provides
+	ErrImportNotFound = errors.New("import not found")
+
+	// ErrImportSignatureMismatch - describes an error regarding an import declared with a different signature than its host function
+	ErrImportSignatureMismatch = errors.New("import signature mismatch")
+)
+
+// TypedImportResolver - import resolver that is given the signature each function import is declared
+// with, so that mismatches fail instantiation
+type TypedImportResolver interface {
+	ImportResolver
+
+	ResolveTypedFunc(module, field string, sig *wasm.FunctionSig) (FunctionImport, error) // Typed func resolver method
+}
+
+// HostModule - named set of Go functions importable by WebAssembly modules. Functions take an
+// optional leading *VirtualMachine followed by int32, uint32, int64, uint64, float32 or float64
+// params, and return at most one value of those types, optionally followed by an error (returning
+// a non-nil error traps the call).
+type HostModule struct {
+	Name string // Module name (as imported)
+
+	functions map[string]*hostFunction // Functions, by field name
+	globals   map[string]int64         // Globals, by field name
+}
+
+// HostRegistry - import resolver serving imports from registered host modules, falling back to
+// another resolver for modules it does not hold
+type HostRegistry struct {
+	Fallback ImportResolver // Resolver of imports from unregistered modules (nil to fail them)
+
+	modules map[string]*HostModule // Modules, by name
+}
+
+// hostFunction - registered Go function with its WebAssembly signature
+type hostFunction struct {
+	fn  reflect.Value     // Function
+	sig *wasm.FunctionSig // WebAssembly signature
+
+	takesVM   bool // First param is the calling vm
+	returnErr bool // Last result is an error
+}
+
+var (
+	vmType    = reflect.TypeOf((*VirtualMachine)(nil))  // Type of a host function's vm param
+	errorType = reflect.TypeOf((*error)(nil)).Elem()    // Type of a host function's error result
+	_         = TypedImportResolver((*HostModule)(nil)) // Host modules are typed resolvers
+	_         = TypedImportResolver((*HostRegistry)(nil))
+)
+
+/* BEGIN EXPORTED METHODS */
+
+// NewHostModule - initialize an empty host module with the given name
+func NewHostModule(name string) *HostModule {
+	return &HostModule{
+		Name:      name,                           // Set name
+		functions: make(map[string]*hostFunction), // Init functions
+		globals:   make(map[string]int64),         // Init globals
+	} // Return module
+}
+
+// Func - register a Go function under the given field name (see HostModule for supported signatures)
+func (module *HostModule) Func(name string, fn interface{}) error {
+	if _, ok := module.functions[name]; ok { // Check name taken
+		return fmt.Errorf("%w: %s.%s", ErrHostFunctionExists, module.Name, name) // Return error
+	}
+
+	function, err := newHostFunction(fn) // Map signature
+
+	if err != nil { // Check for errors
+		return fmt.Errorf("%s.%s: %w", module.Name, name, err) // Return found error
+	}
+
+	module.functions[name] = function // Set function
+
+	return nil // No error occurred, return nil
+}
+
+// Global - register a global value under the given field name
+func (module *HostModule) Global(name string, value int64) {
+	module.globals[name] = value // Set global
+}
+
+// Signature - get the WebAssembly signature of the function registered under the given field name
+func (module *HostModule) Signature(name string) (*wasm.FunctionSig, bool) {
+	function, ok := module.functions[name] // Get function
+
+	if !ok { // Check registered
+		return nil, false // Return not found
+	}
+
+	return function.sig, true // Return signature
+}
+
+// ResolveTypedFunc - get the function registered under field, checking it has the given signature
+func (module *HostModule) ResolveTypedFunc(moduleName, field string, sig *wasm.FunctionSig) (FunctionImport, error) {
+	function, ok := module.functions[field] // Get function
+
+	if !ok || moduleName != module.Name { // Check registered
+		return nil, fmt.Errorf("%w: %s.%s", ErrImportNotFound, moduleName, field) // Return error
+	}
+
+	if sig != nil && !signaturesEqual(sig, function.sig) { // Check signature
+		return nil, fmt.Errorf("%w: %s.%s is imported as %s, but the host function is %s", ErrImportSignatureMismatch, moduleName, field, formatSignature(sig), formatSignature(function.sig)) // Return error
+	}
+
+	return function.call, nil // Return function
+}
+
+// ResolveFunc - get the function registered under field, without checking its signature (panics if not found)
+func (module *HostModule) ResolveFunc(moduleName, field string) FunctionImport {
+	function, err := module.ResolveTypedFunc(moduleName, field, nil) // Resolve function
+
+	if err != nil { // Check for errors
+		panic(err) // Panic
+	}
+
+	return function // Return function
+}
+
+// ResolveGlobal - get the global registered under field (panics if not found)
+func (module *HostModule) ResolveGlobal(moduleName, field string) int64 {
+	value, ok := module.globals[field] // Get global
+
+	if !ok || moduleName != module.Name { // Check registered
+		panic(fmt.Errorf("%w: %s.%s", ErrImportNotFound, moduleName, field)) // Panic
+	}
+
+	return value // Return value
+}
+
+// NewHostRegistry - initialize a registry of the given host modules
+func NewHostRegistry(modules ...*HostModule) (*HostRegistry, error) {
+	registry := &HostRegistry{modules: make(map[string]*HostModule)} // Init registry
+
+	for _, module := range modules { // Iterate through modules
+		if err := registry.Add(module); err != nil { // Add module
+			return nil, err // Return found error
+		}
+	}
+
+	return registry, nil // Return registry
+}
+
+// Add - register a host module
+func (registry *HostRegistry) Add(module *HostModule) error {
+	if _, ok := registry.modules[module.Name]; ok || module.Name == StorageModule { // Check name taken
+		return fmt.Errorf("%w: %s", ErrHostFunctionExists, module.Name) // Return error
+	}
+
+	registry.modules[module.Name] = module // Set module
+
+	return nil // No error occurred, return nil
+}
+
+// ResolveTypedFunc - resolve a function import from the registered module it names, checking its signature
+func (registry *HostRegistry) ResolveTypedFunc(moduleName, field string, sig *wasm.FunctionSig) (FunctionImport, error) {
+	if module, ok := registry.modules[moduleName]; ok { // Check registered
+		return module.ResolveTypedFunc(moduleName, field, sig) // Resolve function
+	}
+
+	return resolveFunc(registry.Fallback, moduleName, field, sig) // Resolve from fallback
+}
+
+// ResolveFunc - resolve a function import without checking its signature (panics if not found)
+func (registry *HostRegistry) ResolveFunc(moduleName, field string) FunctionImport {
+	function, err := registry.ResolveTypedFunc(moduleName, field, nil) // Resolve function
+
+	if err != nil { // Check for errors
+		panic(err) // Panic
+	}
+
+	return function // Return function
+}
+
+// ResolveGlobal - resolve a global import from the registered module it names (panics if not found)
+func (registry *HostRegistry) ResolveGlobal(moduleName, field string) int64 {
+	if module, ok := registry.modules[moduleName]; ok { // Check registered
+		return module.ResolveGlobal(moduleName, field) // Resolve global
+	}
+
+	if registry.Fallback == nil { // Check no fallback
+		panic(fmt.Errorf("%w: %s.%s", ErrImportNotFound, moduleName, field)) // Panic
+	}
+
+	return registry.Fallback.ResolveGlobal(moduleName, field) // Resolve from fallback
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// newHostFunction - map the signature of a Go function to WebAssembly types
+func newHostFunction(fn interface{}) (*hostFunction, error) {
+	value := reflect.ValueOf(fn) // Get function
+
+	if value.Kind() != reflect.Func || value.IsNil() { // Check is function
+		return nil, fmt.Errorf("%w: %T is not a function", ErrInvalidHostFunction, fn) // Return error
+	}
+
+	t := value.Type() // Get type
+
+	function := &hostFunction{fn: value, sig: &wasm.FunctionSig{Form: 0x60}} // Init function
+
+	for i := 0; i < t.NumIn(); i++ { // Iterate through params
+		if i == 0 && t.In(i) == vmType { // Check takes vm
+			function.takesVM = true // Set takes vm
+
+			continue // Continue
+		}
+
+		valueType, ok := wasmType(t.In(i)) // Map type
+
+		if !ok { // Check supported
+			return nil, fmt.Errorf("%w: param %d is %s", ErrInvalidHostFunction, i, t.In(i)) // Return error
+		}
+
+		function.sig.ParamTypes = append(function.sig.ParamTypes, valueType) // Append param
+	}
+
+	results := t.NumOut() // Get result count
+
+	if results > 0 && t.Out(results-1) == errorType { // Check returns error
+		function.returnErr = true // Set returns error
+		results--                 // Skip error
+	}
+
+	if results > 1 { // Check single result
+		return nil, fmt.Errorf("%w: %d results", ErrInvalidHostFunction, results) // Return error
+	}
+
+	if results == 1 { // Check has result
+		valueType, ok := wasmType(t.Out(0)) // Map type
+
+		if !ok { // Check supported
+			return nil, fmt.Errorf("%w: result is %s", ErrInvalidHostFunction, t.Out(0)) // Return error
+		}
+
+		function.sig.ReturnTypes = []wasm.ValueType{valueType} // Set result
+	}
+
+	return function, nil // Return function
+}
+
+// call - call the Go function with the args of the current frame
+func (function *hostFunction) call(vm *VirtualMachine) int64 {
+	locals := vm.GetCurrentFrame().Locals // Get args
+
+	t := function.fn.Type()                     // Get type
+	args := make([]reflect.Value, 0, t.NumIn()) // Init arg buffer
+
+	if function.takesVM { // Check takes vm
+		args = append(args, reflect.ValueOf(vm)) // Append vm
+	}
+
+	for i, valueType := range function.sig.ParamTypes { // Iterate through params
+		args = append(args, goValue(ValueFromRaw(valueType, locals[i]), t.In(len(args)))) // Append arg
+	}
+
+	results := function.fn.Call(args) // Call function
+
+	if function.returnErr { // Check returns error
+		if err := results[len(results)-1]; !err.IsNil() { // Check failed
+			panic(err.Interface()) // Trap
+		}
+	}
+
+	if len(function.sig.ReturnTypes) == 0 { // Check no result
+		return 0 // Nothing to return
+	}
+
+	return rawValue(results[0]) // Return result
+}
+
+// resolveFunc - resolve a function import, checking its signature if the resolver supports it
+func resolveFunc(resolver ImportResolver, module, field string, sig *wasm.FunctionSig) (FunctionImport, error) {
+	if resolver == nil { // Check no resolver
+		return nil, fmt.Errorf("%w: %s.%s", ErrImportNotFound, module, field) // Return error
+	}
+
+	if typed, ok := resolver.(TypedImportResolver); ok { // Check typed
+		return typed.ResolveTypedFunc(module, field, sig) // Resolve function
+	}
+
+	return resolver.ResolveFunc(module, field), nil // Resolve function
+}
+
+// wasmType - get the WebAssembly type of a Go type
+func wasmType(t reflect.Type) (wasm.ValueType, bool) {
+	switch t.Kind() { // Handle kinds
+	case reflect.Int32, reflect.Uint32:
+		return wasm.ValueTypeI32, true // i32
+	case reflect.Int64, reflect.Uint64:
+		return wasm.ValueTypeI64, true // i64
+	case reflect.Float32:
+		return wasm.ValueTypeF32, true // f32
+	case reflect.Float64:
+		return wasm.ValueTypeF64, true // f64
+	default:
+		return 0, false // Unsupported
+	}
+}
+
+// goValue - convert a WebAssembly value to the given Go type
+func goValue(value Value, t reflect.Type) reflect.Value {
+	converted := reflect.New(t).Elem() // Init value
+
+	switch t.Kind() { // Handle kinds
+	case reflect.Int32, reflect.Int64:
+		converted.SetInt(int64(value.signed())) // Set signed
+	case reflect.Uint32, reflect.Uint64:
+		converted.SetUint(value.bits) // Set unsigned
+	case reflect.Float32:
+		converted.SetFloat(float64(value.F32())) // Set f32
+	case reflect.Float64:
+		converted.SetFloat(value.F64()) // Set f64
+	}
+
+	return converted // Return value
+}
+
+// rawValue - convert a Go result to the VM's int64 register representation
+func rawValue(value reflect.Value) int64 {
+	switch value.Kind() { // Handle kinds
+	case reflect.Int32:
+		return I32(int32(value.Int())).Raw() // Return i32
+	case reflect.Uint32:
+		return I32(int32(uint32(value.Uint()))).Raw() // Return i32
+	case reflect.Int64:
+		return value.Int() // Return i64
+	case reflect.Uint64:
+		return int64(value.Uint()) // Return i64
+	case reflect.Float32:
+		return F32(float32(value.Float())).Raw() // Return f32
+	default:
+		return F64(value.Float()).Raw() // Return f64
+	}
+}
+
+// signed - get an integer value sign extended from its width
+func (value Value) signed() int64 {
+	if value.Type == wasm.ValueTypeI32 { // Check is i32
+		return int64(int32(uint32(value.bits))) // Return sign extended
+	}
+
+	return int64(value.bits) // Return i64
+}
+
+// formatSignature - format a function signature as "(i32, i32) -> i32"
+func formatSignature(sig *wasm.FunctionSig) string {
+	params := make([]string, len(sig.ParamTypes)) // Init param buffer
+
+	for i, t := range sig.ParamTypes { // Iterate through params
+		params[i] = t.String() // Format param
+	}
+
+	results := make([]string, len(sig.ReturnTypes)) // Init result buffer
+
+	for i, t := range sig.ReturnTypes { // Iterate through results
+		results[i] = t.String() // Format result
+	}
+
+	return fmt.Sprintf("(%s) -> (%s)", strings.Join(params, ", "), strings.Join(results, ", ")) // Return signature
+}
+
+/* END INTERNAL METHODS */
@@ -0,0 +1,129 @@
+package vm
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// errCheckFailed - error returned by the test check host function
+var errCheckFailed = errors.New("check failed")
+
+// newHostTestModule - initialize the env host module imported by the host example module
+func newHostTestModule(t *testing.T) *HostModule {
+	module := NewHostModule("env") // Init module
+
+	functions := map[string]interface{}{
+		"add": func(a int32, b int64) int64 { return int64(a) + b }, // Sign extends a
+		"scale": func(vm *VirtualMachine, a float32, b float64) float64 {
+			vm.ChargeGas(1) // Charge call
+
+			return float64(a) * b // Return product
+		},
+		"negate": func(a int32) int32 { return -a }, // Negate
+		"check": func(a uint32) error {
+			if a == 0 { // Check zero
+				return errCheckFailed // Fail
+			}
+
+			return nil // Passed
+		},
+	} // Init functions
+
+	for name, fn := range functions { // Iterate through functions
+		if err := module.Func(name, fn); err != nil { // Register function
+			t.Fatal(err) // Panic
+		}
+	}
+
+	return module // Return module
+}
+
+// newHostTestVM - initialize a vm running the host example module with the given resolver
+func newHostTestVM(t *testing.T, resolver ImportResolver) (*VirtualMachine, error) {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/host.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	return NewVirtualMachine(testSourceFile, Environment{StateStore: StateStoreMemory}, resolver, nil) // Init vm
+}
+
+// TestHostModule - test typed host functions receive and return marshalled values
+func TestHostModule(t *testing.T) {
+	registry, err := NewHostRegistry(newHostTestModule(t)) // Init registry
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	vm, err := newHostTestVM(t, registry) // Init vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if results, err := vm.Call("add", I32(-3), I64(1<<40)); err != nil || results[0].I64() != 1<<40-3 { // Add
+		t.Fatalf("expected %d, got %v (%v)", int64(1<<40-3), results, err) // Panic
+	}
+
+	if results, err := vm.Call("scale", F32(1.5), F64(4)); err != nil || results[0].F64() != 6 { // Scale
+		t.Fatalf("expected 6, got %v (%v)", results, err) // Panic
+	}
+
+	if vm.Gas == 0 { // Check host function charged gas
+		t.Fatal("expected scale to charge gas") // Panic
+	}
+
+	if results, err := vm.Call("negate", I32(-5)); err != nil || results[0].I32() != -5 { // Negate twice
+		t.Fatalf("expected -5, got %v (%v)", results, err) // Panic
+	}
+
+	if results, err := vm.Call("check", I32(2)); err != nil || results[0].I32() != 2 { // Pass check
+		t.Fatalf("expected 2, got %v (%v)", results, err) // Panic
+	}
+
+	if _, err := vm.Call("check", I32(0)); !errors.Is(err, errCheckFailed) || !errors.Is(err, TrapHostError) { // Fail check
+		t.Fatalf("expected host error trap, got %v", err) // Panic
+	}
+}
+
+// TestHostModuleSignatures - test unsupported Go functions are rejected and mismatched imports fail instantiation
+func TestHostModuleSignatures(t *testing.T) {
+	module := newHostTestModule(t) // Init module
+
+	if err := module.Func("add", func() {}); !errors.Is(err, ErrHostFunctionExists) { // Register twice
+		t.Fatalf("expected function exists error, got %v", err) // Panic
+	}
+
+	if err := module.Func("text", func(s string) {}); !errors.Is(err, ErrInvalidHostFunction) { // Unsupported param
+		t.Fatalf("expected invalid function error, got %v", err) // Panic
+	}
+
+	if err := module.Func("pair", func() (int32, int32) { return 0, 0 }); !errors.Is(err, ErrInvalidHostFunction) { // Two results
+		t.Fatalf("expected invalid function error, got %v", err) // Panic
+	}
+
+	mismatched := newHostTestModule(t) // Init mismatched module
+	delete(mismatched.functions, "negate")
+
+	if err := mismatched.Func("negate", func(a int64) int64 { return -a }); err != nil { // Register with i64 signature
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := newHostTestVM(t, mismatched); !errors.Is(err, ErrImportSignatureMismatch) { // Instantiate
+		t.Fatalf("expected signature mismatch error, got %v", err) // Panic
+	}
+
+	delete(mismatched.functions, "negate") // Remove import
+
+	if _, err := newHostTestVM(t, mismatched); !errors.Is(err, ErrImportNotFound) { // Instantiate
+		t.Fatalf("expected import not found error, got %v", err) // Panic
+	}
+
+	if _, err := NewHostRegistry(NewHostModule(StorageModule)); !errors.Is(err, ErrHostFunctionExists) { // Shadow built-in module
+		t.Fatalf("expected module exists error, got %v", err) // Panic
+	}
+}
@@ -0,0 +1,157 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	// ErrInvalidLabel - describes an error regarding an empty label name
+	ErrInvalidLabel = errors.New("invalid label")
+
+	// ErrLabelExists - describes an error regarding a label name already in use in the given state db
+	ErrLabelExists = errors.New("label already exists")
+
+	// ErrUnknownLabel - describes an error regarding a label name not found in the given state db
+	ErrUnknownLabel = errors.New("unknown label")
+)
+
+// StateLabel - name attached to a state entry. A checkpoint always names the same entry; a branch
+// names its latest entry, and advances while checked out as states are saved on top of it.
+type StateLabel struct {
+	ID []byte `json:"id"` // Labeled entry ID
+
+	IsBranch bool `json:"branch"` // Label is a branch
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// Label - attach a checkpoint with the given name to the entry with the given ID
+func (stateDB *StateDatabase) Label(name string, id []byte) error {
+	return stateDB.addLabel(name, id, false) // Add checkpoint
+}
+
+// CreateBranch - create a branch with the given name starting at the entry with the given ID
+func (stateDB *StateDatabase) CreateBranch(name string, id []byte) error {
+	return stateDB.addLabel(name, id, true) // Add branch
+}
+
+// RemoveLabel - remove the checkpoint or branch with the given name (the entries it named are kept)
+func (stateDB *StateDatabase) RemoveLabel(name string) error {
+	if _, ok := stateDB.Labels[name]; !ok { // Check exists
+		return fmt.Errorf("%w: %s", ErrUnknownLabel, name) // Return error
+	}
+
+	delete(stateDB.Labels, name) // Remove label
+
+	if stateDB.Branch == name { // Check checked out
+		stateDB.Branch = "" // Detach
+	}
+
+	return stateDB.putHeader() // Write header to store
+}
+
+// Resolve - get the entry named by the checkpoint or branch with the given name
+func (stateDB *StateDatabase) Resolve(name string) (*StateEntry, error) {
+	label, ok := stateDB.Labels[name] // Get label
+
+	if !ok { // Check exists
+		return &StateEntry{}, fmt.Errorf("%w: %s", ErrUnknownLabel, name) // Return error
+	}
+
+	return stateDB.QueryState(label.ID) // Return entry
+}
+
+// LabelsOf - get the names of the checkpoints and branches naming the entry with the given ID, in sorted order
+func (stateDB *StateDatabase) LabelsOf(id []byte) []string {
+	var names []string // Init name buffer
+
+	for name, label := range stateDB.Labels { // Iterate through labels
+		if string(label.ID) == string(id) { // Check names entry
+			names = append(names, name) // Append name
+		}
+	}
+
+	sort.Strings(names) // Sort names
+
+	return names // Return names
+}
+
+// Checkout - set the working root to the entry named by the given label. Checking out a branch
+// makes states added on top of it advance the branch; checking out a checkpoint detaches.
+func (stateDB *StateDatabase) Checkout(name string) (*StateEntry, error) {
+	entry, err := stateDB.Resolve(name) // Resolve label
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	stateDB.SetWorkingRoot(entry) // Set working root
+
+	stateDB.Branch = "" // Detach
+
+	if stateDB.Labels[name].IsBranch { // Check is branch
+		stateDB.Branch = name // Check out branch
+	}
+
+	if err = stateDB.putHeader(); err != nil { // Write header to store
+		return nil, err // Return found error
+	}
+
+	return entry, nil // Return entry
+}
+
+// Checkout - reset the vm to the state named by the given checkpoint or branch (see StateDatabase.Checkout)
+func (vm *VirtualMachine) Checkout(name string) error {
+	stateDB, err := vm.StateDatabase() // Get state database
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	entry, err := stateDB.Resolve(name) // Resolve label
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	if err = vm.restoreState(entry); err != nil { // Load state
+		return err // Return found error
+	}
+
+	_, err = stateDB.Checkout(name) // Check out label
+
+	return err // Return error
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// addLabel - attach a checkpoint or branch with the given name to the entry with the given ID
+func (stateDB *StateDatabase) addLabel(name string, id []byte, branch bool) error {
+	if name == "" { // Check has name
+		return ErrInvalidLabel // Return error
+	}
+
+	if _, ok := stateDB.Labels[name]; ok { // Check name taken
+		return fmt.Errorf("%w: %s", ErrLabelExists, name) // Return error
+	}
+
+	entry, err := stateDB.QueryState(id) // Query state
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	if stateDB.Labels == nil { // Check no labels
+		stateDB.Labels = make(map[string]*StateLabel) // Init labels
+	}
+
+	stateDB.Labels[name] = &StateLabel{ID: entry.ID, IsBranch: branch} // Set label
+
+	return stateDB.putHeader() // Write header to store
+}
+
+/* END INTERNAL METHODS */
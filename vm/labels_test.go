@@ -0,0 +1,122 @@
+package vm
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestLabels - test checkpoints resolve to fixed entries and label names are unique
+func TestLabels(t *testing.T) {
+	vm, entries := newBranchedTestDB(t) // Init db
+	a, b := entries[1], entries[2]
+
+	if err := vm.StateDB.Label("pre-upgrade", a.ID); err != nil { // Label a
+		t.Fatal(err) // Panic
+	}
+
+	if err := vm.StateDB.Label("pre-upgrade", b.ID); !errors.Is(err, ErrLabelExists) { // Reuse name
+		t.Fatalf("expected label exists error, got %v", err) // Panic
+	}
+
+	if err := vm.StateDB.Label("", b.ID); !errors.Is(err, ErrInvalidLabel) { // Empty name
+		t.Fatalf("expected invalid label error, got %v", err) // Panic
+	}
+
+	if err := vm.StateDB.Label("missing", []byte("unknown")); !errors.Is(err, ErrNilStateEntry) { // Unknown entry
+		t.Fatalf("expected unknown entry error, got %v", err) // Panic
+	}
+
+	if entry, err := vm.StateDB.Resolve("pre-upgrade"); err != nil || entry != a { // Resolve label
+		t.Fatalf("expected label to resolve to a (%v)", err) // Panic
+	}
+
+	if names := vm.StateDB.LabelsOf(a.ID); len(names) != 1 || names[0] != "pre-upgrade" { // Check labels of a
+		t.Fatalf("expected [pre-upgrade], got %v", names) // Panic
+	}
+
+	if err := vm.Checkout("pre-upgrade"); err != nil { // Check out checkpoint
+		t.Fatal(err) // Panic
+	}
+
+	if results, err := vm.Call("load", I32(0)); err != nil || results[0].I32() != 1 || vm.StateDB.Branch != "" { // Check reset to a, detached
+		t.Fatalf("expected 1 at checkpoint, got %v (%v)", results, err) // Panic
+	}
+
+	if err := vm.SaveState(); err != nil { // Save on top of checkpoint
+		t.Fatal(err) // Panic
+	}
+
+	if entry, _ := vm.StateDB.Resolve("pre-upgrade"); entry != a { // Check checkpoint did not move
+		t.Fatal("expected checkpoint to stay at a") // Panic
+	}
+
+	if err := vm.StateDB.RemoveLabel("pre-upgrade"); err != nil { // Remove label
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := vm.StateDB.Resolve("pre-upgrade"); !errors.Is(err, ErrUnknownLabel) { // Check removed
+		t.Fatalf("expected unknown label error, got %v", err) // Panic
+	}
+}
+
+// TestBranchLabels - test checked out branches advance as states are saved, and labels persist
+func TestBranchLabels(t *testing.T) {
+	vm, entries := newBranchedTestDB(t) // Init db
+	b, d := entries[2], entries[4]
+
+	if err := vm.StateDB.CreateBranch("scenario", b.ID); err != nil { // Branch from b
+		t.Fatal(err) // Panic
+	}
+
+	if err := vm.StateDB.Label("block-1042", d.ID); err != nil { // Label d
+		t.Fatal(err) // Panic
+	}
+
+	if err := vm.Checkout("scenario"); err != nil { // Check out branch
+		t.Fatal(err) // Panic
+	}
+
+	if vm.StateDB.WorkingRoot != b || vm.StateDB.Branch != "scenario" { // Check working root
+		t.Fatal("expected working root b on branch scenario") // Panic
+	}
+
+	for i := int32(5); i <= 6; i++ { // Save two states on the branch
+		if _, err := vm.Call("store", I32(0), I32(i)); err != nil { // Write
+			t.Fatal(err) // Panic
+		}
+
+		if err := vm.SaveState(); err != nil { // Save state
+			t.Fatal(err) // Panic
+		}
+	}
+
+	head := vm.StateDB.WorkingRoot // Get branch head
+
+	if entry, err := vm.StateDB.Resolve("scenario"); err != nil || entry != head { // Check branch advanced
+		t.Fatalf("expected branch to advance to the last saved state (%v)", err) // Panic
+	}
+
+	if err := vm.Checkout("block-1042"); err != nil { // Switch to checkpoint
+		t.Fatal(err) // Panic
+	}
+
+	if err := vm.LoadWorkingRoot(); err != nil { // Reload from store
+		t.Fatal(err) // Panic
+	}
+
+	if vm.StateDB.WorkingRoot.Nonce != d.Nonce || vm.StateDB.Branch != "" { // Check persisted working root
+		t.Fatal("expected checkpoint to stay checked out after reloading") // Panic
+	}
+
+	if entry, err := vm.StateDB.Resolve("scenario"); err != nil || entry.Nonce != head.Nonce { // Check branch persisted
+		t.Fatalf("expected persisted branch head (%v)", err) // Panic
+	}
+
+	if err := vm.Checkout("scenario"); err != nil { // Switch back to branch
+		t.Fatal(err) // Panic
+	}
+
+	if results, err := vm.Call("load", I32(0)); err != nil || results[0].I32() != 6 { // Check branch memory
+		t.Fatalf("expected 6 at branch head, got %v (%v)", results, err) // Panic
+	}
+}
@@ -0,0 +1,439 @@
+package vm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/SummerCash/ursa/common"
+)
+
+const (
+	// logRecordPut - log record setting a key
+	logRecordPut byte = 1
+
+	// logRecordDelete - log record removing a key
+	logRecordDelete byte = 2
+)
+
+var (
+	// ErrCorruptLogRecord - describes an error regarding a log record (before the end of the log) failing its checksum
+	ErrCorruptLogRecord = errors.New("corrupt log record")
+)
+
+// LogStore - file-backed, append-only store. Every put and delete appends a
+// checksummed record to the log, and an in-memory index maps each live key to the
+// position of its latest value. Superseded records are reclaimed by Compact.
+type LogStore struct {
+	path string   // Log file path
+	file *os.File // Log file
+
+	index map[string]logPointer // Live values by key
+
+	size int64 // Log length
+	live int64 // Length of live records
+
+	lock sync.RWMutex // Log lock
+}
+
+// logPointer - position of a value in the log
+type logPointer struct {
+	offset int64 // Value offset
+	length int   // Value length
+	record int64 // Length of the whole record
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// OpenLogStore - open (or create) the log store at the given path, replaying its log.
+// A torn record at the end of the log (e.g. from a crash mid-write) is discarded; a corrupt record
+// fails with ErrCorruptLogRecord.
+func OpenLogStore(path string) (*LogStore, error) {
+	if err := common.CreateDirIfDoesNotExit(filepath.Dir(path)); err != nil { // Create dir if necessary
+		return nil, err // Return found error
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644) // Open log
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	store := &LogStore{
+		path:  path,                        // Set path
+		file:  file,                        // Set file
+		index: make(map[string]logPointer), // Init index
+	}
+
+	if err = store.replay(); err != nil { // Replay log
+		file.Close() // Close log
+
+		return nil, err // Return found error
+	}
+
+	return store, nil // Return store
+}
+
+// Get - get value of key
+func (store *LogStore) Get(key []byte) ([]byte, error) {
+	store.lock.RLock()         // Lock
+	defer store.lock.RUnlock() // Unlock
+
+	if store.file == nil { // Check closed
+		return nil, ErrStoreClosed // Return error
+	}
+
+	pointer, ok := store.index[string(key)] // Get pointer
+
+	if !ok { // Check exists
+		return nil, ErrKeyNotFound // Return error
+	}
+
+	return store.read(pointer) // Read value
+}
+
+// Put - set value of key
+func (store *LogStore) Put(key []byte, value []byte) error {
+	store.lock.Lock()         // Lock
+	defer store.lock.Unlock() // Unlock
+
+	if store.file == nil { // Check closed
+		return ErrStoreClosed // Return error
+	}
+
+	record, valueOffset := encodeLogRecord(logRecordPut, key, value) // Encode record
+
+	if _, err := store.file.WriteAt(record, store.size); err != nil { // Append record
+		return err // Return found error
+	}
+
+	if old, ok := store.index[string(key)]; ok { // Check superseding a value
+		store.live -= old.record // Remove old record
+	}
+
+	store.index[string(key)] = logPointer{offset: store.size + int64(valueOffset), length: len(value), record: int64(len(record))} // Set pointer
+	store.size += int64(len(record))                                                                                               // Set log length
+	store.live += int64(len(record))                                                                                               // Add live record
+
+	return nil // No error occurred, return nil
+}
+
+// Delete - remove key
+func (store *LogStore) Delete(key []byte) error {
+	store.lock.Lock()         // Lock
+	defer store.lock.Unlock() // Unlock
+
+	if store.file == nil { // Check closed
+		return ErrStoreClosed // Return error
+	}
+
+	old, ok := store.index[string(key)] // Get pointer
+
+	if !ok { // Check exists
+		return nil // Nothing to delete
+	}
+
+	record, _ := encodeLogRecord(logRecordDelete, key, nil) // Encode tombstone
+
+	if _, err := store.file.WriteAt(record, store.size); err != nil { // Append record
+		return err // Return found error
+	}
+
+	delete(store.index, string(key)) // Remove pointer
+
+	store.size += int64(len(record)) // Set log length
+	store.live -= old.record         // Remove old record
+
+	return nil // No error occurred, return nil
+}
+
+// Iterate - call fn for each key with the given prefix, in key order
+func (store *LogStore) Iterate(prefix []byte, fn func(key []byte, value []byte) error) error {
+	store.lock.RLock() // Lock
+
+	if store.file == nil { // Check closed
+		store.lock.RUnlock() // Unlock
+
+		return ErrStoreClosed // Return error
+	}
+
+	keys := sortedKeys(prefix, len(store.index), func(visit func(string)) {
+		for key := range store.index { // Iterate through keys
+			visit(key) // Visit key
+		}
+	}) // Get keys
+
+	values := make([][]byte, len(keys)) // Init value buffer
+
+	for i, key := range keys { // Iterate through keys
+		value, err := store.read(store.index[key]) // Read value
+
+		if err != nil { // Check for errors
+			store.lock.RUnlock() // Unlock
+
+			return err // Return found error
+		}
+
+		values[i] = value // Set value
+	}
+
+	store.lock.RUnlock() // Unlock (fn may use the store)
+
+	for i, key := range keys { // Iterate through keys
+		if err := fn([]byte(key), values[i]); err != nil { // Visit value
+			return err // Return found error
+		}
+	}
+
+	return nil // No error occurred, return nil
+}
+
+// Size - get the length of the log and of the live records in it (the log length after compaction)
+func (store *LogStore) Size() (total int64, live int64) {
+	store.lock.RLock()         // Lock
+	defer store.lock.RUnlock() // Unlock
+
+	return store.size, store.live // Return sizes
+}
+
+// Compact - rewrite the log with only live records, returning the number of bytes reclaimed
+func (store *LogStore) Compact() (int64, error) {
+	store.lock.Lock()         // Lock
+	defer store.lock.Unlock() // Unlock
+
+	if store.file == nil { // Check closed
+		return 0, ErrStoreClosed // Return error
+	}
+
+	tempPath := store.path + ".compact" // Get temp path
+
+	temp, err := os.OpenFile(tempPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644) // Open temp log
+
+	if err != nil { // Check for errors
+		return 0, err // Return found error
+	}
+
+	writer := bufio.NewWriter(temp)      // Init writer
+	index := make(map[string]logPointer) // Init new index
+	size := int64(0)                     // Init new length
+	keys := sortedKeys(nil, len(store.index), func(visit func(string)) {
+		for key := range store.index { // Iterate through keys
+			visit(key) // Visit key
+		}
+	}) // Get keys (sorted so that compaction is deterministic)
+
+	for _, key := range keys { // Iterate through live keys
+		value, err := store.read(store.index[key]) // Read value
+
+		if err != nil { // Check for errors
+			temp.Close() // Close temp log
+
+			return 0, err // Return found error
+		}
+
+		record, valueOffset := encodeLogRecord(logRecordPut, []byte(key), value) // Encode record
+
+		if _, err = writer.Write(record); err != nil { // Write record
+			temp.Close() // Close temp log
+
+			return 0, err // Return found error
+		}
+
+		index[key] = logPointer{offset: size + int64(valueOffset), length: len(value), record: int64(len(record))} // Set pointer
+		size += int64(len(record))                                                                                 // Set length
+	}
+
+	if err = writer.Flush(); err == nil { // Flush records
+		err = temp.Sync() // Sync temp log
+	}
+
+	if err != nil { // Check for errors
+		temp.Close() // Close temp log
+
+		return 0, err // Return found error
+	}
+
+	if err = os.Rename(tempPath, store.path); err != nil { // Replace log
+		temp.Close() // Close temp log
+
+		return 0, err // Return found error
+	}
+
+	store.file.Close() // Close old log
+
+	reclaimed := store.size - size // Get reclaimed bytes
+
+	store.file = temp   // Set file
+	store.index = index // Set index
+	store.size = size   // Set length
+	store.live = size   // Set live length
+
+	return reclaimed, nil // Return reclaimed bytes
+}
+
+// Sync - flush the log to stable storage
+func (store *LogStore) Sync() error {
+	store.lock.RLock()         // Lock
+	defer store.lock.RUnlock() // Unlock
+
+	if store.file == nil { // Check closed
+		return ErrStoreClosed // Return error
+	}
+
+	return store.file.Sync() // Sync log
+}
+
+// Close - close log
+func (store *LogStore) Close() error {
+	store.lock.Lock()         // Lock
+	defer store.lock.Unlock() // Unlock
+
+	if store.file == nil { // Check already closed
+		return nil // Nothing to close
+	}
+
+	err := store.file.Close() // Close log
+
+	store.file = nil  // Reset file
+	store.index = nil // Release index
+
+	return err // Return error
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// replay - rebuild the index from the log, truncating a torn final record. A record failing its
+// checksum is reported as ErrCorruptLogRecord, leaving the log untouched.
+func (store *LogStore) replay() error {
+	info, err := store.file.Stat() // Get log info
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(store.file, 0, info.Size())) // Init reader
+
+	for { // Read until end of log
+		op, key, value, length, err := readLogRecord(reader, info.Size()-store.size) // Read record
+
+		if err == io.EOF { // Check end of log
+			break // Done
+		}
+
+		if err == io.ErrUnexpectedEOF { // Check torn write (a final record cut short)
+			break // Discard torn record
+		}
+
+		if err == ErrCorruptLogRecord { // Check corrupt record (the log is left as is)
+			return fmt.Errorf("%w at offset %d of %s", err, store.size, store.path) // Return error
+		}
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if old, ok := store.index[string(key)]; ok { // Check superseding a value
+			store.live -= old.record // Remove old record
+		}
+
+		if op == logRecordPut { // Check is put
+			store.index[string(key)] = logPointer{offset: store.size + int64(length-len(value)-crc32.Size), length: len(value), record: int64(length)} // Set pointer
+			store.live += int64(length)                                                                                                                // Add live record
+		} else {
+			delete(store.index, string(key)) // Remove pointer
+		}
+
+		store.size += int64(length) // Set length
+	}
+
+	return store.file.Truncate(store.size) // Drop torn record (if any)
+}
+
+// read - read the value at the given pointer
+func (store *LogStore) read(pointer logPointer) ([]byte, error) {
+	value := make([]byte, pointer.length) // Init value buffer
+
+	if _, err := store.file.ReadAt(value, pointer.offset); err != nil { // Read value
+		return nil, err // Return found error
+	}
+
+	return value, nil // Return value
+}
+
+// encodeLogRecord - encode a log record, returning it and the offset of the value within it.
+// Layout: op, uvarint key length, uvarint value length, key, value, crc32 of all preceding bytes.
+func encodeLogRecord(op byte, key []byte, value []byte) ([]byte, int) {
+	record := make([]byte, 1+2*binary.MaxVarintLen64, 1+2*binary.MaxVarintLen64+len(key)+len(value)+crc32.Size) // Init record
+
+	record[0] = op                                                                                                      // Set op
+	n := 1                                                                                                              // Init header length
+	n += binary.PutUvarint(record[n:], uint64(len(key)))                                                                // Set key length
+	n += binary.PutUvarint(record[n:], uint64(len(value)))                                                              // Set value length
+	record = append(append(record[:n], key...), value...)                                                               // Append key, value
+	record = append(record, make([]byte, crc32.Size)...)                                                                // Append checksum space
+	binary.LittleEndian.PutUint32(record[len(record)-crc32.Size:], crc32.ChecksumIEEE(record[:len(record)-crc32.Size])) // Set checksum
+
+	return record, n + len(key) // Return record
+}
+
+// readLogRecord - read the next log record (with at most remaining bytes left in the log), returning its op, key, value and total length
+func readLogRecord(reader *bufio.Reader, remaining int64) (byte, []byte, []byte, int, error) {
+	op, err := reader.ReadByte() // Read op
+
+	if err != nil { // Check for errors
+		return 0, nil, nil, 0, err // Return found error (io.EOF at a record boundary)
+	}
+
+	header := []byte{op} // Init header buffer
+
+	lengths := make([]uint64, 2) // Init length buffer
+
+	for i := range lengths { // Read key and value lengths
+		lengths[i], err = binary.ReadUvarint(reader) // Read length
+
+		if err != nil { // Check for errors
+			return 0, nil, nil, 0, io.ErrUnexpectedEOF // Return torn record
+		}
+
+		var varint [binary.MaxVarintLen64]byte // Init varint buffer
+
+		header = append(header, varint[:binary.PutUvarint(varint[:], lengths[i])]...) // Append to header
+	}
+
+	if (op != logRecordPut && op != logRecordDelete) || lengths[0] > 1<<32 || lengths[1] > 1<<40 { // Check well formed
+		return 0, nil, nil, 0, ErrCorruptLogRecord // Return error
+	}
+
+	if lengths[0]+lengths[1]+crc32.Size > uint64(remaining-int64(len(header))) { // Check body fits in the rest of the log (before allocating it)
+		return 0, nil, nil, 0, io.ErrUnexpectedEOF // Return torn record
+	}
+
+	body := make([]byte, lengths[0]+lengths[1]+crc32.Size) // Init body buffer
+
+	if _, err = io.ReadFull(reader, body); err != nil { // Read body
+		return 0, nil, nil, 0, io.ErrUnexpectedEOF // Return torn record
+	}
+
+	checksum := crc32.NewIEEE()                 // Init checksum
+	checksum.Write(header)                      // Add header
+	checksum.Write(body[:len(body)-crc32.Size]) // Add key, value
+
+	if checksum.Sum32() != binary.LittleEndian.Uint32(body[len(body)-crc32.Size:]) { // Check checksum
+		return 0, nil, nil, 0, ErrCorruptLogRecord // Return error
+	}
+
+	key := body[:lengths[0]]                          // Get key
+	value := body[lengths[0] : lengths[0]+lengths[1]] // Get value
+
+	return op, key, value, len(header) + len(body), nil // Return record
+}
+
+/* END INTERNAL METHODS */
@@ -0,0 +1,180 @@
+package vm
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLogStore - test functionality of the append-only file store, including replay and compaction
+func TestLogStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ursa-logstore") // Init temp dir
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	defer os.RemoveAll(dir) // Remove temp dir
+
+	path := filepath.Join(dir, "test.db") // Get log path
+
+	store, err := OpenLogStore(path) // Open store
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	testStore(t, store) // Test store
+
+	store.Close() // Close store
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644) // Open log
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	record, _ := encodeLogRecord(logRecordPut, []byte("entry/d"), []byte("torn")) // Encode record
+	file.Write(record[:len(record)-2])                                            // Write torn record
+	file.Close()                                                                  // Close log
+
+	store, err = OpenLogStore(path) // Reopen store
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	defer store.Close() // Close store
+
+	if value, err := store.Get([]byte("entry/c")); err != nil || string(value) != "new value" { // Check replayed
+		t.Fatalf("expected new value, got %q (%v)", value, err) // Panic
+	}
+
+	if _, err := store.Get([]byte("entry/d")); !errors.Is(err, ErrKeyNotFound) { // Check torn record dropped
+		t.Fatalf("expected %v, got %v", ErrKeyNotFound, err) // Panic
+	}
+
+	total, live := store.Size() // Get sizes
+
+	reclaimed, err := store.Compact() // Compact log
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if reclaimed != total-live || reclaimed <= 0 { // Check reclaimed superseded records
+		t.Fatalf("expected %d bytes reclaimed, got %d", total-live, reclaimed) // Panic
+	}
+
+	if value, err := store.Get([]byte("header")); err != nil || string(value) != "value of header" { // Check compacted value
+		t.Fatalf("expected value of header, got %q (%v)", value, err) // Panic
+	}
+}
+
+// TestLogStoreOversizedRecord - test a record claiming more bytes than are left in the log is dropped without allocating them
+func TestLogStoreOversizedRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ursa-logstore") // Init temp dir
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	defer os.RemoveAll(dir) // Remove temp dir
+
+	path := filepath.Join(dir, "test.db") // Get log path
+
+	store, err := OpenLogStore(path) // Open store
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if err := store.Put([]byte("a"), []byte("value")); err != nil { // Put value
+		t.Fatal(err) // Panic
+	}
+
+	store.Close() // Close store
+
+	info, err := os.Stat(path) // Get log size before corruption
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644) // Open log
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	header := []byte{logRecordPut}                              // Init header
+	header = append(header, 1)                                  // Set key length
+	header = append(header, 0x80, 0x80, 0x80, 0x80, 0x80, 0x20) // Set value length (1 << 40)
+	file.Write(append(header, 'b', 'x', 'x'))                   // Write corrupt record
+	file.Close()                                                // Close log
+
+	store, err = OpenLogStore(path) // Reopen store
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	defer store.Close() // Close store
+
+	if value, err := store.Get([]byte("a")); err != nil || string(value) != "value" { // Check earlier records kept
+		t.Fatalf("expected value, got %q (%v)", value, err) // Panic
+	}
+
+	if total, _ := store.Size(); total != info.Size() { // Check corrupt record truncated
+		t.Fatalf("expected log size %d, got %d", info.Size(), total) // Panic
+	}
+}
+
+// TestLogStoreCorruptRecord - test a record failing its checksum before the end of the log is reported, keeping the log
+func TestLogStoreCorruptRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ursa-logstore") // Init temp dir
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	defer os.RemoveAll(dir) // Remove temp dir
+
+	path := filepath.Join(dir, "test.db") // Get log path
+
+	store, err := OpenLogStore(path) // Open store
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	for _, key := range []string{"a", "b"} { // Put values
+		if err := store.Put([]byte(key), []byte("value")); err != nil { // Put value
+			t.Fatal(err) // Panic
+		}
+	}
+
+	store.Close() // Close store
+
+	log, err := ioutil.ReadFile(path) // Read log
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	log[4] ^= 0xff // Flip a byte of the first value
+
+	if err := ioutil.WriteFile(path, log, 0644); err != nil { // Write corrupt log
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := OpenLogStore(path); !errors.Is(err, ErrCorruptLogRecord) { // Reopen store
+		t.Fatalf("expected %v, got %v", ErrCorruptLogRecord, err) // Panic
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Size() != int64(len(log)) { // Check log kept
+		t.Fatalf("expected log of %d bytes to be kept (%v)", len(log), err) // Panic
+	}
+}
@@ -0,0 +1,212 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// GuestMemory - bounds-checked view of a vm's linear memory for host functions. Accesses outside of
+// memory return TrapOutOfBoundsMemory instead of panicking; host functions can return it (or panic
+// with it) to trap the call. Writes mark the pages they touch, so they are snapshotted and rolled back.
+type GuestMemory struct {
+	vm *VirtualMachine // Vm owning the memory
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// GuestMemory - get a bounds-checked view of the vm's linear memory
+func (vm *VirtualMachine) GuestMemory() GuestMemory {
+	return GuestMemory{vm: vm} // Return view
+}
+
+// Size - get the size of memory in bytes
+func (memory GuestMemory) Size() uint32 {
+	return uint32(len(memory.vm.Memory)) // Return size
+}
+
+// Read - copy length bytes starting at ptr
+func (memory GuestMemory) Read(ptr uint32, length uint32) ([]byte, error) {
+	data, err := memory.slice(ptr, length) // Get range
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	return append([]byte(nil), data...), nil // Return copy
+}
+
+// Write - copy data to memory starting at ptr
+func (memory GuestMemory) Write(ptr uint32, data []byte) error {
+	if uint64(len(data)) > math.MaxUint32 { // Check fits in memory
+		return TrapOutOfBoundsMemory // Return error
+	}
+
+	if _, err := memory.slice(ptr, uint32(len(data))); err != nil { // Check range
+		return err // Return found error
+	}
+
+	memory.vm.MarkDirty(int(ptr), len(data)) // Mark written pages (copies memory shared with a clone)
+
+	copy(memory.vm.Memory[ptr:], data) // Copy data
+
+	return nil // No error occurred, return nil
+}
+
+// ReadUint8 - read the byte at ptr
+func (memory GuestMemory) ReadUint8(ptr uint32) (uint8, error) {
+	data, err := memory.slice(ptr, 1) // Get range
+
+	if err != nil { // Check for errors
+		return 0, err // Return found error
+	}
+
+	return data[0], nil // Return value
+}
+
+// ReadUint16 - read the little-endian uint16 at ptr
+func (memory GuestMemory) ReadUint16(ptr uint32) (uint16, error) {
+	data, err := memory.slice(ptr, 2) // Get range
+
+	if err != nil { // Check for errors
+		return 0, err // Return found error
+	}
+
+	return binary.LittleEndian.Uint16(data), nil // Return value
+}
+
+// ReadUint32 - read the little-endian uint32 at ptr
+func (memory GuestMemory) ReadUint32(ptr uint32) (uint32, error) {
+	data, err := memory.slice(ptr, 4) // Get range
+
+	if err != nil { // Check for errors
+		return 0, err // Return found error
+	}
+
+	return binary.LittleEndian.Uint32(data), nil // Return value
+}
+
+// ReadUint64 - read the little-endian uint64 at ptr
+func (memory GuestMemory) ReadUint64(ptr uint32) (uint64, error) {
+	data, err := memory.slice(ptr, 8) // Get range
+
+	if err != nil { // Check for errors
+		return 0, err // Return found error
+	}
+
+	return binary.LittleEndian.Uint64(data), nil // Return value
+}
+
+// ReadFloat32 - read the little-endian float32 at ptr
+func (memory GuestMemory) ReadFloat32(ptr uint32) (float32, error) {
+	bits, err := memory.ReadUint32(ptr) // Read bits
+
+	return math.Float32frombits(bits), err // Return value
+}
+
+// ReadFloat64 - read the little-endian float64 at ptr
+func (memory GuestMemory) ReadFloat64(ptr uint32) (float64, error) {
+	bits, err := memory.ReadUint64(ptr) // Read bits
+
+	return math.Float64frombits(bits), err // Return value
+}
+
+// WriteUint8 - write a byte at ptr
+func (memory GuestMemory) WriteUint8(ptr uint32, value uint8) error {
+	return memory.Write(ptr, []byte{value}) // Write value
+}
+
+// WriteUint16 - write a little-endian uint16 at ptr
+func (memory GuestMemory) WriteUint16(ptr uint32, value uint16) error {
+	data := make([]byte, 2)                    // Init buffer
+	binary.LittleEndian.PutUint16(data, value) // Encode value
+
+	return memory.Write(ptr, data) // Write value
+}
+
+// WriteUint32 - write a little-endian uint32 at ptr
+func (memory GuestMemory) WriteUint32(ptr uint32, value uint32) error {
+	data := make([]byte, 4)                    // Init buffer
+	binary.LittleEndian.PutUint32(data, value) // Encode value
+
+	return memory.Write(ptr, data) // Write value
+}
+
+// WriteUint64 - write a little-endian uint64 at ptr
+func (memory GuestMemory) WriteUint64(ptr uint32, value uint64) error {
+	data := make([]byte, 8)                    // Init buffer
+	binary.LittleEndian.PutUint64(data, value) // Encode value
+
+	return memory.Write(ptr, data) // Write value
+}
+
+// WriteFloat32 - write a little-endian float32 at ptr
+func (memory GuestMemory) WriteFloat32(ptr uint32, value float32) error {
+	return memory.WriteUint32(ptr, math.Float32bits(value)) // Write bits
+}
+
+// WriteFloat64 - write a little-endian float64 at ptr
+func (memory GuestMemory) WriteFloat64(ptr uint32, value float64) error {
+	return memory.WriteUint64(ptr, math.Float64bits(value)) // Write bits
+}
+
+// ReadString - read the length bytes starting at ptr as a string
+func (memory GuestMemory) ReadString(ptr uint32, length uint32) (string, error) {
+	data, err := memory.slice(ptr, length) // Get range
+
+	if err != nil { // Check for errors
+		return "", err // Return found error
+	}
+
+	return string(data), nil // Return string
+}
+
+// ReadPrefixedString - read a string stored as its little-endian uint32 length followed by its bytes
+func (memory GuestMemory) ReadPrefixedString(ptr uint32) (string, error) {
+	length, err := memory.ReadUint32(ptr) // Read length
+
+	if err != nil || ptr > math.MaxUint32-4 { // Check for errors
+		return "", TrapOutOfBoundsMemory // Return error
+	}
+
+	return memory.ReadString(ptr+4, length) // Read string
+}
+
+// ReadCString - read a NUL-terminated string starting at ptr, scanning at most maxLength bytes for the
+// terminator (0 to scan to the end of memory). A string without a terminator in range is out of bounds.
+func (memory GuestMemory) ReadCString(ptr uint32, maxLength uint32) (string, error) {
+	if uint64(ptr) >= uint64(len(memory.vm.Memory)) { // Check in bounds
+		return "", TrapOutOfBoundsMemory // Return error
+	}
+
+	data := memory.vm.Memory[ptr:] // Get rest of memory
+
+	if maxLength > 0 && uint64(maxLength) < uint64(len(data)) { // Check limited
+		data = data[:maxLength] // Limit scan
+	}
+
+	end := bytes.IndexByte(data, 0) // Find terminator
+
+	if end < 0 { // Check not found
+		return "", TrapOutOfBoundsMemory // Return error
+	}
+
+	return string(data[:end]), nil // Return string
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// slice - get the live memory range of length bytes starting at ptr
+func (memory GuestMemory) slice(ptr uint32, length uint32) ([]byte, error) {
+	end := uint64(ptr) + uint64(length) // Get end
+
+	if end > uint64(len(memory.vm.Memory)) { // Check in bounds
+		return nil, TrapOutOfBoundsMemory // Return error
+	}
+
+	return memory.vm.Memory[ptr:end], nil // Return range
+}
+
+/* END INTERNAL METHODS */
@@ -0,0 +1,110 @@
+package vm
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestGuestMemory - test guest memory reads and writes round trip and are bounds checked
+func TestGuestMemory(t *testing.T) {
+	vm := newSnapshotTestVM(t) // Init vm
+
+	memory := vm.GuestMemory() // Get view
+	size := memory.Size()      // Get size
+
+	if err := memory.WriteUint16(0, 0xbeef); err != nil { // Write u16
+		t.Fatal(err) // Panic
+	}
+
+	if err := memory.WriteUint64(8, 1<<63|5); err != nil { // Write u64
+		t.Fatal(err) // Panic
+	}
+
+	if err := memory.WriteFloat64(16, -2.5); err != nil { // Write f64
+		t.Fatal(err) // Panic
+	}
+
+	if value, err := memory.ReadUint8(1); err != nil || value != 0xbe { // Check little endian
+		t.Fatalf("expected 0xbe, got %#x (%v)", value, err) // Panic
+	}
+
+	if value, err := memory.ReadUint64(8); err != nil || value != 1<<63|5 { // Read u64
+		t.Fatalf("expected %d, got %d (%v)", uint64(1<<63|5), value, err) // Panic
+	}
+
+	if value, err := memory.ReadFloat64(16); err != nil || value != -2.5 { // Read f64
+		t.Fatalf("expected -2.5, got %v (%v)", value, err) // Panic
+	}
+
+	if pages := vm.DirtyPages(); len(pages) != 1 || pages[0] != 0 { // Check writes marked
+		t.Fatalf("expected page 0 to be dirty, got %v", pages) // Panic
+	}
+
+	if err := memory.WriteUint32(32, 5); err != nil { // Write length prefix
+		t.Fatal(err) // Panic
+	}
+
+	if err := memory.Write(36, []byte("hello\x00")); err != nil { // Write string
+		t.Fatal(err) // Panic
+	}
+
+	if value, err := memory.ReadPrefixedString(32); err != nil || value != "hello" { // Read prefixed string
+		t.Fatalf("expected hello, got %q (%v)", value, err) // Panic
+	}
+
+	if value, err := memory.ReadCString(36, 0); err != nil || value != "hello" { // Read NUL terminated string
+		t.Fatalf("expected hello, got %q (%v)", value, err) // Panic
+	}
+
+	if _, err := memory.ReadCString(36, 4); !errors.Is(err, TrapOutOfBoundsMemory) { // Terminator past limit
+		t.Fatalf("expected out of bounds error, got %v", err) // Panic
+	}
+
+	if _, err := memory.ReadUint32(size - 2); !errors.Is(err, TrapOutOfBoundsMemory) { // Read across end
+		t.Fatalf("expected out of bounds error, got %v", err) // Panic
+	}
+
+	if err := memory.WriteUint32(0xfffffffe, 1); !errors.Is(err, TrapOutOfBoundsMemory) { // Write wrapping pointer
+		t.Fatalf("expected out of bounds error, got %v", err) // Panic
+	}
+
+	if _, err := memory.Read(size, 0); err != nil { // Empty read at end
+		t.Fatal(err) // Panic
+	}
+
+	if err := memory.WriteUint32(size-4, 7); err != nil { // Write last word
+		t.Fatal(err) // Panic
+	}
+
+	if err := memory.WriteUint32(32, 0xffffffff); err != nil { // Write oversized length prefix
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := memory.ReadPrefixedString(32); !errors.Is(err, TrapOutOfBoundsMemory) { // Read oversized string
+		t.Fatalf("expected out of bounds error, got %v", err) // Panic
+	}
+}
+
+// TestGuestMemoryTrap - test host functions returning a guest memory error trap the call
+func TestGuestMemoryTrap(t *testing.T) {
+	module := newHostTestModule(t) // Init module
+	delete(module.functions, "check")
+
+	if err := module.Func("check", func(vm *VirtualMachine, ptr uint32) error {
+		_, err := vm.GuestMemory().ReadUint32(ptr) // Read guest pointer
+
+		return err // Return error
+	}); err != nil { // Register function
+		t.Fatal(err) // Panic
+	}
+
+	vm, err := newHostTestVM(t, module) // Init vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := vm.Call("check", I32(-1)); !errors.Is(err, TrapOutOfBoundsMemory) { // Read malformed pointer
+		t.Fatalf("expected out of bounds memory trap, got %v", err) // Panic
+	}
+}
@@ -0,0 +1,59 @@
+package vm
+
+import "github.com/SummerCash/ursa/compiler/opcodes"
+
+/* BEGIN INTERNAL METHODS */
+
+// runNested - run a function called by a host function on top of the host call's frame, leaving the
+// enclosing run as it was once the call returns or traps
+func (vm *VirtualMachine) runNested(functionID int, params ...int64) (int64, error) {
+	base, entryFrame, numValueSlots := vm.CurrentFrame, vm.entryFrame, vm.NumValueSlots // Get enclosing call stack
+	returnValue, yielded := vm.ReturnValue, vm.Yielded                                  // Get enclosing results
+
+	defer func() {
+		for i := base + 1; i <= vm.CurrentFrame && i < len(vm.CallStack); i++ { // Iterate through frames left by a trap
+			vm.CallStack[i] = Frame{} // Clear frame
+		}
+
+		vm.CurrentFrame = base           // Return to host call frame
+		vm.entryFrame = entryFrame       // Restore entry frame
+		vm.NumValueSlots = numValueSlots // Restore value slots
+		vm.ReturnValue = returnValue     // Restore return value
+		vm.Yielded = yielded             // Restore yielded value
+		vm.Exited = false                // Enclosing run is still running
+		vm.ExitError = nil               // Enclosing run has not failed
+	}()
+
+	if err := vm.enterNested(functionID, params); err != nil { // Push frame
+		return -1, err // Return found error
+	}
+
+	vm.entryFrame = base + 1 // Return once the called function returns
+	vm.Exited = false        // Set running
+
+	return vm.resume(vm.Context()) // Run until the called function returns
+}
+
+// enterNested - push the frame of a function called by a host function
+func (vm *VirtualMachine) enterNested(functionID int, params []int64) (err error) {
+	defer func() {
+		if cause := recover(); cause != nil { // Check call stack exhausted
+			err = vm.newTrap(cause, nil, 0, opcodes.Nop) // Set error
+		}
+	}()
+
+	vm.CurrentFrame++ // Increment current frame
+
+	frame := vm.GetCurrentFrame() // Get current frame
+	frame.Init(                   // Initialize frame
+		vm,
+		functionID,
+		vm.FunctionCode[functionID],
+	)
+
+	copy(frame.Locals, params) // Copy params to frame locals
+
+	return nil // No error occurred, return nil
+}
+
+/* END INTERNAL METHODS */
@@ -0,0 +1,128 @@
+package vm
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// newCallbackTestVM - initialize a vm running the callback example module, whose host functions call back into it
+func newCallbackTestVM(t *testing.T) *VirtualMachine {
+	env := NewHostModule("env") // Init module
+
+	functions := map[string]interface{}{
+		"map": func(vm *VirtualMachine, value int32) (int32, error) {
+			results, err := vm.Call("square", I32(value)) // Call guest
+
+			if err != nil { // Check for errors
+				return 0, err // Return found error
+			}
+
+			return results[0].I32(), nil // Return square
+		},
+		"greet": func(vm *VirtualMachine) (uint32, error) {
+			results, err := vm.Call("alloc", I32(5)) // Allocate guest memory
+
+			if err != nil { // Check for errors
+				return 0, err // Return found error
+			}
+
+			ptr := uint32(results[0].I32()) // Get pointer
+
+			return ptr, vm.GuestMemory().Write(ptr, []byte("hello")) // Return string
+		},
+		"deep": func(vm *VirtualMachine, n int32) (int32, error) {
+			if n == 0 { // Check bottom
+				return 0, nil // Return depth
+			}
+
+			results, err := vm.Call("down", I32(n-1)) // Recurse through guest
+
+			if err != nil { // Check for errors
+				return 0, err // Return found error
+			}
+
+			return results[0].I32() + 1, nil // Return depth
+		},
+		"guarded": func(vm *VirtualMachine) int32 {
+			if _, err := vm.Call("trap"); !errors.Is(err, TrapUnreachable) { // Call trapping guest function
+				return -1 // Unexpected result
+			}
+
+			return 7 // Recovered
+		},
+	} // Init functions
+
+	for name, fn := range functions { // Iterate through functions
+		if err := env.Func(name, fn); err != nil { // Register function
+			t.Fatal(err) // Panic
+		}
+	}
+
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/callback.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	vm, err := NewVirtualMachine(testSourceFile, Environment{StateStore: StateStoreMemory, MaxCallStackDepth: 64}, env, nil) // Init vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	return vm // Return vm
+}
+
+// TestNestedCalls - test host functions can call back into the guest and use its results
+func TestNestedCalls(t *testing.T) {
+	vm := newCallbackTestVM(t) // Init vm
+
+	if results, err := vm.Call("run", I32(5)); err != nil || results[0].I32() != 26 { // Map through guest
+		t.Fatalf("expected 26, got %v (%v)", results, err) // Panic
+	}
+
+	for _, expected := range []int32{1024, 1029} { // Return two strings
+		results, err := vm.Call("hello") // Get string from host
+
+		if err != nil || results[0].I32() != expected { // Check allocated by guest
+			t.Fatalf("expected %d, got %v (%v)", expected, results, err) // Panic
+		}
+
+		if value, err := vm.GuestMemory().ReadString(uint32(expected), 5); err != nil || value != "hello" { // Check written
+			t.Fatalf("expected hello, got %q (%v)", value, err) // Panic
+		}
+	}
+
+	if results, err := vm.Call("down", I32(10)); err != nil || results[0].I32() != 10 { // Recurse through host and guest
+		t.Fatalf("expected 10, got %v (%v)", results, err) // Panic
+	}
+
+	if results, err := vm.Call("recover"); err != nil || results[0].I32() != 7 { // Recover from a trapping callback
+		t.Fatalf("expected 7, got %v (%v)", results, err) // Panic
+	}
+
+	if vm.NumValueSlots != 0 || vm.CurrentFrame != -1 { // Check call stack unwound
+		t.Fatalf("expected empty call stack, got frame %d with %d value slots", vm.CurrentFrame, vm.NumValueSlots) // Panic
+	}
+}
+
+// TestNestedCallLimits - test calls made by host functions share the call stack limit of the enclosing run
+func TestNestedCallLimits(t *testing.T) {
+	vm := newCallbackTestVM(t) // Init vm
+
+	if _, err := vm.Call("down", I32(100)); !errors.Is(err, TrapCallStackExhausted) { // Recurse past the depth limit
+		t.Fatalf("expected call stack exhausted trap, got %v", err) // Panic
+	}
+
+	vm.Reset() // Clear trap
+
+	if results, err := vm.Call("run", I32(3)); err != nil || results[0].I32() != 10 { // Check still usable
+		t.Fatalf("expected 10, got %v (%v)", results, err) // Panic
+	}
+
+	if vm.NumValueSlots != 0 || vm.entryFrame != 0 { // Check nested state unwound
+		t.Fatalf("expected unwound call stack, got %d value slots", vm.NumValueSlots) // Panic
+	}
+}
@@ -0,0 +1,235 @@
+package vm
+
+import (
+	"fmt"
+)
+
+// PrunePolicy - entries of a state database to keep when pruning. The working root and labeled
+// entries are always kept, as is every entry on the path from a kept entry to the (possibly new) state root.
+type PrunePolicy struct {
+	KeepLast int `json:"keep_last"` // Number of entries to keep on the working branch, counting back from the working root (0 keeps the whole branch)
+
+	Checkpoints [][]byte `json:"checkpoints"` // IDs of entries to keep
+
+	DropBranchesBefore uint64 `json:"drop_branches_before"` // Drop branches off the working branch whose latest entry has a lower nonce (0 keeps all branches)
+}
+
+// PruneResult - outcome of pruning a state database
+type PruneResult struct {
+	Removed int `json:"removed"` // Number of entries removed
+
+	ReclaimedBytes int64 `json:"reclaimed_bytes"` // Bytes freed in the store (by compaction for stores supporting it, otherwise the encoded size of removed entries)
+}
+
+// compactor - store that can reclaim the space of removed keys
+type compactor interface {
+	Compact() (int64, error) // Rewrite store without removed keys, returning bytes reclaimed
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// Prune - remove the entries not kept by the given policy from the state database and its store. If
+// the state root is removed, the oldest kept entry becomes the new root.
+func (stateDB *StateDatabase) Prune(policy PrunePolicy) (*PruneResult, error) {
+	if stateDB.WorkingRoot == nil || stateDB.StateRoot == nil { // Check has roots
+		return nil, ErrNilStateEntry // Return error
+	}
+
+	kept, err := stateDB.keptEntries(policy) // Get kept entries
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	root := stateDB.keptRoot(kept) // Get new root
+
+	for id := range kept { // Iterate through kept entries
+		for current := stateDB.index().entries[id]; current != root; current = stateDB.index().parents[string(current.ID)] { // Walk towards the new root
+			kept[string(current.ID)] = true // Keep ancestor
+		}
+	}
+
+	kept[string(root.ID)] = true // Keep root
+
+	if root != stateDB.StateRoot && !root.State.IsFullSnapshot() { // Check root changes
+		base, err := stateDB.ReconstructMemory(root) // Rebuild memory of new root
+
+		if err != nil { // Check for errors
+			return nil, err // Return found error
+		}
+
+		stateDB.baseMemory = base // Set base memory
+	} else if root != stateDB.StateRoot {
+		stateDB.baseMemory = nil // New root is a full snapshot
+	}
+
+	result := &PruneResult{} // Init result
+
+	var removed []*StateEntry // Init removed buffer
+	var states []*StateEntry  // Init kept buffer
+
+	parents := stateDB.parents() // Get parents
+
+	for _, entry := range stateDB.States { // Iterate through states
+		if !kept[string(entry.ID)] { // Check removed
+			result.ReclaimedBytes += int64(len(encodeRecord(entry, parents[string(entry.ID)]))) // Count encoded size
+			removed = append(removed, entry)                                                    // Remove entry
+
+			continue // Continue
+		}
+
+		children := entry.State.StateChildren[:0] // Init kept children
+
+		for _, child := range entry.State.StateChildren { // Iterate through children
+			if kept[string(child.ID)] { // Check kept
+				children = append(children, child) // Keep child
+			}
+		}
+
+		entry.State.StateChildren = children // Set children
+		states = append(states, entry)       // Keep entry
+	}
+
+	result.Removed = len(removed) // Set removed count
+
+	stateDB.States = states  // Set states
+	stateDB.StateRoot = root // Set root
+	stateDB.stateIndex = nil // Reset index
+
+	if stateDB.store == nil { // Check not persisted
+		return result, nil // Return result
+	}
+
+	for _, entry := range removed { // Iterate through removed entries
+		if err = stateDB.store.Delete(append([]byte(stateEntryKeyPrefix), entry.ID...)); err != nil { // Delete entry
+			return nil, err // Return found error
+		}
+	}
+
+	if err = stateDB.putBase(); err != nil { // Write base memory
+		return nil, err // Return found error
+	}
+
+	if err = stateDB.putHeader(); err != nil { // Write header
+		return nil, err // Return found error
+	}
+
+	if store, ok := stateDB.store.(compactor); ok { // Check can compact
+		if result.ReclaimedBytes, err = store.Compact(); err != nil { // Compact store
+			return nil, err // Return found error
+		}
+	}
+
+	return result, nil // Return result
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// keptEntries - get the IDs of the entries the given policy keeps (not including the paths between them)
+func (stateDB *StateDatabase) keptEntries(policy PrunePolicy) (map[string]bool, error) {
+	kept := make(map[string]bool) // Init kept set
+
+	branch, err := stateDB.History(stateDB.WorkingRoot.ID) // Get working branch
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	onBranch := make(map[string]bool, len(branch)) // Init working branch set
+
+	for i, entry := range branch { // Iterate through working branch
+		onBranch[string(entry.ID)] = true // Add to set
+
+		if policy.KeepLast <= 0 || i < policy.KeepLast { // Check within last n
+			kept[string(entry.ID)] = true // Keep entry
+		}
+	}
+
+	for _, id := range policy.Checkpoints { // Iterate through checkpoints
+		if _, err := stateDB.QueryState(id); err != nil { // Check exists
+			return nil, fmt.Errorf("%w: checkpoint %x", err, id) // Return error
+		}
+
+		kept[string(id)] = true // Keep checkpoint
+	}
+
+	for _, label := range stateDB.Labels { // Iterate through labels
+		kept[string(label.ID)] = true // Keep labeled entry
+	}
+
+	for _, entry := range branch { // Iterate through working branch
+		for _, child := range entry.State.StateChildren { // Iterate through forks
+			if onBranch[string(child.ID)] { // Check on working branch
+				continue // Skip
+			}
+
+			subtree := collectSubtree(child) // Get branch
+
+			latest := uint64(0) // Init latest nonce
+
+			for _, forked := range subtree { // Iterate through branch
+				if forked.Nonce > latest { // Check later
+					latest = forked.Nonce // Set latest
+				}
+			}
+
+			if policy.DropBranchesBefore != 0 && latest < policy.DropBranchesBefore { // Check abandoned
+				continue // Drop branch (except checkpoints)
+			}
+
+			for _, forked := range subtree { // Iterate through branch
+				kept[string(forked.ID)] = true // Keep entry
+			}
+		}
+	}
+
+	return kept, nil // Return kept entries
+}
+
+// keptRoot - get the deepest entry that is an ancestor of (or is) every kept entry
+func (stateDB *StateDatabase) keptRoot(kept map[string]bool) *StateEntry {
+	var root []*StateEntry // Init path of root (from the state root)
+
+	for id := range kept { // Iterate through kept entries
+		history, _ := stateDB.History([]byte(id)) // Get path to state root
+
+		path := make([]*StateEntry, len(history)) // Init path from state root
+
+		for i, entry := range history { // Iterate through history
+			path[len(history)-1-i] = entry // Reverse
+		}
+
+		if root == nil { // Check first
+			root = path // Set path
+
+			continue // Continue
+		}
+
+		common := 0 // Init common prefix length
+
+		for common < len(root) && common < len(path) && root[common] == path[common] { // Iterate through common ancestors
+			common++ // Extend prefix
+		}
+
+		root = root[:common] // Keep common ancestors
+	}
+
+	return root[len(root)-1] // Return deepest common ancestor
+}
+
+// collectSubtree - get the given entry and all of its descendants
+func collectSubtree(entry *StateEntry) []*StateEntry {
+	subtree := []*StateEntry{entry} // Init subtree
+
+	for i := 0; i < len(subtree); i++ { // Iterate breadth first
+		if subtree[i].State != nil { // Check has state
+			subtree = append(subtree, subtree[i].State.StateChildren...) // Append children
+		}
+	}
+
+	return subtree // Return subtree
+}
+
+/* END INTERNAL METHODS */
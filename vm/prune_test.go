@@ -0,0 +1,117 @@
+package vm
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestPruneKeepLast - test pruning all but the last entries of the working branch moves the root and keeps memory intact
+func TestPruneKeepLast(t *testing.T) {
+	vm := newSnapshotTestVM(t) // Init vm
+
+	var entries []*StateEntry // Init entry buffer
+
+	for i := 1; i <= 5; i++ { // Save a state after each write
+		if _, err := vm.Call("store", I32(int32(i*DefaultPageSize/2)), I32(int32(i))); err != nil { // Write
+			t.Fatal(err) // Panic
+		}
+
+		if err := vm.SaveState(); err != nil { // Save state
+			t.Fatal(err) // Panic
+		}
+
+		entries = append(entries, vm.StateDB.WorkingRoot) // Append entry
+	}
+
+	result, err := vm.StateDB.Prune(PrunePolicy{KeepLast: 2}) // Prune
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if result.Removed != 4 || result.ReclaimedBytes <= 0 { // Check root and first three saves removed
+		t.Fatalf("expected 4 entries removed with bytes reclaimed, got %d (%d bytes)", result.Removed, result.ReclaimedBytes) // Panic
+	}
+
+	if len(vm.StateDB.States) != 2 || vm.StateDB.StateRoot != entries[3] { // Check new root
+		t.Fatalf("expected 2 states rooted at the fourth save, got %d", len(vm.StateDB.States)) // Panic
+	}
+
+	if _, err := vm.StateDB.QueryState(entries[0].ID); !errors.Is(err, ErrNilStateEntry) { // Check removed
+		t.Fatalf("expected pruned entry to be gone, got %v", err) // Panic
+	}
+
+	check := func(when string) {
+		if err := vm.ResetToState(entries[3].ID); err != nil { // Reset to new root
+			t.Fatal(err) // Panic
+		}
+
+		for i := 1; i <= 5; i++ { // Check each write
+			expected := byte(i) // Get expected value
+
+			if i == 5 { // Check written after new root
+				expected = 0 // Not yet written
+			}
+
+			if value := vm.Memory[i*DefaultPageSize/2]; value != expected { // Check value
+				t.Fatalf("%s: expected %d at write %d, got %d", when, expected, i, value) // Panic
+			}
+		}
+	}
+
+	check("after pruning") // Check in memory
+
+	if err := vm.LoadWorkingRoot(); err != nil { // Reload from store
+		t.Fatal(err) // Panic
+	}
+
+	if len(vm.StateDB.States) != 2 { // Check store pruned
+		t.Fatalf("expected 2 states in store, got %d", len(vm.StateDB.States)) // Panic
+	}
+
+	check("after reloading") // Check from store
+}
+
+// TestPruneBranches - test abandoned branches are dropped unless they hold a checkpoint
+func TestPruneBranches(t *testing.T) {
+	vm, entries := newBranchedTestDB(t) // Init db (working root d)
+	a, b, c := entries[1], entries[2], entries[3]
+
+	result, err := vm.StateDB.Prune(PrunePolicy{DropBranchesBefore: 3}) // Prune branches older than c
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if result.Removed != 0 { // Check branch a kept (c has nonce 3)
+		t.Fatalf("expected nothing removed, got %d", result.Removed) // Panic
+	}
+
+	if _, err = vm.StateDB.Prune(PrunePolicy{Checkpoints: [][]byte{[]byte("unknown")}}); !errors.Is(err, ErrNilStateEntry) { // Prune with unknown checkpoint
+		t.Fatalf("expected unknown checkpoint error, got %v", err) // Panic
+	}
+
+	if result, err = vm.StateDB.Prune(PrunePolicy{DropBranchesBefore: 4, Checkpoints: [][]byte{b.ID}}); err != nil { // Prune branch a, keeping b
+		t.Fatal(err) // Panic
+	}
+
+	if result.Removed != 1 || len(vm.StateDB.States) != 4 { // Check only c removed
+		t.Fatalf("expected only c removed, got %d removed", result.Removed) // Panic
+	}
+
+	if _, err = vm.StateDB.QueryState(c.ID); !errors.Is(err, ErrNilStateEntry) { // Check c removed
+		t.Fatalf("expected c to be gone, got %v", err) // Panic
+	}
+
+	if children, _ := vm.StateDB.Children(a.ID); len(children) != 1 || children[0] != b { // Check a's children
+		t.Fatalf("expected a to have only child b, got %d children", len(children)) // Panic
+	}
+
+	if err = vm.ResetToState(b.ID); err != nil { // Reset to checkpoint
+		t.Fatal(err) // Panic
+	}
+
+	if results, err := vm.Call("load", I32(0)); err != nil || results[0].I32() != 2 { // Check checkpoint memory
+		t.Fatalf("expected 2 at checkpoint, got %v (%v)", results, err) // Panic
+	}
+}
@@ -0,0 +1,223 @@
+package vm
+
+import "fmt"
+
+/* BEGIN EXPORTED METHODS */
+
+// MarkDirty - record that the given range of memory is about to be written. Store instructions mark
+// the pages they write automatically; host functions writing to vm.Memory directly must call MarkDirty
+// before writing, or their writes will be missing from the next incremental snapshot and will not be
+// rolled back with a transaction. MarkDirty copies memory shared with a clone, so slices of vm.Memory
+// must be taken after calling it. Bytes beyond the end of memory are ignored.
+func (vm *VirtualMachine) MarkDirty(offset int, length int) {
+	if length <= 0 || offset < 0 || offset >= len(vm.Memory) { // Check nothing written in memory
+		return // Nothing to mark
+	}
+
+	if offset+length > len(vm.Memory) { // Check write runs past memory
+		length = len(vm.Memory) - offset // Clamp
+	}
+
+	last := (offset + length - 1) / DefaultPageSize // Get last page
+
+	vm.ownMemory() // Copy memory shared with a clone
+
+	if last >= len(vm.dirtyPages) { // Check page not yet tracked
+		vm.dirtyPages = append(vm.dirtyPages, make([]bool, last+1-len(vm.dirtyPages))...) // Track pages
+	}
+
+	if vm.transaction != nil { // Check in transaction
+		vm.transaction.journal(vm.Memory, offset/DefaultPageSize, last) // Save pages before their first write
+	}
+
+	for page := offset / DefaultPageSize; page <= last; page++ { // Iterate through written pages
+		vm.dirtyPages[page] = true // Mark page
+	}
+}
+
+// DirtyPages - get the indexes of the memory pages written since the last saved state, in order
+func (vm *VirtualMachine) DirtyPages() []uint32 {
+	var pages []uint32 // Init page buffer
+
+	for page, dirty := range vm.dirtyPages { // Iterate through pages
+		if dirty && (page+1)*DefaultPageSize <= len(vm.Memory) { // Check written page in memory
+			pages = append(pages, uint32(page)) // Append page
+		}
+	}
+
+	return pages // Return pages
+}
+
+// ReconstructMemory - rebuild the memory of the given entry by overlaying the pages written by each
+// entry on its path from the nearest full snapshot (or from the memory left by pruning the entries
+// before the root). The returned memory is a copy.
+func (stateDB *StateDatabase) ReconstructMemory(entry *StateEntry) ([]byte, error) {
+	if entry == nil || entry.State == nil { // Check no state
+		return nil, ErrNilStateEntry // Return error
+	}
+
+	if entry.State.IsFullSnapshot() { // Check full snapshot
+		return append([]byte(nil), entry.State.Memory...), nil // Return copy
+	}
+
+	memory := make([]byte, entry.State.MemorySize) // Init memory
+	restored := make(map[uint32]bool)              // Init restored page set
+
+	parents := stateDB.parents() // Get parents
+
+	for current := entry; current != nil; current = parents[string(current.ID)] { // Walk towards the root
+		if current.State == nil { // Check no state
+			return nil, ErrNilStateEntry // Return error
+		}
+
+		if current.State.IsFullSnapshot() { // Check full snapshot
+			for start := 0; start < len(memory) && start < len(current.State.Memory); start += DefaultPageSize { // Iterate through pages
+				if !restored[uint32(start/DefaultPageSize)] { // Check not overwritten by a later entry
+					copy(memory[start:start+DefaultPageSize], current.State.Memory[start:]) // Copy page
+				}
+			}
+
+			return memory, nil // Older entries are covered by the snapshot
+		}
+
+		for page, data := range current.State.Pages { // Iterate through written pages
+			start := int(page) * DefaultPageSize // Get page offset
+
+			if restored[page] || start >= len(memory) { // Check overwritten by a later entry
+				continue // Skip
+			}
+
+			copy(memory[start:], data) // Copy page
+			restored[page] = true      // Mark restored
+		}
+	}
+
+	for start := 0; start < len(memory) && start < len(stateDB.baseMemory); start += DefaultPageSize { // Iterate through pages of pruned entries
+		if !restored[uint32(start/DefaultPageSize)] { // Check not overwritten by a kept entry
+			copy(memory[start:start+DefaultPageSize], stateDB.baseMemory[start:]) // Copy page
+		}
+	}
+
+	return memory, nil // Return reconstructed memory
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// captureState - capture the vm's state, holding only the memory pages written since the working root
+func (vm *VirtualMachine) captureState() *State {
+	state := &State{
+		CallStack:        copyCallStack(vm.CallStack, vm.CurrentFrame), // Set call stack
+		CurrentFrame:     vm.CurrentFrame,                              // Set current frame
+		Table:            append([]uint32(nil), vm.Table...),           // Set table
+		Globals:          append([]int64(nil), vm.Globals...),          // Set globals
+		MemorySize:       len(vm.Memory),                               // Set memory size
+		NumValueSlots:    vm.NumValueSlots,                             // Set value slots
+		Yielded:          vm.Yielded,                                   // Set yielded
+		InsideExecute:    vm.InsideExecute,                             // Set inside execute
+		Exited:           vm.Exited,                                    // Set has exited
+		ExitError:        vm.ExitError,                                 // Set exit error
+		ReturnValue:      vm.ReturnValue,                               // Set return value
+		Gas:              vm.Gas,                                       // Set gas
+		GasLimitExceeded: vm.GasLimitExceeded,                          // Set gas limit exceeded
+		Suspended:        vm.Suspended,                                 // Set suspended
+		Storage:          copyStorage(vm.Storage),                      // Set storage
+		MerkleRoot:       vm.StateRoot(),                               // Set state commitment
+		Pages:            vm.dirtyPageData(),                           // Set pages written since the working root
+	} // Init state
+
+	return state // Return state
+}
+
+// dirtyPageData - copy the memory pages written since the last saved state
+func (vm *VirtualMachine) dirtyPageData() map[uint32][]byte {
+	pages := make(map[uint32][]byte) // Init page buffer
+
+	for _, page := range vm.DirtyPages() { // Iterate through dirty pages
+		start := int(page) * DefaultPageSize // Get page offset
+
+		pages[page] = append([]byte(nil), vm.Memory[start:start+DefaultPageSize]...) // Copy page
+	}
+
+	return pages // Return pages
+}
+
+// clearDirty - forget written pages (memory now matches the working root)
+func (vm *VirtualMachine) clearDirty() {
+	for page := range vm.dirtyPages { // Iterate through pages
+		vm.dirtyPages[page] = false // Clear page
+	}
+}
+
+// restoreState - load the given entry of the vm's state database into the vm
+func (vm *VirtualMachine) restoreState(entry *StateEntry) error {
+	memory, err := vm.StateDB.ReconstructMemory(entry) // Rebuild memory
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	state := entry.State // Get state
+
+	callStack := copyCallStack(state.CallStack, state.CurrentFrame) // Copy call stack
+
+	if err := vm.attachFrameCode(callStack, state.CurrentFrame); err != nil { // Reattach frame code
+		return err // Return found error
+	}
+
+	vm.StateDB.SetWorkingRoot(entry) // Set working root
+
+	(*vm).CallStack = callStack                            // Set call stack
+	(*vm).CurrentFrame = state.CurrentFrame                // Set current frame
+	(*vm).Table = append([]uint32(nil), state.Table...)    // Set table
+	(*vm).Globals = append([]int64(nil), state.Globals...) // Set globals
+	(*vm).Memory = memory                                  // Set memory
+	(*vm).pageHashes = nil                                 // Rehash restored memory
+	(*vm).memoryShared = false                             // Restored memory is a copy
+	(*vm).NumValueSlots = state.NumValueSlots              // Set # value slots
+	(*vm).Yielded = state.Yielded                          // Set yielded
+	(*vm).InsideExecute = state.InsideExecute              // Set inside execute
+	(*vm).Exited = state.Exited                            // Set has exited
+	(*vm).ExitError = state.ExitError                      // Set exit error
+	(*vm).ReturnValue = state.ReturnValue                  // Set return val
+	(*vm).Gas = state.Gas                                  // Set gas
+	(*vm).GasLimitExceeded = state.GasLimitExceeded        // Set has exceeded gas limit
+	(*vm).Suspended = state.Suspended                      // Set suspended
+	(*vm).Storage = copyStorage(state.Storage)             // Set storage
+
+	vm.clearDirty() // Memory matches the working root
+
+	return nil // No error occurred, return nil
+}
+
+// attachFrameCode - set the code of each active frame to the bytecode of its function (frame
+// code is not encoded with states)
+func (vm *VirtualMachine) attachFrameCode(callStack []Frame, currentFrame int) error {
+	for i := 0; i <= currentFrame && i < len(callStack); i++ { // Iterate through active frames
+		id := callStack[i].FunctionID // Get function ID
+
+		if id < 0 || id >= len(vm.FunctionCode) { // Check function exists
+			return fmt.Errorf("%w: frame %d runs unknown function %d", ErrMalformedStateEncoding, i, id) // Return error
+		}
+
+		callStack[i].Code = vm.FunctionCode[id].Bytes // Set code
+	}
+
+	return nil // No error occurred, return nil
+}
+
+// copyCallStack - copy a call stack, so that later calls do not modify it (frames above the current frame are left empty)
+func copyCallStack(callStack []Frame, currentFrame int) []Frame {
+	copied := make([]Frame, len(callStack)) // Init call stack
+
+	for i := 0; i <= currentFrame && i < len(callStack); i++ { // Iterate through active frames
+		copied[i] = callStack[i]                                        // Copy frame
+		copied[i].Regs = append([]int64(nil), callStack[i].Regs...)     // Copy regs
+		copied[i].Locals = append([]int64(nil), callStack[i].Locals...) // Copy locals
+	}
+
+	return copied // Return copy
+}
+
+/* END INTERNAL METHODS */
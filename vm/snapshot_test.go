@@ -0,0 +1,117 @@
+package vm
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// newSnapshotTestVM - initialize a vm running the snapshot example module, keeping states in memory
+func newSnapshotTestVM(t *testing.T) *VirtualMachine {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/snapshot.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	vm, err := NewVirtualMachine(testSourceFile, Environment{StateStore: StateStoreMemory}, new(NopResolver), nil) // Init vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	return vm // Return vm
+}
+
+// TestDirtyPages - test stores mark the pages they write, including writes spanning two pages
+func TestDirtyPages(t *testing.T) {
+	vm := newSnapshotTestVM(t) // Init vm
+
+	if _, err := vm.Call("store", I32(8), I32(1)); err != nil { // Write page 0
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := vm.Call("store64", I32(2*DefaultPageSize-4), I64(-1)); err != nil { // Write pages 1 and 2
+		t.Fatal(err) // Panic
+	}
+
+	if pages := vm.DirtyPages(); len(pages) != 3 || pages[0] != 0 || pages[1] != 1 || pages[2] != 2 { // Check dirty pages
+		t.Fatalf("expected pages [0 1 2], got %v", pages) // Panic
+	}
+
+	if err := vm.SaveState(); err != nil { // Save state
+		t.Fatal(err) // Panic
+	}
+
+	if pages := vm.DirtyPages(); len(pages) != 0 { // Check cleared
+		t.Fatalf("expected no dirty pages after saving, got %v", pages) // Panic
+	}
+
+	state := vm.StateDB.WorkingRoot.State // Get saved state
+
+	if state.IsFullSnapshot() || len(state.Pages) != 3 || state.MemorySize != 4*DefaultPageSize { // Check incremental
+		t.Fatalf("expected 3 of 4 pages saved, got %d pages (full: %t)", len(state.Pages), state.IsFullSnapshot()) // Panic
+	}
+
+	vm.Memory[3*DefaultPageSize] = 1   // Write from host
+	vm.MarkDirty(3*DefaultPageSize, 1) // Mark host write
+
+	if pages := vm.DirtyPages(); len(pages) != 1 || pages[0] != 3 { // Check host write tracked
+		t.Fatalf("expected pages [3], got %v", pages) // Panic
+	}
+}
+
+// TestIncrementalSnapshots - test states saved as page deltas reset to the memory they were saved with
+func TestIncrementalSnapshots(t *testing.T) {
+	vm := newSnapshotTestVM(t) // Init vm
+
+	var ids [][]byte // Init state ID buffer
+
+	for i := 1; i <= 3; i++ { // Save a state after each write
+		if _, err := vm.Call("store", I32(int32(i*DefaultPageSize/2)), I32(int32(i))); err != nil { // Write
+			t.Fatal(err) // Panic
+		}
+
+		if i == 3 { // Check last write
+			if _, err := vm.Call("grow", I32(1)); err != nil { // Grow memory
+				t.Fatal(err) // Panic
+			}
+
+			if _, err := vm.Call("store", I32(4*DefaultPageSize), I32(4)); err != nil { // Write new page
+				t.Fatal(err) // Panic
+			}
+		}
+
+		if err := vm.SaveState(); err != nil { // Save state
+			t.Fatal(err) // Panic
+		}
+
+		ids = append(ids, vm.StateDB.WorkingRoot.ID) // Append state ID
+	}
+
+	if err := vm.ResetToState(ids[0]); err != nil { // Reset to first state
+		t.Fatal(err) // Panic
+	}
+
+	if len(vm.Memory) != 4*DefaultPageSize || vm.Memory[DefaultPageSize/2] != 1 || vm.Memory[DefaultPageSize] != 0 { // Check only first write
+		t.Fatalf("unexpected memory after reset to first state (%d bytes)", len(vm.Memory)) // Panic
+	}
+
+	if _, err := vm.Call("store", I32(DefaultPageSize), I32(9)); err != nil { // Write on a new branch
+		t.Fatal(err) // Panic
+	}
+
+	if err := vm.ResetToState(ids[2]); err != nil { // Reset to last state
+		t.Fatal(err) // Panic
+	}
+
+	for i, expected := range []byte{1, 2, 3} { // Check each write
+		if value := vm.Memory[(i+1)*DefaultPageSize/2]; value != expected { // Check value
+			t.Fatalf("expected %d at write %d, got %d", expected, i, value) // Panic
+		}
+	}
+
+	if results, err := vm.Call("load", I32(4*DefaultPageSize)); err != nil || results[0].I32() != 4 { // Check grown page
+		t.Fatalf("expected 4 in grown page, got %v (%v)", results, err) // Panic
+	}
+}
@@ -31,7 +31,9 @@ type State struct {
 
 	Globals []int64 `json:"globals"` // Global vrs
 
-	Memory []byte `json:"memory"` // Virtual machine memory
+	Memory     []byte            `json:"memory"`      // Full virtual machine memory (full snapshots only, e.g. the root)
+	MemorySize int               `json:"memory_size"` // Size of memory in bytes
+	Pages      map[uint32][]byte `json:"pages"`       // Memory pages written since the parent entry, by page index (incremental snapshots)
 
 	NumValueSlots int `json:"num_val_slots"` // Num of used value slots
 
@@ -47,6 +49,12 @@ type State struct {
 	Gas              uint64 `json:"gas"`                // Gas usage
 	GasLimitExceeded bool   `json:"gas_limit_exceeded"` // Has exceeded given gas limit
 
+	Suspended bool `json:"suspended"` // Suspended by a host function
+
+	Storage map[string][]byte `json:"storage"` // Persistent storage (see StorageModule)
+
+	MerkleRoot []byte `json:"merkle_root"` // Merkle commitment of memory, globals, table and storage (see VirtualMachine.StateRoot)
+
 	StateChildren []*StateEntry `json:"children"` // State children
 
 	ID []byte `json:"ID"` // State ID
@@ -57,31 +65,23 @@ type State struct {
 // NewStateEntry - initialize new state entry
 func NewStateEntry(callStack []Frame, currentFrame int, table []uint32, globals []int64, memory []byte, numValueSlots int, yielded int64, insideExecute bool, exited bool, exitError interface{}, returnValue int64, gas uint64, gasLimitExceeded bool, nonce uint64) *StateEntry {
 	state := &State{
-		CallStack:        callStack,        // Set call stack
-		CurrentFrame:     currentFrame,     // Set current frame
-		Table:            table,            // Set table
-		Globals:          globals,          // Set globals
-		Memory:           memory,           // Set memory
-		NumValueSlots:    numValueSlots,    // Set value slots
-		Yielded:          yielded,          // Set yielded
-		InsideExecute:    insideExecute,    // Set inside execute
-		Exited:           exited,           // Set has exited
-		ExitError:        exitError,        // Set exit error
-		ReturnValue:      returnValue,      // Set return value
-		Gas:              gas,              // Set gas
-		GasLimitExceeded: gasLimitExceeded, // Set gas limit exceeded
+		CallStack:        copyCallStack(callStack, currentFrame), // Set call stack
+		CurrentFrame:     currentFrame,                           // Set current frame
+		Table:            table,                                  // Set table
+		Globals:          globals,                                // Set globals
+		Memory:           memory,                                 // Set memory
+		MemorySize:       len(memory),                            // Set memory size
+		NumValueSlots:    numValueSlots,                          // Set value slots
+		Yielded:          yielded,                                // Set yielded
+		InsideExecute:    insideExecute,                          // Set inside execute
+		Exited:           exited,                                 // Set has exited
+		ExitError:        exitError,                              // Set exit error
+		ReturnValue:      returnValue,                            // Set return value
+		Gas:              gas,                                    // Set gas
+		GasLimitExceeded: gasLimitExceeded,                       // Set gas limit exceeded
 	} // Init state
 
-	(*state).ID = crypto.Sha3(state.Bytes()) // Hash
-
-	entry := &StateEntry{
-		State: state, // Set state
-		Nonce: nonce, // Set nonce
-	} // Init state db entry
-
-	(*entry).ID = crypto.Sha3(entry.Bytes()) // Hash
-
-	return entry // Return success
+	return newStateEntry(state, nonce) // Return success
 }
 
 // FindMax - find state child of greatest nonce value
@@ -107,15 +107,18 @@ func (stateEntry *StateEntry) FindMax() (*StateEntry, error) {
 	return lastState, nil // Return found max
 }
 
+// IsFullSnapshot - check whether the state holds all of memory, rather than only the pages written since its parent
+func (state *State) IsFullSnapshot() bool {
+	return state.Memory != nil // Full snapshots carry memory
+}
+
 /*
 	BEGIN TYPE HELPERS
 */
 
-// Bytes - get byte representation of state
+// Bytes - get the canonical byte representation of state, whose hash is the state's ID (see StateFromBytes)
 func (state *State) Bytes() []byte {
-	marshaledVal, _ := json.MarshalIndent(*state, "", "  ") // Marshal JSON
-
-	return marshaledVal // Return success
+	return encodeState(state) // Return encoded
 }
 
 // String - get string representation of state
@@ -125,11 +128,9 @@ func (state *State) String() string {
 	return string(marshaledVal) // Return success
 }
 
-// Bytes - get byte representation of entry
+// Bytes - get the canonical byte representation of entry, whose hash is the entry's ID (see StateEntryFromBytes)
 func (stateEntry *StateEntry) Bytes() []byte {
-	marshaledVal, _ := json.MarshalIndent(*stateEntry, "", "  ") // Marshal JSON
-
-	return marshaledVal // Return success
+	return encodeEntry(stateEntry) // Return encoded
 }
 
 // String - get string representation of entry
@@ -144,3 +145,21 @@ func (stateEntry *StateEntry) String() string {
 */
 
 /* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// newStateEntry - hash the given state and wrap it in an entry with the given nonce
+func newStateEntry(state *State, nonce uint64) *StateEntry {
+	(*state).ID = crypto.Sha3(state.Bytes()) // Hash
+
+	entry := &StateEntry{
+		State: state, // Set state
+		Nonce: nonce, // Set nonce
+	} // Init state db entry
+
+	(*entry).ID = crypto.Sha3(entry.Bytes()) // Hash
+
+	return entry // Return success
+}
+
+/* END INTERNAL METHODS */
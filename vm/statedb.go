@@ -2,11 +2,10 @@ package vm
 
 import (
 	"bytes"
-	"encoding/gob"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 
-	"github.com/SummerCash/ursa/common"
 	"github.com/SummerCash/ursa/crypto"
 )
 
@@ -27,7 +26,20 @@ type StateDatabase struct {
 
 	MerkleRoot []byte `json:"merkle_root"` // State merkle root
 
+	Labels map[string]*StateLabel `json:"labels"` // Named checkpoints and branches, by name
+	Branch string                 `json:"branch"` // Checked out branch, advanced by each state added on top of it ("" if none)
+
 	ID []byte `json:"ID"` // State DB ID
+
+	baseMemory []byte      // Memory the root's pages apply to, once entries before it have been pruned (nil if the root is a full snapshot)
+	store      Store       // Persistent store (nil until first written)
+	stateIndex *stateIndex // Entry lookup index (nil until first queried)
+
+	environment *Environment // Environment configuring the store opened on first write (the default store if nil)
+	unwritten   bool         // Entries not yet written to the store (written before its first write)
+
+	forkBase   []byte      // Rebuilt memory of forkBaseOf, shared by the vms forked from it (see forkRoot)
+	forkBaseOf *StateEntry // Entry forkBase was rebuilt for
 }
 
 /* BEGIN EXPORTED METHODS */
@@ -40,6 +52,10 @@ func NewStateDatabase(rootState *StateEntry) *StateDatabase {
 		MerkleRoot: crypto.Sha3(rootState.Bytes()), // Set merkle root
 	}
 
+	if rootState.State != nil && rootState.State.MerkleRoot != nil { // Check root has state commitment
+		stateDB.MerkleRoot = rootState.State.MerkleRoot // Set merkle root
+	}
+
 	(*stateDB).ID = crypto.Sha3(stateDB.Bytes()) // Set db id
 	(*stateDB).WorkingRoot = rootState           // Set working root
 
@@ -52,9 +68,9 @@ func (stateDB *StateDatabase) AddStateEntry(state *StateEntry, rootState *StateE
 		rootState = stateDB.WorkingRoot // Set root state to working root
 	}
 
-	_, err := stateDB.QueryState(state.ID) // Check state already in DB
+	index := stateDB.index() // Get index
 
-	if err == nil { // Check for already existent state
+	if _, ok := index.entries[string(state.ID)]; ok { // Check for already existent state
 		return ErrStateAlreadyExists // Return error
 	}
 
@@ -62,83 +78,80 @@ func (stateDB *StateDatabase) AddStateEntry(state *StateEntry, rootState *StateE
 		return ErrInvalidStateNonce // Return error
 	}
 
-	(*(*rootState).State).StateChildren = append((*(*rootState).State).StateChildren, state) // Append state
-	(*stateDB).States = append((*stateDB).States, state)                                     // Append to general states
+	next := *stateDB // Init database with the entry added (written to the store before the entry is linked)
+
+	if label, ok := stateDB.Labels[stateDB.Branch]; ok && label.IsBranch && bytes.Equal(label.ID, rootState.ID) { // Check added on top of checked out branch
+		next.Labels = make(map[string]*StateLabel, len(stateDB.Labels)) // Init labels
+
+		for name, label := range stateDB.Labels { // Iterate through labels
+			next.Labels[name] = label // Copy label
+		}
+
+		next.Labels[stateDB.Branch] = &StateLabel{ID: state.ID, IsBranch: true} // Advance branch
+	}
 
-	(*stateDB).WorkingRoot = state // Set working root
+	next.SetWorkingRoot(state) // Set working root
 
-	err = stateDB.WriteToMemory() // Write db to memory
+	if err := stateDB.putEntry(state, rootState); err != nil { // Write entry to store
+		return err // Return found error
+	}
+
+	if err := stateDB.putHeaderOf(&next); err != nil { // Write header to store
+		stateDB.deleteEntry(state) // Remove entry (best effort; a leftover entry is read back as a child of its parent)
 
-	if err != nil { // Check for errors
 		return err // Return found error
 	}
 
+	(*(*rootState).State).StateChildren = append((*(*rootState).State).StateChildren, state) // Append state
+	(*stateDB).States = append((*stateDB).States, state)                                     // Append to general states
+
+	index.add(state, rootState) // Index state
+
+	stateDB.Labels = next.Labels           // Set labels
+	stateDB.WorkingRoot = next.WorkingRoot // Set working root
+	stateDB.MerkleRoot = next.MerkleRoot   // Set merkle root
+
 	return nil // No error occurred, return nil
 }
 
 // SetWorkingRoot - set current working root (similar to a "git checkout COMMIT_HASH")
 func (stateDB *StateDatabase) SetWorkingRoot(rootState *StateEntry) {
 	stateDB.WorkingRoot = rootState // Set working root
+
+	if rootState != nil && rootState.State != nil && rootState.State.MerkleRoot != nil { // Check has state commitment
+		stateDB.MerkleRoot = rootState.State.MerkleRoot // Set merkle root
+	}
 }
 
 // QueryState - query state in db by identifier
 func (stateDB *StateDatabase) QueryState(id []byte) (*StateEntry, error) {
-	if len(stateDB.States) == 0 || stateDB.States == nil { // Check no states
-		return &StateEntry{}, ErrNilStateEntry // Return error
-	}
+	state, ok := stateDB.index().entries[string(id)] // Get state
 
-	for _, state := range stateDB.States { // Iterate through states
-		if common.ByteIsEqual(state.ID, id) { // Check for match
-			return state, nil // Return found state
-		}
+	if !ok { // Check not found
+		return &StateEntry{}, ErrNilStateEntry // Return error
 	}
 
-	return &StateEntry{}, ErrNilStateEntry // Return error
+	return state, nil // Return found state
 }
 
-// FindMax - find state entry with max nonce value
+// FindMax - find state entry with max nonce value (ErrNilStateEntry if the db holds only its root)
 func (stateDB *StateDatabase) FindMax() (*StateEntry, error) {
-	if stateDB.States == nil || len(stateDB.States) == 0 || stateDB.StateRoot == nil { // Check for nil state db
-		return &StateEntry{}, ErrNilStateEntry // Return error
-	}
-
-	lastEntry := stateDB.StateRoot // Set last
-	currentEntry := &StateEntry{}  // Init buffer
-
-	var err error // Init error buffer
-
-	for lastEntry.Nonce >= currentEntry.Nonce { // Iterate until found max
-		if currentEntry.State != nil { // Check is not nil state
-			lastEntry = currentEntry // Set last entry
-		}
+	nonces := stateDB.index().nonces // Get nonce index
 
-		currentEntry, err = lastEntry.FindMax() // Find max
-
-		if err != nil { // Check for errors
-			return &StateEntry{}, err // Return found error
-		}
+	if len(nonces) < 2 || stateDB.StateRoot == nil { // Check for nil state db
+		return &StateEntry{}, ErrNilStateEntry // Return error
 	}
 
-	return currentEntry, nil // Return found state entry
+	return nonces[len(nonces)-1], nil // Return found state entry
 }
 
 /*
 	BEGIN TYPE HELPERS
 */
 
-// Bytes - get byte representation of db
+// Bytes - get the canonical byte representation of db (see StateDatabaseFromBytes)
 func (stateDB *StateDatabase) Bytes() []byte {
-	var stateBuffer bytes.Buffer // Init encoding buffer
-
-	encoder := gob.NewEncoder(&stateBuffer) // Write to state buffer
-
-	err := encoder.Encode(*stateDB) // Encode virtual machine state
-
-	if err != nil { // Check for errors
-		return nil // Return nil
-	}
-
-	return stateBuffer.Bytes() // Return success
+	return encodeStateDB(stateDB) // Return encoded
 }
 
 // String - get string representation of db
@@ -152,4 +165,31 @@ func (stateDB *StateDatabase) String() string {
 	END TYPE HELPERS
 */
 
+// StateDatabaseID - get the ID of the state database of instances of the module with the given
+// identifier that were given the given state key (see Environment.StateKey)
+func StateDatabaseID(moduleID []byte, stateKey string) []byte {
+	return crypto.Sha3(append(append([]byte(nil), moduleID...), stateKey...)) // Return ID
+}
+
 /* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// parents - get the parent of each state entry in the db, by entry ID (the root has none)
+func (stateDB *StateDatabase) parents() map[string]*StateEntry {
+	return stateDB.index().parents // Return parents
+}
+
+// saltedStateDBID - derive the ID of a new state database from the given ID, salted with random bytes
+// so that state databases of different instances (even with identical roots) never share a store
+func saltedStateDBID(id []byte) ([]byte, error) {
+	salt := make([]byte, 16) // Init salt buffer
+
+	if _, err := rand.Read(salt); err != nil { // Generate salt
+		return nil, err // Return found error
+	}
+
+	return crypto.Sha3(append(append([]byte(nil), id...), salt...)), nil // Return salted ID
+}
+
+/* END INTERNAL METHODS */
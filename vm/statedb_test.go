@@ -1,6 +1,8 @@
 package vm
 
 import (
+	"bytes"
+	"errors"
 	"io/ioutil"
 	"path/filepath"
 	"testing"
@@ -359,3 +361,77 @@ func TestBytesStateDatabase(t *testing.T) {
 
 	t.Log(byteVal) // Log success
 }
+
+// failingStore - memory store failing writes of the given key ("" to fail every write)
+type failingStore struct {
+	*MemoryStore
+
+	key string // Key of failing writes
+}
+
+// errStoreWrite - error returned by a failing store
+var errStoreWrite = errors.New("write failed")
+
+// Put - set value of key, failing for the store's key
+func (store *failingStore) Put(key []byte, value []byte) error {
+	if store.key == "" || store.key == string(key) { // Check should fail
+		return errStoreWrite // Return error
+	}
+
+	return store.MemoryStore.Put(key, value) // Set value
+}
+
+// TestAddStateStoreFailure - test a state entry that cannot be written to the store is not added to the database
+func TestAddStateStoreFailure(t *testing.T) {
+	for _, key := range []string{"", stateDBHeaderKey} { // Fail entry write, then header write
+		vm := newSnapshotTestVM(t) // Init vm
+
+		store := &failingStore{MemoryStore: NewMemoryStore(), key: "-"} // Init store
+
+		if _, err := vm.StateDatabase(); err != nil { // Create state database
+			t.Fatal(err) // Panic
+		}
+
+		vm.StateDB.UseStore(store) // Use store
+
+		if err := vm.StateDB.WriteToMemory(); err != nil { // Write db
+			t.Fatal(err) // Panic
+		}
+
+		store.key = key // Start failing
+
+		root := vm.StateDB.WorkingRoot // Get root
+
+		if _, err := vm.Call("store", I32(0), I32(1)); err != nil { // Write
+			t.Fatal(err) // Panic
+		}
+
+		if err := vm.SaveState(); !errors.Is(err, errStoreWrite) { // Save state
+			t.Fatalf("expected write error, got %v", err) // Panic
+		}
+
+		if len(vm.StateDB.States) != 1 || vm.StateDB.WorkingRoot != root || len(root.State.StateChildren) != 0 { // Check not linked
+			t.Fatalf("expected failed entry not to be added (failing %q)", key) // Panic
+		}
+
+		if len(vm.StateDB.QueryNonce(1)) != 0 { // Check not indexed
+			t.Fatal("expected failed entry not to be indexed") // Panic
+		}
+
+		store.key = "-" // Stop failing
+
+		if err := vm.SaveState(); err != nil { // Save state
+			t.Fatal(err) // Panic
+		}
+
+		stateDB, err := ReadStateDB(store) // Read saved states
+
+		if err != nil { // Check for errors
+			t.Fatal(err) // Panic
+		}
+
+		if !bytes.Equal(stateDB.WorkingRoot.ID, vm.StateDB.WorkingRoot.ID) || len(stateDB.States) != len(vm.StateDB.States) { // Check store matches memory
+			t.Fatalf("expected store to match memory, got %d states on disk and %d in memory", len(stateDB.States), len(vm.StateDB.States)) // Panic
+		}
+	}
+}
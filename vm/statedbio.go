@@ -1,98 +1,335 @@
 package vm
 
 import (
-	"bytes"
-	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"sort"
+)
+
+const (
+	// stateDBHeaderKey - store key of a state database's header
+	stateDBHeaderKey = "header"
+
+	// stateDBBaseKey - store key of the memory a pruned state database's root is rebuilt on
+	stateDBBaseKey = "base"
+
+	// stateEntryKeyPrefix - store key prefix of a state database's entries (followed by the entry ID)
+	stateEntryKeyPrefix = "entry/"
+)
 
-	"github.com/SummerCash/ursa/common"
+var (
+	// ErrStateDBNotFound - describes an error regarding a store that does not hold a state database
+	ErrStateDBNotFound = errors.New("state database not found")
 )
 
-// StateDatabaseFromBytes - marshal given byte array into state database
+/* BEGIN EXPORTED METHODS */
+
+// StateDatabaseFromBytes - decode a state database from its canonical encoding (see StateDatabase.Bytes)
 func StateDatabaseFromBytes(b []byte) (*StateDatabase, error) {
-	var stateBytes bytes.Buffer // Init state bytes buffer
+	stateDB, err := decodeStateDB(b) // Decode db
+
+	if err != nil { // Check for errors
+		return &StateDatabase{}, err // Return found error
+	}
+
+	return stateDB, nil // Return read state
+}
+
+// UseStore - set the store the state database is persisted to
+func (stateDB *StateDatabase) UseStore(store Store) {
+	stateDB.store = store // Set store
+}
+
+// Store - get the store the state database is persisted to (nil if not yet persisted)
+func (stateDB *StateDatabase) Store() Store {
+	return stateDB.store // Return store
+}
+
+// Close - close the state database's store
+func (stateDB *StateDatabase) Close() error {
+	if stateDB.store == nil { // Check no store
+		return nil // Nothing to close
+	}
+
+	return stateDB.store.Close() // Close store
+}
+
+// WriteToMemory - write the whole state database to its store (by default, a log file under
+// DataDir/state), removing any entries left in the store that are no longer in the database
+func (stateDB *StateDatabase) WriteToMemory() error {
+	store, err := stateDB.openStore() // Get store
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	entries := make(map[string]bool, len(stateDB.States)) // Init entry set
+
+	for _, state := range stateDB.States { // Iterate through states
+		entries[string(state.ID)] = true // Add to set
+	}
+
+	var stale [][]byte // Init stale key buffer
 
-	_, err := stateBytes.Write(b) // Write to buffer
+	err = store.Iterate([]byte(stateEntryKeyPrefix), func(key []byte, value []byte) error {
+		if !entries[string(key[len(stateEntryKeyPrefix):])] { // Check no longer in db
+			stale = append(stale, key) // Add stale key
+		}
+
+		return nil // Continue
+	}) // Find stale entries
 
 	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	for _, key := range stale { // Iterate through stale keys
+		if err = store.Delete(key); err != nil { // Delete entry
+			return err // Return found error
+		}
+	}
+
+	return stateDB.create() // Write db
+}
+
+// ReadStateDB - read the state database held by the given store
+func ReadStateDB(store Store) (*StateDatabase, error) {
+	headerBytes, err := store.Get([]byte(stateDBHeaderKey)) // Get header
+
+	if errors.Is(err, ErrKeyNotFound) { // Check no db
+		return &StateDatabase{}, ErrStateDBNotFound // Return error
+	}
+
+	if err != nil { // Check for errors
+		return &StateDatabase{}, err // Return found error
+	}
+
+	header := &stateDecoder{data: headerBytes}             // Init header decoder
+	stateDB, stateRootID, workingRootID := header.header() // Decode header
+
+	if err = header.finish(); err != nil { // Check for errors
+		return &StateDatabase{}, err // Return found error
+	}
+
+	if stateDB.baseMemory, err = store.Get([]byte(stateDBBaseKey)); err != nil && !errors.Is(err, ErrKeyNotFound) { // Get base memory
 		return &StateDatabase{}, err // Return found error
 	}
 
-	stateBuffer := &StateDatabase{} // Init state buffer
+	var records []*stateRecord // Init record buffer
 
-	decoder := gob.NewDecoder(&stateBytes) // Init gob decoder
+	err = store.Iterate([]byte(stateEntryKeyPrefix), func(key []byte, value []byte) error {
+		decoder := &stateDecoder{data: value} // Init record decoder
 
-	err = decoder.Decode(stateBuffer) // Decode state bytes
+		record := decoder.record() // Decode record
+
+		if err := decoder.finish(); err != nil { // Check for errors
+			return fmt.Errorf("state entry %x: %w", key[len(stateEntryKeyPrefix):], err) // Return found error
+		}
+
+		records = append(records, record) // Append record
+
+		return nil // Continue
+	}) // Read entries
 
 	if err != nil { // Check for errors
 		return &StateDatabase{}, err // Return found error
 	}
 
-	return stateBuffer, nil // Return read state
+	if err = stateDB.assemble(stateRootID, workingRootID, records); err != nil { // Link entries
+		return &StateDatabase{}, err // Return found error
+	}
+
+	stateDB.store = store // Set store
+
+	return stateDB, nil // Return read state db
 }
 
-// WriteToMemory - write state database to persistent storage with given data path
-func (stateDB *StateDatabase) WriteToMemory() error {
-	var stateBuffer bytes.Buffer // Init encoding buffer
+// ReadStateDBFromMemory - read state database with the given ID from its log file under DataDir/state.
+// The returned database keeps its store open (see Close).
+func ReadStateDBFromMemory(id string) (*StateDatabase, error) {
+	idBytes, err := hex.DecodeString(id) // Decode ID
+
+	if err != nil { // Check for errors
+		return &StateDatabase{}, err // Return found error
+	}
 
-	encoder := gob.NewEncoder(&stateBuffer) // Write to state buffer
+	store, err := OpenStateStore(&Environment{}, idBytes) // Open default store
+
+	if err != nil { // Check for errors
+		return &StateDatabase{}, err // Return found error
+	}
 
-	err := encoder.Encode(*stateDB) // Encode virtual machine state
+	stateDB, err := ReadStateDB(store) // Read db
 
 	if err != nil { // Check for errors
+		store.Close() // Close store
+
+		return &StateDatabase{}, err // Return found error
+	}
+
+	return stateDB, nil // Return read state
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// openStore - get the state database's store (see attachStore), writing the entries not yet written to it
+func (stateDB *StateDatabase) openStore() (Store, error) {
+	if _, err := stateDB.attachStore(); err != nil { // Get store
+		return nil, err // Return found error
+	}
+
+	if stateDB.unwritten { // Check entries not yet written
+		stateDB.unwritten = false // Write once (create writes through openStore)
+
+		if err := stateDB.create(); err != nil { // Write state db
+			stateDB.unwritten = true // Retry on next write
+
+			return nil, err // Return found error
+		}
+	}
+
+	return stateDB.store, nil // Return store
+}
+
+// attachStore - get the state database's store, opening the store configured by its environment (the
+// default file store if none) if it has none, without writing to it
+func (stateDB *StateDatabase) attachStore() (Store, error) {
+	if stateDB.store == nil { // Check no store
+		environment := stateDB.environment // Get environment
+
+		if environment == nil { // Check no environment
+			environment = &Environment{} // Open default store
+		}
+
+		store, err := OpenStateStore(environment, stateDB.ID) // Open store
+
+		if err != nil { // Check for errors
+			return nil, err // Return found error
+		}
+
+		stateDB.store = store // Set store
+	}
+
+	return stateDB.store, nil // Return store
+}
+
+// create - write the whole state database to its store, keeping any other entries already in it
+func (stateDB *StateDatabase) create() error {
+	parents := stateDB.parents() // Get parents
+
+	for _, state := range stateDB.States { // Iterate through states
+		if err := stateDB.putEntry(state, parents[string(state.ID)]); err != nil { // Write entry
+			return err // Return found error
+		}
+	}
+
+	if err := stateDB.putBase(); err != nil { // Write base memory
 		return err // Return found error
 	}
 
-	abs, err := filepath.Abs(filepath.FromSlash(fmt.Sprintf("%s/state", common.DataDir))) // Get absolute dir
+	return stateDB.putHeader() // Write header
+}
+
+// putHeader - write the state database's header to its store
+func (stateDB *StateDatabase) putHeader() error {
+	return stateDB.putHeaderOf(stateDB) // Write header
+}
+
+// putHeaderOf - write the header of the given version of the state database to its store
+func (stateDB *StateDatabase) putHeaderOf(header *StateDatabase) error {
+	store, err := stateDB.openStore() // Get store
 
 	if err != nil { // Check for errors
 		return err // Return found error
 	}
 
-	err = common.CreateDirIfDoesNotExit(abs) // Create data dir if not exist
+	return store.Put([]byte(stateDBHeaderKey), encodeHeader(header)) // Write header
+}
+
+// putBase - write the memory the state database's root is rebuilt on to its store (removing it if the root is a full snapshot)
+func (stateDB *StateDatabase) putBase() error {
+	store, err := stateDB.openStore() // Get store
 
 	if err != nil { // Check for errors
 		return err // Return found error
 	}
 
-	err = ioutil.WriteFile(filepath.FromSlash(fmt.Sprintf("%s/%s.db", abs, hex.EncodeToString(stateDB.ID))), stateBuffer.Bytes(), 0644) // Write state buffer to persistent memory
+	if stateDB.baseMemory == nil { // Check no base
+		return store.Delete([]byte(stateDBBaseKey)) // Remove base
+	}
+
+	return store.Put([]byte(stateDBBaseKey), stateDB.baseMemory) // Write base
+}
+
+// putEntry - write a single state entry (with the given parent, nil for the root) to the state database's store
+func (stateDB *StateDatabase) putEntry(entry *StateEntry, parent *StateEntry) error {
+	store, err := stateDB.openStore() // Get store
 
 	if err != nil { // Check for errors
 		return err // Return found error
 	}
 
-	return nil // No error occurred, return nil
+	return store.Put(append([]byte(stateEntryKeyPrefix), entry.ID...), encodeRecord(entry, parent)) // Write entry
 }
 
-// ReadStateDBFromMemory - read state database from persistent memory
-func ReadStateDBFromMemory(id string) (*StateDatabase, error) {
-	abs, err := filepath.Abs(filepath.FromSlash(fmt.Sprintf("%s/state", common.DataDir))) // Get absolute dir
+// deleteEntry - remove a single state entry from the state database's store
+func (stateDB *StateDatabase) deleteEntry(entry *StateEntry) error {
+	store, err := stateDB.openStore() // Get store
 
 	if err != nil { // Check for errors
-		return &StateDatabase{}, err // Return found error
+		return err // Return found error
 	}
 
-	stateBuffer := &StateDatabase{} // Init state buffer
+	return store.Delete(append([]byte(stateEntryKeyPrefix), entry.ID...)) // Remove entry
+}
 
-	stateFile, err := os.Open(filepath.FromSlash(fmt.Sprintf("%s/%s.db", abs, id))) // Read state bytes
+// assemble - link decoded entries into the state database's tree and set its roots
+func (stateDB *StateDatabase) assemble(stateRootID []byte, workingRootID []byte, records []*stateRecord) error {
+	entries := make(map[string]*StateEntry, len(records)) // Init entry buffer
 
-	if err != nil { // Check for errors
-		return &StateDatabase{}, err // Return found error
+	stateDB.States = nil     // Reset states
+	stateDB.stateIndex = nil // Reset index
+
+	for _, record := range records { // Iterate through records
+		if record.Entry == nil || record.Entry.State == nil { // Check has state
+			return ErrNilStateEntry // Return error
+		}
+
+		entries[string(record.Entry.ID)] = record.Entry       // Set entry
+		stateDB.States = append(stateDB.States, record.Entry) // Append entry
 	}
 
-	decoder := gob.NewDecoder(stateFile) // Init gob decoder
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Entry.Nonce < records[j].Entry.Nonce // Order by nonce
+	}) // Sort records (children are appended in the same order)
 
-	err = decoder.Decode(stateBuffer) // Decode state bytes
+	sort.SliceStable(stateDB.States, func(i, j int) bool {
+		return stateDB.States[i].Nonce < stateDB.States[j].Nonce // Order by nonce
+	}) // Sort states
 
-	if err != nil { // Check for errors
-		return &StateDatabase{}, err // Return found error
+	for _, record := range records { // Iterate through records
+		if parent, ok := entries[string(record.ParentID)]; ok { // Check has parent
+			parent.State.StateChildren = append(parent.State.StateChildren, record.Entry) // Append child
+		}
 	}
 
-	stateFile.Close() // Close state file
+	stateDB.StateRoot = entries[string(stateRootID)]     // Set root
+	stateDB.WorkingRoot = entries[string(workingRootID)] // Set working root
+
+	if stateDB.StateRoot == nil || stateDB.WorkingRoot == nil { // Check roots found
+		return ErrNilStateEntry // Return error
+	}
 
-	return stateBuffer, nil // Return read state
+	for name, label := range stateDB.Labels { // Iterate through labels
+		if _, ok := entries[string(label.ID)]; !ok { // Check labeled entry found
+			return fmt.Errorf("%w: label %s", ErrNilStateEntry, name) // Return error
+		}
+	}
+
+	return nil // No error occurred, return nil
 }
+
+/* END INTERNAL METHODS */
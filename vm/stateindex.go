@@ -0,0 +1,203 @@
+package vm
+
+import (
+	"sort"
+)
+
+// stateIndex - lookup structures over a state database's entries
+type stateIndex struct {
+	entries  map[string]*StateEntry // Entries by ID
+	parents  map[string]*StateEntry // Parent of each entry, by entry ID (the root has none)
+	maxChild map[string]*StateEntry // Child of greatest nonce of each entry, by entry ID
+	chains   map[string]*stateChain // Chain of each entry, by entry ID
+
+	nonces []*StateEntry // Entries in nonce order
+}
+
+// stateChain - path of entries linked by their children of greatest nonce. Every entry on a
+// chain has the same latest entry: the chain's head.
+type stateChain struct {
+	head *StateEntry // Last entry on chain
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// QueryNonce - get the entries with the given nonce (SaveState never reuses a nonce, but entries
+// added directly with AddStateEntry may share one across branches)
+func (stateDB *StateDatabase) QueryNonce(nonce uint64) []*StateEntry {
+	nonces := stateDB.index().nonces // Get nonce index
+
+	first := sort.Search(len(nonces), func(i int) bool { return nonces[i].Nonce >= nonce }) // Find first entry
+
+	var entries []*StateEntry // Init entry buffer
+
+	for i := first; i < len(nonces) && nonces[i].Nonce == nonce; i++ { // Iterate through matches
+		entries = append(entries, nonces[i]) // Append entry
+	}
+
+	return entries // Return entries
+}
+
+// Parent - get the parent of the entry with the given ID (ErrNilStateEntry for the root)
+func (stateDB *StateDatabase) Parent(id []byte) (*StateEntry, error) {
+	index := stateDB.index() // Get index
+
+	if _, ok := index.entries[string(id)]; !ok { // Check exists
+		return &StateEntry{}, ErrNilStateEntry // Return error
+	}
+
+	parent, ok := index.parents[string(id)] // Get parent
+
+	if !ok { // Check is root
+		return &StateEntry{}, ErrNilStateEntry // Return error
+	}
+
+	return parent, nil // Return parent
+}
+
+// Children - get the children of the entry with the given ID, in the order they were saved
+func (stateDB *StateDatabase) Children(id []byte) ([]*StateEntry, error) {
+	entry, err := stateDB.QueryState(id) // Query state
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	return append([]*StateEntry(nil), entry.State.StateChildren...), nil // Return children
+}
+
+// History - get the entry with the given ID and each of its ancestors, back to the state root
+func (stateDB *StateDatabase) History(id []byte) ([]*StateEntry, error) {
+	entry, err := stateDB.QueryState(id) // Query state
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	index := stateDB.index() // Get index
+
+	history := []*StateEntry{entry} // Init history
+
+	for parent, ok := index.parents[string(entry.ID)]; ok; parent, ok = index.parents[string(parent.ID)] { // Walk towards the root
+		history = append(history, parent) // Append ancestor
+	}
+
+	return history, nil // Return history
+}
+
+// Branches - get the head of every branch (entries with no children), in nonce order
+func (stateDB *StateDatabase) Branches() []*StateEntry {
+	var heads []*StateEntry // Init head buffer
+
+	for _, entry := range stateDB.index().nonces { // Iterate through entries
+		if entry.State != nil && len(entry.State.StateChildren) == 0 { // Check is head
+			heads = append(heads, entry) // Append head
+		}
+	}
+
+	return heads // Return heads
+}
+
+// Latest - get the latest entry on the branch continuing from the entry with the given ID, found by
+// repeatedly following the child of greatest nonce
+func (stateDB *StateDatabase) Latest(id []byte) (*StateEntry, error) {
+	chain, ok := stateDB.index().chains[string(id)] // Get chain
+
+	if !ok { // Check exists
+		return &StateEntry{}, ErrNilStateEntry // Return error
+	}
+
+	return chain.head, nil // Return head
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// index - get the state database's index, rebuilding it if entries were added or removed without it
+func (stateDB *StateDatabase) index() *stateIndex {
+	if stateDB.stateIndex != nil && len(stateDB.stateIndex.entries) == len(stateDB.States) { // Check up to date
+		return stateDB.stateIndex // Return index
+	}
+
+	index := &stateIndex{
+		entries:  make(map[string]*StateEntry, len(stateDB.States)), // Init entries
+		parents:  make(map[string]*StateEntry, len(stateDB.States)), // Init parents
+		maxChild: make(map[string]*StateEntry),                      // Init max children
+		chains:   make(map[string]*stateChain, len(stateDB.States)), // Init chains
+	} // Init index
+
+	parents := make(map[string]*StateEntry) // Init parent buffer
+
+	for _, entry := range stateDB.States { // Iterate through states
+		if entry.State == nil { // Check no state
+			continue // Skip
+		}
+
+		for _, child := range entry.State.StateChildren { // Iterate through children
+			parents[string(child.ID)] = entry // Set parent
+		}
+	}
+
+	ordered := append([]*StateEntry(nil), stateDB.States...) // Copy states
+
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Nonce < ordered[j].Nonce }) // Parents have lower nonces than their children
+
+	for _, entry := range ordered { // Iterate through states
+		index.add(entry, parents[string(entry.ID)]) // Index entry
+	}
+
+	stateDB.stateIndex = index // Set index
+
+	return index // Return index
+}
+
+// add - index an entry added under the given parent (nil for the root)
+func (index *stateIndex) add(entry *StateEntry, parent *StateEntry) {
+	id := string(entry.ID) // Get ID
+
+	index.entries[id] = entry // Set entry
+
+	position := sort.Search(len(index.nonces), func(i int) bool { return index.nonces[i].Nonce > entry.Nonce }) // Find position (usually the end)
+
+	index.nonces = append(index.nonces, nil)                 // Grow index
+	copy(index.nonces[position+1:], index.nonces[position:]) // Shift later entries
+	index.nonces[position] = entry                           // Insert entry
+
+	if parent == nil { // Check is root
+		index.chains[id] = &stateChain{head: entry} // Start chain
+
+		return // Done
+	}
+
+	index.parents[id] = parent // Set parent
+
+	previous := index.maxChild[string(parent.ID)] // Get previous child of greatest nonce
+
+	if previous != nil && previous.Nonce >= entry.Nonce { // Check not continuing parent's chain
+		index.chains[id] = &stateChain{head: entry} // Start chain
+
+		return // Done
+	}
+
+	index.maxChild[string(parent.ID)] = entry // Set child of greatest nonce
+
+	chain := index.chains[string(parent.ID)] // Get parent's chain
+
+	if chain == nil { // Check parent not indexed
+		chain = &stateChain{} // Start chain
+	}
+
+	if previous != nil { // Check chain forks at parent
+		split := &stateChain{head: chain.head} // Init chain of previous child
+
+		for current := previous; current != nil; current = index.maxChild[string(current.ID)] { // Iterate through previous child's chain
+			index.chains[string(current.ID)] = split // Move entry
+		}
+	}
+
+	chain.head = entry       // Extend chain
+	index.chains[id] = chain // Set chain
+}
+
+/* END INTERNAL METHODS */
@@ -0,0 +1,97 @@
+package vm
+
+import (
+	"testing"
+)
+
+// newBranchedTestDB - save the tree root -> a -> b, a -> c, root -> d, returning the entries (root, a, b, c, d)
+func newBranchedTestDB(t *testing.T) (*VirtualMachine, []*StateEntry) {
+	vm := newSnapshotTestVM(t) // Init vm
+
+	stateDB, err := vm.StateDatabase() // Get state database
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	entries := []*StateEntry{stateDB.StateRoot} // Init entry buffer
+
+	save := func(parent *StateEntry, value int32) {
+		if err := vm.ResetToState(parent.ID); err != nil { // Check out parent
+			t.Fatal(err) // Panic
+		}
+
+		if _, err := vm.Call("store", I32(0), I32(value)); err != nil { // Write
+			t.Fatal(err) // Panic
+		}
+
+		if err := vm.SaveState(); err != nil { // Save state
+			t.Fatal(err) // Panic
+		}
+
+		entries = append(entries, vm.StateDB.WorkingRoot) // Append entry
+	}
+
+	save(entries[0], 1) // Save a
+	save(entries[1], 2) // Save b
+	save(entries[1], 3) // Save c
+	save(entries[0], 4) // Save d
+
+	return vm, entries // Return vm and entries
+}
+
+// TestStateHistory - test parent, children and history lookups
+func TestStateHistory(t *testing.T) {
+	vm, entries := newBranchedTestDB(t) // Init db
+	root, a, b, c := entries[0], entries[1], entries[2], entries[3]
+
+	if parent, err := vm.StateDB.Parent(c.ID); err != nil || parent != a { // Check parent
+		t.Fatalf("expected parent %x, got %v (%v)", a.ID, parent, err) // Panic
+	}
+
+	if _, err := vm.StateDB.Parent(root.ID); err != ErrNilStateEntry { // Check root has no parent
+		t.Fatalf("expected %v, got %v", ErrNilStateEntry, err) // Panic
+	}
+
+	if children, err := vm.StateDB.Children(a.ID); err != nil || len(children) != 2 || children[0] != b || children[1] != c { // Check children
+		t.Fatalf("expected children b and c, got %d (%v)", len(children), err) // Panic
+	}
+
+	history, err := vm.StateDB.History(b.ID) // Get history
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if len(history) != 3 || history[0] != b || history[1] != a || history[2] != root { // Check history
+		t.Fatalf("expected history b, a, root, got %d entries", len(history)) // Panic
+	}
+}
+
+// TestStateBranches - test nonce lookups, branch heads and latest-on-branch queries
+func TestStateBranches(t *testing.T) {
+	vm, entries := newBranchedTestDB(t) // Init db
+	root, a, b, c, d := entries[0], entries[1], entries[2], entries[3], entries[4]
+
+	for nonce, expected := range entries { // Iterate through entries
+		if found := vm.StateDB.QueryNonce(uint64(nonce)); len(found) != 1 || found[0] != expected { // Check unique nonce
+			t.Fatalf("expected one entry with nonce %d, got %d", nonce, len(found)) // Panic
+		}
+	}
+
+	if heads := vm.StateDB.Branches(); len(heads) != 3 || heads[0] != b || heads[1] != c || heads[2] != d { // Check heads
+		t.Fatalf("expected heads b, c and d, got %d", len(heads)) // Panic
+	}
+
+	tests := map[*StateEntry]*StateEntry{root: d, a: c, b: b, c: c} // Entries and their latest entries
+
+	for entry, expected := range tests { // Iterate through tests
+		if latest, err := vm.StateDB.Latest(entry.ID); err != nil || latest != expected { // Check latest
+			t.Fatalf("expected latest of nonce %d to be nonce %d, got %d (%v)", entry.Nonce, expected.Nonce, latest.Nonce, err) // Panic
+		}
+	}
+
+	if max, err := vm.StateDB.FindMax(); err != nil || max != d { // Check max
+		t.Fatalf("expected max nonce %d, got %d (%v)", d.Nonce, max.Nonce, err) // Panic
+	}
+}
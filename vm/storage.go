@@ -0,0 +1,210 @@
+package vm
+
+import "sort"
+
+const (
+	// StorageModule - name of the built-in host module giving contracts persistent key-value storage.
+	// Its functions (all taking and returning i32) are resolved by the vm itself, and imports declaring
+	// other signatures fail instantiation:
+	//
+	//	storage_get(key_ptr, key_len, value_ptr, value_cap) -> value length (-1 if not found); copies up to value_cap bytes to value_ptr
+	//	storage_set(key_ptr, key_len, value_ptr, value_len)
+	//	storage_delete(key_ptr, key_len) -> 1 if the key was found, else 0
+	//	storage_has(key_ptr, key_len) -> 1 if the key is found, else 0
+	StorageModule = "ursa"
+)
+
+// storageModule - built-in storage host module
+var storageModule = newStorageModule()
+
+// storageUndo - value of a storage key before its first write in a transaction
+type storageUndo struct {
+	value   []byte // Value (nil if not found)
+	existed bool   // Key was found
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// GetStorage - get the value stored under the given key
+func (vm *VirtualMachine) GetStorage(key []byte) ([]byte, bool) {
+	value, ok := vm.Storage[string(key)] // Get value
+
+	return value, ok // Return value
+}
+
+// SetStorage - store a copy of the given value under the given key
+func (vm *VirtualMachine) SetStorage(key []byte, value []byte) {
+	vm.journalStorage(string(key)) // Journal previous value
+
+	if vm.Storage == nil { // Check no storage
+		vm.Storage = make(map[string][]byte) // Init storage
+	}
+
+	vm.Storage[string(key)] = append([]byte{}, value...) // Set value
+}
+
+// DeleteStorage - remove the value stored under the given key, reporting whether there was one
+func (vm *VirtualMachine) DeleteStorage(key []byte) bool {
+	if _, ok := vm.Storage[string(key)]; !ok { // Check found
+		return false // Nothing to delete
+	}
+
+	vm.journalStorage(string(key)) // Journal previous value
+
+	delete(vm.Storage, string(key)) // Delete value
+
+	return true // Deleted
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// newStorageModule - initialize the built-in storage host module (see StorageModule)
+func newStorageModule() *HostModule {
+	module := NewHostModule(StorageModule) // Init module
+
+	functions := map[string]interface{}{
+		"storage_get":    storageGet,    // Get value
+		"storage_set":    storageSet,    // Set value
+		"storage_delete": storageDelete, // Delete value
+		"storage_has":    storageHas,    // Check has value
+	} // Init functions
+
+	for name, fn := range functions { // Iterate through functions
+		if err := module.Func(name, fn); err != nil { // Register function
+			panic(err) // Panic
+		}
+	}
+
+	return module // Return module
+}
+
+// storageGet - copy up to valueCap bytes of the value stored under a key to valuePtr, returning its length (-1 if not found)
+func storageGet(vm *VirtualMachine, keyPtr, keyLen, valuePtr, valueCap uint32) int32 {
+	key := vm.hostMemory(keyPtr, keyLen) // Get key
+	vm.hostMemory(valuePtr, valueCap)    // Check output buffer
+
+	value, ok := vm.Storage[string(key)] // Get value
+
+	vm.chargeStorage(len(key) + len(value)) // Charge for bytes read
+
+	if !ok { // Check not found
+		return -1 // Return not found
+	}
+
+	vm.MarkDirty(int(valuePtr), int(valueCap)) // Mark output buffer (copies memory shared with a clone)
+
+	copy(vm.hostMemory(valuePtr, valueCap), value) // Copy value
+
+	return int32(len(value)) // Return value length
+}
+
+// storageSet - store a value under a key
+func storageSet(vm *VirtualMachine, keyPtr, keyLen, valuePtr, valueLen uint32) {
+	key := vm.hostMemory(keyPtr, keyLen)       // Get key
+	value := vm.hostMemory(valuePtr, valueLen) // Get value
+
+	vm.chargeStorage(len(key) + len(value)) // Charge for bytes written
+	vm.SetStorage(key, value)               // Set value
+}
+
+// storageDelete - remove the value stored under a key, returning 1 if it was found
+func storageDelete(vm *VirtualMachine, keyPtr, keyLen uint32) int32 {
+	key := vm.hostMemory(keyPtr, keyLen) // Get key
+
+	vm.chargeStorage(len(key)) // Charge for key
+
+	if vm.DeleteStorage(key) { // Delete value
+		return 1 // Return found
+	}
+
+	return 0 // Return not found
+}
+
+// storageHas - check a value is stored under a key, returning 1 if it is found
+func storageHas(vm *VirtualMachine, keyPtr, keyLen uint32) int32 {
+	key := vm.hostMemory(keyPtr, keyLen) // Get key
+
+	vm.chargeStorage(len(key)) // Charge for key
+
+	if _, ok := vm.Storage[string(key)]; ok { // Check found
+		return 1 // Return found
+	}
+
+	return 0 // Return not found
+}
+
+// hostMemory - get the memory range of the given i32 pointer and length passed to a host function,
+// trapping if it is out of bounds
+func (vm *VirtualMachine) hostMemory(ptr uint32, length uint32) []byte {
+	data, err := vm.GuestMemory().slice(ptr, length) // Get range
+
+	if err != nil { // Check for errors
+		panic(err) // Panic
+	}
+
+	return data // Return range
+}
+
+// chargeStorage - charge gas for the given number of storage bytes read or written
+func (vm *VirtualMachine) chargeStorage(bytes int) {
+	if vm.Environment.GasPerStorageByte == 0 || bytes == 0 { // Check free
+		return // Nothing to charge
+	}
+
+	cost := uint64(bytes) * vm.Environment.GasPerStorageByte // Calculate cost
+
+	if cost/vm.Environment.GasPerStorageByte != uint64(bytes) { // Check for overflow
+		panic(TrapOutOfGas) // Panic
+	}
+
+	vm.ChargeGas(cost) // Charge cost
+}
+
+// journalStorage - save the value of the given key before its first write in the active transaction
+func (vm *VirtualMachine) journalStorage(key string) {
+	tx := vm.transaction // Get transaction
+
+	if tx == nil { // Check no transaction
+		return // Nothing to journal
+	}
+
+	if _, ok := tx.storage[key]; ok { // Check already saved
+		return // Keep value from before the transaction
+	}
+
+	value, existed := vm.Storage[key] // Get value
+
+	tx.storage[key] = storageUndo{value: value, existed: existed} // Save value
+}
+
+// copyStorage - copy a storage map (values are never written in place, so they are shared)
+func copyStorage(storage map[string][]byte) map[string][]byte {
+	if len(storage) == 0 { // Check empty
+		return nil // Nothing to copy
+	}
+
+	copied := make(map[string][]byte, len(storage)) // Init copy
+
+	for key, value := range storage { // Iterate through storage
+		copied[key] = value // Copy entry
+	}
+
+	return copied // Return copy
+}
+
+// sortedStorageKeys - get the keys of a storage map in order
+func sortedStorageKeys(storage map[string][]byte) []string {
+	keys := make([]string, 0, len(storage)) // Init key buffer
+
+	for key := range storage { // Iterate through storage
+		keys = append(keys, key) // Append key
+	}
+
+	sort.Strings(keys) // Sort keys
+
+	return keys // Return keys
+}
+
+/* END INTERNAL METHODS */
@@ -0,0 +1,107 @@
+package vm
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// newStorageTestVM - initialize a vm running the storage example module, keeping states in memory
+func newStorageTestVM(t *testing.T, env Environment) *VirtualMachine {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/storage.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	env.StateStore = StateStoreMemory // Keep states in memory
+
+	vm, err := NewVirtualMachine(testSourceFile, env, nil, nil) // Init vm (storage imports need no resolver)
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	return vm // Return vm
+}
+
+// TestStorage - test contracts read and write storage through the host module, versioned with saved states
+func TestStorage(t *testing.T) {
+	vm := newStorageTestVM(t, Environment{}) // Init vm
+
+	emptyRoot := vm.StateRoot() // Get commitment of empty storage
+
+	for i := int32(1); i <= 2; i++ { // Increment twice
+		if results, err := vm.Call("increment"); err != nil || results[0].I32() != i { // Increment
+			t.Fatalf("expected %d, got %v (%v)", i, results, err) // Panic
+		}
+	}
+
+	if value, ok := vm.GetStorage([]byte("count")); !ok || len(value) != 4 || value[0] != 2 { // Check stored value
+		t.Fatalf("expected count 2 in storage, got %v", value) // Panic
+	}
+
+	if string(vm.StateRoot()) == string(emptyRoot) { // Check storage committed to
+		t.Fatal("expected storage to change the state root") // Panic
+	}
+
+	if err := vm.SaveState(); err != nil { // Save state
+		t.Fatal(err) // Panic
+	}
+
+	saved := vm.StateDB.WorkingRoot // Get saved entry
+
+	if results, err := vm.Call("remove"); err != nil || results[0].I32() != 1 { // Delete count
+		t.Fatalf("expected count to be deleted, got %v (%v)", results, err) // Panic
+	}
+
+	if results, err := vm.Call("has"); err != nil || results[0].I32() != 0 { // Check deleted
+		t.Fatalf("expected count to be gone, got %v (%v)", results, err) // Panic
+	}
+
+	if err := vm.ResetToState(saved.ID); err != nil { // Reset to saved state
+		t.Fatal(err) // Panic
+	}
+
+	if results, err := vm.Call("increment"); err != nil || results[0].I32() != 3 { // Check storage restored
+		t.Fatalf("expected 3 after reset, got %v (%v)", results, err) // Panic
+	}
+
+	decoded, err := StateFromBytes(saved.State.Bytes()) // Round trip saved state
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if value := decoded.Storage["count"]; len(value) != 4 || value[0] != 2 { // Check storage encoded
+		t.Fatalf("expected count 2 in decoded state, got %v", value) // Panic
+	}
+}
+
+// TestStorageRollback - test storage writes are rolled back with a trapping transaction, and metered per byte
+func TestStorageRollback(t *testing.T) {
+	vm := newStorageTestVM(t, Environment{GasPerStorageByte: 10}) // Init vm
+
+	if _, err := vm.CallTransaction("increment"); err != nil { // Increment
+		t.Fatal(err) // Panic
+	}
+
+	if vm.Gas != 10*(5+0)+10*(5+4) { // Check charged for get (key) and set (key and value)
+		t.Fatalf("expected 140 gas, got %d", vm.Gas) // Panic
+	}
+
+	if _, err := vm.CallTransaction("increment_fail"); !errors.Is(err, TrapUnreachable) { // Increment, then trap
+		t.Fatalf("expected unreachable trap, got %v", err) // Panic
+	}
+
+	if value, _ := vm.GetStorage([]byte("count")); value[0] != 1 { // Check rolled back
+		t.Fatalf("expected count 1 after rollback, got %d", value[0]) // Panic
+	}
+
+	vm.Environment.GasLimit = vm.Gas + 10 // Leave too little gas to read storage
+
+	if _, err := vm.CallTransaction("increment"); !errors.Is(err, TrapOutOfGas) { // Run out of gas
+		t.Fatalf("expected out of gas trap, got %v", err) // Panic
+	}
+}
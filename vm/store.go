@@ -0,0 +1,228 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/SummerCash/ursa/common"
+)
+
+const (
+	// StateStoreFile - keep state databases in append-only log files (the default)
+	StateStoreFile = "file"
+
+	// StateStoreMemory - keep state databases in memory only
+	StateStoreMemory = "memory"
+)
+
+var (
+	// ErrKeyNotFound - describes an error regarding a store lookup for a key that is not present
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrStoreClosed - describes an error regarding an operation on a closed store
+	ErrStoreClosed = errors.New("store closed")
+
+	// ErrUnknownStateStore - describes an error regarding an environment naming a state store that does not exist
+	ErrUnknownStateStore = errors.New("unknown state store")
+)
+
+// Store - keyed blob storage backing a state database
+type Store interface {
+	Get(key []byte) ([]byte, error)                                       // Get value of key (ErrKeyNotFound if not present)
+	Put(key []byte, value []byte) error                                   // Set value of key
+	Delete(key []byte) error                                              // Remove key (no error if not present)
+	Iterate(prefix []byte, fn func(key []byte, value []byte) error) error // Call fn for each key with prefix, in key order, stopping on error
+	Close() error                                                         // Release store
+}
+
+// MemoryStore - in-memory store
+type MemoryStore struct {
+	values map[string][]byte // Values by key
+
+	closed bool // Has been closed
+
+	lock sync.RWMutex // Value lock
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// NewMemoryStore - initialize an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		values: make(map[string][]byte), // Init values
+	}
+}
+
+// OpenStateStore - open the store configured by the given environment for the state database with the given ID
+func OpenStateStore(environment *Environment, id []byte) (Store, error) {
+	switch environment.StateStore { // Handle store kinds
+	case "", StateStoreFile:
+		return OpenLogStore(stateStoreFile(environment, id)) // Open log store
+	case StateStoreMemory:
+		return NewMemoryStore(), nil // Init memory store
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStateStore, environment.StateStore) // Return error
+	}
+}
+
+// OpenExistingStateStore - open the store configured by the given environment for the state database
+// with the given ID, without creating it (ErrStateDBNotFound if nothing was persisted for the ID)
+func OpenExistingStateStore(environment *Environment, id []byte) (Store, error) {
+	switch environment.StateStore { // Handle store kinds
+	case "", StateStoreFile:
+		if _, err := os.Stat(stateStoreFile(environment, id)); os.IsNotExist(err) { // Check no log
+			return nil, fmt.Errorf("%w: %x", ErrStateDBNotFound, id) // Return error
+		}
+
+		return OpenStateStore(environment, id) // Open log store
+	case StateStoreMemory:
+		return nil, fmt.Errorf("%w: %x", ErrStateDBNotFound, id) // Nothing persisted
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStateStore, environment.StateStore) // Return error
+	}
+}
+
+// RemoveStateStore - delete the store configured by the given environment for the state database with
+// the given ID (no error if it does not exist). The store must be closed first.
+func RemoveStateStore(environment *Environment, id []byte) error {
+	switch environment.StateStore { // Handle store kinds
+	case "", StateStoreFile:
+		if err := os.Remove(stateStoreFile(environment, id)); err != nil && !os.IsNotExist(err) { // Remove log
+			return err // Return found error
+		}
+
+		return nil // No error occurred, return nil
+	case StateStoreMemory:
+		return nil // Nothing persisted
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownStateStore, environment.StateStore) // Return error
+	}
+}
+
+// Get - get value of key
+func (store *MemoryStore) Get(key []byte) ([]byte, error) {
+	store.lock.RLock()         // Lock
+	defer store.lock.RUnlock() // Unlock
+
+	if store.closed { // Check closed
+		return nil, ErrStoreClosed // Return error
+	}
+
+	value, ok := store.values[string(key)] // Get value
+
+	if !ok { // Check exists
+		return nil, ErrKeyNotFound // Return error
+	}
+
+	return append([]byte(nil), value...), nil // Return copy
+}
+
+// Put - set value of key
+func (store *MemoryStore) Put(key []byte, value []byte) error {
+	store.lock.Lock()         // Lock
+	defer store.lock.Unlock() // Unlock
+
+	if store.closed { // Check closed
+		return ErrStoreClosed // Return error
+	}
+
+	store.values[string(key)] = append([]byte(nil), value...) // Set copy
+
+	return nil // No error occurred, return nil
+}
+
+// Delete - remove key
+func (store *MemoryStore) Delete(key []byte) error {
+	store.lock.Lock()         // Lock
+	defer store.lock.Unlock() // Unlock
+
+	if store.closed { // Check closed
+		return ErrStoreClosed // Return error
+	}
+
+	delete(store.values, string(key)) // Delete value
+
+	return nil // No error occurred, return nil
+}
+
+// Iterate - call fn for each key with the given prefix, in key order
+func (store *MemoryStore) Iterate(prefix []byte, fn func(key []byte, value []byte) error) error {
+	store.lock.RLock() // Lock
+
+	if store.closed { // Check closed
+		store.lock.RUnlock() // Unlock
+
+		return ErrStoreClosed // Return error
+	}
+
+	keys := sortedKeys(prefix, len(store.values), func(visit func(string)) {
+		for key := range store.values { // Iterate through keys
+			visit(key) // Visit key
+		}
+	}) // Get keys
+
+	values := make([][]byte, len(keys)) // Init value buffer
+
+	for i, key := range keys { // Iterate through keys
+		values[i] = store.values[key] // Snapshot value
+	}
+
+	store.lock.RUnlock() // Unlock (fn may use the store)
+
+	for i, key := range keys { // Iterate through keys
+		if err := fn([]byte(key), append([]byte(nil), values[i]...)); err != nil { // Visit value
+			return err // Return found error
+		}
+	}
+
+	return nil // No error occurred, return nil
+}
+
+// Close - release store
+func (store *MemoryStore) Close() error {
+	store.lock.Lock()         // Lock
+	defer store.lock.Unlock() // Unlock
+
+	store.closed = true // Set closed
+	store.values = nil  // Release values
+
+	return nil // No error occurred, return nil
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// sortedKeys - collect the keys with the given prefix produced by each, in order
+func sortedKeys(prefix []byte, size int, each func(visit func(string))) []string {
+	keys := make([]string, 0, size) // Init key buffer
+
+	each(func(key string) {
+		if bytes.HasPrefix([]byte(key), prefix) { // Check has prefix
+			keys = append(keys, key) // Append key
+		}
+	})
+
+	sort.Strings(keys) // Sort keys
+
+	return keys // Return keys
+}
+
+// stateStoreFile - get the path of the log file the given environment keeps the state database with the given ID in
+func stateStoreFile(environment *Environment, id []byte) string {
+	dir := environment.StateStorePath // Get store dir
+
+	if dir == "" { // Check no dir
+		dir = filepath.Join(common.DataDir, "state") // Use default dir
+	}
+
+	return filepath.Join(dir, hex.EncodeToString(id)+".db") // Return path
+}
+
+/* END INTERNAL METHODS */
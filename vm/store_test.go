@@ -0,0 +1,305 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testStore - test the behavior shared by every store implementation
+func testStore(t *testing.T, store Store) {
+	if _, err := store.Get([]byte("a")); !errors.Is(err, ErrKeyNotFound) { // Check missing key
+		t.Fatalf("expected %v, got %v", ErrKeyNotFound, err) // Panic
+	}
+
+	for _, key := range []string{"entry/b", "entry/a", "header", "entry/c"} { // Iterate through keys
+		if err := store.Put([]byte(key), []byte("value of "+key)); err != nil { // Put value
+			t.Fatal(err) // Panic
+		}
+	}
+
+	if err := store.Put([]byte("entry/c"), []byte("new value")); err != nil { // Overwrite value
+		t.Fatal(err) // Panic
+	}
+
+	if err := store.Delete([]byte("entry/b")); err != nil { // Delete value
+		t.Fatal(err) // Panic
+	}
+
+	if value, err := store.Get([]byte("entry/c")); err != nil || string(value) != "new value" { // Check overwritten
+		t.Fatalf("expected new value, got %q (%v)", value, err) // Panic
+	}
+
+	var keys []string // Init key buffer
+
+	err := store.Iterate([]byte("entry/"), func(key []byte, value []byte) error {
+		keys = append(keys, string(key)) // Append key
+
+		return nil // Continue
+	}) // Iterate entries
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if len(keys) != 2 || keys[0] != "entry/a" || keys[1] != "entry/c" { // Check prefix and order
+		t.Fatalf("unexpected keys %v", keys) // Panic
+	}
+}
+
+// TestMemoryStore - test functionality of the in-memory store
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore() // Init store
+
+	testStore(t, store) // Test store
+
+	store.Close() // Close store
+
+	if err := store.Put([]byte("a"), nil); !errors.Is(err, ErrStoreClosed) { // Check closed
+		t.Fatalf("expected %v, got %v", ErrStoreClosed, err) // Panic
+	}
+}
+
+// TestMemoryStateStore - test a vm configured with the memory store saves and reverts state without touching disk
+func TestMemoryStateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ursa-state") // Init temp dir
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	defer os.RemoveAll(dir) // Remove temp dir
+
+	env := &Environment{DefaultMemoryPages: 128, DefaultTableSize: 65536, StateStore: StateStoreMemory, StateStorePath: dir} // Init env
+
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/main.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	vm, err := NewVirtualMachine(testSourceFile, *env, new(NopResolver), nil) // Init vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	entryID, _ := vm.GetFunctionExport("main") // Get main func
+
+	if _, err = vm.Run(entryID); err != nil { // Execute
+		t.Fatal(err) // Panic
+	}
+
+	if err = vm.SaveState(); err != nil { // Save state
+		t.Fatal(err) // Panic
+	}
+
+	if _, ok := vm.StateDB.Store().(*MemoryStore); !ok { // Check store kind
+		t.Fatalf("expected *MemoryStore, got %T", vm.StateDB.Store()) // Panic
+	}
+
+	if err = vm.ResetToState(vm.StateDB.States[1].ID); err != nil { // Reset to saved state
+		t.Fatal(err) // Panic
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 { // Check nothing written
+		t.Fatalf("expected no state files, found %d", len(files)) // Panic
+	}
+
+	if _, err = OpenStateStore(&Environment{StateStore: "leveldb"}, vm.StateDB.ID); !errors.Is(err, ErrUnknownStateStore) { // Check unknown store rejected
+		t.Fatalf("expected %v, got %v", ErrUnknownStateStore, err) // Panic
+	}
+}
+
+// TestInstanceStateStores - test instances of the same module keep their states in separate file stores,
+// created on their first save
+func TestInstanceStateStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ursa-state") // Init temp dir
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	defer os.RemoveAll(dir) // Remove temp dir
+
+	env := Environment{StateStore: StateStoreFile, StateStorePath: dir} // Init env
+
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/snapshot.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	var instances []*VirtualMachine // Init instance buffer
+
+	for i := int32(1); i <= 2; i++ { // Init two live instances
+		vm, err := NewVirtualMachine(testSourceFile, env, new(NopResolver), nil) // Init vm
+
+		if err != nil { // Check for errors
+			t.Fatal(err) // Panic
+		}
+
+		instances = append(instances, vm) // Append instance
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 { // Check instantiating wrote nothing
+		t.Fatalf("expected no state files before the first save, found %d", len(files)) // Panic
+	}
+
+	for i, vm := range instances { // Iterate through instances
+		if _, err := vm.Call("store", I32(0), I32(int32(i+1))); err != nil { // Write
+			t.Fatal(err) // Panic
+		}
+
+		if err := vm.SaveState(); err != nil { // Save state
+			t.Fatal(err) // Panic
+		}
+
+		if err := vm.StateDB.Close(); err != nil { // Close store
+			t.Fatal(err) // Panic
+		}
+	}
+
+	if _, err := NewVirtualMachine(testSourceFile, env, new(NopResolver), nil); err != nil { // Init a later instance
+		t.Fatal(err) // Panic
+	}
+
+	for _, vm := range instances { // Iterate through instances
+		store, err := OpenStateStore(&env, vm.StateDB.ID) // Reopen store
+
+		if err != nil { // Check for errors
+			t.Fatal(err) // Panic
+		}
+
+		stateDB, err := ReadStateDB(store) // Read saved states
+
+		if err != nil { // Check for errors
+			t.Fatal(err) // Panic
+		}
+
+		if len(stateDB.States) != 2 { // Check root and saved state kept
+			t.Fatalf("expected 2 states, got %d", len(stateDB.States)) // Panic
+		}
+
+		if _, err := stateDB.QueryState(vm.StateDB.WorkingRoot.ID); err != nil { // Check saved state kept
+			t.Fatal(err) // Panic
+		}
+
+		store.Close() // Close store
+	}
+}
+
+// TestStateKey - test instances given the same state key name the same state database, reopened byte for byte in a later process, and that it can be removed
+func TestStateKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ursa-state") // Init temp dir
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	defer os.RemoveAll(dir) // Remove temp dir
+
+	env := Environment{StateStorePath: dir, StateKey: "account-1"} // Init env
+
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/snapshot.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	vm, err := NewVirtualMachine(testSourceFile, env, new(NopResolver), nil) // Init vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if err := vm.LoadWorkingRoot(); err != nil { // Load root (nothing saved yet)
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := vm.Call("store", I32(0), I32(1)); err != nil { // Write
+		t.Fatal(err) // Panic
+	}
+
+	if err := vm.SaveState(); err != nil { // Save state
+		t.Fatal(err) // Panic
+	}
+
+	if !bytes.Equal(vm.StateDB.ID, StateDatabaseID(vm.Module.Identifier, env.StateKey)) { // Check ID named by key
+		t.Fatalf("expected state database ID %x, got %x", StateDatabaseID(vm.Module.Identifier, env.StateKey), vm.StateDB.ID) // Panic
+	}
+
+	encoded := vm.StateDB.Bytes() // Encode db
+
+	if err := vm.StateDB.Close(); err != nil { // Close store (end of the first process)
+		t.Fatal(err) // Panic
+	}
+
+	later, err := NewVirtualMachine(testSourceFile, env, new(NopResolver), nil) // Init vm of a later process
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if err := later.LoadWorkingRoot(); err != nil { // Load saved states
+		t.Fatal(err) // Panic
+	}
+
+	if !bytes.Equal(later.StateDB.Bytes(), encoded) { // Check same encoding
+		t.Fatal("expected the reopened state database to encode identically") // Panic
+	}
+
+	if results, err := later.Call("load", I32(0)); err != nil || results[0].I32() != 1 { // Check saved state loaded
+		t.Fatalf("expected 1, got %v (%v)", results, err) // Panic
+	}
+
+	if err := later.StateDB.Close(); err != nil { // Close store
+		t.Fatal(err) // Panic
+	}
+
+	if err := RemoveStateStore(&env, later.StateDB.ID); err != nil { // Remove store
+		t.Fatal(err) // Panic
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 { // Check removed
+		t.Fatalf("expected no state files, found %d", len(files)) // Panic
+	}
+}
+
+// TestOpenExistingStateStore - test opening the store of a state database that was never persisted fails without creating it
+func TestOpenExistingStateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ursa-state") // Init temp dir
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	defer os.RemoveAll(dir) // Remove temp dir
+
+	env := &Environment{StateStorePath: dir} // Init env
+
+	if _, err := OpenExistingStateStore(env, []byte("missing")); !errors.Is(err, ErrStateDBNotFound) { // Open missing store
+		t.Fatalf("expected %v, got %v", ErrStateDBNotFound, err) // Panic
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 { // Check nothing created
+		t.Fatalf("expected no state files, found %d", len(files)) // Panic
+	}
+
+	store, err := OpenStateStore(env, []byte("existing")) // Create store
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	store.Close() // Close store
+
+	if store, err = OpenExistingStateStore(env, []byte("existing")); err != nil { // Open existing store
+		t.Fatal(err) // Panic
+	}
+
+	store.Close() // Close store
+}
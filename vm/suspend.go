@@ -0,0 +1,89 @@
+package vm
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrSuspended - describes an error regarding a run suspended by a host function. Host functions
+	// return (or panic with) ErrSuspended to suspend the run until their result is available.
+	ErrSuspended = errors.New("execution suspended by host call")
+
+	// ErrNoSuspendedCall - describes an error regarding an attempt to resume a vm that was not suspended by a host function
+	ErrNoSuspendedCall = errors.New("vm is not suspended by a host call")
+)
+
+/* BEGIN EXPORTED METHODS */
+
+// Suspend - suspend the run from inside a host function (panics with ErrSuspended, so it does not return).
+// The run stops with ErrSuspended, its call stack is saved as a new state entry (the state db's working
+// root), and it can be continued with Resume once the result of the host call is known, in this or in
+// a later process (which reopens the state database with LoadStateDB and loads the suspended entry with
+// ResetToState). Calls made by host functions (see CallFunction) cannot be suspended.
+func (vm *VirtualMachine) Suspend() {
+	panic(ErrSuspended) // Panic
+}
+
+// Resume - continue a run suspended by a host function, passing the result of the host call (no
+// value for imports without results). Returns the results of the suspended run's entry function,
+// or ErrSuspended if it is suspended again.
+func (vm *VirtualMachine) Resume(result ...Value) ([]Value, error) {
+	return vm.ResumeContext(context.Background(), result...) // Resume without deadline
+}
+
+// ResumeContext - continue a run suspended by a host function (see Resume), stopping once ctx is done
+func (vm *VirtualMachine) ResumeContext(ctx context.Context, result ...Value) ([]Value, error) {
+	if !vm.Suspended || vm.CurrentFrame < 0 || vm.CurrentFrame >= len(vm.CallStack) { // Check suspended
+		return nil, ErrNoSuspendedCall // Return error
+	}
+
+	if err := contextError(ctx); err != nil { // Check already done
+		return nil, err // Return error
+	}
+
+	frame := &vm.CallStack[vm.CurrentFrame]                      // Get host call frame
+	sig := vm.functionSignature(frame.FunctionID)                // Get import signature
+	entrySig := vm.functionSignature(vm.CallStack[0].FunctionID) // Get entry function signature
+
+	if len(result) != len(sig.ReturnTypes) { // Check arity
+		return nil, fmt.Errorf("%w: import %d returns %d values, got %d", ErrArgumentCount, frame.FunctionID, len(sig.ReturnTypes), len(result)) // Return error
+	}
+
+	if len(result) > 0 { // Check has result
+		if result[0].Type != sig.ReturnTypes[0] { // Check type
+			return nil, fmt.Errorf("%w: import %d returns %s, got %s", ErrArgumentType, frame.FunctionID, sig.ReturnTypes[0], result[0].Type) // Return error
+		}
+
+		reg := int(binary.LittleEndian.Uint32(frame.Code[frame.IP-9 : frame.IP-5])) // Get result reg of the InvokeImport instruction
+
+		frame.Regs[reg] = result[0].Raw() // Set result
+	}
+
+	vm.Suspended = false // Continue run
+
+	ret, err := vm.resume(ctx) // Run until exit
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	return returnValues(entrySig, ret), nil // Return results
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// suspend - save the state of a run suspended by a host function
+func (vm *VirtualMachine) suspend() error {
+	if err := vm.SaveState(); err != nil { // Save state
+		return err // Return found error
+	}
+
+	return ErrSuspended // Return suspended
+}
+
+/* END INTERNAL METHODS */
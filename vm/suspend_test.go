@@ -0,0 +1,142 @@
+package vm
+
+import (
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newSuspendTestVM - initialize a vm running the suspend example module, whose fetch host function
+// suspends for any key but 0, and whose notify host function always suspends
+func newSuspendTestVM(t *testing.T, env Environment) *VirtualMachine {
+	host := NewHostModule("env") // Init module
+
+	if err := host.Func("fetch", func(key int32) (int32, error) {
+		if key == 0 { // Check answered immediately
+			return 42, nil // Return result
+		}
+
+		return 0, ErrSuspended // Answer later
+	}); err != nil { // Register function
+		t.Fatal(err) // Panic
+	}
+
+	if err := host.Func("notify", func(vm *VirtualMachine, key int32) {
+		vm.Suspend() // Answer later
+	}); err != nil { // Register function
+		t.Fatal(err) // Panic
+	}
+
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/suspend.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	vm, err := NewVirtualMachine(testSourceFile, env, host, nil) // Init vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	return vm // Return vm
+}
+
+// TestSuspend - test a run suspended by a host call is saved, and can be resumed by a later process
+func TestSuspend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ursa-state") // Init temp dir
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	defer os.RemoveAll(dir) // Remove temp dir
+
+	env := Environment{StateStore: StateStoreFile, StateStorePath: dir} // Keep states in files
+
+	vm := newSuspendTestVM(t, env) // Init vm
+
+	if results, err := vm.Call("run", I32(0)); err != nil || results[0].I32() != 42 { // Run without suspending
+		t.Fatalf("expected 42, got %v (%v)", results, err) // Panic
+	}
+
+	if _, err := vm.Resume(I32(1)); !errors.Is(err, ErrNoSuspendedCall) { // Resume idle vm
+		t.Fatalf("expected no suspended call error, got %v", err) // Panic
+	}
+
+	if _, err := vm.Call("run", I32(5)); !errors.Is(err, ErrSuspended) { // Suspend
+		t.Fatalf("expected suspended error, got %v", err) // Panic
+	}
+
+	suspended := vm.StateDB.WorkingRoot // Get saved state
+
+	if !vm.Suspended || !suspended.State.Suspended || suspended.State.CurrentFrame != 1 { // Check saved with call stack
+		t.Fatal("expected suspended state with the host call frame") // Panic
+	}
+
+	stateDBID := hex.EncodeToString(vm.StateDB.ID) // Get ID of the saved states
+
+	if err := vm.StateDB.Close(); err != nil { // Close store (end of the first process)
+		t.Fatal(err) // Panic
+	}
+
+	later := newSuspendTestVM(t, env) // Init vm of a later process
+
+	if err := later.LoadStateDB(stateDBID); err != nil { // Read saved states from disk
+		t.Fatal(err) // Panic
+	}
+
+	defer later.StateDB.Close() // Close store
+
+	if err := later.ResetToState(suspended.ID); err != nil { // Load suspended state
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := later.Resume(I64(7)); !errors.Is(err, ErrArgumentType) { // Resume with wrong type
+		t.Fatalf("expected argument type error, got %v", err) // Panic
+	}
+
+	if results, err := later.Resume(I32(7)); err != nil || results[0].I32() != 507 { // Resume with result
+		t.Fatalf("expected 507, got %v (%v)", results, err) // Panic
+	}
+
+	if value, err := later.GuestMemory().ReadUint32(0); err != nil || value != 7 { // Check result was used
+		t.Fatalf("expected 7 in memory, got %d (%v)", value, err) // Panic
+	}
+
+	if later.Suspended || later.CurrentFrame != -1 { // Check finished
+		t.Fatal("expected finished run") // Panic
+	}
+}
+
+// TestSuspendRepeatedly - test runs can be suspended more than once, and by imports without results
+func TestSuspendRepeatedly(t *testing.T) {
+	vm := newSuspendTestVM(t, Environment{StateStore: StateStoreMemory}) // Init vm
+
+	if _, err := vm.Call("twice"); !errors.Is(err, ErrSuspended) { // Suspend on first fetch
+		t.Fatalf("expected suspended error, got %v", err) // Panic
+	}
+
+	if _, err := vm.Resume(I32(10)); !errors.Is(err, ErrSuspended) { // Suspend on second fetch
+		t.Fatalf("expected suspended error, got %v", err) // Panic
+	}
+
+	if results, err := vm.Resume(I32(20)); err != nil || results[0].I32() != 30 { // Resume with second result
+		t.Fatalf("expected 30, got %v (%v)", results, err) // Panic
+	}
+
+	if _, err := vm.Call("wait"); !errors.Is(err, ErrSuspended) { // Suspend on notify
+		t.Fatalf("expected suspended error, got %v", err) // Panic
+	}
+
+	if _, err := vm.Resume(I32(1)); !errors.Is(err, ErrArgumentCount) { // Resume void import with a result
+		t.Fatalf("expected argument count error, got %v", err) // Panic
+	}
+
+	if results, err := vm.Resume(); err != nil || len(results) != 0 { // Resume without result
+		t.Fatalf("expected no results, got %v (%v)", results, err) // Panic
+	}
+}
@@ -0,0 +1,158 @@
+package vm
+
+import (
+	"errors"
+)
+
+var (
+	// ErrTransactionActive - describes an error regarding an attempt to begin a transaction while one is active
+	ErrTransactionActive = errors.New("transaction already active")
+
+	// ErrNoTransaction - describes an error regarding an attempt to commit or roll back with no active transaction
+	ErrNoTransaction = errors.New("no active transaction")
+)
+
+// transaction - journal of the state a transaction can roll back. Memory pages are copied just
+// before their first write, so a transaction costs in proportion to the pages it writes.
+type transaction struct {
+	memorySize int      // Memory size when the transaction began
+	pages      [][]byte // Contents of each page when the transaction began, by page index (nil until first written)
+
+	globals []int64  // Globals when the transaction began
+	table   []uint32 // Table when the transaction began
+
+	storage map[string]storageUndo // Value of each storage key when the transaction began (set before its first write)
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// Begin - start a transaction. Until it is committed, memory, globals, the table and storage can be
+// rolled back to their values at this point.
+func (vm *VirtualMachine) Begin() error {
+	if vm.transaction != nil { // Check already active
+		return ErrTransactionActive // Return error
+	}
+
+	vm.transaction = &transaction{
+		memorySize: len(vm.Memory),                                                     // Set memory size
+		pages:      make([][]byte, (len(vm.Memory)+DefaultPageSize-1)/DefaultPageSize), // Init page journal
+		globals:    append([]int64(nil), vm.Globals...),                                // Copy globals
+		table:      append([]uint32(nil), vm.Table...),                                 // Copy table
+		storage:    make(map[string]storageUndo),                                       // Init storage journal
+	} // Init transaction
+
+	return nil // No error occurred, return nil
+}
+
+// Commit - end the active transaction, keeping its changes
+func (vm *VirtualMachine) Commit() error {
+	if vm.transaction == nil { // Check active
+		return ErrNoTransaction // Return error
+	}
+
+	vm.transaction = nil // Drop journal
+
+	return nil // No error occurred, return nil
+}
+
+// Rollback - end the active transaction, restoring memory, globals, the table and storage to their values
+// when it began, and abandoning any in-progress or trapped execution (see Reset). Gas used is kept.
+func (vm *VirtualMachine) Rollback() error {
+	tx := vm.transaction // Get transaction
+
+	if tx == nil { // Check active
+		return ErrNoTransaction // Return error
+	}
+
+	vm.ownMemory() // Copy memory shared with a clone
+
+	for page, data := range tx.pages { // Iterate through journaled pages
+		if data != nil { // Check written
+			copy(vm.Memory[page*DefaultPageSize:], data) // Restore page
+		}
+	}
+
+	if len(vm.Memory) > tx.memorySize { // Check memory grown
+		vm.Memory = vm.Memory[:tx.memorySize] // Drop grown pages
+	}
+
+	vm.Globals = tx.globals // Restore globals
+	vm.Table = tx.table     // Restore table
+
+	for key, undo := range tx.storage { // Iterate through journaled keys
+		if undo.existed { // Check was set
+			vm.Storage[key] = undo.value // Restore value
+		} else {
+			delete(vm.Storage, key) // Remove value
+		}
+	}
+
+	vm.transaction = nil // Drop journal
+
+	vm.Reset() // Abandon execution
+
+	return nil // No error occurred, return nil
+}
+
+// InTransaction - check whether a transaction is active
+func (vm *VirtualMachine) InTransaction() bool {
+	return vm.transaction != nil // Return is active
+}
+
+// RunTransaction - run the function with the given ID in a transaction, committing its changes if
+// it returns, or rolling them back and returning the trap if it traps, runs out of gas or is canceled
+func (vm *VirtualMachine) RunTransaction(entryID int, params ...int64) (int64, error) {
+	if err := vm.Begin(); err != nil { // Begin transaction
+		return -1, err // Return found error
+	}
+
+	ret, err := vm.Run(entryID, params...) // Run
+
+	if err != nil { // Check failed
+		vm.Rollback() // Roll back
+
+		return -1, err // Return found error
+	}
+
+	return ret, vm.Commit() // Commit
+}
+
+// CallTransaction - call the exported function with the given name in a transaction (see RunTransaction)
+func (vm *VirtualMachine) CallTransaction(name string, args ...Value) ([]Value, error) {
+	if err := vm.Begin(); err != nil { // Begin transaction
+		return nil, err // Return found error
+	}
+
+	results, err := vm.Call(name, args...) // Call
+
+	if err != nil { // Check failed
+		vm.Rollback() // Roll back
+
+		return nil, err // Return found error
+	}
+
+	return results, vm.Commit() // Commit
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// journal - save the pages in the given range that have not been written since the transaction began
+func (tx *transaction) journal(memory []byte, first int, last int) {
+	for page := first; page <= last && page < len(tx.pages); page++ { // Iterate through pages present at begin
+		if tx.pages[page] != nil { // Check already saved
+			continue // Skip
+		}
+
+		end := (page + 1) * DefaultPageSize // Get page end
+
+		if end > tx.memorySize { // Check partial page
+			end = tx.memorySize // Clamp
+		}
+
+		tx.pages[page] = append([]byte(nil), memory[page*DefaultPageSize:end]...) // Save page
+	}
+}
+
+/* END INTERNAL METHODS */
@@ -0,0 +1,66 @@
+package vm
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestTransactionRollback - test a trapping call in a transaction leaves memory, globals and memory size as they were
+func TestTransactionRollback(t *testing.T) {
+	vm := newSnapshotTestVM(t) // Init vm
+
+	if _, err := vm.CallTransaction("store", I32(16), I32(42)); err != nil { // Commit a write
+		t.Fatal(err) // Panic
+	}
+
+	if vm.InTransaction() { // Check committed
+		t.Fatal("expected no active transaction after commit") // Panic
+	}
+
+	root := vm.StateRoot() // Get state commitment
+
+	if _, err := vm.CallTransaction("fail", I32(16), I32(7)); !errors.Is(err, TrapUnreachable) { // Write, bump, grow, then trap
+		t.Fatalf("expected unreachable trap, got %v", err) // Panic
+	}
+
+	if len(vm.Memory) != 4*DefaultPageSize || vm.Globals[0] != 7 || vm.ExitError != nil { // Check rolled back
+		t.Fatalf("expected rollback, got %d bytes of memory and counter %d (%v)", len(vm.Memory), vm.Globals[0], vm.ExitError) // Panic
+	}
+
+	if results, err := vm.Call("load", I32(16)); err != nil || results[0].I32() != 42 { // Check committed write kept, trapped write undone
+		t.Fatalf("expected 42, got %v (%v)", results, err) // Panic
+	}
+
+	if string(vm.StateRoot()) != string(root) { // Check commitment restored
+		t.Fatal("expected state root to match the state before the trapped call") // Panic
+	}
+}
+
+// TestTransactionBoundaries - test transactions do not nest, and commit and rollback need an active transaction
+func TestTransactionBoundaries(t *testing.T) {
+	vm := newSnapshotTestVM(t) // Init vm
+
+	if err := vm.Commit(); !errors.Is(err, ErrNoTransaction) { // Commit without transaction
+		t.Fatalf("expected no transaction error, got %v", err) // Panic
+	}
+
+	if err := vm.Begin(); err != nil { // Begin transaction
+		t.Fatal(err) // Panic
+	}
+
+	if _, err := vm.CallTransaction("bump"); !errors.Is(err, ErrTransactionActive) { // Nest transaction
+		t.Fatalf("expected transaction active error, got %v", err) // Panic
+	}
+
+	if _, err := vm.Call("bump"); err != nil { // Bump within transaction
+		t.Fatal(err) // Panic
+	}
+
+	if err := vm.Rollback(); err != nil { // Roll back
+		t.Fatal(err) // Panic
+	}
+
+	if vm.Globals[0] != 7 { // Check bump undone
+		t.Fatalf("expected counter 7 after rollback, got %d", vm.Globals[0]) // Panic
+	}
+}
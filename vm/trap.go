@@ -0,0 +1,207 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/SummerCash/ursa/common"
+	"github.com/SummerCash/ursa/compiler/opcodes"
+)
+
+// TrapKind - category of a runtime trap. A TrapKind is itself an error, so that
+// errors.Is(err, vm.TrapOutOfGas) reports whether err is (or wraps) a trap of that kind.
+type TrapKind int
+
+const (
+	// TrapUnknown - describes a trap whose cause could not be classified
+	TrapUnknown TrapKind = iota
+
+	// TrapUnreachable - describes a trap regarding an executed unreachable instruction
+	TrapUnreachable
+
+	// TrapIntegerDivideByZero - describes a trap regarding an integer division or remainder by zero
+	TrapIntegerDivideByZero
+
+	// TrapIntegerOverflow - describes a trap regarding an integer result that cannot be represented (signed division, truncation)
+	TrapIntegerOverflow
+
+	// TrapInvalidConversion - describes a trap regarding a float to integer truncation of NaN
+	TrapInvalidConversion
+
+	// TrapOutOfBoundsMemory - describes a trap regarding a load or store outside of linear memory
+	TrapOutOfBoundsMemory
+
+	// TrapUndefinedElement - describes a trap regarding a call_indirect through an empty or out of range table slot
+	TrapUndefinedElement
+
+	// TrapIndirectCallTypeMismatch - describes a trap regarding a call_indirect whose callee signature differs from the expected type
+	TrapIndirectCallTypeMismatch
+
+	// TrapCallStackExhausted - describes a trap regarding exceeding the max call stack depth or value slot count
+	TrapCallStackExhausted
+
+	// TrapOutOfGas - describes a trap regarding exceeding the environment's gas limit
+	TrapOutOfGas
+
+	// TrapFloatingPointDisabled - describes a trap regarding a floating point instruction executed while floating point is disabled
+	TrapFloatingPointDisabled
+
+	// TrapHostError - describes a trap regarding a host (imported) function that failed
+	TrapHostError
+)
+
+// Trap - runtime failure raised by a running WebAssembly function
+type Trap struct {
+	Kind TrapKind `json:"kind"` // Trap kind
+
+	FunctionID   int    `json:"function_id"`   // Index of the function that trapped (-1 if unknown)
+	FunctionName string `json:"function_name"` // Name of the function that trapped (from the name section; may be empty)
+	Offset       int    `json:"offset"`        // Bytecode offset of the trapping instruction within the function
+
+	Err error `json:"-"` // Underlying cause (runtime or host error; may be nil)
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// String - get string representation of trap kind
+func (kind TrapKind) String() string {
+	switch kind { // Handle kinds
+	case TrapUnreachable:
+		return "unreachable executed"
+	case TrapIntegerDivideByZero:
+		return "integer divide by zero"
+	case TrapIntegerOverflow:
+		return "integer overflow"
+	case TrapInvalidConversion:
+		return "invalid conversion to integer"
+	case TrapOutOfBoundsMemory:
+		return "out of bounds memory access"
+	case TrapUndefinedElement:
+		return "undefined element"
+	case TrapIndirectCallTypeMismatch:
+		return "indirect call type mismatch"
+	case TrapCallStackExhausted:
+		return "call stack exhausted"
+	case TrapOutOfGas:
+		return "gas limit exceeded"
+	case TrapFloatingPointDisabled:
+		return "floating point disabled"
+	case TrapHostError:
+		return "host function failed"
+	default:
+		return "unknown trap"
+	}
+}
+
+// Error - get error message of trap kind
+func (kind TrapKind) Error() string {
+	return "wasm: " + kind.String() // Return message
+}
+
+// Error - get error message of trap, including its location
+func (trap *Trap) Error() string {
+	message := trap.Kind.Error() // Init message
+
+	if trap.FunctionID >= 0 { // Check has location
+		if trap.FunctionName != "" { // Check has name
+			message += fmt.Sprintf(" in function %d (%s) at offset %d", trap.FunctionID, trap.FunctionName, trap.Offset) // Append location
+		} else {
+			message += fmt.Sprintf(" in function %d at offset %d", trap.FunctionID, trap.Offset) // Append location
+		}
+	}
+
+	if trap.Err != nil { // Check has cause
+		message += ": " + trap.Err.Error() // Append cause
+	}
+
+	return message // Return message
+}
+
+// Unwrap - get the underlying cause of trap
+func (trap *Trap) Unwrap() error {
+	return trap.Err // Return cause
+}
+
+// Is - check trap is of the given kind (for use with errors.Is)
+func (trap *Trap) Is(target error) bool {
+	kind, ok := target.(TrapKind) // Get kind
+
+	return ok && kind == trap.Kind // Check kinds match
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// newTrap - convert a value recovered while executing the given frame into a trap.
+// ins is the instruction that was executing at offset.
+func (vm *VirtualMachine) newTrap(cause interface{}, frame *Frame, offset int, ins opcodes.Opcode) *Trap {
+	trap := &Trap{Kind: TrapUnknown, FunctionID: -1, Offset: offset} // Init trap
+
+	switch cause := cause.(type) { // Handle cause types
+	case TrapKind:
+		trap.Kind = cause // Set kind
+	case *Trap:
+		return cause // Already located
+	case runtime.Error:
+		if ins >= opcodes.I32Load && ins <= opcodes.I64Store32 { // Check is memory access
+			trap.Kind = TrapOutOfBoundsMemory // Set kind
+		}
+
+		trap.Err = cause // Set cause
+	default:
+		trap.Err = common.UnifyError(cause) // Set cause
+	}
+
+	if frame != nil { // Check has frame
+		trap.FunctionID = frame.FunctionID                            // Set function ID
+		trap.FunctionName = vm.Module.FunctionNames[frame.FunctionID] // Set function name
+	}
+
+	return trap // Return trap
+}
+
+// runDelegate - run the pending host call, recording a panic inside it as a trap.
+// Hosts may panic with a TrapKind (e.g. TrapOutOfGas) to raise that kind directly;
+// anything else becomes a TrapHostError wrapping the panic value.
+func (vm *VirtualMachine) runDelegate() (retErr error) {
+	delegate := vm.Delegate // Get delegate call
+
+	vm.Delegate = nil // Clear delegate, so that the host can call back into the vm
+	vm.hostCalls++    // Enter host call
+
+	defer func() {
+		vm.hostCalls-- // Leave host call
+
+		if err := recover(); err != nil { // Check for errors
+			if cause, ok := err.(error); ok && errors.Is(cause, ErrSuspended) && vm.entryFrame == 0 { // Check host suspended the run
+				vm.Suspended = true // Set suspended
+
+				return // Leave the import frame to receive the result on resume
+			}
+
+			frame := &vm.CallStack[vm.CurrentFrame] // Get import frame
+
+			trap := &Trap{Kind: TrapHostError, FunctionID: frame.FunctionID, Offset: frame.IP - 9} // Init trap (InvokeImport is a 5 byte header plus 4 byte import ID)
+
+			if kind, ok := err.(TrapKind); ok { // Check host raised a trap kind
+				trap.Kind = kind // Set kind
+			} else {
+				trap.Err = common.UnifyError(err) // Set cause
+			}
+
+			trap.FunctionName = vm.Module.FunctionNames[frame.FunctionID] // Set function name
+
+			vm.Exited = true    // Set exited
+			vm.ExitError = trap // Set exit error
+			retErr = trap       // Set error
+		}
+	}()
+
+	delegate() // Run delegate call
+
+	return nil // No error occurred, return nil
+}
+
+/* END INTERNAL METHODS */
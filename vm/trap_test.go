@@ -0,0 +1,132 @@
+package vm
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// errHostFailure - error raised by the trap example's env.fail import
+var errHostFailure = errors.New("host failure")
+
+// failResolver - resolves env.fail to a host function panicking with fail
+type failResolver struct {
+	fail interface{} // Panic value
+}
+
+// ResolveFunc - resolve env.fail
+func (r *failResolver) ResolveFunc(module, field string) FunctionImport {
+	return func(vm *VirtualMachine) int64 {
+		panic(r.fail) // Panic
+	}
+}
+
+// ResolveGlobal - panic
+func (r *failResolver) ResolveGlobal(module, field string) int64 {
+	panic("global import not allowed") // Panic
+}
+
+// newTrapTestVM - initialize a vm running the trap example module
+func newTrapTestVM(t *testing.T, fail interface{}) *VirtualMachine {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/trap.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	vm, err := NewVirtualMachine(testSourceFile, Environment{}, &failResolver{fail: fail}, nil) // Init vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	return vm // Return vm
+}
+
+// TestTrapKinds - test each failure surfaces as a trap of the matching kind
+func TestTrapKinds(t *testing.T) {
+	tests := []struct {
+		name string   // Export name
+		args []Value  // Arguments
+		kind TrapKind // Expected kind
+	}{
+		{"unreachable", nil, TrapUnreachable},
+		{"div", []Value{I32(1), I32(0)}, TrapIntegerDivideByZero},
+		{"div", []Value{I32(-2147483648), I32(-1)}, TrapIntegerOverflow},
+		{"load", []Value{I32(65535)}, TrapOutOfBoundsMemory},
+		{"recurse", nil, TrapCallStackExhausted},
+		{"host", nil, TrapHostError},
+	}
+
+	for _, test := range tests { // Iterate through tests
+		vm := newTrapTestVM(t, errHostFailure) // Init vm
+
+		_, err := vm.Call(test.name, test.args...) // Call function
+
+		if !errors.Is(err, test.kind) { // Check kind
+			t.Fatalf("%s: expected %v, got %v", test.name, test.kind, err) // Panic
+		}
+
+		var trap *Trap // Init trap buffer
+
+		if !errors.As(err, &trap) { // Check is trap
+			t.Fatalf("%s: expected *Trap, got %T", test.name, err) // Panic
+		}
+
+		if trap.FunctionID < 0 { // Check located
+			t.Fatalf("%s: trap has no function", test.name) // Panic
+		}
+	}
+}
+
+// TestTrapLocation - test a trap records the trapping function's index, name and offset
+func TestTrapLocation(t *testing.T) {
+	vm := newTrapTestVM(t, errHostFailure) // Init vm
+
+	functionID, _ := vm.GetFunctionExport("div") // Get function
+
+	_, err := vm.Call("div", I32(1), I32(0)) // Divide by zero
+
+	var trap *Trap // Init trap buffer
+
+	if !errors.As(err, &trap) { // Check is trap
+		t.Fatalf("expected *Trap, got %v", err) // Panic
+	}
+
+	if trap.FunctionID != functionID || trap.FunctionName != "div" { // Check function
+		t.Fatalf("expected function %d (div), got %d (%s)", functionID, trap.FunctionID, trap.FunctionName) // Panic
+	}
+
+	if trap.Offset <= 0 || trap.Offset >= len(vm.FunctionCode[functionID].Bytes) { // Check offset is inside the function
+		t.Fatalf("offset %d out of range", trap.Offset) // Panic
+	}
+
+	if trap.Err != nil { // Check no cause
+		t.Fatalf("unexpected cause %v", trap.Err) // Panic
+	}
+}
+
+// TestHostTrap - test host panics are wrapped or raised as the given kind
+func TestHostTrap(t *testing.T) {
+	vm := newTrapTestVM(t, errHostFailure) // Init vm
+
+	if _, err := vm.Call("host"); !errors.Is(err, errHostFailure) { // Check cause preserved
+		t.Fatalf("expected %v, got %v", errHostFailure, err) // Panic
+	}
+
+	vm = newTrapTestVM(t, TrapOutOfGas) // Init vm raising a trap kind
+
+	if _, err := vm.Call("host"); !errors.Is(err, TrapOutOfGas) || errors.Is(err, TrapHostError) { // Check kind raised directly
+		t.Fatalf("expected %v, got %v", TrapOutOfGas, err) // Panic
+	}
+}
+
+// TestOutOfGasTrap - test exceeding the gas limit raises TrapOutOfGas
+func TestOutOfGasTrap(t *testing.T) {
+	vm := newMeteredSpinTestVM(t, Environment{GasLimit: 1000}) // Init metered vm
+
+	if _, err := vm.Call("count", I32(1000000)); !errors.Is(err, TrapOutOfGas) { // Run until out of gas
+		t.Fatalf("expected %v, got %v", TrapOutOfGas, err) // Panic
+	}
+}
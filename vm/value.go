@@ -0,0 +1,183 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/SummerCash/wagon/wasm"
+)
+
+var (
+	// ErrFunctionNotFound - describes an error regarding a call to a function that is not exported by the module
+	ErrFunctionNotFound = errors.New("function not found")
+
+	// ErrArgumentCount - describes an error regarding a call with a different number of arguments than the function declares
+	ErrArgumentCount = errors.New("argument count mismatch")
+
+	// ErrArgumentType - describes an error regarding a call argument whose type differs from the declared param type
+	ErrArgumentType = errors.New("argument type mismatch")
+)
+
+// Value - typed WebAssembly value (i32, i64, f32 or f64)
+type Value struct {
+	Type wasm.ValueType // Value type
+
+	bits uint64 // Raw bits (floats as IEEE 754 bit patterns)
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// I32 - initialize an i32 value
+func I32(v int32) Value {
+	return Value{Type: wasm.ValueTypeI32, bits: uint64(uint32(v))} // Return value
+}
+
+// I64 - initialize an i64 value
+func I64(v int64) Value {
+	return Value{Type: wasm.ValueTypeI64, bits: uint64(v)} // Return value
+}
+
+// F32 - initialize an f32 value
+func F32(v float32) Value {
+	return Value{Type: wasm.ValueTypeF32, bits: uint64(math.Float32bits(v))} // Return value
+}
+
+// F64 - initialize an f64 value
+func F64(v float64) Value {
+	return Value{Type: wasm.ValueTypeF64, bits: math.Float64bits(v)} // Return value
+}
+
+// ValueFromRaw - initialize a value of the given type from the VM's int64 register representation
+func ValueFromRaw(t wasm.ValueType, raw int64) Value {
+	if t == wasm.ValueTypeI32 || t == wasm.ValueTypeF32 { // Check is 32-bit
+		return Value{Type: t, bits: uint64(uint32(raw))} // Return value (upper bits discarded)
+	}
+
+	return Value{Type: t, bits: uint64(raw)} // Return value
+}
+
+// Raw - get value in the VM's int64 register representation
+func (value Value) Raw() int64 {
+	return int64(value.bits) // Return bits
+}
+
+// I32 - get value as an i32 (panics if not an i32)
+func (value Value) I32() int32 {
+	value.mustBe(wasm.ValueTypeI32) // Check type
+
+	return int32(uint32(value.bits)) // Return value
+}
+
+// I64 - get value as an i64 (panics if not an i64)
+func (value Value) I64() int64 {
+	value.mustBe(wasm.ValueTypeI64) // Check type
+
+	return int64(value.bits) // Return value
+}
+
+// F32 - get value as an f32 (panics if not an f32)
+func (value Value) F32() float32 {
+	value.mustBe(wasm.ValueTypeF32) // Check type
+
+	return math.Float32frombits(uint32(value.bits)) // Return value
+}
+
+// F64 - get value as an f64 (panics if not an f64)
+func (value Value) F64() float64 {
+	value.mustBe(wasm.ValueTypeF64) // Check type
+
+	return math.Float64frombits(value.bits) // Return value
+}
+
+// String - get string representation of value
+func (value Value) String() string {
+	switch value.Type { // Handle types
+	case wasm.ValueTypeI32:
+		return fmt.Sprintf("i32:%d", value.I32()) // Return i32
+	case wasm.ValueTypeI64:
+		return fmt.Sprintf("i64:%d", value.I64()) // Return i64
+	case wasm.ValueTypeF32:
+		return fmt.Sprintf("f32:%v", value.F32()) // Return f32
+	case wasm.ValueTypeF64:
+		return fmt.Sprintf("f64:%v", value.F64()) // Return f64
+	default:
+		return fmt.Sprintf("unknown:%d", value.bits) // Return raw bits
+	}
+}
+
+// Call - call the exported function with the given name, checking args against its signature
+func (vm *VirtualMachine) Call(name string, args ...Value) ([]Value, error) {
+	functionID, ok := vm.GetFunctionExport(name) // Get function
+
+	if !ok { // Check exported
+		return nil, fmt.Errorf("%w: %s", ErrFunctionNotFound, name) // Return error
+	}
+
+	return vm.CallFunction(functionID, args...) // Call function
+}
+
+// CallFunction - call the function with the given index, checking args against its signature.
+// Returns one value per declared result (none for void functions). Host functions may call
+// back into the guest this way: the call runs on top of the host call's frame, sharing its
+// gas limit and call stack limits, and a trap inside it is returned rather than ending the
+// enclosing run.
+func (vm *VirtualMachine) CallFunction(functionID int, args ...Value) ([]Value, error) {
+	if functionID < 0 || functionID >= len(vm.FunctionCode) { // Check in bounds
+		return nil, fmt.Errorf("%w: function %d", ErrFunctionNotFound, functionID) // Return error
+	}
+
+	sig := vm.functionSignature(functionID) // Get signature
+
+	if len(args) != len(sig.ParamTypes) { // Check arity
+		return nil, fmt.Errorf("%w: function %d takes %d arguments, got %d", ErrArgumentCount, functionID, len(sig.ParamTypes), len(args)) // Return error
+	}
+
+	params := make([]int64, len(args)) // Init param buffer
+
+	for i, arg := range args { // Iterate through args
+		if arg.Type != sig.ParamTypes[i] { // Check type
+			return nil, fmt.Errorf("%w: argument %d of function %d must be %s, got %s", ErrArgumentType, i, functionID, sig.ParamTypes[i], arg.Type) // Return error
+		}
+
+		params[i] = arg.Raw() // Set param
+	}
+
+	run := vm.Run // Init run buffer
+
+	if vm.hostCalls > 0 { // Check called by a host function
+		run = vm.runNested // Run on top of the host call
+	}
+
+	ret, err := run(functionID, params...) // Run function
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	return returnValues(sig, ret), nil // Return results
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// returnValues - convert the raw return value of a function with the given signature to one value per declared result
+func returnValues(sig *wasm.FunctionSig, ret int64) []Value {
+	results := make([]Value, len(sig.ReturnTypes)) // Init result buffer
+
+	for i, t := range sig.ReturnTypes { // Iterate through results
+		results[i] = ValueFromRaw(t, ret) // Set result
+	}
+
+	return results // Return results
+}
+
+// mustBe - panic if value is not of the given type
+func (value Value) mustBe(t wasm.ValueType) {
+	if value.Type != t { // Check type
+		panic(fmt.Sprintf("value is %s, not %s", value.Type, t)) // Panic
+	}
+}
+
+/* END INTERNAL METHODS */
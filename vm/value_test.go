@@ -0,0 +1,115 @@
+package vm
+
+import (
+	"errors"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/SummerCash/wagon/wasm"
+)
+
+// newTypedTestVM - initialize a vm running the typed example module
+func newTypedTestVM(t *testing.T) *VirtualMachine {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/typed.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	vm, err := NewVirtualMachine(testSourceFile, Environment{DefaultMemoryPages: 1}, new(NopResolver), nil) // Init vm
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	return vm // Return vm
+}
+
+// TestValue - test functionality of typed value conversions
+func TestValue(t *testing.T) {
+	if v := I32(-5); v.I32() != -5 || v.Raw() != 0xfffffffb { // Check i32 round trip
+		t.Fatalf("unexpected i32 %s (raw %d)", v, v.Raw()) // Panic
+	}
+
+	if v := ValueFromRaw(wasm.ValueTypeI32, -5); v.I32() != -5 { // Check sign-extended register
+		t.Fatalf("unexpected i32 %s", v) // Panic
+	}
+
+	if v := F32(1.5); v.F32() != 1.5 || v.Raw() != int64(math.Float32bits(1.5)) { // Check f32 round trip
+		t.Fatalf("unexpected f32 %s", v) // Panic
+	}
+
+	if v := F64(-2.25); v.F64() != -2.25 || v.String() != "f64:-2.25" { // Check f64 round trip
+		t.Fatalf("unexpected f64 %s", v) // Panic
+	}
+
+	defer func() {
+		if recover() == nil { // Check panicked
+			t.Fatal("expected panic reading i64 as f64") // Panic
+		}
+	}()
+
+	I64(1).F64() // Read wrong type
+}
+
+// TestCall - test functionality of typed calls
+func TestCall(t *testing.T) {
+	vm := newTypedTestVM(t) // Init vm
+
+	results, err := vm.Call("add_f64", F64(1.25), F64(2.5)) // Call add_f64
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if len(results) != 1 || results[0].F64() != 3.75 { // Check result
+		t.Fatalf("unexpected results %v", results) // Panic
+	}
+
+	if results, err = vm.Call("mul_f32", F32(1.5), F32(-4)); err != nil || results[0].F32() != -6 { // Call mul_f32
+		t.Fatalf("unexpected results %v (%v)", results, err) // Panic
+	}
+
+	if results, err = vm.Call("mix", I32(-1), I64(10), F32(0.5), F64(0.25)); err != nil || results[0].F64() != 9.75 { // Call mix
+		t.Fatalf("unexpected results %v (%v)", results, err) // Panic
+	}
+
+	if results, err = vm.Call("neg_i32", I32(7)); err != nil || results[0].I32() != -7 { // Call neg_i32
+		t.Fatalf("unexpected results %v (%v)", results, err) // Panic
+	}
+
+	if results, err = vm.Call("neg_i64", I64(math.MinInt64+1)); err != nil || results[0].I64() != math.MaxInt64 { // Call neg_i64
+		t.Fatalf("unexpected results %v (%v)", results, err) // Panic
+	}
+
+	if results, err = vm.Call("nop"); err != nil || len(results) != 0 { // Call void function
+		t.Fatalf("unexpected results %v (%v)", results, err) // Panic
+	}
+}
+
+// TestCallErrors - test typed calls reject mismatched arguments
+func TestCallErrors(t *testing.T) {
+	vm := newTypedTestVM(t) // Init vm
+
+	if _, err := vm.Call("missing"); !errors.Is(err, ErrFunctionNotFound) { // Check missing export
+		t.Fatalf("expected %v, got %v", ErrFunctionNotFound, err) // Panic
+	}
+
+	if _, err := vm.Call("add_f64", F64(1)); !errors.Is(err, ErrArgumentCount) { // Check arity
+		t.Fatalf("expected %v, got %v", ErrArgumentCount, err) // Panic
+	}
+
+	if _, err := vm.Call("add_f64", F64(1), I64(1)); !errors.Is(err, ErrArgumentType) { // Check types
+		t.Fatalf("expected %v, got %v", ErrArgumentType, err) // Panic
+	}
+
+	if _, err := vm.CallFunction(len(vm.FunctionCode)); !errors.Is(err, ErrFunctionNotFound) { // Check out of bounds
+		t.Fatalf("expected %v, got %v", ErrFunctionNotFound, err) // Panic
+	}
+
+	if results, err := vm.Call("neg_i32", I32(1)); err != nil || results[0].I32() != -1 { // Check vm still usable
+		t.Fatalf("unexpected results %v (%v)", results, err) // Panic
+	}
+}
@@ -1,8 +1,10 @@
 package vm
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"math"
 	"math/bits"
@@ -10,6 +12,7 @@ import (
 	"github.com/SummerCash/ursa/common"
 	"github.com/SummerCash/ursa/compiler"
 	"github.com/SummerCash/ursa/compiler/opcodes"
+	"github.com/SummerCash/ursa/crypto"
 	"github.com/SummerCash/wagon/wasm"
 )
 
@@ -17,6 +20,9 @@ const (
 	// DefaultCallStackSize - default call stack size.
 	DefaultCallStackSize = 512
 
+	// ExecutionSliceSize - max number of instructions run by a single call to Execute
+	ExecutionSliceSize = 10000
+
 	// DefaultPageSize - linear memory page size
 	DefaultPageSize = 65536
 )
@@ -40,7 +46,7 @@ type VirtualMachine struct {
 
 	Globals []int64 // Global vrs
 
-	Memory []byte // Virtual machine memory
+	Memory []byte // Virtual machine memory (may be shared with a clone: write through GuestMemory, or call MarkDirty before writing directly)
 
 	NumValueSlots int // Num of used value slots
 
@@ -58,7 +64,28 @@ type VirtualMachine struct {
 	Gas              uint64 // Gas usage
 	GasLimitExceeded bool   // Has exceeded given gas limit
 
-	StateDB *StateDatabase // State database
+	deniedGas uint64 // Gas of the last charge rejected for exceeding the gas limit
+
+	Suspended bool // Suspended by a host function (see Resume)
+
+	Storage map[string][]byte // Persistent storage (see StorageModule)
+
+	StateDB *StateDatabase // State database (nil until first used, see StateDatabase)
+
+	pendingRoot *StateEntry // Root of the state database created on first use: the instance's initial state (ID nil) or the working root of the vm it was forked from
+	pendingBase []byte      // Memory the pending root's pages apply to (nil if it is a full snapshot)
+
+	dirtyPages []bool   // Memory pages written since the working root was saved, by page index
+	pageHashes [][]byte // Hash of each memory page (as of its last rehash)
+
+	memoryShared bool // Memory is shared with a clone (copied before the next write)
+
+	transaction *transaction // Journal of the active transaction (nil outside one)
+
+	hostCalls  int // Number of host calls in progress
+	entryFrame int // Call stack index of the innermost run's entry frame (above 0 inside calls made by host functions)
+
+	ctx context.Context // Context of the current run (nil outside RunContext)
 }
 
 // Frame - call stack frame
@@ -81,68 +108,92 @@ type ImportResolver interface {
 // NewVirtualMachine - instantiate a virtual machine for a given WebAssembly module, with
 // specific execution options specified under a VMConfig, and a WebAssembly module import
 // resolver
-func NewVirtualMachine(code []byte, config Environment, impResolver ImportResolver, gasPolicy compiler.GasPolicy) (_retVM *VirtualMachine, retErr error) {
+func NewVirtualMachine(code []byte, config Environment, impResolver ImportResolver, gasPolicy compiler.GasPolicy) (*VirtualMachine, error) {
 	if config.EnableJIT { // Check needs JIT
 		fmt.Println("Warning: JIT support is removed.") // Log removed JIT support
 	}
 
-	m, err := compiler.LoadModule(code) // Load module
-
-	if err != nil { // Check for errors
-		return nil, err // Return error
+	if gasPolicy == nil && config.GasTable != nil { // Check should use environment gas table
+		gasPolicy = config.GasTable // Set gas policy
 	}
 
-	m.DisableFloatingPoint = config.DisableFloatingPoint // Set floating point disabled
+	var compiled *compiler.CompiledModule // Init compiled module buffer
+	var err error                         // Init error buffer
 
-	functionCode, err := m.CompileForInterpreter(gasPolicy) // Compile function code for interpreter
+	if config.CodeCache { // Check should cache code
+		compiled, err = compiler.NewCodeCache(config.CodeCachePath).Compile(code, gasPolicy, config.DisableFloatingPoint) // Load module, reusing cached code
+	} else {
+		compiled, err = compiler.Compile(code, gasPolicy, config.DisableFloatingPoint) // Load and compile module
+	}
 
 	if err != nil { // Check for errors
 		return nil, err // Return error
 	}
 
+	return Instantiate(compiled, config, impResolver) // Instantiate module
+}
+
+// Instantiate - instantiate a virtual machine for a compiled module, resolving its imports with the
+// given resolver. The module's parsed form and function code are shared with every other instance.
+func Instantiate(compiled *compiler.CompiledModule, config Environment, impResolver ImportResolver) (_retVM *VirtualMachine, retErr error) {
 	defer common.CatchPanic(&retErr) // Catch panic
 
+	m := compiled.Module() // Get module
+
+	var memoryLimits *wasm.ResizableLimits // Init memory limits buffer
+	var tableLimits *wasm.ResizableLimits  // Init table limits buffer
+
+	if m.Base.Memory != nil && len(m.Base.Memory.Entries) > 0 { // Check has memory
+		memoryLimits = &m.Base.Memory.Entries[0].Limits // Set memory limits
+	}
+
+	if m.Base.Table != nil && len(m.Base.Table.Entries) > 0 { // Check has table
+		tableLimits = &m.Base.Table.Entries[0].Limits // Set table limits
+	}
+
 	table := make([]uint32, 0)               // Init buffer
 	globals := make([]int64, 0)              // Init buffer
 	funcImports := make([]FunctionImport, 0) // Init buffer
 
-	if m.Base.Import != nil && impResolver != nil { // Check has import/import resolver
+	if impResolver == nil { // Check no import resolver
+		impResolver = new(NopResolver) // Only built-in imports
+	}
+
+	if m.Base.Import != nil { // Check has imports
 		for _, imp := range m.Base.Import.Entries { // Iterate through imports
 			switch imp.Type.Kind() { // Handle import types
 			case wasm.ExternalFunction: // Check is extern func import
-				funcImports = append(funcImports, impResolver.ResolveFunc(imp.ModuleName, imp.FieldName)) // Append to func imports
+				resolver := impResolver // Get resolver
+
+				if imp.ModuleName == StorageModule { // Check is built-in storage import
+					resolver = storageModule // Resolve from storage module
+				}
+
+				sig := &m.Base.Types.Entries[imp.Type.(wasm.FuncImport).Type] // Get declared signature
+
+				funcImport, err := resolveFunc(resolver, imp.ModuleName, imp.FieldName, sig) // Resolve import
+
+				if err != nil { // Check for errors
+					return nil, err // Return found error
+				}
+
+				funcImports = append(funcImports, funcImport) // Append to func imports
 			case wasm.ExternalGlobal: // Check is extern global import
 				globals = append(globals, impResolver.ResolveGlobal(imp.ModuleName, imp.FieldName)) // Handle
 			case wasm.ExternalMemory:
 				// TODO: Do we want a real import?
-				if m.Base.Memory != nil && len(m.Base.Memory.Entries) > 0 { // Check mem not nil
+				if memoryLimits != nil { // Check mem not nil
 					panic("cannot import another memory while we already have one") // Panic
 				}
 
-				m.Base.Memory = &wasm.SectionMemories{ // Set memory
-					Entries: []wasm.Memory{
-						wasm.Memory{
-							Limits: wasm.ResizableLimits{
-								Initial: uint32(config.DefaultMemoryPages),
-							},
-						},
-					},
-				}
+				memoryLimits = &wasm.ResizableLimits{Initial: uint32(config.DefaultMemoryPages)} // Set memory (the shared module is left untouched)
 			case wasm.ExternalTable:
 				// TODO: Do we want a real import?
-				if m.Base.Table != nil && len(m.Base.Table.Entries) > 0 { // Check table not empty
+				if tableLimits != nil { // Check table not empty
 					panic("cannot import another table while we already have one")
 				}
 
-				m.Base.Table = &wasm.SectionTables{ // Set table
-					Entries: []wasm.Table{
-						wasm.Table{
-							Limits: wasm.ResizableLimits{
-								Initial: uint32(config.DefaultTableSize),
-							},
-						},
-					},
-				}
+				tableLimits = &wasm.ResizableLimits{Initial: uint32(config.DefaultTableSize)} // Set table (the shared module is left untouched)
 			default:
 				panic(fmt.Errorf("import kind not supported: %d", imp.Type.Kind())) // Panic
 			}
@@ -153,16 +204,14 @@ func NewVirtualMachine(code []byte, config Environment, impResolver ImportResolv
 		globals = append(globals, execInitExpr(entry.Init, globals)) // Append global entry
 	}
 
-	if m.Base.Table != nil && len(m.Base.Table.Entries) > 0 { // Populate table elements
-		t := &m.Base.Table.Entries[0] // Set table entry buffer
-
-		if config.MaxTableSize != 0 && int(t.Limits.Initial) > config.MaxTableSize { // Check table size exceeded
+	if tableLimits != nil { // Populate table elements
+		if config.MaxTableSize != 0 && int(tableLimits.Initial) > config.MaxTableSize { // Check table size exceeded
 			panic("max table size exceeded") // Panic
 		}
 
-		table = make([]uint32, int(t.Limits.Initial)) // Init table buffer
+		table = make([]uint32, int(tableLimits.Initial)) // Init table buffer
 
-		for i := 0; i < int(t.Limits.Initial); i++ { // Iterate
+		for i := 0; i < int(tableLimits.Initial); i++ { // Iterate
 			table[i] = 0xffffffff // Set table entry
 		}
 
@@ -175,35 +224,21 @@ func NewVirtualMachine(code []byte, config Environment, impResolver ImportResolv
 		}
 	}
 
-	memory := make([]byte, 0)                                   // Init memory buffer
-	if m.Base.Memory != nil && len(m.Base.Memory.Entries) > 0 { // Check base memory not nil
-		initialLimit := int(m.Base.Memory.Entries[0].Limits.Initial) // Init initial limit
+	memory := make([]byte, 0) // Init memory buffer
+	if memoryLimits != nil {  // Check base memory not nil
+		initialLimit := int(memoryLimits.Initial) // Init initial limit
 
 		if config.MaxMemoryPages != 0 && initialLimit > config.MaxMemoryPages { // Check max memory exceeded
 			panic("max memory exceeded") // Panic
 		}
 
-		capacity := initialLimit * DefaultPageSize // Get capacity
-
-		memory = make([]byte, capacity) // Init empty memory
-
-		for i := 0; i < capacity; i++ { // Iterate until capacity
-			memory[i] = 0 // Set empty mem
-		}
-
-		if m.Base.Data != nil && len(m.Base.Data.Entries) > 0 { // Iterate through entries
-			for _, e := range m.Base.Data.Entries { // Iterate through entires
-				offset := int(execInitExpr(e.Offset, globals)) // Get offset
-
-				copy(memory[int(offset):], e.Data) // Copy
-			}
-		}
+		memory = initMemory(m, initialLimit*DefaultPageSize, globals) // Init memory
 	}
 
 	vm := &VirtualMachine{
 		Module:          m,
 		Environment:     config,
-		FunctionCode:    functionCode,
+		FunctionCode:    compiled.FunctionCode(),
 		FunctionImports: funcImports,
 		CallStack:       make([]Frame, DefaultCallStackSize),
 		CurrentFrame:    -1,
@@ -213,121 +248,214 @@ func NewVirtualMachine(code []byte, config Environment, impResolver ImportResolv
 		Exited:          true,
 	} // Init VM
 
-	rootState := NewStateEntry(vm.CallStack, vm.CurrentFrame, vm.Table, vm.Globals, vm.Memory, vm.NumValueSlots, vm.Yielded, vm.InsideExecute, vm.Exited, vm.ExitError, vm.ReturnValue, vm.Gas, vm.GasLimitExceeded, 0) // Init state entry
-
-	stateDB := NewStateDatabase(rootState) // Init state database
-
-	err = stateDB.WriteToMemory() // Write state db
-
-	if err != nil { // Check for errors
-		return nil, err // Return found error
-	}
-
-	(*vm).StateDB = stateDB // Set state DB
+	(*vm).pendingRoot = &StateEntry{
+		State: &State{
+			CurrentFrame: -1,                               // Set current frame
+			Table:        append([]uint32(nil), table...),  // Set table
+			Globals:      append([]int64(nil), globals...), // Set globals
+			MemorySize:   len(memory),                      // Set memory size
+			Exited:       true,                             // Set has exited
+		}, // Set initial state (its memory is rebuilt from the module when the state database is created)
+	} // Set root of the state database created on first use
 
 	return vm, nil // Return init vm
 }
 
 // SaveState - save state
 func (vm *VirtualMachine) SaveState() error {
-	workingRoot := vm.StateDB.WorkingRoot // Get working root
+	stateDB, err := vm.StateDatabase() // Get state database
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	workingRoot := stateDB.WorkingRoot // Get working root
 
 	nonce := workingRoot.Nonce + 1 // Init nonce buffer
 
-	maxChild, err := workingRoot.FindMax() // Find max
+	max, err := stateDB.FindMax() // Find max
 
-	if err == nil { // Check no errors
-		nonce = maxChild.Nonce + 1 // Set nonce
+	if err == nil && max.Nonce >= nonce { // Check nonce taken
+		nonce = max.Nonce + 1 // Set nonce (unique across branches)
 	}
 
-	state := NewStateEntry(vm.CallStack, vm.CurrentFrame, vm.Table, vm.Globals, vm.Memory, vm.NumValueSlots, vm.Yielded, vm.InsideExecute, vm.Exited, vm.ExitError, vm.ReturnValue, vm.Gas, vm.GasLimitExceeded, nonce) // Init state entry
+	state := newStateEntry(vm.captureState(), nonce) // Init incremental state entry
 
-	err = vm.StateDB.AddStateEntry(state, workingRoot) // Add state entry
+	err = stateDB.AddStateEntry(state, workingRoot) // Add state entry
 
 	if err != nil { // Check for errors
 		return err // Return found error
 	}
 
+	vm.clearDirty() // Memory matches the new working root
+
 	return nil // No error occurred, return nil
 }
 
 // ResetToState - revert vm state to given state with ID
 func (vm *VirtualMachine) ResetToState(id []byte) error {
-	err := vm.LoadStateDB(hex.EncodeToString(vm.StateDB.ID)) // Load state db
+	stateDB, err := vm.StateDatabase() // Get state database
 
 	if err != nil { // Check for errors
 		return err // Return found error
 	}
 
-	state, err := vm.StateDB.QueryState(id) // Query state
+	state, err := stateDB.QueryState(id) // Query state
 
-	if err != nil { // Check for errors
-		return err // Return found error
-	}
+	if err != nil { // Check not in memory
+		if err = vm.LoadStateDB(hex.EncodeToString(stateDB.ID)); err != nil { // Load state db
+			return err // Return found error
+		}
 
-	vm.StateDB.SetWorkingRoot(state) // Set working root
-
-	(*vm).CallStack = state.State.CallStack               // Set call stack
-	(*vm).CurrentFrame = state.State.CurrentFrame         // Set current frame
-	(*vm).Table = state.State.Table                       // Set table
-	(*vm).Globals = state.State.Globals                   // Set globals
-	(*vm).Memory = state.State.Memory                     // Set memory
-	(*vm).NumValueSlots = state.State.NumValueSlots       // Set # value slots
-	(*vm).Yielded = state.State.Yielded                   // Set yielded
-	(*vm).InsideExecute = state.State.InsideExecute       // Set inside execute
-	(*vm).Exited = state.State.Exited                     // Set has exited
-	(*vm).ExitError = state.State.ExitError               // Set exit error
-	(*vm).ReturnValue = state.State.ReturnValue           // Set return val
-	(*vm).Gas = state.State.Gas                           // Set gas
-	(*vm).GasLimitExceeded = state.State.GasLimitExceeded // Set has exceeded gas limit
+		if state, err = vm.StateDB.QueryState(id); err != nil { // Query state
+			return err // Return found error
+		}
+	}
 
-	return nil // No error occurred, return nil
+	return vm.restoreState(state) // Load state
 }
 
 // LoadWorkingRoot - load last saved state
 func (vm *VirtualMachine) LoadWorkingRoot() error {
-	err := vm.LoadStateDB(hex.EncodeToString(vm.StateDB.ID)) // Load state db
+	stateDB, err := vm.StateDatabase() // Get state database
 
 	if err != nil { // Check for errors
 		return err // Return found error
 	}
 
-	(*vm).CallStack = vm.StateDB.WorkingRoot.State.CallStack               // Set call stack
-	(*vm).CurrentFrame = vm.StateDB.WorkingRoot.State.CurrentFrame         // Set current frame
-	(*vm).Table = vm.StateDB.WorkingRoot.State.Table                       // Set table
-	(*vm).Globals = vm.StateDB.WorkingRoot.State.Globals                   // Set globals
-	(*vm).Memory = vm.StateDB.WorkingRoot.State.Memory                     // Set memory
-	(*vm).NumValueSlots = vm.StateDB.WorkingRoot.State.NumValueSlots       // Set # value slots
-	(*vm).Yielded = vm.StateDB.WorkingRoot.State.Yielded                   // Set yielded
-	(*vm).InsideExecute = vm.StateDB.WorkingRoot.State.InsideExecute       // Set inside execute
-	(*vm).Exited = vm.StateDB.WorkingRoot.State.Exited                     // Set has exited
-	(*vm).ExitError = vm.StateDB.WorkingRoot.State.ExitError               // Set exit error
-	(*vm).ReturnValue = vm.StateDB.WorkingRoot.State.ReturnValue           // Set return val
-	(*vm).Gas = vm.StateDB.WorkingRoot.State.Gas                           // Set gas
-	(*vm).GasLimitExceeded = vm.StateDB.WorkingRoot.State.GasLimitExceeded // Set has exceeded gas limit
+	if err = vm.LoadStateDB(hex.EncodeToString(stateDB.ID)); err != nil { // Load state db
+		return err // Return found error
+	}
 
-	return nil // No error occurred, return nil
+	return vm.restoreState(vm.StateDB.WorkingRoot) // Load working root
 }
 
-// LoadStateDB - load state database
+// LoadStateDB - load state database with the given ID from the store configured by the vm's environment
 func (vm *VirtualMachine) LoadStateDB(id string) error {
-	stateDB, err := ReadStateDBFromMemory(id) // Read state db
+	idBytes, err := hex.DecodeString(id) // Decode ID
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	store := Store(nil) // Init store buffer
+
+	if vm.StateDB != nil && common.ByteIsEqual(vm.StateDB.ID, idBytes) { // Check is current db
+		if store, err = vm.StateDB.attachStore(); err != nil { // Reuse store (entries not yet written are replaced by the store's)
+			return err // Return found error
+		}
+	} else {
+		if store, err = OpenStateStore(&vm.Environment, idBytes); err != nil { // Open store
+			return err // Return found error
+		}
+
+		if vm.StateDB != nil { // Check has db
+			vm.StateDB.Close() // Close previous store
+		}
+	}
+
+	stateDB, err := ReadStateDB(store) // Read state db
+
+	if errors.Is(err, ErrStateDBNotFound) && vm.StateDB != nil && vm.StateDB.store == store && vm.StateDB.unwritten { // Check current db not yet written
+		return nil // Keep current db
+	}
 
 	if err != nil { // Check for errors
 		return err // Return found error
 	}
 
 	(*vm).StateDB = stateDB // Set state db
+	(*vm).pendingRoot = nil // Replaces the state database created on first use
+	(*vm).pendingBase = nil // Clear base memory
 
 	return nil // No error occurred, return nil
 }
 
+// StateDatabase - get the vm's state database, creating it on first use. Until then, an instance's
+// initial state is neither committed to nor written to a store, and a clone only holds a copy of the
+// working root of the vm it was forked from. A created database is written to its store (an
+// in-memory store for clones) on its first write, e.g. by SaveState.
+//
+// The database's ID is StateDatabaseID of the module and Environment.StateKey, so that an instance
+// given the same key in a later process finds its states. Keys must be unique among live instances of
+// a module sharing a store directory. Without a key, an instance keeping its states in a file store
+// gets a random ID, so every such instance that saves leaves a new log under the store directory
+// (remove it with RemoveStateStore). A clone's ID is derived from its database's root.
+func (vm *VirtualMachine) StateDatabase() (*StateDatabase, error) {
+	if vm.StateDB != nil || vm.pendingRoot == nil { // Check already created
+		return vm.StateDB, nil // Return state database
+	}
+
+	root := vm.pendingRoot // Get root
+
+	forked := root.ID != nil // Check is a fork of another vm's state database
+
+	if !forked { // Check is the instance's initial state
+		state := *root.State // Copy state
+
+		state.CallStack = make([]Frame, len(vm.CallStack))                    // Set call stack (no active frames)
+		state.Memory = initMemory(vm.Module, state.MemorySize, state.Globals) // Rebuild memory
+
+		initial := &VirtualMachine{
+			Table:   state.Table,   // Set table
+			Globals: state.Globals, // Set globals
+			Memory:  state.Memory,  // Set memory
+		} // Init vm holding the initial state
+
+		state.MerkleRoot = initial.StateRoot() // Commit to state
+
+		if vm.pageHashes == nil { // Check memory not yet hashed
+			vm.pageHashes = initial.pageHashes // Reuse page hashes (pages written since are rehashed)
+		}
+
+		root = newStateEntry(&state, 0) // Init full state entry
+	}
+
+	id := StateDatabaseID(vm.Module.Identifier, vm.Environment.StateKey) // Get ID of the module's state database with the vm's key
+
+	if forked { // Check is a fork
+		id = crypto.Sha3(append(id, root.ID...)) // Derive from the root (forks are kept in memory, so never share a store)
+	} else if vm.Environment.StateKey == "" && vm.Environment.StateStore != StateStoreMemory { // Check file store without a key
+		salted, err := saltedStateDBID(id) // Get ID unique to the instance
+
+		if err != nil { // Check for errors
+			return nil, err // Return found error
+		}
+
+		id = salted // Set ID
+	}
+
+	stateDB := &StateDatabase{
+		States:      []*StateEntry{root},   // Set states
+		StateRoot:   root,                  // Set root
+		WorkingRoot: root,                  // Set working root
+		MerkleRoot:  root.State.MerkleRoot, // Set merkle root
+		ID:          id,                    // Set ID
+		baseMemory:  vm.pendingBase,        // Set memory the root's pages apply to
+		unwritten:   true,                  // Write on first write
+	} // Init state database
+
+	if forked { // Check is a fork
+		stateDB.UseStore(NewMemoryStore()) // Keep in memory
+	} else {
+		environment := vm.Environment // Copy environment
+
+		stateDB.environment = &environment // Open the store configured by the environment
+	}
+
+	(*vm).StateDB = stateDB // Set state db
+	(*vm).pendingRoot = nil // Created
+	(*vm).pendingBase = nil // Held by state db
+
+	return stateDB, nil // Return state database
+}
+
 // Init - initializes a frame; must be called on `call` and `call_indirect`
 func (f *Frame) Init(vm *VirtualMachine, functionID int, code compiler.InterpreterCode) {
 	numValueSlots := code.NumRegs + code.NumParams + code.NumLocals // Get num slots
 
 	if vm.Environment.MaxValueSlots != 0 && vm.NumValueSlots+numValueSlots > vm.Environment.MaxValueSlots { // Check for max count exceeded
-		panic("max value slot count exceeded") // Panic
+		panic(TrapCallStackExhausted) // Panic
 	}
 
 	vm.NumValueSlots += numValueSlots // Set num value slots
@@ -355,11 +483,11 @@ func (f *Frame) Destroy(vm *VirtualMachine) {
 // GetCurrentFrame - return the current frame
 func (vm *VirtualMachine) GetCurrentFrame() *Frame {
 	if vm.Environment.MaxCallStackDepth != 0 && vm.CurrentFrame >= vm.Environment.MaxCallStackDepth { // Check for stack limit exceeded
-		panic("max call stack depth exceeded") // Panic
+		panic(TrapCallStackExhausted) // Panic
 	}
 
 	if vm.CurrentFrame >= len(vm.CallStack) { // Check for stack overflow ( ͡° ͜ʖ ͡°)
-		panic("call stack overflow")
+		panic(TrapCallStackExhausted) // Panic
 		//vm.CallStack = append(vm.CallStack, make([]Frame, DefaultCallStackSize / 2)...)
 	}
 
@@ -385,6 +513,60 @@ func (vm *VirtualMachine) getExport(key string, kind wasm.External) (int, bool)
 	return int(entry.Index), true // Return index of export entry
 }
 
+// functionSignature - get the signature of the function with the given index (imports first)
+func (vm *VirtualMachine) functionSignature(functionID int) *wasm.FunctionSig {
+	if vm.Module.Base.Import != nil { // Check has imports
+		for _, imp := range vm.Module.Base.Import.Entries { // Iterate through imports
+			if funcImport, ok := imp.Type.(wasm.FuncImport); ok { // Check is function import
+				if functionID == 0 { // Check is target
+					return &vm.Module.Base.Types.Entries[funcImport.Type] // Return import signature
+				}
+
+				functionID-- // Skip import
+			}
+		}
+	}
+
+	return vm.Module.Base.FunctionIndexSpace[functionID].Sig // Return defined signature
+}
+
+// initMemory - initialize memory of the given size holding the module's data segments, placed at
+// offsets evaluated against the given globals
+func initMemory(m *compiler.Module, size int, globals []int64) []byte {
+	memory := make([]byte, size) // Init empty memory
+
+	if m.Base.Data != nil && len(m.Base.Data.Entries) > 0 { // Iterate through entries
+		for _, e := range m.Base.Data.Entries { // Iterate through entires
+			offset := int(execInitExpr(e.Offset, globals)) // Get offset
+
+			copy(memory[int(offset):], e.Data) // Copy
+		}
+	}
+
+	return memory // Return memory
+}
+
+// signaturesEqual - check two function signatures have identical params and results
+func signaturesEqual(a *wasm.FunctionSig, b *wasm.FunctionSig) bool {
+	if len(a.ParamTypes) != len(b.ParamTypes) || len(a.ReturnTypes) != len(b.ReturnTypes) { // Check arity
+		return false // Mismatch
+	}
+
+	for i, t := range a.ParamTypes { // Iterate through params
+		if b.ParamTypes[i] != t { // Check match
+			return false // Mismatch
+		}
+	}
+
+	for i, t := range a.ReturnTypes { // Iterate through results
+		if b.ReturnTypes[i] != t { // Check match
+			return false // Mismatch
+		}
+	}
+
+	return true // Signatures match
+}
+
 // GetGlobalExport - return the global export with the given name
 func (vm *VirtualMachine) GetGlobalExport(key string) (int, bool) {
 	return vm.getExport(key, wasm.ExternalGlobal) // Return export
@@ -442,15 +624,17 @@ func (vm *VirtualMachine) AddAndCheckGas(delta uint64) bool {
 	newGas := vm.Gas + delta // Calculate gas
 
 	if newGas < vm.Gas { // Check for gas overflow
-		panic("gas overflow") // Panic
+		panic(TrapOutOfGas) // Panic
 	}
 
 	if vm.Environment.GasLimit != 0 && newGas > vm.Environment.GasLimit { // Check gas limit exceeded
+		vm.deniedGas = delta // Set denied charge
+
 		if vm.Environment.ReturnOnGasLimitExceeded { // Check should return
 			return false // Return
 		}
 
-		panic("gas limit exceeded") // Panic
+		panic(TrapOutOfGas) // Panic
 	}
 
 	vm.Gas = newGas // Set gas
@@ -478,20 +662,29 @@ func (vm *VirtualMachine) Execute() {
 	vm.InsideExecute = true     // Set inside execute
 	vm.GasLimitExceeded = false // Set gas limit exceeded
 
+	var frame *Frame       // Init current frame buffer
+	var ins opcodes.Opcode // Init current instruction buffer
+	offset := 0            // Init current instruction offset
+
 	defer func() {
 		vm.InsideExecute = false // Set inside execute
 
 		if err := recover(); err != nil { // Check for errors
-			vm.Exited = true   // Set exited
-			vm.ExitError = err // Set exit error
+			vm.Exited = true                                   // Set exited
+			vm.ExitError = vm.newTrap(err, frame, offset, ins) // Set exit error
 		}
 	}()
 
-	frame := vm.GetCurrentFrame() // Get current frame
+	frame = vm.GetCurrentFrame() // Get current frame
+
+	for executed := 0; ; executed++ { // Iterate
+		if executed == ExecutionSliceSize { // Check slice exhausted
+			return // Yield to caller
+		}
 
-	for { // Iterate
+		offset = frame.IP                                                             // Set instruction offset
 		valueID := int(binary.LittleEndian.Uint32(frame.Code[frame.IP : frame.IP+4])) // Init valueID
-		ins := opcodes.Opcode(frame.Code[frame.IP+4])                                 // Init instruction
+		ins = opcodes.Opcode(frame.Code[frame.IP+4])                                  // Set instruction
 		frame.IP += 5                                                                 // Set frame IP
 
 		//fmt.Printf("INS: [%d] %s\n", valueID, ins.String())
@@ -499,7 +692,7 @@ func (vm *VirtualMachine) Execute() {
 		switch ins { // Handle different opcodes
 		case opcodes.Nop: // Handle Nop
 		case opcodes.Unreachable: // Handle Unreachable
-			panic("wasm: unreachable executed")
+			panic(TrapUnreachable)
 		case opcodes.Select: // Handle Select
 			a := frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))]
 			b := frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP+4:frame.IP+8]))]
@@ -534,11 +727,11 @@ func (vm *VirtualMachine) Execute() {
 			b := int32(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(TrapIntegerDivideByZero)
 			}
 
 			if a == math.MinInt32 && b == -1 {
-				panic("signed integer overflow")
+				panic(TrapIntegerOverflow)
 			}
 
 			frame.IP += 8
@@ -548,7 +741,7 @@ func (vm *VirtualMachine) Execute() {
 			b := uint32(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(TrapIntegerDivideByZero)
 			}
 
 			frame.IP += 8
@@ -558,7 +751,7 @@ func (vm *VirtualMachine) Execute() {
 			b := int32(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(TrapIntegerDivideByZero)
 			}
 
 			frame.IP += 8
@@ -568,7 +761,7 @@ func (vm *VirtualMachine) Execute() {
 			b := uint32(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(TrapIntegerDivideByZero)
 			}
 
 			frame.IP += 8
@@ -759,11 +952,11 @@ func (vm *VirtualMachine) Execute() {
 			b := frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP+4:frame.IP+8]))]
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(TrapIntegerDivideByZero)
 			}
 
 			if a == math.MinInt64 && b == -1 {
-				panic("signed integer overflow")
+				panic(TrapIntegerOverflow)
 			}
 
 			frame.IP += 8
@@ -773,7 +966,7 @@ func (vm *VirtualMachine) Execute() {
 			b := uint64(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(TrapIntegerDivideByZero)
 			}
 
 			frame.IP += 8
@@ -783,7 +976,7 @@ func (vm *VirtualMachine) Execute() {
 			b := frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP+4:frame.IP+8]))]
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(TrapIntegerDivideByZero)
 			}
 
 			frame.IP += 8
@@ -793,7 +986,7 @@ func (vm *VirtualMachine) Execute() {
 			b := uint64(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP+4:frame.IP+8]))])
 
 			if b == 0 {
-				panic("integer division by zero")
+				panic(TrapIntegerDivideByZero)
 			}
 
 			frame.IP += 8
@@ -1200,25 +1393,93 @@ func (vm *VirtualMachine) Execute() {
 			frame.IP += 4
 			frame.Regs[valueID] = int64(v)
 
-		case opcodes.I32TruncSF32, opcodes.I32TruncUF32: // Handle I32TruncUF32
-			v := math.Float32frombits(uint32(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))]))
+		case opcodes.I32TruncSF32: // Handle I32TruncSF32
+			v := math.Trunc(float64(math.Float32frombits(uint32(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))]))))
 			frame.IP += 4
-			frame.Regs[valueID] = int64(int32(math.Trunc(float64(v))))
+			if math.IsNaN(v) {
+				panic(TrapInvalidConversion)
+			}
+			if v < -2147483648 || v > 2147483647 {
+				panic(TrapIntegerOverflow)
+			}
+			frame.Regs[valueID] = int64(int32(v))
 
-		case opcodes.I32TruncSF64, opcodes.I32TruncUF64: // Handle I32TruncUF64
-			v := math.Float64frombits(uint64(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))]))
+		case opcodes.I32TruncSF64: // Handle I32TruncSF64
+			v := math.Trunc(math.Float64frombits(uint64(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))])))
 			frame.IP += 4
-			frame.Regs[valueID] = int64(int32(math.Trunc(v)))
+			if math.IsNaN(v) {
+				panic(TrapInvalidConversion)
+			}
+			if v < -2147483648 || v > 2147483647 {
+				panic(TrapIntegerOverflow)
+			}
+			frame.Regs[valueID] = int64(int32(v))
 
-		case opcodes.I64TruncSF32, opcodes.I64TruncUF32: // Handle I64TruncUF32
-			v := math.Float32frombits(uint32(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))]))
+		case opcodes.I32TruncUF32: // Handle I32TruncUF32
+			v := math.Trunc(float64(math.Float32frombits(uint32(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))]))))
 			frame.IP += 4
-			frame.Regs[valueID] = int64(math.Trunc(float64(v)))
+			if math.IsNaN(v) {
+				panic(TrapInvalidConversion)
+			}
+			if v < 0 || v > 4294967295 {
+				panic(TrapIntegerOverflow)
+			}
+			frame.Regs[valueID] = int64(uint32(v))
 
-		case opcodes.I64TruncSF64, opcodes.I64TruncUF64: // Handle I64TruncUF64
-			v := math.Float64frombits(uint64(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))]))
+		case opcodes.I32TruncUF64: // Handle I32TruncUF64
+			v := math.Trunc(math.Float64frombits(uint64(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))])))
+			frame.IP += 4
+			if math.IsNaN(v) {
+				panic(TrapInvalidConversion)
+			}
+			if v < 0 || v > 4294967295 {
+				panic(TrapIntegerOverflow)
+			}
+			frame.Regs[valueID] = int64(uint32(v))
+
+		case opcodes.I64TruncSF32: // Handle I64TruncSF32
+			v := math.Trunc(float64(math.Float32frombits(uint32(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))]))))
+			frame.IP += 4
+			if math.IsNaN(v) {
+				panic(TrapInvalidConversion)
+			}
+			if v < -9223372036854775808 || v >= 9223372036854775808 {
+				panic(TrapIntegerOverflow)
+			}
+			frame.Regs[valueID] = int64(v)
+
+		case opcodes.I64TruncSF64: // Handle I64TruncSF64
+			v := math.Trunc(math.Float64frombits(uint64(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))])))
 			frame.IP += 4
-			frame.Regs[valueID] = int64(math.Trunc(v))
+			if math.IsNaN(v) {
+				panic(TrapInvalidConversion)
+			}
+			if v < -9223372036854775808 || v >= 9223372036854775808 {
+				panic(TrapIntegerOverflow)
+			}
+			frame.Regs[valueID] = int64(v)
+
+		case opcodes.I64TruncUF32: // Handle I64TruncUF32
+			v := math.Trunc(float64(math.Float32frombits(uint32(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))]))))
+			frame.IP += 4
+			if math.IsNaN(v) {
+				panic(TrapInvalidConversion)
+			}
+			if v < 0 || v >= 18446744073709551616 {
+				panic(TrapIntegerOverflow)
+			}
+			frame.Regs[valueID] = int64(uint64(v))
+
+		case opcodes.I64TruncUF64: // Handle I64TruncUF64
+			v := math.Trunc(math.Float64frombits(uint64(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))])))
+			frame.IP += 4
+			if math.IsNaN(v) {
+				panic(TrapInvalidConversion)
+			}
+			if v < 0 || v >= 18446744073709551616 {
+				panic(TrapIntegerOverflow)
+			}
+			frame.Regs[valueID] = int64(uint64(v))
 
 		case opcodes.F32DemoteF64: // Handle F32DemoteF64
 			v := math.Float64frombits(uint64(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))]))
@@ -1253,12 +1514,12 @@ func (vm *VirtualMachine) Execute() {
 		case opcodes.F64ConvertSI32: // Handle F64ConvertSI32
 			v := int32(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))])
 			frame.IP += 4
-			frame.Regs[valueID] = int64(int32(math.Float64bits(float64(v))))
+			frame.Regs[valueID] = int64(math.Float64bits(float64(v)))
 
 		case opcodes.F64ConvertUI32: // Handle F64ConvertUI32
 			v := uint32(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))])
 			frame.IP += 4
-			frame.Regs[valueID] = int64(int32(math.Float64bits(float64(v))))
+			frame.Regs[valueID] = int64(math.Float64bits(float64(v)))
 
 		case opcodes.F64ConvertSI64: // Handle F64ConvertSI64
 			v := int64(frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))])
@@ -1353,6 +1614,7 @@ func (vm *VirtualMachine) Execute() {
 			frame.IP += 16
 
 			effective := int(uint64(base) + uint64(offset))
+			vm.MarkDirty(effective, 4)
 			binary.LittleEndian.PutUint32(vm.Memory[effective:effective+4], uint32(value))
 		case opcodes.I64Store: // Handle I64Store
 			binary.LittleEndian.Uint32(frame.Code[frame.IP : frame.IP+4])
@@ -1364,6 +1626,7 @@ func (vm *VirtualMachine) Execute() {
 			frame.IP += 16
 
 			effective := int(uint64(base) + uint64(offset))
+			vm.MarkDirty(effective, 8)
 			binary.LittleEndian.PutUint64(vm.Memory[effective:effective+8], uint64(value))
 		case opcodes.I32Store8, opcodes.I64Store8: // Handle I64Store8
 			binary.LittleEndian.Uint32(frame.Code[frame.IP : frame.IP+4])
@@ -1375,6 +1638,7 @@ func (vm *VirtualMachine) Execute() {
 			frame.IP += 16
 
 			effective := int(uint64(base) + uint64(offset))
+			vm.MarkDirty(effective, 1)
 			vm.Memory[effective] = byte(value)
 		case opcodes.I32Store16, opcodes.I64Store16: // Handle I64Store16
 			binary.LittleEndian.Uint32(frame.Code[frame.IP : frame.IP+4])
@@ -1386,6 +1650,7 @@ func (vm *VirtualMachine) Execute() {
 			frame.IP += 16
 
 			effective := int(uint64(base) + uint64(offset))
+			vm.MarkDirty(effective, 2)
 			binary.LittleEndian.PutUint16(vm.Memory[effective:effective+2], uint16(value))
 
 		case opcodes.Jmp: // Handle Jmp
@@ -1440,7 +1705,7 @@ func (vm *VirtualMachine) Execute() {
 			val := frame.Regs[int(binary.LittleEndian.Uint32(frame.Code[frame.IP:frame.IP+4]))]
 			frame.Destroy(vm)
 			vm.CurrentFrame--
-			if vm.CurrentFrame == -1 {
+			if vm.CurrentFrame < vm.entryFrame {
 				vm.Exited = true
 				vm.ReturnValue = val
 				return
@@ -1451,7 +1716,7 @@ func (vm *VirtualMachine) Execute() {
 		case opcodes.ReturnVoid: // Handle ReturnVoid
 			frame.Destroy(vm)
 			vm.CurrentFrame--
-			if vm.CurrentFrame == -1 {
+			if vm.CurrentFrame < vm.entryFrame {
 				vm.Exited = true
 				vm.ReturnValue = 0
 				return
@@ -1491,8 +1756,9 @@ func (vm *VirtualMachine) Execute() {
 			frame.ReturnReg = valueID
 
 			vm.CurrentFrame++
-			frame = vm.GetCurrentFrame()
-			frame.Init(vm, functionID, vm.FunctionCode[functionID])
+			callee := vm.GetCurrentFrame()
+			callee.Init(vm, functionID, vm.FunctionCode[functionID])
+			frame = callee
 			for i := 0; i < argCount; i++ {
 				frame.Locals[i] = oldRegs[int(binary.LittleEndian.Uint32(argsRaw[i*4:i*4+4]))]
 			}
@@ -1510,20 +1776,24 @@ func (vm *VirtualMachine) Execute() {
 
 			sig := &vm.Module.Base.Types.Entries[typeID]
 
+			if uint64(tableItemID) >= uint64(len(vm.Table)) || vm.Table[tableItemID] == 0xffffffff {
+				panic(TrapUndefinedElement)
+			}
+
 			functionID := int(vm.Table[tableItemID])
 			code := vm.FunctionCode[functionID]
 
-			// TODO: We are only checking CC here; Do we want strict type-check?
-			if code.NumParams != len(sig.ParamTypes) || code.NumReturns != len(sig.ReturnTypes) {
-				panic("type mismatch")
+			if !signaturesEqual(sig, vm.functionSignature(functionID)) {
+				panic(TrapIndirectCallTypeMismatch)
 			}
 
 			oldRegs := frame.Regs
 			frame.ReturnReg = valueID
 
 			vm.CurrentFrame++
-			frame = vm.GetCurrentFrame()
-			frame.Init(vm, functionID, code)
+			callee := vm.GetCurrentFrame()
+			callee.Init(vm, functionID, code)
+			frame = callee
 			for i := 0; i < argCount; i++ {
 				frame.Locals[i] = oldRegs[int(binary.LittleEndian.Uint32(argsRaw[i*4:i*4+4]))]
 			}
@@ -1532,6 +1802,7 @@ func (vm *VirtualMachine) Execute() {
 			importID := int(binary.LittleEndian.Uint32(frame.Code[frame.IP : frame.IP+4]))
 			frame.IP += 4
 			vm.Delegate = func() {
+				vm.ownMemory() // Copy memory shared with a clone (host functions may write vm.Memory directly)
 				frame.Regs[valueID] = vm.FunctionImports[importID](vm)
 			}
 			return
@@ -1545,6 +1816,12 @@ func (vm *VirtualMachine) Execute() {
 
 			current := len(vm.Memory) / DefaultPageSize
 			if vm.Environment.MaxMemoryPages == 0 || (current+n >= current && current+n <= vm.Environment.MaxMemoryPages) {
+				if !vm.chargeMemoryGrowth(n) {
+					frame.IP = offset // Grow again once resumed
+					vm.GasLimitExceeded = true
+					return
+				}
+
 				frame.Regs[valueID] = int64(current)
 				vm.Memory = append(vm.Memory, make([]byte, n*DefaultPageSize)...)
 			} else {
@@ -1558,12 +1835,13 @@ func (vm *VirtualMachine) Execute() {
 			delta := binary.LittleEndian.Uint64(frame.Code[frame.IP : frame.IP+8])
 			frame.IP += 8
 			if !vm.AddAndCheckGas(delta) {
+				frame.IP = offset // Charge again once resumed
 				vm.GasLimitExceeded = true
 				return
 			}
 
 		case opcodes.FPDisabledError: // Handle FPDisabledError
-			panic("wasm: floating point disabled") // Panic
+			panic(TrapFloatingPointDisabled) // Panic
 
 		default:
 			panic("unknown instruction") // Panic
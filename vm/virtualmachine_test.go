@@ -2,8 +2,11 @@ package vm
 
 import (
 	"encoding/hex"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/SummerCash/ursa/compiler"
@@ -378,3 +381,130 @@ func TestRun(t *testing.T) {
 
 	t.Log(result) // Log success
 }
+
+// TestInstantiate - test instances of one compiled module share its code but not their state
+func TestInstantiate(t *testing.T) {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/snapshot.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	compiled, err := compiler.Compile(testSourceFile, nil, false) // Compile module
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	var instances []*VirtualMachine // Init instance buffer
+
+	for i := int32(1); i <= 2; i++ { // Instantiate twice
+		vm, err := Instantiate(compiled, Environment{StateStore: StateStoreMemory}, nil) // Instantiate module
+
+		if err != nil { // Check for errors
+			t.Fatal(err) // Panic
+		}
+
+		if _, err := vm.Call("store", I32(0), I32(i)); err != nil { // Write
+			t.Fatal(err) // Panic
+		}
+
+		instances = append(instances, vm) // Append instance
+	}
+
+	if &instances[0].FunctionCode[0] != &instances[1].FunctionCode[0] { // Check code shared
+		t.Fatal("expected instances to share function code") // Panic
+	}
+
+	if results, err := instances[0].Call("load", I32(0)); err != nil || results[0].I32() != 1 { // Check memory separate
+		t.Fatalf("expected 1, got %v (%v)", results, err) // Panic
+	}
+}
+
+// TestInstantiateConcurrently - test a compiled module can be instantiated and run from many goroutines
+func TestInstantiateConcurrently(t *testing.T) {
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/snapshot.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	compiled, err := compiler.Compile(testSourceFile, nil, false) // Compile module
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	var wg sync.WaitGroup       // Init wait group
+	errs := make(chan error, 8) // Init error buffer
+
+	for worker := int32(0); worker < 8; worker++ { // Start workers
+		wg.Add(1) // Add worker
+
+		go func(worker int32) {
+			defer wg.Done() // Done
+
+			vm, err := Instantiate(compiled, Environment{StateStore: StateStoreMemory}, nil) // Instantiate module
+
+			if err != nil { // Check for errors
+				errs <- err // Report error
+
+				return // Stop
+			}
+
+			if _, err := vm.Call("store", I32(0), I32(worker)); err != nil { // Write
+				errs <- err // Report error
+
+				return // Stop
+			}
+
+			if results, err := vm.Call("load", I32(0)); err != nil || results[0].I32() != worker { // Check memory separate
+				errs <- fmt.Errorf("expected %d, got %v (%v)", worker, results, err) // Report error
+			}
+		}(worker)
+	}
+
+	wg.Wait()   // Wait for workers
+	close(errs) // Done reporting errors
+
+	for err := range errs { // Iterate through errors
+		t.Fatal(err) // Panic
+	}
+}
+
+// TestNewVirtualMachineCodeCache - test vms initialized with the code cache enabled run cached code
+func TestNewVirtualMachineCodeCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ursa-code") // Init cache dir
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	defer os.RemoveAll(dir) // Remove cache dir
+
+	testSourceFile, err := ioutil.ReadFile(filepath.FromSlash("../examples/snapshot.wasm")) // Read test WASM file
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	for i := int32(1); i <= 2; i++ { // Compile, then load cached code
+		vm, err := NewVirtualMachine(testSourceFile, Environment{StateStore: StateStoreMemory, CodeCache: true, CodeCachePath: dir}, nil, nil) // Init vm
+
+		if err != nil { // Check for errors
+			t.Fatal(err) // Panic
+		}
+
+		if _, err := vm.Call("store", I32(0), I32(i)); err != nil { // Write
+			t.Fatal(err) // Panic
+		}
+
+		if results, err := vm.Call("load", I32(0)); err != nil || results[0].I32() != i { // Check ran
+			t.Fatalf("expected %d, got %v (%v)", i, results, err) // Panic
+		}
+	}
+
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 1 { // Check cached once
+		t.Fatalf("expected 1 cached file, got %d (%v)", len(files), err) // Panic
+	}
+}
@@ -0,0 +1,1686 @@
+package wast
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/SummerCash/wagon/wasm"
+	"github.com/SummerCash/wagon/wasm/leb128"
+	ops "github.com/SummerCash/wagon/wasm/operators"
+)
+
+var (
+	// ErrUnknownInstruction - describes an error regarding an instruction name with no known opcode
+	ErrUnknownInstruction = errors.New("unknown instruction")
+
+	// ErrUnknownIdentifier - describes an error regarding a reference to an undeclared $name
+	ErrUnknownIdentifier = errors.New("unknown identifier")
+
+	// ErrMalformedModule - describes an error regarding a module field that does not follow the text grammar
+	ErrMalformedModule = errors.New("malformed module")
+
+	// opcodeNames - opcode by instruction name (both MVP and current spec spellings)
+	opcodeNames = buildOpcodeNames()
+)
+
+// entity - function, table, memory or global in a module index space
+type entity struct {
+	Kind  wasm.External // Entity kind
+	Name  string        // $name (if any)
+	Index uint32        // Index in the kind's index space
+
+	Import *importDef // Import (nil if defined by the module)
+	Node   *Node      // Defining field
+}
+
+// importDef - import field
+type importDef struct {
+	Module string // Module name
+	Field  string // Field name
+
+	Type   uint32               // Function type index
+	Limits wasm.ResizableLimits // Table/memory limits
+	Global wasm.GlobalVar       // Global type
+}
+
+// exportDef - export field
+type exportDef struct {
+	Name   string  // Export name
+	Target *entity // Exported entity (nil until resolved)
+
+	Kind wasm.External // Referenced kind
+	Ref  *Node         // Index reference (when not inline)
+}
+
+// funcDef - defined function
+type funcDef struct {
+	Entity *entity // Function entity
+
+	Type       uint32            // Type index
+	LocalNames map[string]uint32 // Local index by $name
+	Locals     []wasm.ValueType  // Declared locals (excluding params)
+	Body       []*Node           // Instructions
+}
+
+// segmentDef - element or data segment
+type segmentDef struct {
+	Target *Node   // Table/memory reference (nil for index 0)
+	Offset []*Node // Offset expression
+	Elems  []*Node // Function references (element segments)
+	Data   []byte  // Data bytes (data segments)
+
+	Inline *entity // Inline table/memory the segment initializes
+}
+
+// assembler - text module to binary encoder state
+type assembler struct {
+	types     []wasm.FunctionSig // Type section
+	typeNames map[string]uint32  // Type index by $name
+
+	entities map[wasm.External][]*entity // Imported, then defined entities by kind
+	imports  []*entity                   // Imports in field order
+
+	funcs    []*funcDef                       // Defined functions
+	tables   []*entity                        // Defined tables
+	memories []*entity                        // Defined memories
+	globals  []*globalDef                     // Defined globals
+	limits   map[*entity]wasm.ResizableLimits // Defined table/memory limits
+	exports  []*exportDef                     // Exports
+	start    *Node                            // Start function reference
+	elems    []*segmentDef                    // Element segments
+	datas    []*segmentDef                    // Data segments
+}
+
+// globalDef - defined global
+type globalDef struct {
+	Entity *entity        // Global entity
+	Type   wasm.GlobalVar // Global type
+	Init   []*Node        // Initializer expression
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// AssembleModule - encode a text-format (module ...) node into the WebAssembly binary format
+func AssembleModule(node *Node) (_ []byte, retErr error) {
+	defer func() {
+		if r := recover(); r != nil { // Check for malformed field access
+			retErr = fmt.Errorf("line %d: %w: %v", node.Line, ErrMalformedModule, r) // Set error
+		}
+	}()
+
+	if node.Head() != "module" { // Check is module
+		return nil, fmt.Errorf("line %d: %w: expected module", node.Line, ErrMalformedModule) // Return error
+	}
+
+	fields := node.List[1:] // Get fields
+
+	if len(fields) > 0 && fields[0].IsID() { // Skip module name
+		fields = fields[1:] // Set fields
+	}
+
+	a := &assembler{
+		typeNames: make(map[string]uint32),
+		entities:  make(map[wasm.External][]*entity),
+		limits:    make(map[*entity]wasm.ResizableLimits),
+	} // Init assembler
+
+	for _, field := range fields { // Declare explicit types first
+		if field.Head() == "type" { // Check is type
+			if err := a.declareType(field); err != nil { // Declare
+				return nil, err // Return found error
+			}
+		}
+	}
+
+	for _, field := range fields { // Declare remaining fields
+		if err := a.declareField(field); err != nil { // Declare
+			return nil, err // Return found error
+		}
+	}
+
+	a.assignIndices() // Resolve index spaces
+
+	return a.encode() // Encode module
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// declareType - declare an explicit (type $t? (func ...)) field
+func (a *assembler) declareType(field *Node) error {
+	rest := field.List[1:] // Get contents
+
+	if len(rest) > 0 && rest[0].IsID() { // Check named
+		a.typeNames[rest[0].Atom] = uint32(len(a.types)) // Set name
+		rest = rest[1:]                                  // Skip name
+	}
+
+	if len(rest) != 1 || rest[0].Head() != "func" { // Check is function type
+		return malformed(field, "expected func type") // Return error
+	}
+
+	sig, _, err := parseSignature(rest[0].List[1:]) // Parse signature
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	a.types = append(a.types, sig) // Append type
+
+	return nil // No error occurred, return nil
+}
+
+// declareField - declare a module field's entities
+func (a *assembler) declareField(field *Node) error {
+	switch field.Head() { // Handle fields
+	case "type":
+		return nil // Already declared
+	case "import":
+		if len(field.List) != 4 || !field.List[1].IsString || !field.List[2].IsString || !field.List[3].IsList { // Check well formed
+			return malformed(field, "expected import descriptor") // Return error
+		}
+
+		desc := field.List[3]                  // Get descriptor
+		kind, err := externalKind(desc.Head()) // Get kind
+
+		if err != nil { // Check for errors
+			return malformed(field, err.Error()) // Return error
+		}
+
+		ent := &entity{Kind: kind, Node: desc, Import: &importDef{Module: field.List[1].Atom, Field: field.List[2].Atom}} // Init entity
+		rest := desc.List[1:]                                                                                             // Get descriptor contents
+
+		if len(rest) > 0 && rest[0].IsID() { // Check named
+			ent.Name = rest[0].Atom // Set name
+			rest = rest[1:]         // Skip name
+		}
+
+		return a.declareImport(ent, rest) // Declare import
+	case "func", "table", "memory", "global":
+		kind, _ := externalKind(field.Head())   // Get kind
+		ent := &entity{Kind: kind, Node: field} // Init entity
+		rest := field.List[1:]                  // Get contents
+
+		if len(rest) > 0 && rest[0].IsID() { // Check named
+			ent.Name = rest[0].Atom // Set name
+			rest = rest[1:]         // Skip name
+		}
+
+		for len(rest) > 0 && rest[0].Head() == "export" { // Collect inline exports
+			if len(rest[0].List) != 2 || !rest[0].List[1].IsString { // Check well formed
+				return malformed(rest[0], "expected export name") // Return error
+			}
+
+			a.exports = append(a.exports, &exportDef{Name: rest[0].List[1].Atom, Target: ent, Kind: kind}) // Append export
+			rest = rest[1:]                                                                                // Skip export
+		}
+
+		if len(rest) > 0 && rest[0].Head() == "import" { // Check inline import
+			imp := rest[0] // Get import
+
+			if len(imp.List) != 3 || !imp.List[1].IsString || !imp.List[2].IsString { // Check well formed
+				return malformed(imp, "expected import names") // Return error
+			}
+
+			ent.Import = &importDef{Module: imp.List[1].Atom, Field: imp.List[2].Atom} // Set import
+
+			return a.declareImport(ent, rest[1:]) // Declare import
+		}
+
+		return a.declareDefinition(ent, rest) // Declare definition
+	case "export":
+		if len(field.List) != 3 || !field.List[1].IsString || !field.List[2].IsList || len(field.List[2].List) != 2 { // Check well formed
+			return malformed(field, "expected export descriptor") // Return error
+		}
+
+		kind, err := externalKind(field.List[2].Head()) // Get kind
+
+		if err != nil { // Check for errors
+			return malformed(field, err.Error()) // Return error
+		}
+
+		a.exports = append(a.exports, &exportDef{Name: field.List[1].Atom, Kind: kind, Ref: field.List[2].List[1]}) // Append export
+	case "start":
+		if len(field.List) != 2 || a.start != nil { // Check well formed
+			return malformed(field, "expected single start function") // Return error
+		}
+
+		a.start = field.List[1] // Set start
+	case "elem", "data":
+		seg := &segmentDef{}   // Init segment
+		rest := field.List[1:] // Get contents
+
+		if len(rest) > 0 && (rest[0].IsID() || isNumeric(rest[0])) { // Check explicit target
+			seg.Target = rest[0] // Set target
+			rest = rest[1:]      // Skip target
+		} else if len(rest) > 0 && (rest[0].Head() == "table" || rest[0].Head() == "memory") && len(rest[0].List) == 2 { // Check explicit target
+			seg.Target = rest[0].List[1] // Set target
+			rest = rest[1:]              // Skip target
+		}
+
+		if len(rest) == 0 || !rest[0].IsList { // Check has offset
+			return malformed(field, "expected offset expression") // Return error
+		}
+
+		if rest[0].Head() == "offset" { // Check explicit offset
+			seg.Offset = rest[0].List[1:] // Set offset
+		} else {
+			seg.Offset = rest[:1] // Set folded offset
+		}
+
+		for _, n := range rest[1:] { // Iterate through payload
+			if field.Head() == "elem" { // Check is element segment
+				seg.Elems = append(seg.Elems, n) // Append function reference
+			} else if n.IsString { // Check is string
+				seg.Data = append(seg.Data, n.Atom...) // Append data
+			} else {
+				return malformed(n, "expected data string") // Return error
+			}
+		}
+
+		if field.Head() == "elem" { // Check is element segment
+			a.elems = append(a.elems, seg) // Append segment
+		} else {
+			a.datas = append(a.datas, seg) // Append segment
+		}
+	default:
+		return malformed(field, "unknown module field") // Return error
+	}
+
+	return nil // No error occurred, return nil
+}
+
+// declareImport - declare an imported entity from the remaining descriptor nodes
+func (a *assembler) declareImport(ent *entity, rest []*Node) error {
+	switch ent.Kind { // Handle kinds
+	case wasm.ExternalFunction:
+		typeIndex, _, rest, err := a.parseTypeUse(rest) // Parse type use
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if len(rest) != 0 { // Check consumed
+			return malformed(ent.Node, "unexpected function import contents") // Return error
+		}
+
+		ent.Import.Type = typeIndex // Set type
+	case wasm.ExternalTable:
+		if len(rest) == 0 || !isElemType(rest[len(rest)-1]) { // Check element type
+			return malformed(ent.Node, "expected table element type") // Return error
+		}
+
+		limits, err := parseLimits(rest[:len(rest)-1]) // Parse limits
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		ent.Import.Limits = limits // Set limits
+	case wasm.ExternalMemory:
+		limits, err := parseLimits(rest) // Parse limits
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		ent.Import.Limits = limits // Set limits
+	case wasm.ExternalGlobal:
+		if len(rest) != 1 { // Check well formed
+			return malformed(ent.Node, "expected global type") // Return error
+		}
+
+		global, err := parseGlobalType(rest[0]) // Parse global type
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		ent.Import.Global = global // Set type
+	}
+
+	a.entities[ent.Kind] = append(a.entities[ent.Kind], ent) // Append entity
+	a.imports = append(a.imports, ent)                       // Append import
+
+	return nil // No error occurred, return nil
+}
+
+// declareDefinition - declare a defined entity from the remaining field nodes
+func (a *assembler) declareDefinition(ent *entity, rest []*Node) error {
+	switch ent.Kind { // Handle kinds
+	case wasm.ExternalFunction:
+		typeIndex, paramNames, rest, err := a.parseTypeUse(rest) // Parse type use
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		def := &funcDef{Entity: ent, Type: typeIndex, LocalNames: paramNames} // Init definition
+		numParams := uint32(len(a.types[typeIndex].ParamTypes))               // Get param count
+
+		for len(rest) > 0 && rest[0].Head() == "local" { // Collect locals
+			names, types, err := parseValueTypes(rest[0].List[1:]) // Parse locals
+
+			if err != nil { // Check for errors
+				return err // Return found error
+			}
+
+			for i, name := range names { // Iterate through names
+				if name != "" { // Check named
+					def.LocalNames[name] = numParams + uint32(len(def.Locals)+i) // Set name
+				}
+			}
+
+			def.Locals = append(def.Locals, types...) // Append locals
+			rest = rest[1:]                           // Skip locals
+		}
+
+		def.Body = rest                // Set body
+		a.funcs = append(a.funcs, def) // Append function
+	case wasm.ExternalTable:
+		if len(rest) == 2 && isElemType(rest[0]) && rest[1].Head() == "elem" { // Check inline elements
+			elems := rest[1].List[1:]                                                                                // Get elements
+			a.limits[ent] = wasm.ResizableLimits{Flags: 1, Initial: uint32(len(elems)), Maximum: uint32(len(elems))} // Set limits
+			a.elems = append(a.elems, &segmentDef{Inline: ent, Elems: elems})                                        // Append segment
+		} else {
+			if len(rest) == 0 || !isElemType(rest[len(rest)-1]) { // Check element type
+				return malformed(ent.Node, "expected table element type") // Return error
+			}
+
+			limits, err := parseLimits(rest[:len(rest)-1]) // Parse limits
+
+			if err != nil { // Check for errors
+				return err // Return found error
+			}
+
+			a.limits[ent] = limits // Set limits
+		}
+
+		a.tables = append(a.tables, ent) // Append table
+	case wasm.ExternalMemory:
+		if len(rest) == 1 && rest[0].Head() == "data" { // Check inline data
+			seg := &segmentDef{Inline: ent} // Init segment
+
+			for _, n := range rest[0].List[1:] { // Iterate through strings
+				if !n.IsString { // Check is string
+					return malformed(n, "expected data string") // Return error
+				}
+
+				seg.Data = append(seg.Data, n.Atom...) // Append data
+			}
+
+			pages := uint32((len(seg.Data) + 65535) / 65536)                               // Get page count
+			a.limits[ent] = wasm.ResizableLimits{Flags: 1, Initial: pages, Maximum: pages} // Set limits
+			a.datas = append(a.datas, seg)                                                 // Append segment
+		} else {
+			limits, err := parseLimits(rest) // Parse limits
+
+			if err != nil { // Check for errors
+				return err // Return found error
+			}
+
+			a.limits[ent] = limits // Set limits
+		}
+
+		a.memories = append(a.memories, ent) // Append memory
+	case wasm.ExternalGlobal:
+		if len(rest) == 0 { // Check has type
+			return malformed(ent.Node, "expected global type") // Return error
+		}
+
+		global, err := parseGlobalType(rest[0]) // Parse global type
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		a.globals = append(a.globals, &globalDef{Entity: ent, Type: global, Init: rest[1:]}) // Append global
+	}
+
+	a.entities[ent.Kind] = append(a.entities[ent.Kind], ent) // Append entity
+
+	return nil // No error occurred, return nil
+}
+
+// assignIndices - number imported entities before defined ones in each index space
+func (a *assembler) assignIndices() {
+	for kind, entities := range a.entities { // Iterate through index spaces
+		index := uint32(0) // Init index buffer
+
+		for _, ent := range entities { // Number imports
+			if ent.Import != nil { // Check is import
+				ent.Index = index // Set index
+				index++           // Increment index
+			}
+		}
+
+		for _, ent := range entities { // Number definitions
+			if ent.Import == nil { // Check is definition
+				ent.Index = index // Set index
+				index++           // Increment index
+			}
+		}
+
+		a.entities[kind] = entities // Set entities
+	}
+}
+
+// resolve - resolve a $name or numeric reference into the given index space
+func (a *assembler) resolve(kind wasm.External, ref *Node) (uint32, error) {
+	if ref.IsID() { // Check is name
+		for _, ent := range a.entities[kind] { // Find named entity
+			if ent.Name == ref.Atom { // Check match
+				return ent.Index, nil // Return index
+			}
+		}
+
+		return 0, fmt.Errorf("line %d: %w %s", ref.Line, ErrUnknownIdentifier, ref.Atom) // Return error
+	}
+
+	return parseIndex(ref) // Return numeric index
+}
+
+// parseTypeUse - parse (type x)? (param ...)* (result ...)*, finding or appending a matching type
+func (a *assembler) parseTypeUse(nodes []*Node) (uint32, map[string]uint32, []*Node, error) {
+	explicit := -1 // Init explicit type buffer
+
+	if len(nodes) > 0 && nodes[0].Head() == "type" { // Check explicit type
+		if len(nodes[0].List) != 2 { // Check well formed
+			return 0, nil, nil, malformed(nodes[0], "expected type index") // Return error
+		}
+
+		ref := nodes[0].List[1] // Get reference
+
+		if ref.IsID() { // Check is name
+			index, ok := a.typeNames[ref.Atom] // Get index
+
+			if !ok { // Check declared
+				return 0, nil, nil, fmt.Errorf("line %d: %w %s", ref.Line, ErrUnknownIdentifier, ref.Atom) // Return error
+			}
+
+			explicit = int(index) // Set index
+		} else {
+			index, err := parseIndex(ref) // Parse index
+
+			if err != nil || int(index) >= len(a.types) { // Check in bounds
+				return 0, nil, nil, malformed(ref, "unknown type") // Return error
+			}
+
+			explicit = int(index) // Set index
+		}
+
+		nodes = nodes[1:] // Skip type
+	}
+
+	end := 0 // Init signature end
+
+	for end < len(nodes) && (nodes[end].Head() == "param" || nodes[end].Head() == "result") { // Find end of signature
+		end++ // Increment end
+	}
+
+	sig, names, err := parseSignature(nodes[:end]) // Parse signature
+
+	if err != nil { // Check for errors
+		return 0, nil, nil, err // Return found error
+	}
+
+	if explicit >= 0 { // Check explicit type
+		if end > 0 && !sameSignature(sig, a.types[explicit]) { // Check inline signature agrees
+			return 0, nil, nil, malformed(nodes[0], "inline function type does not match explicit type") // Return error
+		}
+
+		return uint32(explicit), names, nodes[end:], nil // Return explicit type
+	}
+
+	for i, t := range a.types { // Find matching type
+		if sameSignature(sig, t) { // Check match
+			return uint32(i), names, nodes[end:], nil // Return found type
+		}
+	}
+
+	a.types = append(a.types, sig) // Append implicit type
+
+	return uint32(len(a.types) - 1), names, nodes[end:], nil // Return new type
+}
+
+// encode - encode declared module into binary
+func (a *assembler) encode() ([]byte, error) {
+	out := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00} // Init header
+
+	var sec []byte // Init section buffer
+
+	if len(a.types) > 0 { // Encode type section
+		sec = leb128.AppendUleb128(nil, uint64(len(a.types))) // Write count
+
+		for _, t := range a.types { // Iterate through types
+			sec = append(sec, 0x60) // Write func type
+
+			sec = appendValueTypes(sec, t.ParamTypes)  // Write params
+			sec = appendValueTypes(sec, t.ReturnTypes) // Write results
+		}
+
+		out = appendSection(out, wasm.SectionIDType, sec) // Write section
+	}
+
+	if len(a.imports) > 0 { // Encode import section
+		sec = leb128.AppendUleb128(nil, uint64(len(a.imports))) // Write count
+
+		for _, ent := range a.imports { // Iterate through imports
+			sec = appendName(sec, ent.Import.Module) // Write module
+			sec = appendName(sec, ent.Import.Field)  // Write field
+			sec = append(sec, byte(ent.Kind))        // Write kind
+
+			switch ent.Kind { // Handle kinds
+			case wasm.ExternalFunction:
+				sec = leb128.AppendUleb128(sec, uint64(ent.Import.Type)) // Write type
+			case wasm.ExternalTable:
+				sec = append(sec, 0x70)                    // Write anyfunc
+				sec = appendLimits(sec, ent.Import.Limits) // Write limits
+			case wasm.ExternalMemory:
+				sec = appendLimits(sec, ent.Import.Limits) // Write limits
+			case wasm.ExternalGlobal:
+				sec = appendGlobalType(sec, ent.Import.Global) // Write type
+			}
+		}
+
+		out = appendSection(out, wasm.SectionIDImport, sec) // Write section
+	}
+
+	if len(a.funcs) > 0 { // Encode function section
+		sec = leb128.AppendUleb128(nil, uint64(len(a.funcs))) // Write count
+
+		for _, f := range a.funcs { // Iterate through functions
+			sec = leb128.AppendUleb128(sec, uint64(f.Type)) // Write type
+		}
+
+		out = appendSection(out, wasm.SectionIDFunction, sec) // Write section
+	}
+
+	if len(a.tables) > 0 { // Encode table section
+		sec = leb128.AppendUleb128(nil, uint64(len(a.tables))) // Write count
+
+		for _, t := range a.tables { // Iterate through tables
+			sec = append(sec, 0x70)              // Write anyfunc
+			sec = appendLimits(sec, a.limits[t]) // Write limits
+		}
+
+		out = appendSection(out, wasm.SectionIDTable, sec) // Write section
+	}
+
+	if len(a.memories) > 0 { // Encode memory section
+		sec = leb128.AppendUleb128(nil, uint64(len(a.memories))) // Write count
+
+		for _, m := range a.memories { // Iterate through memories
+			sec = appendLimits(sec, a.limits[m]) // Write limits
+		}
+
+		out = appendSection(out, wasm.SectionIDMemory, sec) // Write section
+	}
+
+	if len(a.globals) > 0 { // Encode global section
+		sec = leb128.AppendUleb128(nil, uint64(len(a.globals))) // Write count
+
+		for _, g := range a.globals { // Iterate through globals
+			sec = appendGlobalType(sec, g.Type) // Write type
+
+			expr, err := a.encodeExpr(g.Init) // Encode initializer
+
+			if err != nil { // Check for errors
+				return nil, err // Return found error
+			}
+
+			sec = append(sec, expr...) // Write initializer
+		}
+
+		out = appendSection(out, wasm.SectionIDGlobal, sec) // Write section
+	}
+
+	if len(a.exports) > 0 { // Encode export section
+		sec = leb128.AppendUleb128(nil, uint64(len(a.exports))) // Write count
+
+		for _, e := range a.exports { // Iterate through exports
+			index := uint32(0) // Init index buffer
+
+			if e.Target != nil { // Check inline export
+				index = e.Target.Index // Set index
+			} else {
+				resolved, err := a.resolve(e.Kind, e.Ref) // Resolve reference
+
+				if err != nil { // Check for errors
+					return nil, err // Return found error
+				}
+
+				index = resolved // Set index
+			}
+
+			sec = appendName(sec, e.Name)                  // Write name
+			sec = append(sec, byte(e.Kind))                // Write kind
+			sec = leb128.AppendUleb128(sec, uint64(index)) // Write index
+		}
+
+		out = appendSection(out, wasm.SectionIDExport, sec) // Write section
+	}
+
+	if a.start != nil { // Encode start section
+		index, err := a.resolve(wasm.ExternalFunction, a.start) // Resolve start
+
+		if err != nil { // Check for errors
+			return nil, err // Return found error
+		}
+
+		out = appendSection(out, wasm.SectionIDStart, leb128.AppendUleb128(nil, uint64(index))) // Write section
+	}
+
+	if len(a.elems) > 0 { // Encode element section
+		sec = leb128.AppendUleb128(nil, uint64(len(a.elems))) // Write count
+
+		for _, seg := range a.elems { // Iterate through segments
+			header, err := a.encodeSegmentHeader(seg, wasm.ExternalTable) // Encode target, offset
+
+			if err != nil { // Check for errors
+				return nil, err // Return found error
+			}
+
+			sec = append(sec, header...)                            // Write header
+			sec = leb128.AppendUleb128(sec, uint64(len(seg.Elems))) // Write count
+
+			for _, ref := range seg.Elems { // Iterate through elements
+				index, err := a.resolve(wasm.ExternalFunction, ref) // Resolve function
+
+				if err != nil { // Check for errors
+					return nil, err // Return found error
+				}
+
+				sec = leb128.AppendUleb128(sec, uint64(index)) // Write function
+			}
+		}
+
+		out = appendSection(out, wasm.SectionIDElement, sec) // Write section
+	}
+
+	if len(a.funcs) > 0 { // Encode code section
+		sec = leb128.AppendUleb128(nil, uint64(len(a.funcs))) // Write count
+
+		for _, f := range a.funcs { // Iterate through functions
+			body, err := a.encodeFunc(f) // Encode body
+
+			if err != nil { // Check for errors
+				return nil, err // Return found error
+			}
+
+			sec = leb128.AppendUleb128(sec, uint64(len(body))) // Write size
+			sec = append(sec, body...)                         // Write body
+		}
+
+		out = appendSection(out, wasm.SectionIDCode, sec) // Write section
+	}
+
+	if len(a.datas) > 0 { // Encode data section
+		sec = leb128.AppendUleb128(nil, uint64(len(a.datas))) // Write count
+
+		for _, seg := range a.datas { // Iterate through segments
+			header, err := a.encodeSegmentHeader(seg, wasm.ExternalMemory) // Encode target, offset
+
+			if err != nil { // Check for errors
+				return nil, err // Return found error
+			}
+
+			sec = append(sec, header...)                           // Write header
+			sec = leb128.AppendUleb128(sec, uint64(len(seg.Data))) // Write size
+			sec = append(sec, seg.Data...)                         // Write data
+		}
+
+		out = appendSection(out, wasm.SectionIDData, sec) // Write section
+	}
+
+	return appendNameSection(out, a.entities[wasm.ExternalFunction]), nil // Return encoded module
+}
+
+// encodeSegmentHeader - encode a segment's target index and offset expression
+func (a *assembler) encodeSegmentHeader(seg *segmentDef, kind wasm.External) ([]byte, error) {
+	index := uint32(0) // Init index buffer
+
+	if seg.Inline != nil { // Check inline segment
+		return append(leb128.AppendUleb128(nil, uint64(seg.Inline.Index)), ops.I32Const, 0x00, ops.End), nil // Return zero offset header
+	}
+
+	if seg.Target != nil { // Check explicit target
+		resolved, err := a.resolve(kind, seg.Target) // Resolve target
+
+		if err != nil { // Check for errors
+			return nil, err // Return found error
+		}
+
+		index = resolved // Set index
+	}
+
+	expr, err := a.encodeExpr(seg.Offset) // Encode offset
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	return append(leb128.AppendUleb128(nil, uint64(index)), expr...), nil // Return header
+}
+
+// encodeExpr - encode a constant expression followed by end
+func (a *assembler) encodeExpr(nodes []*Node) ([]byte, error) {
+	e := &funcEncoder{a: a, labels: []string{""}} // Init encoder
+
+	if err := e.sequence(nodes); err != nil { // Encode instructions
+		return nil, err // Return found error
+	}
+
+	return append(e.buf, ops.End), nil // Return terminated expression
+}
+
+// encodeFunc - encode a function body (locals and code)
+func (a *assembler) encodeFunc(f *funcDef) ([]byte, error) {
+	var body []byte // Init body buffer
+
+	groups := 0 // Init local group count
+
+	for i := range f.Locals { // Count runs of equal types
+		if i == 0 || f.Locals[i] != f.Locals[i-1] { // Check new run
+			groups++ // Increment groups
+		}
+	}
+
+	body = leb128.AppendUleb128(body, uint64(groups)) // Write group count
+
+	for i := 0; i < len(f.Locals); { // Iterate through runs
+		j := i // Init run end
+
+		for j < len(f.Locals) && f.Locals[j] == f.Locals[i] { // Find end of run
+			j++ // Increment end
+		}
+
+		body = leb128.AppendUleb128(body, uint64(j-i)) // Write count
+		body = append(body, byte(f.Locals[i]&0x7f))    // Write type
+		i = j                                          // Skip run
+	}
+
+	e := &funcEncoder{a: a, locals: f.LocalNames, labels: []string{""}} // Init encoder
+
+	if err := e.sequence(f.Body); err != nil { // Encode instructions
+		return nil, err // Return found error
+	}
+
+	if len(e.labels) != 1 { // Check blocks closed
+		return nil, malformed(f.Entity.Node, "unterminated block") // Return error
+	}
+
+	return append(append(body, e.buf...), ops.End), nil // Return body
+}
+
+// funcEncoder - instruction encoder state
+type funcEncoder struct {
+	a *assembler // Module assembler
+
+	locals map[string]uint32 // Local index by $name
+	labels []string          // Label stack (innermost last)
+
+	buf []byte // Encoded instructions
+}
+
+// sequence - encode a sequence of plain and folded instructions
+func (e *funcEncoder) sequence(nodes []*Node) error {
+	for i := 0; i < len(nodes); { // Iterate through instructions
+		n := nodes[i] // Get node
+
+		if n.IsList { // Check is folded
+			if err := e.folded(n); err != nil { // Encode folded instruction
+				return err // Return found error
+			}
+
+			i++      // Increment position
+			continue // Continue
+		}
+
+		if n.IsString || n.IsID() { // Check is keyword
+			return malformed(n, "expected instruction") // Return error
+		}
+
+		i++ // Skip instruction name
+
+		switch n.Atom { // Handle structured instructions
+		case "block", "loop", "if":
+			label, blockType, next, err := parseBlockHeader(nodes, i) // Parse label, signature
+
+			if err != nil { // Check for errors
+				return err // Return found error
+			}
+
+			e.buf = append(e.buf, opcodeNames[n.Atom], blockType) // Write instruction
+			e.labels = append(e.labels, label)                    // Push label
+			i = next                                              // Skip header
+		case "else", "end":
+			if len(e.labels) < 2 { // Check has open block
+				return malformed(n, "unmatched "+n.Atom) // Return error
+			}
+
+			if i < len(nodes) && nodes[i].IsID() { // Check trailing label
+				if nodes[i].Atom != e.labels[len(e.labels)-1] { // Check matches
+					return malformed(nodes[i], "mismatching label") // Return error
+				}
+
+				i++ // Skip label
+			}
+
+			e.buf = append(e.buf, opcodeNames[n.Atom]) // Write instruction
+
+			if n.Atom == "end" { // Check closes block
+				e.labels = e.labels[:len(e.labels)-1] // Pop label
+			}
+		default:
+			next, err := e.plain(n, nodes, i) // Encode plain instruction
+
+			if err != nil { // Check for errors
+				return err // Return found error
+			}
+
+			i = next // Skip immediates
+		}
+	}
+
+	return nil // No error occurred, return nil
+}
+
+// folded - encode a folded (op ...) instruction
+func (e *funcEncoder) folded(n *Node) error {
+	head := n.Head() // Get instruction
+
+	if head == "" { // Check has instruction
+		return malformed(n, "expected instruction") // Return error
+	}
+
+	switch head { // Handle structured instructions
+	case "block", "loop":
+		label, blockType, next, err := parseBlockHeader(n.List, 1) // Parse label, signature
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		e.buf = append(e.buf, opcodeNames[head], blockType) // Write instruction
+		e.labels = append(e.labels, label)                  // Push label
+
+		if err = e.sequence(n.List[next:]); err != nil { // Encode body
+			return err // Return found error
+		}
+
+		e.buf = append(e.buf, ops.End)        // Write end
+		e.labels = e.labels[:len(e.labels)-1] // Pop label
+	case "if":
+		label, blockType, next, err := parseBlockHeader(n.List, 1) // Parse label, signature
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		rest := n.List[next:] // Get condition, branches
+
+		for len(rest) > 0 && rest[0].Head() != "then" { // Encode condition
+			if err = e.folded(rest[0]); err != nil { // Encode operand
+				return err // Return found error
+			}
+
+			rest = rest[1:] // Skip operand
+		}
+
+		if len(rest) == 0 || len(rest) > 2 || (len(rest) == 2 && rest[1].Head() != "else") { // Check branches
+			return malformed(n, "expected (then ...) (else ...)?") // Return error
+		}
+
+		e.buf = append(e.buf, ops.If, blockType) // Write instruction
+		e.labels = append(e.labels, label)       // Push label
+
+		if err = e.sequence(rest[0].List[1:]); err != nil { // Encode then-branch
+			return err // Return found error
+		}
+
+		if len(rest) == 2 { // Check has else-branch
+			e.buf = append(e.buf, ops.Else) // Write else
+
+			if err = e.sequence(rest[1].List[1:]); err != nil { // Encode else-branch
+				return err // Return found error
+			}
+		}
+
+		e.buf = append(e.buf, ops.End)        // Write end
+		e.labels = e.labels[:len(e.labels)-1] // Pop label
+	default:
+		end := 1 // Init immediate end
+
+		for end < len(n.List) && (!n.List[end].IsList || (head == "call_indirect" && isTypeUse(n.List[end]))) { // Find end of immediates
+			end++ // Increment end
+		}
+
+		for _, operand := range n.List[end:] { // Encode operands
+			if err := e.folded(operand); err != nil { // Encode operand
+				return err // Return found error
+			}
+		}
+
+		next, err := e.plain(n.List[0], n.List[:end], 1) // Encode instruction
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if next != end { // Check immediates consumed
+			return malformed(n, "unexpected immediate") // Return error
+		}
+	}
+
+	return nil // No error occurred, return nil
+}
+
+// plain - encode a plain instruction reading immediates from nodes[i:], returning the next position
+func (e *funcEncoder) plain(op *Node, nodes []*Node, i int) (int, error) {
+	code, ok := opcodeNames[op.Atom] // Get opcode
+
+	if !ok { // Check known
+		return i, fmt.Errorf("line %d: %w %s", op.Line, ErrUnknownInstruction, op.Atom) // Return error
+	}
+
+	e.buf = append(e.buf, code) // Write opcode
+
+	immediate := func() (*Node, error) { // Read next atom immediate
+		if i >= len(nodes) || nodes[i].IsList || nodes[i].IsString { // Check has atom
+			return nil, malformed(op, "missing immediate") // Return error
+		}
+
+		i++ // Increment position
+
+		return nodes[i-1], nil // Return immediate
+	}
+
+	switch code { // Handle immediates
+	case ops.Br, ops.BrIf:
+		ref, err := immediate() // Read label
+
+		if err != nil { // Check for errors
+			return i, err // Return found error
+		}
+
+		depth, err := e.label(ref) // Resolve label
+
+		if err != nil { // Check for errors
+			return i, err // Return found error
+		}
+
+		e.buf = leb128.AppendUleb128(e.buf, uint64(depth)) // Write label
+	case ops.BrTable:
+		var depths []uint32 // Init depth buffer
+
+		for i < len(nodes) && (nodes[i].IsID() || isNumeric(nodes[i])) { // Read labels
+			depth, err := e.label(nodes[i]) // Resolve label
+
+			if err != nil { // Check for errors
+				return i, err // Return found error
+			}
+
+			depths = append(depths, depth) // Append depth
+			i++                            // Increment position
+		}
+
+		if len(depths) == 0 { // Check has default
+			return i, malformed(op, "missing default label") // Return error
+		}
+
+		e.buf = leb128.AppendUleb128(e.buf, uint64(len(depths)-1)) // Write count
+
+		for _, depth := range depths { // Write labels
+			e.buf = leb128.AppendUleb128(e.buf, uint64(depth)) // Write label
+		}
+	case ops.Call:
+		ref, err := immediate() // Read function
+
+		if err != nil { // Check for errors
+			return i, err // Return found error
+		}
+
+		index, err := e.a.resolve(wasm.ExternalFunction, ref) // Resolve function
+
+		if err != nil { // Check for errors
+			return i, err // Return found error
+		}
+
+		e.buf = leb128.AppendUleb128(e.buf, uint64(index)) // Write function
+	case ops.CallIndirect:
+		end := i // Init type use end
+
+		for end < len(nodes) && isTypeUse(nodes[end]) { // Find end of type use
+			end++ // Increment end
+		}
+
+		typeUse := nodes[i:end] // Get type use
+
+		if end == i && i < len(nodes) && (nodes[i].IsID() || isNumeric(nodes[i])) { // Check legacy bare type reference (call_indirect $sig)
+			typeUse = []*Node{{IsList: true, List: []*Node{{Atom: "type"}, nodes[i]}, Line: nodes[i].Line}} // Set explicit type use
+			end++                                                                                           // Skip reference
+		}
+
+		typeIndex, names, rest, err := e.a.parseTypeUse(typeUse) // Parse type use
+
+		if err != nil || len(rest) != 0 || len(names) != 0 { // Check well formed
+			return i, malformed(op, "malformed call_indirect type") // Return error
+		}
+
+		e.buf = leb128.AppendUleb128(e.buf, uint64(typeIndex)) // Write type
+		e.buf = append(e.buf, 0x00)                            // Write reserved table index
+		i = end                                                // Skip type use
+	case ops.GetLocal, ops.SetLocal, ops.TeeLocal:
+		ref, err := immediate() // Read local
+
+		if err != nil { // Check for errors
+			return i, err // Return found error
+		}
+
+		var index uint32 // Init index buffer
+
+		if ref.IsID() { // Check is name
+			if index, ok = e.locals[ref.Atom]; !ok { // Resolve name
+				return i, fmt.Errorf("line %d: %w %s", ref.Line, ErrUnknownIdentifier, ref.Atom) // Return error
+			}
+		} else if index, err = parseIndex(ref); err != nil { // Parse index
+			return i, err // Return found error
+		}
+
+		e.buf = leb128.AppendUleb128(e.buf, uint64(index)) // Write local
+	case ops.GetGlobal, ops.SetGlobal:
+		ref, err := immediate() // Read global
+
+		if err != nil { // Check for errors
+			return i, err // Return found error
+		}
+
+		index, err := e.a.resolve(wasm.ExternalGlobal, ref) // Resolve global
+
+		if err != nil { // Check for errors
+			return i, err // Return found error
+		}
+
+		e.buf = leb128.AppendUleb128(e.buf, uint64(index)) // Write global
+	case ops.CurrentMemory, ops.GrowMemory:
+		e.buf = append(e.buf, 0x00) // Write reserved memory index
+	case ops.I32Const, ops.I64Const, ops.F32Const, ops.F64Const:
+		ref, err := immediate() // Read literal
+
+		if err != nil { // Check for errors
+			return i, err // Return found error
+		}
+
+		value, err := parseConst(code, ref.Atom) // Parse literal
+
+		if err != nil { // Check for errors
+			return i, malformed(ref, err.Error()) // Return error
+		}
+
+		switch code { // Handle encodings
+		case ops.I32Const:
+			e.buf = leb128.AppendSleb128(e.buf, int64(int32(value))) // Write signed
+		case ops.I64Const:
+			e.buf = leb128.AppendSleb128(e.buf, int64(value)) // Write signed
+		case ops.F32Const:
+			e.buf = append(e.buf, byte(value), byte(value>>8), byte(value>>16), byte(value>>24)) // Write bits
+		case ops.F64Const:
+			for x := uint(0); x < 64; x += 8 { // Write bits
+				e.buf = append(e.buf, byte(value>>x)) // Write byte
+			}
+		}
+	default:
+		if width := naturalAlignment(op.Atom); width >= 0 { // Check is load/store
+			offset, align := uint64(0), uint64(width) // Init memarg
+
+			for i < len(nodes) && !nodes[i].IsList && (strings.HasPrefix(nodes[i].Atom, "offset=") || strings.HasPrefix(nodes[i].Atom, "align=")) { // Read memarg
+				kv := strings.SplitN(nodes[i].Atom, "=", 2) // Split field
+				v, err := parseUint(kv[1], 64)              // Parse value
+
+				if err != nil { // Check for errors
+					return i, malformed(nodes[i], "malformed memarg") // Return error
+				}
+
+				if kv[0] == "offset" { // Check is offset
+					offset = v // Set offset
+				} else {
+					if v == 0 || v&(v-1) != 0 { // Check power of two
+						return i, malformed(nodes[i], "alignment must be a power of two") // Return error
+					}
+
+					align = uint64(0) // Reset alignment
+
+					for v > 1 { // Compute log2
+						v >>= 1 // Shift
+						align++ // Increment exponent
+					}
+				}
+
+				i++ // Increment position
+			}
+
+			if offset > math.MaxUint32 { // Check offset fits
+				return i, malformed(op, "offset out of range") // Return error
+			}
+
+			e.buf = leb128.AppendUleb128(e.buf, align)  // Write alignment
+			e.buf = leb128.AppendUleb128(e.buf, offset) // Write offset
+		}
+	}
+
+	return i, nil // Return next position
+}
+
+// label - resolve a branch label to its relative depth
+func (e *funcEncoder) label(ref *Node) (uint32, error) {
+	if ref.IsID() { // Check is name
+		for depth := len(e.labels) - 1; depth >= 0; depth-- { // Search innermost first
+			if e.labels[depth] == ref.Atom { // Check match
+				return uint32(len(e.labels) - 1 - depth), nil // Return relative depth
+			}
+		}
+
+		return 0, fmt.Errorf("line %d: %w %s", ref.Line, ErrUnknownIdentifier, ref.Atom) // Return error
+	}
+
+	return parseIndex(ref) // Return numeric depth
+}
+
+// parseBlockHeader - parse an optional label and result type starting at nodes[i]
+func parseBlockHeader(nodes []*Node, i int) (string, byte, int, error) {
+	label := "" // Init label buffer
+
+	if i < len(nodes) && nodes[i].IsID() { // Check labeled
+		label = nodes[i].Atom // Set label
+		i++                   // Skip label
+	}
+
+	blockType := byte(0x40) // Init empty signature
+
+	for i < len(nodes) && nodes[i].Head() == "result" { // Read results
+		_, types, err := parseValueTypes(nodes[i].List[1:]) // Parse types
+
+		if err != nil { // Check for errors
+			return "", 0, i, err // Return found error
+		}
+
+		for _, t := range types { // Iterate through types
+			if blockType != 0x40 { // Check single result
+				return "", 0, i, malformed(nodes[i], "multiple block results") // Return error
+			}
+
+			blockType = byte(t & 0x7f) // Set signature
+		}
+
+		i++ // Skip result
+	}
+
+	return label, blockType, i, nil // Return header
+}
+
+// parseSignature - parse (param ...)* (result ...)* into a signature and param names
+func parseSignature(nodes []*Node) (wasm.FunctionSig, map[string]uint32, error) {
+	sig := wasm.FunctionSig{Form: 0x60, ParamTypes: []wasm.ValueType{}, ReturnTypes: []wasm.ValueType{}} // Init signature
+	names := make(map[string]uint32)                                                                     // Init name buffer
+
+	for _, n := range nodes { // Iterate through declarations
+		switch n.Head() { // Handle declarations
+		case "param":
+			if len(sig.ReturnTypes) != 0 { // Check ordering
+				return sig, nil, malformed(n, "param after result") // Return error
+			}
+
+			paramNames, types, err := parseValueTypes(n.List[1:]) // Parse types
+
+			if err != nil { // Check for errors
+				return sig, nil, err // Return found error
+			}
+
+			for i, name := range paramNames { // Iterate through names
+				if name != "" { // Check named
+					names[name] = uint32(len(sig.ParamTypes) + i) // Set name
+				}
+			}
+
+			sig.ParamTypes = append(sig.ParamTypes, types...) // Append params
+		case "result":
+			_, types, err := parseValueTypes(n.List[1:]) // Parse types
+
+			if err != nil { // Check for errors
+				return sig, nil, err // Return found error
+			}
+
+			sig.ReturnTypes = append(sig.ReturnTypes, types...) // Append results
+		default:
+			return sig, nil, malformed(n, "expected param or result") // Return error
+		}
+	}
+
+	return sig, names, nil // Return signature
+}
+
+// parseValueTypes - parse "$name type" or "type*" declaration contents
+func parseValueTypes(nodes []*Node) ([]string, []wasm.ValueType, error) {
+	if len(nodes) == 2 && nodes[0].IsID() { // Check named declaration
+		t, err := parseValueType(nodes[1]) // Parse type
+
+		if err != nil { // Check for errors
+			return nil, nil, err // Return found error
+		}
+
+		return []string{nodes[0].Atom}, []wasm.ValueType{t}, nil // Return named type
+	}
+
+	names := make([]string, len(nodes))         // Init name buffer
+	types := make([]wasm.ValueType, len(nodes)) // Init type buffer
+
+	for i, n := range nodes { // Iterate through types
+		t, err := parseValueType(n) // Parse type
+
+		if err != nil { // Check for errors
+			return nil, nil, err // Return found error
+		}
+
+		types[i] = t // Set type
+	}
+
+	return names, types, nil // Return types
+}
+
+// parseValueType - parse i32, i64, f32 or f64
+func parseValueType(n *Node) (wasm.ValueType, error) {
+	switch n.Atom { // Handle types
+	case "i32":
+		return wasm.ValueTypeI32, nil
+	case "i64":
+		return wasm.ValueTypeI64, nil
+	case "f32":
+		return wasm.ValueTypeF32, nil
+	case "f64":
+		return wasm.ValueTypeF64, nil
+	default:
+		return 0, malformed(n, "unknown value type") // Return error
+	}
+}
+
+// parseGlobalType - parse "type" or "(mut type)"
+func parseGlobalType(n *Node) (wasm.GlobalVar, error) {
+	if n.Head() == "mut" && len(n.List) == 2 { // Check mutable
+		t, err := parseValueType(n.List[1]) // Parse type
+
+		return wasm.GlobalVar{Type: t, Mutable: true}, err // Return type
+	}
+
+	t, err := parseValueType(n) // Parse type
+
+	return wasm.GlobalVar{Type: t}, err // Return type
+}
+
+// parseLimits - parse "min max?"
+func parseLimits(nodes []*Node) (wasm.ResizableLimits, error) {
+	limits := wasm.ResizableLimits{} // Init limits
+
+	if len(nodes) == 0 || len(nodes) > 2 { // Check well formed
+		return limits, fmt.Errorf("%w: expected limits", ErrMalformedModule) // Return error
+	}
+
+	min, err := parseIndex(nodes[0]) // Parse min
+
+	if err != nil { // Check for errors
+		return limits, err // Return found error
+	}
+
+	limits.Initial = min // Set min
+
+	if len(nodes) == 2 { // Check has max
+		max, err := parseIndex(nodes[1]) // Parse max
+
+		if err != nil { // Check for errors
+			return limits, err // Return found error
+		}
+
+		limits.Flags = 1     // Set has max
+		limits.Maximum = max // Set max
+	}
+
+	return limits, nil // Return limits
+}
+
+// parseIndex - parse an unsigned 32-bit index literal
+func parseIndex(n *Node) (uint32, error) {
+	if n.IsList || n.IsString { // Check is atom
+		return 0, malformed(n, "expected index") // Return error
+	}
+
+	v, err := parseUint(n.Atom, 32) // Parse literal
+
+	if err != nil { // Check for errors
+		return 0, malformed(n, "malformed index") // Return error
+	}
+
+	return uint32(v), nil // Return index
+}
+
+// parseUint - parse an unsigned decimal or hex integer literal with optional underscores
+func parseUint(s string, bits int) (uint64, error) {
+	if strings.HasPrefix(s, "_") || strings.HasSuffix(s, "_") || strings.Contains(s, "__") { // Check underscore placement
+		return 0, strconv.ErrSyntax // Return error
+	}
+
+	s = strings.Replace(s, "_", "", -1) // Strip separators
+
+	if strings.HasPrefix(s, "0x") { // Check is hex
+		return strconv.ParseUint(s[2:], 16, bits) // Return parsed hex
+	}
+
+	return strconv.ParseUint(s, 10, bits) // Return parsed decimal
+}
+
+// parseConst - parse a numeric literal for the given const opcode into its bit pattern
+func parseConst(code byte, s string) (uint64, error) {
+	switch code { // Handle types
+	case ops.I32Const, ops.I64Const:
+		bits := 32 // Init width
+
+		if code == ops.I64Const { // Check is 64-bit
+			bits = 64 // Set width
+		}
+
+		negative := strings.HasPrefix(s, "-") // Check sign
+
+		if negative || strings.HasPrefix(s, "+") { // Strip sign
+			s = s[1:] // Set magnitude
+		}
+
+		v, err := parseUint(s, bits) // Parse magnitude
+
+		if err != nil { // Check for errors
+			return 0, fmt.Errorf("malformed integer constant %q", s) // Return error
+		}
+
+		if negative { // Check is negative
+			if v > uint64(1)<<uint(bits-1) { // Check in signed range
+				return 0, fmt.Errorf("integer constant out of range: -%s", s) // Return error
+			}
+
+			v = -v // Negate
+		}
+
+		if bits == 32 { // Check is 32-bit
+			v = uint64(uint32(v)) // Truncate
+		}
+
+		return v, nil // Return bits
+	default:
+		return parseFloat(s, code == ops.F32Const) // Return float bits
+	}
+}
+
+// parseFloat - parse a float literal (decimal, hex, inf, nan, nan:0x...) into its bit pattern
+func parseFloat(s string, single bool) (uint64, error) {
+	sign := uint64(0) // Init sign buffer
+
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") { // Check signed
+		if s[0] == '-' { // Check negative
+			sign = 1 // Set sign
+		}
+
+		s = s[1:] // Strip sign
+	}
+
+	expBits, mantBits := uint(8), uint(23) // Init f32 layout
+
+	if !single { // Check is f64
+		expBits, mantBits = 11, 52 // Set f64 layout
+	}
+
+	signBit := sign << (expBits + mantBits)         // Get sign bit
+	expMask := (uint64(1)<<expBits - 1) << mantBits // Get exponent mask
+	quietBit := uint64(1) << (mantBits - 1)         // Get canonical NaN payload
+
+	switch {
+	case s == "inf":
+		return signBit | expMask, nil // Return infinity
+	case s == "nan":
+		return signBit | expMask | quietBit, nil // Return canonical NaN
+	case strings.HasPrefix(s, "nan:0x"):
+		payload, err := parseUint(s[4:], 64) // Parse payload
+
+		if err != nil || payload == 0 || payload >= uint64(1)<<mantBits { // Check payload in range
+			return 0, fmt.Errorf("malformed NaN payload %q", s) // Return error
+		}
+
+		return signBit | expMask | payload, nil // Return NaN
+	}
+
+	if strings.HasPrefix(s, "_") || strings.HasSuffix(s, "_") || strings.Contains(s, "__") { // Check underscore placement
+		return 0, fmt.Errorf("malformed float constant %q", s) // Return error
+	}
+
+	s = strings.Replace(s, "_", "", -1) // Strip separators
+
+	if strings.HasPrefix(s, "0x") && !strings.ContainsAny(s, "pP") { // Check hex without exponent
+		s += "p0" // Append exponent
+	}
+
+	if single { // Check is f32
+		f, err := strconv.ParseFloat(s, 32) // Parse
+
+		if err != nil { // Check for errors
+			return 0, fmt.Errorf("malformed float constant %q", s) // Return error
+		}
+
+		return signBit | uint64(math.Float32bits(float32(f))), nil // Return bits
+	}
+
+	f, err := strconv.ParseFloat(s, 64) // Parse
+
+	if err != nil { // Check for errors
+		return 0, fmt.Errorf("malformed float constant %q", s) // Return error
+	}
+
+	return signBit | math.Float64bits(f), nil // Return bits
+}
+
+// naturalAlignment - get log2 natural alignment of a load/store instruction, or -1
+func naturalAlignment(name string) int {
+	op := name[strings.IndexByte(name, '.')+1:] // Get operator
+
+	if !strings.HasPrefix(op, "load") && !strings.HasPrefix(op, "store") { // Check is memory access
+		return -1
+	}
+
+	switch {
+	case strings.HasSuffix(op, "8") || strings.HasSuffix(op, "8_s") || strings.HasSuffix(op, "8_u"):
+		return 0
+	case strings.HasSuffix(op, "16") || strings.HasSuffix(op, "16_s") || strings.HasSuffix(op, "16_u"):
+		return 1
+	case strings.HasSuffix(op, "32") || strings.HasSuffix(op, "32_s") || strings.HasSuffix(op, "32_u"):
+		return 2
+	case strings.HasPrefix(name, "i64") || strings.HasPrefix(name, "f64"):
+		return 3
+	default:
+		return 2
+	}
+}
+
+// externalKind - get external kind from a field keyword
+func externalKind(keyword string) (wasm.External, error) {
+	switch keyword { // Handle keywords
+	case "func":
+		return wasm.ExternalFunction, nil
+	case "table":
+		return wasm.ExternalTable, nil
+	case "memory":
+		return wasm.ExternalMemory, nil
+	case "global":
+		return wasm.ExternalGlobal, nil
+	default:
+		return 0, fmt.Errorf("unknown external kind %q", keyword) // Return error
+	}
+}
+
+// buildOpcodeNames - index wagon's operator table by MVP and current spec instruction names
+func buildOpcodeNames() map[string]byte {
+	names := map[string]byte{
+		"local.get":      ops.GetLocal,
+		"local.set":      ops.SetLocal,
+		"local.tee":      ops.TeeLocal,
+		"global.get":     ops.GetGlobal,
+		"global.set":     ops.SetGlobal,
+		"current_memory": ops.CurrentMemory,
+		"grow_memory":    ops.GrowMemory,
+	} // Init aliases
+
+	for code := 0; code < 256; code++ { // Iterate through opcodes
+		op, err := ops.New(byte(code)) // Get operator
+
+		if err != nil || !op.IsValid() { // Check valid
+			continue // Continue
+		}
+
+		names[op.Name] = byte(code) // Set MVP name
+
+		if slash := strings.IndexByte(op.Name, '/'); slash >= 0 { // Check is conversion (e.g. i32.trunc_s/f32)
+			base, from := op.Name[:slash], op.Name[slash+1:] // Split name
+
+			if strings.HasSuffix(base, "_s") || strings.HasSuffix(base, "_u") { // Check signed variant
+				names[base[:len(base)-2]+"_"+from+base[len(base)-2:]] = byte(code) // Set current name (e.g. i32.trunc_f32_s)
+			} else {
+				names[base+"_"+from] = byte(code) // Set current name (e.g. i32.wrap_i64)
+			}
+		}
+	}
+
+	return names // Return names
+}
+
+// sameSignature - check two signatures are identical
+func sameSignature(a wasm.FunctionSig, b wasm.FunctionSig) bool {
+	if len(a.ParamTypes) != len(b.ParamTypes) || len(a.ReturnTypes) != len(b.ReturnTypes) { // Check arity
+		return false
+	}
+
+	for i := range a.ParamTypes { // Iterate through params
+		if a.ParamTypes[i] != b.ParamTypes[i] { // Check match
+			return false
+		}
+	}
+
+	for i := range a.ReturnTypes { // Iterate through results
+		if a.ReturnTypes[i] != b.ReturnTypes[i] { // Check match
+			return false
+		}
+	}
+
+	return true // Signatures match
+}
+
+// isTypeUse - check node is a (type ...), (param ...) or (result ...) list
+func isTypeUse(n *Node) bool {
+	head := n.Head() // Get head
+
+	return head == "type" || head == "param" || head == "result" // Return is type use
+}
+
+// isElemType - check node is a table element type keyword
+func isElemType(n *Node) bool {
+	return !n.IsList && (n.Atom == "anyfunc" || n.Atom == "funcref") // Return is element type
+}
+
+// isNumeric - check node is a numeric atom
+func isNumeric(n *Node) bool {
+	return !n.IsList && !n.IsString && len(n.Atom) > 0 && n.Atom[0] >= '0' && n.Atom[0] <= '9' // Return is numeric
+}
+
+// malformed - build a positioned malformed-module error
+func malformed(n *Node, reason string) error {
+	return fmt.Errorf("line %d: %w: %s", n.Line, ErrMalformedModule, reason) // Return error
+}
+
+// appendSection - append a section with the given ID and payload
+func appendSection(out []byte, id wasm.SectionID, payload []byte) []byte {
+	out = append(out, byte(id))                           // Write ID
+	out = leb128.AppendUleb128(out, uint64(len(payload))) // Write size
+
+	return append(out, payload...) // Write payload
+}
+
+// appendNameSection - append a "name" custom section naming $-identified functions
+func appendNameSection(out []byte, funcs []*entity) []byte {
+	var names []byte // Init name map buffer
+
+	count := 0 // Init count
+
+	for index := uint32(0); index < uint32(len(funcs)); index++ { // Iterate in index order
+		for _, f := range funcs { // Find function
+			if f.Index == index && f.Name != "" { // Check named
+				names = leb128.AppendUleb128(names, uint64(index)) // Write index
+				names = appendName(names, f.Name[1:])              // Write name
+				count++                                            // Increment count
+			}
+		}
+	}
+
+	if count == 0 { // Check has names
+		return out // Return unchanged
+	}
+
+	subsection := leb128.AppendUleb128(nil, uint64(count)) // Init subsection
+	subsection = append(subsection, names...)              // Write names
+
+	payload := appendName(nil, "name")                               // Write section name
+	payload = append(payload, 0x01)                                  // Write function names subsection ID
+	payload = leb128.AppendUleb128(payload, uint64(len(subsection))) // Write size
+	payload = append(payload, subsection...)                         // Write subsection
+
+	return appendSection(out, wasm.SectionIDCustom, payload) // Return with section
+}
+
+// appendName - append a length-prefixed name
+func appendName(out []byte, name string) []byte {
+	out = leb128.AppendUleb128(out, uint64(len(name))) // Write length
+
+	return append(out, name...) // Write name
+}
+
+// appendValueTypes - append a vector of value types
+func appendValueTypes(out []byte, types []wasm.ValueType) []byte {
+	out = leb128.AppendUleb128(out, uint64(len(types))) // Write count
+
+	for _, t := range types { // Iterate through types
+		out = append(out, byte(t&0x7f)) // Write type
+	}
+
+	return out // Return buffer
+}
+
+// appendLimits - append resizable limits
+func appendLimits(out []byte, limits wasm.ResizableLimits) []byte {
+	out = append(out, byte(limits.Flags))                   // Write flags
+	out = leb128.AppendUleb128(out, uint64(limits.Initial)) // Write min
+
+	if limits.Flags&1 != 0 { // Check has max
+		out = leb128.AppendUleb128(out, uint64(limits.Maximum)) // Write max
+	}
+
+	return out // Return buffer
+}
+
+// appendGlobalType - append a global type
+func appendGlobalType(out []byte, global wasm.GlobalVar) []byte {
+	mutable := byte(0) // Init mutability
+
+	if global.Mutable { // Check mutable
+		mutable = 1 // Set mutable
+	}
+
+	return append(out, byte(global.Type&0x7f), mutable) // Write type
+}
+
+/* END INTERNAL METHODS */
@@ -0,0 +1,115 @@
+package wast
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SummerCash/ursa/compiler"
+)
+
+// TestAssembleModule - test functionality of text module assembly
+func TestAssembleModule(t *testing.T) {
+	nodes, err := ParseSExprs([]byte(`(module
+		(type $binop (func (param i32 i32) (result i32)))
+		(import "spectest" "print_i32" (func $print (param i32)))
+		(memory (data "hi"))
+		(table anyfunc (elem $add))
+		(global $g (mut i64) (i64.const -1))
+		(func $add (export "add") (type $binop) (i32.add (get_local 0) (get_local 1)))
+		(func (export "loop") (param $n i32) (result i32) (local $acc i32)
+			(block $done
+				(loop $next
+					(br_if $done (i32.eqz (get_local $n)))
+					(set_local $acc (i32.add (get_local $acc) (get_local $n)))
+					(set_local $n (i32.sub (get_local $n) (i32.const 1)))
+					(br $next)))
+			get_local $acc)
+		(func (export "indirect") (result i32)
+			(call_indirect (type $binop) (i32.const 2) (i32.const 3) (i32.const 0)))
+	)`)) // Parse module
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	code, err := AssembleModule(nodes[0]) // Assemble module
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	module, err := compiler.LoadModule(code) // Load assembled module
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if len(module.Base.FunctionIndexSpace) != 3 || len(module.Base.Import.Entries) != 1 { // Check functions, imports
+		t.Fatalf("unexpected module layout: %d functions, %d imports", len(module.Base.FunctionIndexSpace), len(module.Base.Import.Entries)) // Panic
+	}
+
+	if entry := module.Base.Export.Entries["add"]; entry.Index != 1 { // Check imports are numbered first
+		t.Fatalf("expected add at index 1, got %d", entry.Index) // Panic
+	}
+
+	if module.FunctionNames[1] != "add" { // Check name section
+		t.Fatalf("expected name section entry for add, got %v", module.FunctionNames) // Panic
+	}
+}
+
+// TestAssembleModuleErrors - test assembly of malformed modules fails
+func TestAssembleModuleErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		err    error
+	}{
+		{"(module (func (i32.bogus)))", ErrUnknownInstruction},
+		{"(module (func (call $missing)))", ErrUnknownIdentifier},
+		{"(module (func (br $missing)))", ErrUnknownIdentifier},
+		{"(module (func (i32.const 0x1_0000_0000) drop))", ErrMalformedModule},
+		{"(module (bogus))", ErrMalformedModule},
+	}
+
+	for _, test := range tests { // Iterate through tests
+		nodes, err := ParseSExprs([]byte(test.source)) // Parse module
+
+		if err != nil { // Check for errors
+			t.Fatal(err) // Panic
+		}
+
+		if _, err = AssembleModule(nodes[0]); !errors.Is(err, test.err) { // Check rejected
+			t.Fatalf("%s: expected %v, got %v", test.source, test.err, err) // Panic
+		}
+	}
+}
+
+// TestParseFloat - test functionality of float literal parsing
+func TestParseFloat(t *testing.T) {
+	tests := []struct {
+		literal string
+		single  bool
+		bits    uint64
+	}{
+		{"1.5", true, 0x3fc00000},
+		{"-0x1p-149", true, 0x80000001},
+		{"0xf32", true, 0x45732000},
+		{"inf", true, 0x7f800000},
+		{"-nan", true, 0xffc00000},
+		{"nan:0x200000", true, 0x7fa00000},
+		{"1_000.0", false, 0x408f400000000000},
+		{"-0x1.fffffffffffffp+1023", false, 0xffefffffffffffff},
+		{"nan:0x4000000000000", false, 0x7ff4000000000000},
+	}
+
+	for _, test := range tests { // Iterate through tests
+		bits, err := parseFloat(test.literal, test.single) // Parse literal
+
+		if err != nil { // Check for errors
+			t.Fatalf("%s: %s", test.literal, err) // Panic
+		}
+
+		if bits != test.bits { // Check bits
+			t.Fatalf("%s: expected 0x%x, got 0x%x", test.literal, test.bits, bits) // Panic
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package wast
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/SummerCash/ursa/vm"
+)
+
+// scriptResolver - resolves imports from the spectest host module and registered script modules
+type scriptResolver struct {
+	runner *Runner // Owning runner
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// ResolveFunc - resolve a function import (panics if unlinkable)
+func (resolver *scriptResolver) ResolveFunc(module, field string) vm.FunctionImport {
+	if module == "spectest" { // Check is spectest host module
+		switch field { // Handle print functions
+		case "print", "print_i32", "print_i64", "print_f32", "print_f64", "print_i32_f32", "print_f64_f64":
+			return func(machine *vm.VirtualMachine) int64 {
+				return 0 // Discard output
+			}
+		}
+
+		panic(fmt.Errorf("unknown import spectest.%s", field)) // Panic
+	}
+
+	target, ok := resolver.runner.registered[module] // Get registered module
+
+	if !ok { // Check registered
+		panic(fmt.Errorf("unknown import module %q", module)) // Panic
+	}
+
+	id, ok := target.GetFunctionExport(field) // Get function
+
+	if !ok { // Check exported
+		panic(fmt.Errorf("unknown import %s.%s", module, field)) // Panic
+	}
+
+	return func(machine *vm.VirtualMachine) int64 {
+		frame := machine.GetCurrentFrame()         // Get import frame
+		params := make([]int64, len(frame.Locals)) // Init param buffer
+		copy(params, frame.Locals)                 // Copy params
+
+		ret, err := call(target, id, params...) // Call into registered module
+
+		if err != nil { // Check for errors
+			panic(err) // Propagate trap
+		}
+
+		return ret // Return result
+	}
+}
+
+// ResolveGlobal - resolve a global import (panics if unlinkable)
+func (resolver *scriptResolver) ResolveGlobal(module, field string) int64 {
+	if module == "spectest" { // Check is spectest host module
+		switch field { // Handle globals
+		case "global_i32", "global_i64":
+			return 666 // Return spectest value
+		case "global_f32":
+			return int64(math.Float32bits(666)) // Return spectest value
+		case "global_f64":
+			return int64(math.Float64bits(666)) // Return spectest value
+		}
+
+		panic(fmt.Errorf("unknown import spectest.%s", field)) // Panic
+	}
+
+	target, ok := resolver.runner.registered[module] // Get registered module
+
+	if !ok { // Check registered
+		panic(fmt.Errorf("unknown import module %q", module)) // Panic
+	}
+
+	index, ok := target.GetGlobalExport(field) // Get global
+
+	if !ok { // Check exported
+		panic(fmt.Errorf("unknown import %s.%s", module, field)) // Panic
+	}
+
+	return target.Globals[index] // Return value
+}
+
+/* END EXPORTED METHODS */
@@ -0,0 +1,438 @@
+package wast
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+
+	"github.com/SummerCash/ursa/common"
+	"github.com/SummerCash/ursa/compiler"
+	"github.com/SummerCash/ursa/vm"
+	"github.com/SummerCash/wagon/wasm"
+)
+
+var (
+	// ErrNoModule - describes an error regarding an action issued before any module was defined
+	ErrNoModule = errors.New("no module defined")
+
+	// ErrUnknownExport - describes an error regarding an action naming a missing export
+	ErrUnknownExport = errors.New("unknown export")
+
+	// ErrUnexpectedResult - describes an error regarding an action that returned a value other than the expected one
+	ErrUnexpectedResult = errors.New("unexpected result")
+
+	// ErrExpectedTrap - describes an error regarding an action or module that was expected to trap but did not
+	ErrExpectedTrap = errors.New("expected trap")
+
+	// ErrUnexpectedTrap - describes an error regarding an action or module that trapped with a different trap than expected
+	ErrUnexpectedTrap = errors.New("unexpected trap")
+
+	// ErrUnknownTrapMessage - describes an error regarding an assert_trap message naming no known trap
+	ErrUnknownTrapMessage = errors.New("unknown trap message")
+
+	// ErrExpectedFailure - describes an error regarding a module that was expected to be rejected but was accepted
+	ErrExpectedFailure = errors.New("expected module to be rejected")
+
+	// errSkipped - marks a directive the runner does not support
+	errSkipped = errors.New("skipped")
+
+	// trapMessages - trap kinds by the messages spec scripts expect of them (across suite versions)
+	trapMessages = []struct {
+		message string      // Spec message
+		kind    vm.TrapKind // Trap kind
+	}{
+		{"unreachable", vm.TrapUnreachable},
+		{"integer divide by zero", vm.TrapIntegerDivideByZero},
+		{"integer overflow", vm.TrapIntegerOverflow},
+		{"invalid conversion to integer", vm.TrapInvalidConversion},
+		{"out of bounds memory access", vm.TrapOutOfBoundsMemory},
+		{"undefined element", vm.TrapUndefinedElement},
+		{"uninitialized element", vm.TrapUndefinedElement},
+		{"indirect call type mismatch", vm.TrapIndirectCallTypeMismatch},
+		{"indirect call signature mismatch", vm.TrapIndirectCallTypeMismatch},
+		{"call stack exhausted", vm.TrapCallStackExhausted},
+	}
+)
+
+// Result - outcome of a single script directive
+type Result struct {
+	Line      int    // Source line of the directive
+	Directive string // Directive keyword (e.g. assert_return)
+
+	Passed  bool  // Directive passed
+	Skipped bool  // Directive not supported by the runner
+	Err     error // Failure reason (nil if passed or skipped)
+}
+
+// Runner - .wast script interpreter running modules on the ursa VM
+type Runner struct {
+	Environment vm.Environment     // VM config used for every instantiated module
+	GasPolicy   compiler.GasPolicy // Gas policy used for every instantiated module
+
+	current    *vm.VirtualMachine            // Most recently defined module
+	named      map[string]*vm.VirtualMachine // Modules by $name
+	registered map[string]*vm.VirtualMachine // Modules by registered import name
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// NewRunner - initialize a script runner with the given VM config
+func NewRunner(environment vm.Environment) *Runner {
+	return &Runner{
+		Environment: environment,
+		named:       make(map[string]*vm.VirtualMachine),
+		registered:  make(map[string]*vm.VirtualMachine),
+	} // Return initialized runner
+}
+
+// DefaultEnvironment - get the VM config used for spec scripts
+func DefaultEnvironment() vm.Environment {
+	return vm.Environment{
+		MaxMemoryPages:     1024,
+		MaxTableSize:       1024,
+		MaxValueSlots:      4096,
+		MaxCallStackDepth:  512,
+		DefaultMemoryPages: 1,
+		DefaultTableSize:   10,
+		StateStore:         vm.StateStoreMemory,
+	} // Return config
+}
+
+// RunFile - run the .wast script at the given path with the default environment
+func RunFile(path string) ([]Result, error) {
+	source, err := ioutil.ReadFile(path) // Read script
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	return NewRunner(DefaultEnvironment()).Run(source) // Run script
+}
+
+// Run - run every directive in the given script source, returning one result per directive
+func (runner *Runner) Run(source []byte) ([]Result, error) {
+	nodes, err := ParseSExprs(source) // Parse script
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	results := make([]Result, len(nodes)) // Init result buffer
+
+	for i, node := range nodes { // Iterate through directives
+		results[i] = runner.runDirective(node) // Run directive
+	}
+
+	return results, nil // Return results
+}
+
+// String - get string representation of result
+func (result Result) String() string {
+	switch {
+	case result.Skipped:
+		return fmt.Sprintf("line %d: %s: skipped", result.Line, result.Directive) // Return skipped
+	case result.Passed:
+		return fmt.Sprintf("line %d: %s: ok", result.Line, result.Directive) // Return passed
+	default:
+		return fmt.Sprintf("line %d: %s: %v", result.Line, result.Directive, result.Err) // Return failed
+	}
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// runDirective - run a single top-level script directive
+func (runner *Runner) runDirective(node *Node) Result {
+	result := Result{Line: node.Line, Directive: node.Head()} // Init result
+
+	result.Err = runner.directive(node) // Run directive
+
+	if result.Err == errSkipped { // Check unsupported
+		result.Err = nil      // Reset error
+		result.Skipped = true // Set skipped
+	} else {
+		result.Passed = result.Err == nil // Set passed
+	}
+
+	return result // Return result
+}
+
+// directive - run a single top-level script directive
+func (runner *Runner) directive(node *Node) error {
+	args := []*Node{} // Init argument buffer
+
+	if node.IsList && len(node.List) > 1 { // Check has arguments
+		args = node.List[1:] // Set arguments
+	}
+
+	switch node.Head() { // Handle directives
+	case "module":
+		return runner.define(node) // Define module
+	case "register":
+		if len(args) == 0 || !args[0].IsString { // Check well formed
+			return malformed(node, "expected registration name") // Return error
+		}
+
+		machine := runner.current // Get current module
+
+		if len(args) > 1 { // Check explicit module
+			machine = runner.named[args[1].Atom] // Set module
+		}
+
+		if machine == nil { // Check defined
+			return ErrNoModule // Return error
+		}
+
+		runner.registered[args[0].Atom] = machine // Register module
+	case "invoke", "get":
+		_, err := runner.perform(node) // Perform action
+
+		return err // Return error
+	case "assert_return", "assert_return_canonical_nan", "assert_return_arithmetic_nan":
+		if len(args) == 0 { // Check well formed
+			return malformed(node, "expected action") // Return error
+		}
+
+		ret, err := runner.perform(args[0]) // Perform action
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if node.Head() != "assert_return" { // Check legacy NaN assertion
+			action, _ := ParseAction(args[0]) // Get action
+
+			return runner.expectNaN(ret, action, node.Head()) // Check NaN
+		}
+
+		if len(args) == 1 { // Check no result expected
+			return nil // Passed
+		}
+
+		expected, err := ParseValue(args[1]) // Parse expected result
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if !expected.Matches(ret) { // Check result
+			return fmt.Errorf("%w: got %s, want %s", ErrUnexpectedResult, formatBits(expected.Type, uint64(ret)), expected) // Return error
+		}
+	case "assert_trap", "assert_exhaustion":
+		if len(args) == 0 { // Check well formed
+			return malformed(node, "expected action") // Return error
+		}
+
+		var err error // Init error buffer
+
+		if args[0].Head() == "module" { // Check is module trap (start function)
+			err = runner.define(args[0]) // Define module
+		} else {
+			_, err = runner.perform(args[0]) // Perform action
+		}
+
+		if err == nil { // Check trapped
+			return ErrExpectedTrap // Return error
+		}
+
+		if errors.Is(err, ErrUnknownExport) || errors.Is(err, ErrNoModule) || errors.Is(err, ErrMalformedAction) || errors.Is(err, ErrMalformedValue) { // Check failed for reasons other than a trap
+			return err // Return found error
+		}
+
+		kind := vm.TrapCallStackExhausted // Init expected kind (exhaustion)
+
+		if node.Head() == "assert_trap" { // Check expects a specific trap
+			if len(args) < 2 || !args[1].IsString { // Check has message
+				return malformed(node, "expected trap message") // Return error
+			}
+
+			var ok bool // Init found buffer
+
+			if kind, ok = trapKind(args[1].Atom); !ok { // Get expected kind
+				return fmt.Errorf("%w %q", ErrUnknownTrapMessage, args[1].Atom) // Return error
+			}
+		}
+
+		if !errors.Is(err, kind) { // Check trapped as expected
+			return fmt.Errorf("%w: got %v, want %v", ErrUnexpectedTrap, err, kind) // Return error
+		}
+	case "assert_invalid":
+		if len(args) == 0 || args[0].Head() != "module" { // Check well formed
+			return malformed(node, "expected module") // Return error
+		}
+
+		_, code, err := moduleBinary(args[0]) // Encode module
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if _, err = compiler.LoadModule(code); err == nil { // Check rejected
+			return ErrExpectedFailure // Return error
+		}
+	case "assert_malformed":
+		if len(args) == 0 || args[0].Head() != "module" { // Check well formed
+			return malformed(node, "expected module") // Return error
+		}
+
+		_, code, err := moduleBinary(args[0]) // Encode module
+
+		if err != nil { // Check rejected by text format
+			return nil // Passed
+		}
+
+		if _, err = compiler.LoadModule(code); err == nil { // Check rejected by binary format
+			return ErrExpectedFailure // Return error
+		}
+	case "assert_unlinkable":
+		if len(args) == 0 || args[0].Head() != "module" { // Check well formed
+			return malformed(node, "expected module") // Return error
+		}
+
+		_, code, err := moduleBinary(args[0]) // Encode module
+
+		if err != nil { // Check for errors
+			return err // Return found error
+		}
+
+		if _, err = runner.instantiate(code); err == nil { // Check rejected
+			return ErrExpectedFailure // Return error
+		}
+	default:
+		return errSkipped // Unsupported directive
+	}
+
+	return nil // No error occurred, return nil
+}
+
+// define - instantiate a (module ...) directive and make it the current module
+func (runner *Runner) define(node *Node) error {
+	name, code, err := moduleBinary(node) // Encode module
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	machine, err := runner.instantiate(code) // Instantiate module
+
+	if err != nil { // Check for errors
+		return err // Return found error
+	}
+
+	runner.current = machine // Set current
+
+	if name != "" { // Check named
+		runner.named[name] = machine // Set name
+	}
+
+	return nil // No error occurred, return nil
+}
+
+// instantiate - compile a module, resolve its imports and run its start function
+func (runner *Runner) instantiate(code []byte) (*vm.VirtualMachine, error) {
+	machine, err := vm.NewVirtualMachine(code, runner.Environment, &scriptResolver{runner: runner}, runner.GasPolicy) // Init VM
+
+	if err != nil { // Check for errors
+		return nil, err // Return found error
+	}
+
+	if start := machine.Module.Base.Start; start != nil { // Check has start function
+		if _, err = call(machine, int(start.Index)); err != nil { // Run start function
+			return nil, err // Return found error
+		}
+	}
+
+	return machine, nil // Return initialized VM
+}
+
+// perform - perform an invoke or get action, returning the raw result
+func (runner *Runner) perform(node *Node) (int64, error) {
+	action, err := ParseAction(node) // Parse action
+
+	if err != nil { // Check for errors
+		return 0, err // Return found error
+	}
+
+	machine := runner.current // Get current module
+
+	if action.Module != "" { // Check explicit module
+		machine = runner.named[action.Module] // Set module
+	}
+
+	if machine == nil { // Check defined
+		return 0, ErrNoModule // Return error
+	}
+
+	if action.Kind == "get" { // Check is get
+		index, ok := machine.GetGlobalExport(action.Field) // Get global
+
+		if !ok { // Check exists
+			return 0, fmt.Errorf("%w %q", ErrUnknownExport, action.Field) // Return error
+		}
+
+		return machine.Globals[index], nil // Return value
+	}
+
+	id, ok := machine.GetFunctionExport(action.Field) // Get function
+
+	if !ok { // Check exists
+		return 0, fmt.Errorf("%w %q", ErrUnknownExport, action.Field) // Return error
+	}
+
+	params := make([]int64, len(action.Args)) // Init param buffer
+
+	for i, arg := range action.Args { // Iterate through arguments
+		params[i] = arg.Int64() // Set param
+	}
+
+	return call(machine, id, params...) // Call function
+}
+
+// expectNaN - check a legacy assert_return_*_nan result
+func (runner *Runner) expectNaN(ret int64, action *Action, directive string) error {
+	class := "canonical" // Init NaN class
+
+	if directive == "assert_return_arithmetic_nan" { // Check is arithmetic
+		class = "arithmetic" // Set class
+	}
+
+	f32, f64 := Value{Type: wasm.ValueTypeF32, NaN: class}, Value{Type: wasm.ValueTypeF64, NaN: class} // Init patterns
+
+	if f32.Matches(ret) && uint64(ret)>>32 == 0 || f64.Matches(ret) { // Check either width matches
+		return nil // Passed
+	}
+
+	return fmt.Errorf("%w: got 0x%x (%v), want nan:%s", ErrUnexpectedResult, uint64(ret), math.Float64frombits(uint64(ret)), class) // Return error
+}
+
+// trapKind - get the trap kind of a spec trap message. Spec scripts may give only a prefix of the
+// message (e.g. "undefined"), and newer suites extend older messages (e.g. "unreachable executed").
+func trapKind(message string) (vm.TrapKind, bool) {
+	for _, trap := range trapMessages { // Iterate through known messages
+		if message != "" && (strings.HasPrefix(trap.message, message) || strings.HasPrefix(message, trap.message)) { // Check matches
+			return trap.kind, true // Return kind
+		}
+	}
+
+	return vm.TrapUnknown, false // Unknown message
+}
+
+// call - run a function to completion, restoring the VM to an idle state if it traps
+func call(machine *vm.VirtualMachine, id int, params ...int64) (ret int64, retErr error) {
+	defer func() {
+		if r := recover(); r != nil { // Check for panic outside execute (e.g. param mismatch)
+			retErr = common.UnifyError(r) // Set error
+		}
+
+		if retErr != nil { // Check trapped
+			machine.Reset() // Return to idle state
+		}
+	}()
+
+	return machine.Run(id, params...) // Run function
+}
+
+/* END INTERNAL METHODS */
@@ -0,0 +1,189 @@
+package wast
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// coreScripts - scripts of the official core test suite (test/core of github.com/WebAssembly/spec)
+// the VM must be checked against
+var coreScripts = []string{"i32", "i64", "f32", "f64", "memory", "call", "call_indirect", "func", "br_table", "conversions"}
+
+// TestRunSpecScripts - run every vendored .wast script, reporting each failed directive that is not a known failure
+func TestRunSpecScripts(t *testing.T) {
+	files, err := filepath.Glob(filepath.FromSlash("testdata/*.wast")) // Get scripts
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if len(files) == 0 { // Check has scripts
+		t.Fatal("no spec scripts found") // Panic
+	}
+
+	runSpecScripts(t, "testdata", files) // Run scripts
+}
+
+// TestRunCoreSpecScripts - run the official core test suite vendored in testdata/core (or found in
+// $URSA_SPEC_DIR), reporting each failed directive that is not a known failure
+func TestRunCoreSpecScripts(t *testing.T) {
+	dir := os.Getenv("URSA_SPEC_DIR") // Get suite dir
+
+	if dir == "" { // Check no suite given
+		dir = filepath.FromSlash("testdata/core") // Use vendored suite
+
+		if _, err := os.Stat(filepath.Join(dir, coreScripts[0]+".wast")); os.IsNotExist(err) { // Check suite vendored
+			t.Skip("official core scripts are not vendored yet, see testdata/core/README.md") // Skip
+		}
+	}
+
+	files := make([]string, len(coreScripts)) // Init script buffer
+
+	for i, script := range coreScripts { // Iterate through required scripts
+		files[i] = filepath.Join(dir, script+".wast") // Set path
+
+		if _, err := os.Stat(files[i]); err != nil { // Check exists
+			t.Fatal(err) // Panic
+		}
+	}
+
+	runSpecScripts(t, "core", files) // Run scripts
+}
+
+// runSpecScripts - run the given scripts of a suite, failing on directives that fail without being listed
+// in testdata/known_failures.txt, and on listed directives that pass
+func runSpecScripts(t *testing.T, suite string, files []string) {
+	known := readKnownFailures(t) // Read known failures
+
+	for _, file := range files { // Iterate through scripts
+		results, err := RunFile(file) // Run script
+
+		if err != nil { // Check for errors
+			t.Fatalf("%s: %s", file, err) // Panic
+		}
+
+		passed, expected := 0, 0 // Init passed and known failure counts
+
+		for _, result := range results { // Iterate through results
+			key := fmt.Sprintf("%s/%s:%d", suite, filepath.Base(file), result.Line) // Get known failure key
+
+			_, isKnown := known[key] // Check known failure
+
+			switch {
+			case result.Passed && isKnown:
+				t.Errorf("%s: %s: known failure passes, remove it from testdata/known_failures.txt", key, result.Directive) // Log stale entry
+			case result.Passed:
+				passed++ // Increment passed
+			case result.Skipped:
+			case isKnown:
+				expected++ // Increment known failures
+			default:
+				t.Errorf("%s: %s", file, result) // Log failure
+			}
+		}
+
+		t.Logf("%s: %d/%d directives passed, %d known failures", file, passed, len(results), expected) // Log summary
+	}
+}
+
+// readKnownFailures - read testdata/known_failures.txt, mapping <suite>/<script>:<line> to the reason the directive fails
+func readKnownFailures(t *testing.T) map[string]string {
+	source, err := ioutil.ReadFile(filepath.FromSlash("testdata/known_failures.txt")) // Read known failures
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	known := make(map[string]string) // Init known failure buffer
+
+	for i, line := range strings.Split(string(source), "\n") { // Iterate through lines
+		line = strings.TrimSpace(line) // Trim line
+
+		if line == "" || strings.HasPrefix(line, "#") { // Check is comment
+			continue // Skip
+		}
+
+		fields := strings.SplitN(line, " ", 2) // Split key and reason
+
+		if len(fields) != 2 || strings.TrimSpace(fields[1]) == "" { // Check has reason
+			t.Fatalf("known_failures.txt:%d: expected <suite>/<script>:<line> <reason>", i+1) // Panic
+		}
+
+		known[fields[0]] = strings.TrimSpace(fields[1]) // Set reason
+	}
+
+	return known // Return known failures
+}
+
+// TestRunnerChecksTraps - test trap assertions pass only when the action traps with the expected kind
+func TestRunnerChecksTraps(t *testing.T) {
+	results, err := NewRunner(DefaultEnvironment()).Run([]byte(`
+		(module
+			(func (export "crash") (unreachable))
+			(func (export "div") (param i32) (result i32) (i32.div_u (i32.const 1) (get_local 0)))
+			(func $loop (export "runaway") (call $loop))
+		)
+		(assert_trap (invoke "crash") "unreachable")
+		(assert_trap (invoke "crash") "unreachable executed")
+		(assert_trap (invoke "div" (i32.const 0)) "integer divide by zero")
+		(assert_trap (invoke "div" (i32.const 0)) "integer overflow")
+		(assert_trap (invoke "crash") "out of bounds memory access")
+		(assert_trap (invoke "crash") "not a trap")
+		(assert_trap (invoke "crash"))
+		(assert_exhaustion (invoke "runaway") "call stack exhausted")
+		(assert_exhaustion (invoke "crash") "call stack exhausted")
+	`)) // Run script
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	expected := []error{nil, nil, nil, nil, ErrUnexpectedTrap, ErrUnexpectedTrap, ErrUnknownTrapMessage, ErrMalformedModule, nil, ErrUnexpectedTrap} // Init expected errors
+
+	if len(results) != len(expected) { // Check result count
+		t.Fatalf("expected %d results, got %d", len(expected), len(results)) // Panic
+	}
+
+	for i, result := range results { // Iterate through results
+		if expected[i] == nil && !result.Passed || expected[i] != nil && !errors.Is(result.Err, expected[i]) { // Check outcome
+			t.Fatalf("directive %d: expected %v, got %s", i, expected[i], result) // Panic
+		}
+	}
+}
+
+// TestRunnerReportsFailures - test failing directives are reported rather than aborting the script
+func TestRunnerReportsFailures(t *testing.T) {
+	results, err := NewRunner(DefaultEnvironment()).Run([]byte(`
+		(module (func (export "one") (result i32) (i32.const 1)))
+		(assert_return (invoke "one") (i32.const 2))
+		(assert_trap (invoke "one") "unreachable")
+		(assert_invalid (module (func)) "nothing wrong")
+		(assert_return (invoke "missing"))
+		(assert_soft_invalid (module) "unsupported")
+		(assert_return (invoke "one") (i32.const 1))
+	`)) // Run script
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	expected := []struct {
+		passed  bool
+		skipped bool
+	}{{true, false}, {false, false}, {false, false}, {false, false}, {false, false}, {false, true}, {true, false}} // Init expected outcomes
+
+	if len(results) != len(expected) { // Check result count
+		t.Fatalf("expected %d results, got %d", len(expected), len(results)) // Panic
+	}
+
+	for i, result := range results { // Iterate through results
+		if result.Passed != expected[i].passed || result.Skipped != expected[i].skipped { // Check outcome
+			t.Fatalf("directive %d: unexpected result %s", i, result) // Panic
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package wast
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/SummerCash/wagon/wasm"
+	ops "github.com/SummerCash/wagon/wasm/operators"
+)
+
+var (
+	// ErrMalformedAction - describes an error regarding an invoke/get action that does not follow the script grammar
+	ErrMalformedAction = errors.New("malformed action")
+
+	// ErrMalformedValue - describes an error regarding a constant that does not follow the script grammar
+	ErrMalformedValue = errors.New("malformed value")
+)
+
+// Value - typed WebAssembly constant (or NaN pattern for expected results)
+type Value struct {
+	Type wasm.ValueType // Value type
+	Bits uint64         // Raw bits (floats as IEEE 754 bit patterns)
+
+	NaN string // Expected NaN class ("canonical" or "arithmetic"); empty for exact values
+}
+
+// Action - invoke or get action
+type Action struct {
+	Kind   string  // "invoke" or "get"
+	Module string  // Module $name (empty for the current module)
+	Field  string  // Export name
+	Args   []Value // Invocation arguments
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// ParseAction - parse an (invoke $M? "name" const*) or (get $M? "name") node
+func ParseAction(node *Node) (*Action, error) {
+	head := node.Head() // Get head
+
+	if head != "invoke" && head != "get" { // Check is action
+		return nil, fmt.Errorf("line %d: %w: expected invoke or get", node.Line, ErrMalformedAction) // Return error
+	}
+
+	action := &Action{Kind: head} // Init action
+	rest := node.List[1:]         // Get contents
+
+	if len(rest) > 0 && rest[0].IsID() { // Check explicit module
+		action.Module = rest[0].Atom // Set module
+		rest = rest[1:]              // Skip module
+	}
+
+	if len(rest) == 0 || !rest[0].IsString { // Check has name
+		return nil, fmt.Errorf("line %d: %w: expected export name", node.Line, ErrMalformedAction) // Return error
+	}
+
+	action.Field = rest[0].Atom // Set name
+
+	for _, arg := range rest[1:] { // Iterate through arguments
+		value, err := ParseValue(arg) // Parse argument
+
+		if err != nil { // Check for errors
+			return nil, err // Return found error
+		}
+
+		action.Args = append(action.Args, value) // Append argument
+	}
+
+	if head == "get" && len(action.Args) != 0 { // Check get has no arguments
+		return nil, fmt.Errorf("line %d: %w: get takes no arguments", node.Line, ErrMalformedAction) // Return error
+	}
+
+	return action, nil // Return action
+}
+
+// ParseValue - parse a (t.const literal) node, accepting nan:canonical and nan:arithmetic for floats
+func ParseValue(node *Node) (Value, error) {
+	if len(node.List) != 2 || node.List[1].IsList { // Check well formed
+		return Value{}, fmt.Errorf("line %d: %w: expected (t.const value)", node.Line, ErrMalformedValue) // Return error
+	}
+
+	code, ok := map[string]byte{
+		"i32.const": ops.I32Const,
+		"i64.const": ops.I64Const,
+		"f32.const": ops.F32Const,
+		"f64.const": ops.F64Const,
+	}[node.Head()] // Get opcode
+
+	if !ok { // Check known
+		return Value{}, fmt.Errorf("line %d: %w: unknown constant %s", node.Line, ErrMalformedValue, node.Head()) // Return error
+	}
+
+	value := Value{Type: [...]wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI64, wasm.ValueTypeF32, wasm.ValueTypeF64}[code-ops.I32Const]} // Init value
+
+	literal := node.List[1].Atom // Get literal
+
+	if (code == ops.F32Const || code == ops.F64Const) && (literal == "nan:canonical" || literal == "nan:arithmetic") { // Check NaN pattern
+		value.NaN = strings.TrimPrefix(literal, "nan:") // Set pattern
+
+		return value, nil // Return pattern
+	}
+
+	bits, err := parseConst(code, literal) // Parse literal
+
+	if err != nil { // Check for errors
+		return Value{}, fmt.Errorf("line %d: %w: %v", node.Line, ErrMalformedValue, err) // Return error
+	}
+
+	value.Bits = bits // Set bits
+
+	return value, nil // Return value
+}
+
+// Int64 - get value in the VM's int64 register representation
+func (value Value) Int64() int64 {
+	if value.Type == wasm.ValueTypeI32 || value.Type == wasm.ValueTypeF32 { // Check is 32-bit
+		return int64(uint32(value.Bits)) // Return zero-extended bits
+	}
+
+	return int64(value.Bits) // Return bits
+}
+
+// Matches - check an int64 register value satisfies this (expected) value
+func (value Value) Matches(ret int64) bool {
+	switch value.Type { // Handle types
+	case wasm.ValueTypeI32:
+		return uint32(ret) == uint32(value.Bits) // Compare low bits
+	case wasm.ValueTypeI64:
+		return uint64(ret) == value.Bits // Compare bits
+	case wasm.ValueTypeF32:
+		bits := uint32(ret) // Get bits
+
+		switch value.NaN { // Handle NaN patterns
+		case "canonical":
+			return bits&0x7fffffff == 0x7fc00000 // Check canonical NaN
+		case "arithmetic":
+			return bits&0x7fc00000 == 0x7fc00000 // Check quiet NaN
+		}
+
+		return bits == uint32(value.Bits) // Compare bits
+	default:
+		bits := uint64(ret) // Get bits
+
+		switch value.NaN { // Handle NaN patterns
+		case "canonical":
+			return bits&0x7fffffffffffffff == 0x7ff8000000000000 // Check canonical NaN
+		case "arithmetic":
+			return bits&0x7ff8000000000000 == 0x7ff8000000000000 // Check quiet NaN
+		}
+
+		return bits == value.Bits // Compare bits
+	}
+}
+
+// String - get script-like string representation of value
+func (value Value) String() string {
+	name := map[wasm.ValueType]string{wasm.ValueTypeI32: "i32", wasm.ValueTypeI64: "i64", wasm.ValueTypeF32: "f32", wasm.ValueTypeF64: "f64"}[value.Type] // Get type name
+
+	if value.NaN != "" { // Check NaN pattern
+		return fmt.Sprintf("(%s.const nan:%s)", name, value.NaN) // Return pattern
+	}
+
+	return fmt.Sprintf("(%s.const %s)", name, formatBits(value.Type, value.Bits)) // Return value
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// formatBits - format raw bits of the given type for diagnostics
+func formatBits(t wasm.ValueType, bits uint64) string {
+	switch t { // Handle types
+	case wasm.ValueTypeI32:
+		return fmt.Sprintf("%d", int32(bits)) // Return signed
+	case wasm.ValueTypeI64:
+		return fmt.Sprintf("%d", int64(bits)) // Return signed
+	case wasm.ValueTypeF32:
+		return fmt.Sprintf("%v (0x%08x)", math.Float32frombits(uint32(bits)), uint32(bits)) // Return float, bits
+	default:
+		return fmt.Sprintf("%v (0x%016x)", math.Float64frombits(bits), bits) // Return float, bits
+	}
+}
+
+// moduleBinary - get the binary encoding of a (module ...) node (text, binary or quote form)
+func moduleBinary(node *Node) (name string, code []byte, err error) {
+	rest := node.List[1:] // Get contents
+
+	if len(rest) > 0 && rest[0].IsID() { // Check named
+		name = rest[0].Atom // Set name
+		rest = rest[1:]     // Skip name
+	}
+
+	if len(rest) > 0 && !rest[0].IsList && (rest[0].Atom == "binary" || rest[0].Atom == "quote") { // Check string form
+		var buf []byte // Init buffer
+
+		for _, n := range rest[1:] { // Iterate through strings
+			if !n.IsString { // Check is string
+				return name, nil, malformed(n, "expected string") // Return error
+			}
+
+			buf = append(buf, n.Atom...) // Append string
+		}
+
+		if rest[0].Atom == "binary" { // Check is binary
+			return name, buf, nil // Return bytes
+		}
+
+		nodes, err := ParseSExprs(append(append([]byte("(module "), buf...), ')')) // Parse quoted text
+
+		if err != nil { // Check for errors
+			return name, nil, err // Return found error
+		}
+
+		code, err = AssembleModule(nodes[0]) // Assemble quoted text
+
+		return name, code, err // Return encoded module
+	}
+
+	code, err = AssembleModule(node) // Assemble text
+
+	return name, code, err // Return encoded module
+}
+
+/* END INTERNAL METHODS */
@@ -0,0 +1,305 @@
+package wast
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrUnexpectedEOF - describes an error regarding an unterminated list, string or comment
+	ErrUnexpectedEOF = errors.New("unexpected end of script")
+
+	// ErrUnexpectedParen - describes an error regarding a closing paren without a matching open paren
+	ErrUnexpectedParen = errors.New("unexpected )")
+)
+
+// Node - s-expression node (either an atom or a list)
+type Node struct {
+	Atom     string  // Atom text (decoded bytes for string literals)
+	IsString bool    // Atom is a string literal
+	IsList   bool    // Node is a list
+	List     []*Node // List children
+	Line     int     // Source line
+}
+
+/* BEGIN EXPORTED METHODS */
+
+// ParseSExprs - parse all top-level s-expressions in the given source
+func ParseSExprs(source []byte) ([]*Node, error) {
+	p := &sexprParser{source: source, line: 1} // Init parser
+
+	nodes := []*Node{} // Init node buffer
+
+	for { // Iterate
+		node, err := p.next() // Read node
+
+		if err != nil { // Check for errors
+			return nil, err // Return found error
+		}
+
+		if node == nil { // Check done
+			break // Break
+		}
+
+		if node.closing { // Check unmatched paren
+			return nil, fmt.Errorf("line %d: %w", p.line, ErrUnexpectedParen) // Return error
+		}
+
+		nodes = append(nodes, &node.Node) // Append node
+	}
+
+	return nodes, nil // Return parsed nodes
+}
+
+// Head - get leading keyword of list (empty if not a list or headless)
+func (node *Node) Head() string {
+	if !node.IsList || len(node.List) == 0 || node.List[0].IsList || node.List[0].IsString { // Check has keyword head
+		return ""
+	}
+
+	return node.List[0].Atom // Return head
+}
+
+// IsID - check node is a symbolic identifier ($name)
+func (node *Node) IsID() bool {
+	return !node.IsList && !node.IsString && strings.HasPrefix(node.Atom, "$") // Check is identifier
+}
+
+// String - get source-like string representation of node
+func (node *Node) String() string {
+	if node.IsString { // Check is string
+		return strconv.Quote(node.Atom) // Return quoted
+	}
+
+	if !node.IsList { // Check is atom
+		return node.Atom // Return atom
+	}
+
+	parts := make([]string, len(node.List)) // Init part buffer
+
+	for i, child := range node.List { // Iterate through children
+		parts[i] = child.String() // Set part
+	}
+
+	return "(" + strings.Join(parts, " ") + ")" // Return list
+}
+
+/* END EXPORTED METHODS */
+
+/* BEGIN INTERNAL METHODS */
+
+// sexprParser - s-expression tokenizer state
+type sexprParser struct {
+	source []byte // Source text
+	pos    int    // Read position
+	line   int    // Current line
+}
+
+// parsedNode - node with a marker for an unmatched closing paren
+type parsedNode struct {
+	Node
+
+	closing bool // Node is a closing paren
+}
+
+// next - read the next node (nil at end of input)
+func (p *sexprParser) next() (*parsedNode, error) {
+	if err := p.skipSpace(); err != nil { // Skip whitespace, comments
+		return nil, err // Return found error
+	}
+
+	if p.pos >= len(p.source) { // Check done
+		return nil, nil // Return end
+	}
+
+	line := p.line // Get line
+
+	switch p.source[p.pos] { // Handle token types
+	case '(':
+		p.pos++ // Skip paren
+
+		list := &parsedNode{Node: Node{IsList: true, List: []*Node{}, Line: line}} // Init list
+
+		for { // Iterate through children
+			child, err := p.next() // Read child
+
+			if err != nil { // Check for errors
+				return nil, err // Return found error
+			}
+
+			if child == nil { // Check unterminated
+				return nil, fmt.Errorf("line %d: %w", line, ErrUnexpectedEOF) // Return error
+			}
+
+			if child.closing { // Check list done
+				return list, nil // Return list
+			}
+
+			list.List = append(list.List, &child.Node) // Append child
+		}
+	case ')':
+		p.pos++ // Skip paren
+
+		return &parsedNode{closing: true}, nil // Return closing marker
+	case '"':
+		str, err := p.readString() // Read string
+
+		if err != nil { // Check for errors
+			return nil, fmt.Errorf("line %d: %v", line, err) // Return error
+		}
+
+		return &parsedNode{Node: Node{Atom: str, IsString: true, Line: line}}, nil // Return string
+	default:
+		start := p.pos // Get atom start
+
+		for p.pos < len(p.source) && !isDelimiter(p.source[p.pos]) { // Read until delimiter
+			p.pos++ // Increment position
+		}
+
+		return &parsedNode{Node: Node{Atom: string(p.source[start:p.pos]), Line: line}}, nil // Return atom
+	}
+}
+
+// skipSpace - skip whitespace, line comments and (nested) block comments
+func (p *sexprParser) skipSpace() error {
+	for p.pos < len(p.source) { // Iterate
+		c := p.source[p.pos] // Get char
+
+		switch {
+		case c == '\n':
+			p.line++ // Increment line
+			p.pos++  // Increment position
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++ // Increment position
+		case c == ';' && p.peek(1) == ';':
+			for p.pos < len(p.source) && p.source[p.pos] != '\n' { // Skip to end of line
+				p.pos++ // Increment position
+			}
+		case c == '(' && p.peek(1) == ';':
+			depth := 0 // Init nesting depth
+
+			for { // Iterate through comment
+				if p.pos >= len(p.source) { // Check unterminated
+					return fmt.Errorf("line %d: %w", p.line, ErrUnexpectedEOF) // Return error
+				}
+
+				if p.source[p.pos] == '(' && p.peek(1) == ';' { // Check nested open
+					depth++    // Increment depth
+					p.pos += 2 // Skip token
+				} else if p.source[p.pos] == ';' && p.peek(1) == ')' { // Check close
+					depth--    // Decrement depth
+					p.pos += 2 // Skip token
+
+					if depth == 0 { // Check done
+						break // Break
+					}
+				} else {
+					if p.source[p.pos] == '\n' { // Check newline
+						p.line++ // Increment line
+					}
+
+					p.pos++ // Increment position
+				}
+			}
+		default:
+			return nil // Done
+		}
+	}
+
+	return nil // Done
+}
+
+// peek - get byte at offset from current position (0 if past end)
+func (p *sexprParser) peek(offset int) byte {
+	if p.pos+offset >= len(p.source) { // Check in bounds
+		return 0
+	}
+
+	return p.source[p.pos+offset] // Return byte
+}
+
+// readString - read and decode a string literal
+func (p *sexprParser) readString() (string, error) {
+	p.pos++ // Skip quote
+
+	var buf []byte // Init decoded buffer
+
+	for { // Iterate through string
+		if p.pos >= len(p.source) { // Check unterminated
+			return "", ErrUnexpectedEOF // Return error
+		}
+
+		c := p.source[p.pos] // Get char
+		p.pos++              // Increment position
+
+		switch c { // Handle special chars
+		case '"':
+			return string(buf), nil // Return decoded string
+		case '\n':
+			return "", errors.New("newline in string") // Return error
+		case '\\':
+			if p.pos >= len(p.source) { // Check unterminated
+				return "", ErrUnexpectedEOF // Return error
+			}
+
+			e := p.source[p.pos] // Get escape
+			p.pos++              // Increment position
+
+			switch e { // Handle escapes
+			case 't':
+				buf = append(buf, '\t')
+			case 'n':
+				buf = append(buf, '\n')
+			case 'r':
+				buf = append(buf, '\r')
+			case '"', '\'', '\\':
+				buf = append(buf, e)
+			case 'u':
+				end := strings.IndexByte(string(p.source[p.pos:]), '}') // Find end of code point
+
+				if p.peek(0) != '{' || end < 0 { // Check well formed
+					return "", errors.New("malformed unicode escape") // Return error
+				}
+
+				r, err := strconv.ParseUint(strings.Replace(string(p.source[p.pos+1:p.pos+end]), "_", "", -1), 16, 32) // Parse code point
+
+				if err != nil || r >= 0xd800 && r < 0xe000 || r > utf8.MaxRune { // Check valid scalar value
+					return "", errors.New("malformed unicode escape") // Return error
+				}
+
+				buf = append(buf, string(rune(r))...) // Append encoded rune
+				p.pos += end + 1                      // Skip escape
+			default:
+				if p.pos >= len(p.source) { // Check unterminated
+					return "", ErrUnexpectedEOF // Return error
+				}
+
+				b, err := strconv.ParseUint(string([]byte{e, p.source[p.pos]}), 16, 8) // Parse hex byte
+
+				if err != nil { // Check for errors
+					return "", errors.New("malformed escape") // Return error
+				}
+
+				buf = append(buf, byte(b)) // Append byte
+				p.pos++                    // Increment position
+			}
+		default:
+			buf = append(buf, c) // Append char
+		}
+	}
+}
+
+// isDelimiter - check c terminates an atom
+func isDelimiter(c byte) bool {
+	switch c { // Handle delimiters
+	case ' ', '\t', '\n', '\r', '(', ')', '"', ';':
+		return true
+	default:
+		return false
+	}
+}
+
+/* END INTERNAL METHODS */
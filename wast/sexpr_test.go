@@ -0,0 +1,37 @@
+package wast
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestParseSExprs - test functionality of s-expression parsing
+func TestParseSExprs(t *testing.T) {
+	nodes, err := ParseSExprs([]byte("(module ;; comment\n  (; block (; nested ;) ;) (func $f \"a\\n\\00\\u{263a}\"))\n(invoke \"f\")")) // Parse script
+
+	if err != nil { // Check for errors
+		t.Fatal(err) // Panic
+	}
+
+	if len(nodes) != 2 || nodes[0].Head() != "module" || nodes[1].Head() != "invoke" { // Check top-level nodes
+		t.Fatalf("unexpected nodes %v", nodes) // Panic
+	}
+
+	if nodes[1].Line != 3 { // Check line tracking
+		t.Fatalf("expected line 3, got %d", nodes[1].Line) // Panic
+	}
+
+	fn := nodes[0].List[1] // Get function
+
+	if !fn.List[1].IsID() || !fn.List[2].IsString || fn.List[2].Atom != "a\n\x00☺" { // Check identifier, decoded string
+		t.Fatalf("unexpected function node %s", fn) // Panic
+	}
+
+	if _, err = ParseSExprs([]byte("(module")); !errors.Is(err, ErrUnexpectedEOF) { // Check unterminated list
+		t.Fatalf("expected %v, got %v", ErrUnexpectedEOF, err) // Panic
+	}
+
+	if _, err = ParseSExprs([]byte("(module))")); !errors.Is(err, ErrUnexpectedParen) { // Check unmatched paren
+		t.Fatalf("expected %v, got %v", ErrUnexpectedParen, err) // Panic
+	}
+}
@@ -0,0 +1,85 @@
+;; Float/integer conversions, including the signed/unsigned truncation split
+;; and the traps required on NaN and out-of-range operands.
+
+(module
+  (func (export "i32.trunc_s/f32") (param f32) (result i32) (i32.trunc_s/f32 (get_local 0)))
+  (func (export "i32.trunc_u/f32") (param f32) (result i32) (i32.trunc_u/f32 (get_local 0)))
+  (func (export "i32.trunc_s/f64") (param f64) (result i32) (i32.trunc_s/f64 (get_local 0)))
+  (func (export "i32.trunc_u/f64") (param f64) (result i32) (i32.trunc_u/f64 (get_local 0)))
+  (func (export "i64.trunc_s/f32") (param f32) (result i64) (i64.trunc_s/f32 (get_local 0)))
+  (func (export "i64.trunc_u/f32") (param f32) (result i64) (i64.trunc_u/f32 (get_local 0)))
+  (func (export "i64.trunc_s/f64") (param f64) (result i64) (i64.trunc_s/f64 (get_local 0)))
+  (func (export "i64.trunc_u/f64") (param f64) (result i64) (i64.trunc_u/f64 (get_local 0)))
+  (func (export "f32.convert_s/i32") (param i32) (result f32) (f32.convert_s/i32 (get_local 0)))
+  (func (export "f32.convert_u/i32") (param i32) (result f32) (f32.convert_u/i32 (get_local 0)))
+  (func (export "f64.convert_s/i32") (param i32) (result f64) (f64.convert_s/i32 (get_local 0)))
+  (func (export "f64.convert_u/i32") (param i32) (result f64) (f64.convert_u/i32 (get_local 0)))
+  (func (export "f64.convert_s/i64") (param i64) (result f64) (f64.convert_s/i64 (get_local 0)))
+  (func (export "f64.convert_u/i64") (param i64) (result f64) (f64.convert_u/i64 (get_local 0)))
+  (func (export "i64.extend_s/i32") (param i32) (result i64) (i64.extend_s/i32 (get_local 0)))
+  (func (export "i64.extend_u/i32") (param i32) (result i64) (i64.extend_u/i32 (get_local 0)))
+  (func (export "i32.wrap/i64") (param i64) (result i32) (i32.wrap/i64 (get_local 0)))
+  (func (export "f32.demote/f64") (param f64) (result f32) (f32.demote/f64 (get_local 0)))
+  (func (export "f64.promote/f32") (param f32) (result f64) (f64.promote/f32 (get_local 0)))
+)
+
+(assert_return (invoke "i32.trunc_s/f32" (f32.const 0.0)) (i32.const 0))
+(assert_return (invoke "i32.trunc_s/f32" (f32.const -0.0)) (i32.const 0))
+(assert_return (invoke "i32.trunc_s/f32" (f32.const 1.5)) (i32.const 1))
+(assert_return (invoke "i32.trunc_s/f32" (f32.const -1.5)) (i32.const -1))
+(assert_return (invoke "i32.trunc_s/f32" (f32.const 2147483520.0)) (i32.const 2147483520))
+(assert_return (invoke "i32.trunc_s/f32" (f32.const -2147483648.0)) (i32.const -2147483648))
+(assert_trap (invoke "i32.trunc_s/f32" (f32.const 2147483648.0)) "integer overflow")
+(assert_trap (invoke "i32.trunc_s/f32" (f32.const -2147483904.0)) "integer overflow")
+(assert_trap (invoke "i32.trunc_s/f32" (f32.const inf)) "integer overflow")
+(assert_trap (invoke "i32.trunc_s/f32" (f32.const nan)) "invalid conversion to integer")
+
+(assert_return (invoke "i32.trunc_u/f32" (f32.const 1.5)) (i32.const 1))
+(assert_return (invoke "i32.trunc_u/f32" (f32.const -0.9)) (i32.const 0))
+(assert_return (invoke "i32.trunc_u/f32" (f32.const 2147483648.0)) (i32.const -2147483648))
+(assert_return (invoke "i32.trunc_u/f32" (f32.const 4294967040.0)) (i32.const -256))
+(assert_trap (invoke "i32.trunc_u/f32" (f32.const 4294967296.0)) "integer overflow")
+(assert_trap (invoke "i32.trunc_u/f32" (f32.const -1.0)) "integer overflow")
+(assert_trap (invoke "i32.trunc_u/f32" (f32.const -nan)) "invalid conversion to integer")
+
+(assert_return (invoke "i32.trunc_s/f64" (f64.const 2147483647.9)) (i32.const 2147483647))
+(assert_return (invoke "i32.trunc_s/f64" (f64.const -2147483648.9)) (i32.const -2147483648))
+(assert_trap (invoke "i32.trunc_s/f64" (f64.const 2147483648.0)) "integer overflow")
+(assert_trap (invoke "i32.trunc_s/f64" (f64.const -2147483649.0)) "integer overflow")
+(assert_trap (invoke "i32.trunc_s/f64" (f64.const nan:0x4000000000000)) "invalid conversion to integer")
+
+(assert_return (invoke "i32.trunc_u/f64" (f64.const 4294967295.9)) (i32.const -1))
+(assert_return (invoke "i32.trunc_u/f64" (f64.const 1e8)) (i32.const 100000000))
+(assert_trap (invoke "i32.trunc_u/f64" (f64.const 4294967296.0)) "integer overflow")
+(assert_trap (invoke "i32.trunc_u/f64" (f64.const -1.0)) "integer overflow")
+
+(assert_return (invoke "i64.trunc_s/f32" (f32.const -9223372036854775808.0)) (i64.const -9223372036854775808))
+(assert_trap (invoke "i64.trunc_s/f32" (f32.const 9223372036854775808.0)) "integer overflow")
+(assert_return (invoke "i64.trunc_u/f32" (f32.const 18446742974197923840.0)) (i64.const -1099511627776))
+(assert_trap (invoke "i64.trunc_u/f32" (f32.const 18446744073709551616.0)) "integer overflow")
+(assert_trap (invoke "i64.trunc_u/f32" (f32.const -1.0)) "integer overflow")
+
+(assert_return (invoke "i64.trunc_s/f64" (f64.const -1.9)) (i64.const -1))
+(assert_return (invoke "i64.trunc_s/f64" (f64.const 9223372036854774784.0)) (i64.const 9223372036854774784))
+(assert_trap (invoke "i64.trunc_s/f64" (f64.const 9223372036854775808.0)) "integer overflow")
+(assert_trap (invoke "i64.trunc_s/f64" (f64.const -inf)) "integer overflow")
+(assert_return (invoke "i64.trunc_u/f64" (f64.const 9223372036854775808.0)) (i64.const -9223372036854775808))
+(assert_return (invoke "i64.trunc_u/f64" (f64.const 18446744073709549568.0)) (i64.const -2048))
+(assert_trap (invoke "i64.trunc_u/f64" (f64.const 18446744073709551616.0)) "integer overflow")
+(assert_trap (invoke "i64.trunc_u/f64" (f64.const nan)) "invalid conversion to integer")
+
+(assert_return (invoke "f32.convert_s/i32" (i32.const -1)) (f32.const -1.0))
+(assert_return (invoke "f32.convert_u/i32" (i32.const -1)) (f32.const 4294967296.0))
+(assert_return (invoke "f64.convert_s/i32" (i32.const -7)) (f64.const -7.0))
+(assert_return (invoke "f64.convert_s/i32" (i32.const 2147483647)) (f64.const 2147483647.0))
+(assert_return (invoke "f64.convert_u/i32" (i32.const -2147483648)) (f64.const 2147483648.0))
+(assert_return (invoke "f64.convert_u/i32" (i32.const 40)) (f64.const 40.0))
+(assert_return (invoke "f64.convert_s/i64" (i64.const -1)) (f64.const -1.0))
+(assert_return (invoke "f64.convert_u/i64" (i64.const -1)) (f64.const 18446744073709551616.0))
+
+(assert_return (invoke "i64.extend_s/i32" (i32.const -1)) (i64.const -1))
+(assert_return (invoke "i64.extend_u/i32" (i32.const -1)) (i64.const 0xffffffff))
+(assert_return (invoke "i32.wrap/i64" (i64.const 0x1_0000_0005)) (i32.const 5))
+(assert_return (invoke "f32.demote/f64" (f64.const 0x1p-149)) (f32.const 0x1p-149))
+(assert_return (invoke "f64.promote/f32" (f32.const -0x1.fffffep+127)) (f64.const -0x1.fffffep+127))
+(assert_return (invoke "f64.promote/f32" (f32.const nan)) (f64.const nan:canonical))
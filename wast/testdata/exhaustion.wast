@@ -0,0 +1,17 @@
+;; Unbounded recursion must trap instead of crashing the host.
+
+(module
+  (func $loop (export "runaway") (call $loop))
+  (func $mutual1 (export "mutual") (call $mutual2))
+  (func $mutual2 (call $mutual1))
+  (func (export "bounded") (param i32) (result i32)
+    (if (result i32) (i32.eqz (get_local 0))
+      (then (i32.const 0))
+      (else (i32.add (i32.const 1) (call 3 (i32.sub (get_local 0) (i32.const 1)))))
+    )
+  )
+)
+
+(assert_exhaustion (invoke "runaway") "call stack exhausted")
+(assert_exhaustion (invoke "mutual") "call stack exhausted")
+(assert_return (invoke "bounded" (i32.const 100)) (i32.const 100))
@@ -0,0 +1,19 @@
+;; Derived from the WebAssembly specification test suite as packaged by
+;; go-interpreter/wagon (exec/testdata/spec; BSD-3-Clause). Assertions were
+;; generated from wagon's modules.json.
+
+(module
+  (global (export "memoryBase") i32 (i32.const 0))
+  (global (export "tableBase") i32 (i32.const 0))
+)
+(register "env")
+
+(module binary
+  "\00\61\73\6d\01\00\00\00\01\04\01\60\00\00\02\44\04\03\65\6e\76\06\6d\65"
+  "\6d\6f\72\79\02\01\80\02\80\02\03\65\6e\76\05\74\61\62\6c\65\01\70\01\00"
+  "\00\03\65\6e\76\0a\6d\65\6d\6f\72\79\42\61\73\65\03\7f\00\03\65\6e\76\09"
+  "\74\61\62\6c\65\42\61\73\65\03\7f\00\03\02\01\00\07\08\01\04\6d\61\69\6e"
+  "\00\00\09\01\00\0a\05\01\03\00\00\0b"
+)
+
+(assert_trap (invoke "main") "unreachable")
@@ -0,0 +1,91 @@
+;; Modules the loader must reject, in both the binary and text formats.
+
+(assert_invalid
+  (module (func (result i32) (i64.const 0)))
+  "type mismatch"
+)
+(assert_invalid
+  (module (func (param i32) (result i32) (i32.add (get_local 0))))
+  "type mismatch"
+)
+(assert_invalid
+  (module (func (get_local 0)))
+  "unknown local"
+)
+(assert_invalid
+  (module (func (call 1)))
+  "unknown function"
+)
+(assert_invalid
+  (module (func (br 1)))
+  "unknown label"
+)
+(assert_invalid
+  (module (global i32 (i32.const 0)) (func (set_global 0 (i32.const 1))))
+  "global is immutable"
+)
+(assert_invalid
+  (module (memory 0) (func (drop (i32.load align=8 (i32.const 0)))))
+  "alignment must not be larger than natural"
+)
+(assert_invalid
+  (module (func (drop (i32.load (i32.const 0)))))
+  "unknown memory"
+)
+(assert_invalid
+  (module (memory 2 1))
+  "size minimum must not be greater than maximum"
+)
+(assert_invalid
+  (module (func (export "f")) (start 1))
+  "unknown function"
+)
+
+(assert_malformed
+  (module binary "\00asm" "\02\00\00\00")
+  "unknown binary version"
+)
+(assert_malformed
+  (module binary "\00asm\01\00\00")
+  "unexpected end"
+)
+(assert_malformed
+  (module quote "(func (i32.bogus))")
+  "unknown operator"
+)
+(assert_malformed
+  (module quote "(func (i32.const 0x1_0000_0000) drop)")
+  "constant out of range"
+)
+(assert_malformed
+  (module quote "(func (get_local $missing))")
+  "unknown identifier"
+)
+
+(module $M
+  (global (export "g") i32 (i32.const 42))
+  (global $counter (mut i32) (i32.const 0))
+  (func $bump (set_global $counter (i32.add (get_global $counter) (i32.const 1))))
+  (func (export "count") (result i32) (get_global $counter))
+  (start $bump)
+)
+
+(assert_return (get "g") (i32.const 42))
+(assert_return (invoke "count") (i32.const 1))
+(register "M" $M)
+
+(module
+  (import "M" "g" (global $g i32))
+  (import "spectest" "print_i32" (func $print (param i32)))
+  (func (export "imported") (result i32) (call $print (get_global $g)) (get_global $g))
+)
+
+(assert_return (invoke "imported") (i32.const 42))
+(assert_unlinkable
+  (module (import "M" "missing" (func)))
+  "unknown import"
+)
+(assert_trap
+  (module (func $trap unreachable) (start $trap))
+  "unreachable"
+)